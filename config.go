@@ -21,6 +21,36 @@ type ProxyConfig struct {
 	MaxConn         int64
 	MulOpParallel   int
 	PoolSizePerNode int
+	KeepAlive       int64 // seconds between PINGs on idle redis connections, 0 disabled
+
+	MaxInFlight     int   // commands sent to a redis node and not replied yet, 0 unlimited
+	InFlightTimeout int64 // milliseconds a command waits for MaxInFlight, 0 is the pool timeout
+
+	BreakerThreshold int   // consecutive node failures before fail fast, 0 disabled
+	BreakerCooldown  int64 // seconds before probing a broken node
+
+	WriteChunkSize int // write large requests to redis in chunks of this size, 0 disabled
+	ReadBufferSize int // buffer size of every redis connection for replies
+
+	CoalesceReplies bool // write the replies to a client pipeline batch at once
+	ReplyBufferSize int  // buffer size of every client connection for replies
+
+	MaxInlineLength int   // longest inline command accepted from clients
+	LenientNewlines bool  // accept lines ended by a bare \n from clients, always from redis
+	MaxBulkSize     int   // largest bulk string accepted from clients and redis
+	MaxArrayLen     int64 // most elements of a multi bulk accepted from clients and redis
+
+	KeyPrefix string // prepended to every key sent to redis, stripped from replied keys
+
+	CoalesceReads bool // identical reads in flight share a single redis round-trip
+	CmdLogEvery   int  // log one in CmdLogEvery commands, 0 disables the command log
+	CmdLogRedact  bool // log only the keys of the logged commands
+
+	ReadRetries  int   // retries of reads failed by a connection error, writes are never retried
+	RetryBackoff int64 // milliseconds before the first retry, doubled for every next one
+
+	AllowCommands []string // only these commands are accepted, if set
+	DenyCommands  []string // commands rejected with NOPERM
 
 	Statsd       string // statsd addr
 	StatsdPrefix string
@@ -73,6 +103,33 @@ func NewProxyConfig(filename string) *ProxyConfig {
 
 	pc.Config = c
 
+	pc.BreakerThreshold = c.DefaultInt("proxy::breakerthreshold", 0)
+	pc.BreakerCooldown = c.DefaultInt64("proxy::breakercooldown", 5)
+	pc.WriteChunkSize = c.DefaultInt("proxy::writechunksize", 0)
+	pc.ReadBufferSize = c.DefaultInt("proxy::readbuffersize", 4096)
+	pc.CoalesceReplies = c.DefaultBool("proxy::coalescereplies", false)
+	pc.ReplyBufferSize = c.DefaultInt("proxy::replybuffersize", 4096)
+	pc.MaxInlineLength = c.DefaultInt("proxy::maxinlinelength", 64*1024)
+	pc.LenientNewlines = c.DefaultBool("proxy::lenientnewlines", false)
+	pc.MaxBulkSize = c.DefaultInt("proxy::maxbulksize", 512*1024*1024)
+	pc.MaxArrayLen = c.DefaultInt64("proxy::maxarraylen", 16*1024*1024)
+	pc.KeyPrefix = c.DefaultString("proxy::keyprefix", "")
+	pc.CoalesceReads = c.DefaultBool("proxy::coalescereads", false)
+	pc.CmdLogEvery = c.DefaultInt("proxy::cmdlogevery", 0)
+	pc.CmdLogRedact = c.DefaultBool("proxy::cmdlogredact", true)
+	pc.ReadRetries = c.DefaultInt("proxy::readretries", 0)
+	pc.RetryBackoff = c.DefaultInt64("proxy::retrybackoff", 0)
+	pc.KeepAlive = c.DefaultInt64("proxy::keepalive", 0)
+	pc.MaxInFlight = c.DefaultInt("proxy::maxinflight", 0)
+	pc.InFlightTimeout = c.DefaultInt64("proxy::inflighttimeout", 0)
+
+	if allow := c.DefaultString("proxy::allowcommands", ""); allow != "" {
+		pc.AllowCommands = strings.Split(allow, ",")
+	}
+	if deny := c.DefaultString("proxy::denycommands", ""); deny != "" {
+		pc.DenyCommands = strings.Split(deny, ",")
+	}
+
 	nodes := c.DefaultString("proxy::nodes", "")
 	if nodes == "" {
 		log.Fatal("proxy nodes must not empty ")
@@ -102,6 +159,31 @@ func NewProxyConfig(filename string) *ProxyConfig {
 		pc.IdleTime = 300
 	}
 
+	if pc.MaxInlineLength < 1 {
+		log.Info("Adjust MaxInlineLength to 65536")
+		pc.MaxInlineLength = 64 * 1024
+	}
+
+	if pc.MaxBulkSize < 1 {
+		log.Info("Adjust MaxBulkSize to 536870912")
+		pc.MaxBulkSize = 512 * 1024 * 1024
+	}
+
+	if pc.MaxArrayLen < 1 {
+		log.Info("Adjust MaxArrayLen to 16777216")
+		pc.MaxArrayLen = 16 * 1024 * 1024
+	}
+
+	if len(pc.AllowCommands) > 0 && len(pc.DenyCommands) > 0 {
+		log.Warning("both allowcommands and denycommands set, denycommands ignored")
+		pc.DenyCommands = nil
+	}
+
+	if pc.BreakerCooldown < 1 {
+		log.Info("Adjust BreakerCooldown to 5")
+		pc.BreakerCooldown = 5
+	}
+
 	fcpu := c.DefaultString("debug::cpufile", "")
 	if fcpu != "" {
 		f, err := os.Create(fcpu)
@@ -0,0 +1,55 @@
+package smartproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commandFilter is consulted for every client command before it is
+// forwarded, nil lets everything through.
+var commandFilter *CommandFilter
+
+// CommandFilter decides by name which commands clients are allowed to
+// send. An allowlist filter only lets the listed commands through, a
+// denylist filter blocks the listed ones. Names are case-insensitive.
+type CommandFilter struct {
+	names map[string]struct{}
+	allow bool
+}
+
+func NewAllowFilter(names ...string) *CommandFilter {
+	return newCommandFilter(true, names)
+}
+
+func NewDenyFilter(names ...string) *CommandFilter {
+	return newCommandFilter(false, names)
+}
+
+func newCommandFilter(allow bool, names []string) *CommandFilter {
+	f := &CommandFilter{
+		names: make(map[string]struct{}, len(names)),
+		allow: allow,
+	}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			f.names[strings.ToUpper(name)] = struct{}{}
+		}
+	}
+	return f
+}
+
+func (f *CommandFilter) Allow(name string) bool {
+	if f == nil {
+		return true
+	}
+	_, ok := f.names[strings.ToUpper(name)]
+	return ok == f.allow
+}
+
+// check returns the NOPERM error replied for a blocked command.
+func (f *CommandFilter) check(name string) error {
+	if f.Allow(name) {
+		return nil
+	}
+	return fmt.Errorf("NOPERM command '%s' is not allowed by proxy", strings.ToLower(name))
+}
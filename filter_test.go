@@ -0,0 +1,59 @@
+package smartproxy
+
+import (
+	"testing"
+
+	"github.com/dongzerun/smartproxy/redis"
+)
+
+func TestCommandFilter(t *testing.T) {
+	deny := NewDenyFilter("FLUSHALL", " config ", "Keys")
+	for _, name := range []string{"FLUSHALL", "flushall", "FlushAll", "CONFIG", "config", "KEYS", "keys"} {
+		if deny.Allow(name) {
+			t.Errorf("denylist must block %s", name)
+		}
+	}
+	for _, name := range []string{"GET", "get", "flushdb"} {
+		if !deny.Allow(name) {
+			t.Errorf("denylist must allow %s", name)
+		}
+	}
+
+	allow := NewAllowFilter("get", "SET")
+	for _, name := range []string{"GET", "get", "set", "Set"} {
+		if !allow.Allow(name) {
+			t.Errorf("allowlist must allow %s", name)
+		}
+	}
+	for _, name := range []string{"DEL", "del", ""} {
+		if allow.Allow(name) {
+			t.Errorf("allowlist must block %q", name)
+		}
+	}
+
+	var none *CommandFilter
+	if !none.Allow("FLUSHALL") {
+		t.Error("nil filter must allow everything")
+	}
+}
+
+func TestPreCheckCommandFilter(t *testing.T) {
+	defer func(f *CommandFilter) { commandFilter = f }(commandFilter)
+	commandFilter = NewDenyFilter("GETSET")
+
+	req := redis.NewRequest([]string{"getset", "key", "value"})
+	_, _, handled, err := preCheckCommand(req)
+	if !handled || err == nil {
+		t.Fatalf("blocked command must be handled, got %v", err)
+	}
+	req.SetError(err)
+	want := "-NOPERM command 'getset' is not allowed by proxy\r\n"
+	if got := string(req.Result()); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	req = redis.NewRequest([]string{"GET", "key"})
+	if _, _, handled, err := preCheckCommand(req); handled || err != nil {
+		t.Errorf("GET must be forwarded, got %v", err)
+	}
+}
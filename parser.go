@@ -11,6 +11,15 @@ import (
 var (
 	errReaderTooSmall = errors.New("redis: reader is too small")
 
+	// errProtocol is wrapped by the errors after which the rest of the
+	// request can't be told from the next one, the connection is closed.
+	errProtocol = errors.New("ERR Protocol error")
+
+	errInlineTooLong       = fmt.Errorf("%w: too big inline request", errProtocol)
+	errInvalidMultiBulkLen = fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	errInvalidBulkLen      = fmt.Errorf("%w: invalid bulk length", errProtocol)
+	errUnbalancedQuotes    = errors.New("ERR Protocol error: unbalanced quotes in request")
+
 	// [43 79 75 13 10]
 	OK_BYTES = []byte("+OK\r\n")
 	OK_PONG  = []byte("+PONG\r\n")
@@ -34,7 +43,8 @@ func appendArgs(buf []byte, args []string) []byte {
 
 //------------------------------------------------------------------------------
 
-func readLine(rd *bufio.Reader) ([]byte, error) {
+// readLine reads a line of a request within the limits of c.
+func readLine(rd *bufio.Reader, c *ProxyConfig) ([]byte, error) {
 	// line, isPrefix, err := rd.ReadLine()
 	// if err != nil {
 	// 	return line, err
@@ -49,15 +59,37 @@ func readLine(rd *bufio.Reader) ([]byte, error) {
 	// return line, nil
 
 	line, err := rd.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		line, err = readLongLine(rd, line, c.MaxInlineLength)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if len(line) < 2 || line[len(line)-2] != '\r' { // \r\n
-		return nil, errors.New(fmt.Sprintf("invalid redis packet %v, err:%v", line, err))
+	n := len(line) - 1
+	if n > 0 && line[n-1] == '\r' { // \r\n
+		return line[:n-1], nil
+	}
+	if c.LenientNewlines {
+		return line[:n], nil
 	}
+	return nil, errors.New(fmt.Sprintf("invalid redis packet %v, err:%v", line, err))
+}
 
-	return line[:len(line)-2], nil
+// readLongLine reads the rest of a line longer than the buffer of rd,
+// whose start is line, up to max.
+func readLongLine(rd *bufio.Reader, line []byte, max int) ([]byte, error) {
+	buf := append([]byte(nil), line...)
+	for {
+		if len(buf) > max+2 {
+			return nil, errInlineTooLong
+		}
+		line, err := rd.ReadSlice('\n')
+		buf = append(buf, line...)
+		if err != bufio.ErrBufferFull {
+			return buf, err
+		}
+	}
 }
 
 func readN(rd *bufio.Reader, n int) ([]byte, error) {
@@ -89,33 +121,45 @@ func readN(rd *bufio.Reader, n int) ([]byte, error) {
 
 //------------------------------------------------------------------------------
 
-func parseReq(rd *bufio.Reader) ([]string, error) {
-	line, err := readLine(rd)
+// parseReq reads the next request of a client, inline or multi bulk,
+// within the limits of c.
+func parseReq(rd *bufio.Reader, c *ProxyConfig) ([]string, error) {
+	line, err := readLine(rd, c)
 	if err != nil {
 		return nil, err
 	}
+	// Empty lines are skipped like redis does for telnet clients.
+	for len(line) == 0 {
+		if line, err = readLine(rd, c); err != nil {
+			return nil, err
+		}
+	}
 
 	if line[0] != '*' {
-		return nil, errors.New(fmt.Sprintf("bad command %s ", string(line)))
+		if len(line) > c.MaxInlineLength {
+			return nil, errInlineTooLong
+		}
+		return ParseInlineCommand(line)
 	}
-	numReplies, err := strconv.ParseInt(string(line[1:]), 10, 64)
-	if err != nil {
-		return nil, err
+	numReplies, ok := parseLen(line, c.MaxArrayLen)
+	if !ok {
+		return nil, errInvalidMultiBulkLen
 	}
 
-	args := make([]string, 0, numReplies)
+	// The count is the client's word, don't allocate for it up front.
+	args := make([]string, 0, clampLen(numReplies, 1024))
 	for i := int64(0); i < numReplies; i++ {
-		line, err = readLine(rd)
+		line, err = readLine(rd, c)
 		if err != nil {
 			return nil, err
 		}
-		if line[0] != '$' {
-			return nil, fmt.Errorf("redis: expected '$', but got %q", line)
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got %q", errProtocol, line)
 		}
 
-		argLen, err := strconv.ParseInt(string(line[1:]), 10, 32)
-		if err != nil {
-			return nil, err
+		argLen, ok := parseLen(line, int64(c.MaxBulkSize))
+		if !ok || argLen < 0 {
+			return nil, errInvalidBulkLen
 		}
 
 		arg, err := readN(rd, int(argLen)+2)
@@ -126,3 +170,112 @@ func parseReq(rd *bufio.Reader) ([]string, error) {
 	}
 	return args, nil
 }
+
+// parseLen parses the length of a multi bulk or bulk header line, -1 is
+// accepted for a nil.
+func parseLen(line []byte, max int64) (int64, bool) {
+	n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	return n, err == nil && n >= -1 && n <= max
+}
+
+func clampLen(n, max int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// ParseInlineCommand splits an inline command, as sent by telnet, into
+// its arguments. Arguments are separated by whitespace and may be quoted,
+// double quoted ones support the \n \r \t \b \a \xhh escapes and single
+// quoted ones only \'.
+func ParseInlineCommand(line []byte) ([]string, error) {
+	var args []string
+	for i := 0; ; {
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg []byte
+		switch line[i] {
+		case '"':
+			i++
+			for {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '"' {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(line) {
+					i++
+					c = line[i]
+					switch c {
+					case 'n':
+						c = '\n'
+					case 'r':
+						c = '\r'
+					case 't':
+						c = '\t'
+					case 'b':
+						c = '\b'
+					case 'a':
+						c = '\a'
+					case 'x':
+						if i+2 < len(line) {
+							if v, err := strconv.ParseUint(string(line[i+1:i+3]), 16, 8); err == nil {
+								c = byte(v)
+								i += 2
+							}
+						}
+					}
+				}
+				arg = append(arg, c)
+				i++
+			}
+		case '\'':
+			i++
+			for {
+				if i == len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				c := line[i]
+				if c == '\'' {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					c = '\''
+				}
+				arg = append(arg, c)
+				i++
+			}
+		default:
+			start := i
+			for i < len(line) && !isInlineSpace(line[i]) {
+				i++
+			}
+			args = append(args, string(line[start:i]))
+			continue
+		}
+
+		// A closing quote must be followed by a space.
+		if i < len(line) && !isInlineSpace(line[i]) {
+			return nil, errUnbalancedQuotes
+		}
+		args = append(args, string(arg))
+	}
+}
+
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
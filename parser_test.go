@@ -0,0 +1,131 @@
+package smartproxy
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testConf holds the request limits of the default config.
+var testConf = &ProxyConfig{
+	MaxInlineLength: 64 * 1024,
+	MaxBulkSize:     512 * 1024 * 1024,
+	MaxArrayLen:     16 * 1024 * 1024,
+}
+
+func TestParseInlineCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"PING", []string{"PING"}},
+		{"  set   key\tvalue  ", []string{"set", "key", "value"}},
+		{`SET key "hello world"`, []string{"SET", "key", "hello world"}},
+		{`SET key "a\"b\n\x41"`, []string{"SET", "key", "a\"b\nA"}},
+		{`SET key 'it\'s'`, []string{"SET", "key", "it's"}},
+		{`SET key ""`, []string{"SET", "key", ""}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		got, err := ParseInlineCommand([]byte(test.line))
+		if err != nil {
+			t.Errorf("%q: %s", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, wanted %q", test.line, got, test.want)
+		}
+	}
+
+	for _, line := range []string{`SET key "value`, `SET key 'value`, `SET key "a"b`} {
+		if _, err := ParseInlineCommand([]byte(line)); err != errUnbalancedQuotes {
+			t.Errorf("%q: got %v, wanted %v", line, err, errUnbalancedQuotes)
+		}
+	}
+}
+
+func TestParseReqInline(t *testing.T) {
+	rd := bufio.NewReader(strings.NewReader("\r\nGET key\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"))
+
+	args, err := parseReq(rd, testConf)
+	if err != nil || !reflect.DeepEqual(args, []string{"GET", "key"}) {
+		t.Fatalf("got %q, %v", args, err)
+	}
+	args, err = parseReq(rd, testConf)
+	if err != nil || !reflect.DeepEqual(args, []string{"GET", "k"}) {
+		t.Fatalf("got %q, %v", args, err)
+	}
+}
+
+func TestParseReqNewlines(t *testing.T) {
+	for _, lenient := range []bool{false, true} {
+		c := *testConf
+		c.LenientNewlines = lenient
+		for _, req := range []string{"*1\r\n$4\r\nPING\r\n", "*1\n$4\nPING\r\n", "PING\n"} {
+			args, err := parseReq(bufio.NewReader(strings.NewReader(req)), &c)
+			ok := lenient || strings.Count(req, "\r\n") == strings.Count(req, "\n")
+			if ok && (err != nil || !reflect.DeepEqual(args, []string{"PING"})) {
+				t.Errorf("%q lenient=%v: got %q, %v", req, lenient, args, err)
+			}
+			if !ok && err == nil {
+				t.Errorf("%q lenient=%v: bare \\n must be rejected", req, lenient)
+			}
+		}
+	}
+}
+
+func TestParseReqInvalidLengths(t *testing.T) {
+	tests := []struct {
+		req  string
+		want error
+	}{
+		{"*-5\r\n", errInvalidMultiBulkLen},
+		{"*x\r\n", errInvalidMultiBulkLen},
+		{"*99999999999\r\n", errInvalidMultiBulkLen},
+		{"*1\r\n\r\n", errProtocol},
+		{"*1\r\nGET\r\n", errProtocol},
+		{"*1\r\n$-3\r\n", errInvalidBulkLen},
+		{"*1\r\n$-1\r\n", errInvalidBulkLen},
+		{"*1\r\n$9999999999\r\n", errInvalidBulkLen},
+	}
+	for _, test := range tests {
+		_, err := parseReq(bufio.NewReader(strings.NewReader(test.req)), testConf)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%q: got %v, wanted %v", test.req, err, test.want)
+		}
+	}
+
+	args, err := parseReq(bufio.NewReader(strings.NewReader("*0\r\n")), testConf)
+	if err != nil || len(args) != 0 {
+		t.Errorf("got %q, %v", args, err)
+	}
+}
+
+func TestParseReqLongInline(t *testing.T) {
+	// Longer than the session buffer, but within MaxInlineLength.
+	value := strings.Repeat("a", 5000)
+	rd := bufio.NewReaderSize(strings.NewReader("SET k "+value+" FLUSHALL\r\nPING\r\n"), 4096)
+	args, err := parseReq(rd, testConf)
+	if err != nil || !reflect.DeepEqual(args, []string{"SET", "k", value, "FLUSHALL"}) {
+		t.Fatalf("got %d args, %v", len(args), err)
+	}
+	if args, err = parseReq(rd, testConf); err != nil || !reflect.DeepEqual(args, []string{"PING"}) {
+		t.Fatalf("got %q, %v", args, err)
+	}
+
+	long := "SET k " + strings.Repeat("a", testConf.MaxInlineLength) + "\r\n"
+	rd = bufio.NewReaderSize(strings.NewReader(long), 4096)
+	if _, err := parseReq(rd, testConf); err != errInlineTooLong {
+		t.Errorf("got %v, wanted %v", err, errInlineTooLong)
+	}
+
+	// The limit comes from the config, lines within the buffer too.
+	c := *testConf
+	c.MaxInlineLength = 8
+	rd = bufio.NewReader(strings.NewReader("SET key value\r\n"))
+	if _, err := parseReq(rd, &c); err != errInlineTooLong {
+		t.Errorf("got %v, wanted %v", err, errInlineTooLong)
+	}
+}
@@ -41,33 +41,43 @@ func init() {
 var reqrules = map[string][]interface{}{
 	// proxy special command
 	"PROXY": []interface{}{2, 5},
+	// server, merged over the masters
+	"INFO": []interface{}{1, -1},
 	// key
 	"DEL":       []interface{}{2, 2001},
+	"UNLINK":    []interface{}{2, -1},
+	"TOUCH":     []interface{}{2, -1},
 	"TYPE":      []interface{}{2, 2},
 	"EXISTS":    []interface{}{2, 2},
-	"EXPIRE":    []interface{}{3, 3},
-	"EXPIREAT":  []interface{}{3, 3},
+	"EXPIRE":    []interface{}{3, 4},
+	"EXPIREAT":  []interface{}{3, 4},
 	"TTL":       []interface{}{2, 2},
 	"PTTL":      []interface{}{2, 2},
 	"PERSIST":   []interface{}{2, 2},
-	"PEXPIRE":   []interface{}{3, 3},
-	"PEXPIREAT": []interface{}{3, 3},
+	"PEXPIRE":   []interface{}{3, 4},
+	"PEXPIREAT": []interface{}{3, 4},
 	"RENAME":    []interface{}{3, 3},
 	"RENAMENX":  []interface{}{3, 3},
+	"COPY":      []interface{}{3, 6},
 	"DUMP":      []interface{}{2, 2},
-	"RESTORE":   []interface{}{4, 4},
+	"RESTORE":   []interface{}{4, 10},
 	// bit
 
-	"SETBIT":   []interface{}{4, 4},
-	"BITCOUNT": []interface{}{2, 2},
-	"GETBIT":   []interface{}{3, 3},
+	"SETBIT":      []interface{}{4, 4},
+	"BITCOUNT":    []interface{}{2, 5},
+	"BITFIELD":    []interface{}{2, -1},
+	"BITPOS":      []interface{}{3, 6},
+	"GETBIT":      []interface{}{3, 3},
+	"BITFIELD_RO": []interface{}{2, -1},
 
 	// string
 	"GET":         []interface{}{2, 2},
 	"MGET":        []interface{}{2, 2001},
 	"GETRANGE":    []interface{}{4, 4},
 	"GETSET":      []interface{}{3, 3},
-	"SET":         []interface{}{3, 6},
+	"GETDEL":      []interface{}{2, 2},
+	"GETEX":       []interface{}{2, 4},
+	"SET":         []interface{}{3, 7},
 	"MSET":        []interface{}{3, 4001},
 	"SETEX":       []interface{}{4, 4},
 	"SETNX":       []interface{}{3, 3},
@@ -80,12 +90,20 @@ var reqrules = map[string][]interface{}{
 	"DECRBY":      []interface{}{3, 3},
 	"INCRBYFLOAT": []interface{}{3, 3},
 	"APPEND":      []interface{}{3, 3},
+	"LCS":         []interface{}{3, 8},
 	// hash
 	"HGET":         []interface{}{3, 3},
-	"HSET":         []interface{}{4, 4},
+	"HSET":         []interface{}{4, -1},
 	"HMGET":        []interface{}{3, -1},
 	"HMSET":        []interface{}{4, -1},
 	"HGETALL":      []interface{}{2, 2},
+	"HEXPIRE":      []interface{}{6, -1},
+	"HPEXPIRE":     []interface{}{6, -1},
+	"HEXPIREAT":    []interface{}{6, -1},
+	"HPEXPIREAT":   []interface{}{6, -1},
+	"HTTL":         []interface{}{5, -1},
+	"HPTTL":        []interface{}{5, -1},
+	"HPERSIST":     []interface{}{5, -1},
 	"HLEN":         []interface{}{2, 2},
 	"HDEL":         []interface{}{3, -1},
 	"HEXISTS":      []interface{}{3, 3},
@@ -94,6 +112,11 @@ var reqrules = map[string][]interface{}{
 	"HKEYS":        []interface{}{2, 2},
 	"HSETNX":       []interface{}{4, 4},
 	"HVALS":        []interface{}{2, 2},
+	"HRANDFIELD":   []interface{}{2, 4},
+	// hyperloglog
+	"PFADD":   []interface{}{2, -1},
+	"PFCOUNT": []interface{}{2, -1},
+	"PFMERGE": []interface{}{2, -1},
 	// set
 	"SADD":        []interface{}{3, -1},
 	"SCARD":       []interface{}{2, 2},
@@ -102,7 +125,7 @@ var reqrules = map[string][]interface{}{
 	"SREM":        []interface{}{3, -1},
 	"SPOP":        []interface{}{2, 2},
 	"SRANDMEMBER": []interface{}{2, 3},
-	// "SMOVE":       []interface{}{4, 4},
+	"SMOVE":       []interface{}{4, 4},
 	// list
 	"LPUSH":   []interface{}{3, -1},
 	"RPUSH":   []interface{}{3, -1},
@@ -113,6 +136,7 @@ var reqrules = map[string][]interface{}{
 	"LTRIM":   []interface{}{4, 4},
 	"LRANGE":  []interface{}{4, 4},
 	"LLEN":    []interface{}{2, 2},
+	"LPOS":    []interface{}{3, 9},
 	"LPUSHX":  []interface{}{3, 3},
 	"RPUSHX":  []interface{}{3, 3},
 	"LSET":    []interface{}{4, 4},
@@ -120,6 +144,7 @@ var reqrules = map[string][]interface{}{
 	// zset
 	"ZADD":             []interface{}{4, -1},
 	"ZCARD":            []interface{}{2, 2},
+	"ZRANDMEMBER":      []interface{}{2, 4},
 	"ZCOUNT":           []interface{}{4, 4},
 	"ZRANK":            []interface{}{3, 3},
 	"ZREVRANK":         []interface{}{3, 3},
@@ -132,9 +157,11 @@ var reqrules = map[string][]interface{}{
 	"ZREMRANGEBYSCORE": []interface{}{4, 4},
 	"ZINCRBY":          []interface{}{4, 4},
 	"ZSCORE":           []interface{}{3, 3},
+	"ZMSCORE":          []interface{}{3, -1},
 	"ZRANGEBYLEX":      []interface{}{4, 7},
 	"ZLEXCOUNT":        []interface{}{4, 4},
 	"ZREMRANGEBYLEX":   []interface{}{4, 4},
+	"XINFO":            []interface{}{3, 6},
 	//finite zset
 	"XADD":        []interface{}{4, -1},
 	"XINCRBY":     []interface{}{4, 9},
@@ -150,9 +177,6 @@ var reqrules = map[string][]interface{}{
 
 var specList = map[string]bool{
 	"PROXY":       true,
-	"RENAME":      true,
-	"RENAMENX":    true,
-	"MGET":        true,
 	"MSET":        true,
 	"DEL":         true,
 	"MSETNX":      true,
@@ -161,7 +185,6 @@ var specList = map[string]bool{
 	"SDIFFSTORE":  true,
 	"SINTER":      true,
 	"SINTERSTORE": true,
-	"SMOVE":       true,
 	"ZUNIONSTORE": true,
 	"ZINTERSTORE": true,
 }
@@ -192,8 +215,6 @@ var blackList = map[string]bool{
 	"PUBLISH":      true,
 	"PUNSUBSCRIBE": true,
 	"RANDOMKEY":    true,
-	"RENAME":       true,
-	"RENAMENX":     true,
 	"SAVE":         true,
 	"SCAN":         true,
 	"SSCAN":        true,
@@ -210,7 +231,6 @@ var blackList = map[string]bool{
 	"SDIFFSTORE":   true,
 	"SINTER":       true,
 	"SINTERSTORE":  true,
-	"SMOVE":        true,
 	"SUNION":       true,
 	"SUNIONSTORE":  true,
 	"TIME":         true,
@@ -228,6 +248,10 @@ func verifyCommand(req *redis.Request) error {
 
 	name := req.Name()
 
+	if err := commandFilter.check(name); err != nil {
+		return err
+	}
+
 	if _, ok := blackList[name]; ok {
 		return CommandForbidden
 	}
@@ -275,6 +299,10 @@ func preCheckCommand(req *redis.Request) ([]byte, bool, bool, error) {
 		reply = OK_BYTES
 	case "AUTH":
 		reply = OK_BYTES
+	case "RESET":
+		// sessions keep no db, auth or subscription state, backend
+		// connections are shared and never see the client's RESET
+		reply = []byte("+RESET\r\n")
 	case "ECHO":
 		if len(req.Args()) == 1 {
 			echo := fmt.Sprintf("+%s\r\n", req.Args()[0])
@@ -282,6 +310,14 @@ func preCheckCommand(req *redis.Request) ([]byte, bool, bool, error) {
 		} else {
 			return nil, false, true, WrongArgumentCount
 		}
+	case "COMMAND":
+		// answered from the local command table, so smart clients learn
+		// key positions without a round trip to a random backend
+		if err := commandFilter.check(cmd); err != nil {
+			return nil, false, true, err
+		}
+		buf, err := redis.CommandReply(req.Args())
+		return buf, false, true, err
 	}
 
 	if len(reply) > 0 {
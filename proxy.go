@@ -36,12 +36,54 @@ type ProxyServer struct {
 	QpsChan  chan int64
 	LastQPS  int64
 	OpCount  int64
+	// Per command round-trips and reply sizes, for a metrics endpoint.
+	Stats *redis.CmdStats
 }
 
 func NewProxyServer(c *ProxyConfig) *ProxyServer {
+	stats := redis.NewCmdStats()
 	opt := &redis.ClusterOptions{
 		Addrs:    c.Nodes,
 		PoolSize: c.PoolSizePerNode,
+
+		KeepAliveInterval: time.Duration(c.KeepAlive) * time.Second,
+
+		MaxInFlight:     c.MaxInFlight,
+		InFlightTimeout: time.Duration(c.InFlightTimeout) * time.Millisecond,
+
+		BreakerThreshold: c.BreakerThreshold,
+		BreakerCooldown:  time.Duration(c.BreakerCooldown) * time.Second,
+
+		WriteChunkSize: c.WriteChunkSize,
+		ReadBufferSize: c.ReadBufferSize,
+		MaxBulkSize:    c.MaxBulkSize,
+		MaxArrayLen:    c.MaxArrayLen,
+
+		CoalesceReads: c.CoalesceReads,
+		MulOpParallel: c.MulOpParallel,
+
+		Observer: stats,
+	}
+	if c.ReadRetries > 0 {
+		opt.RetryPolicy = &redis.RetryPolicy{
+			MaxRetries: c.ReadRetries,
+			Backoff:    time.Duration(c.RetryBackoff) * time.Millisecond,
+		}
+	}
+	if c.CmdLogEvery > 0 {
+		opt.CommandLogger = &redis.CommandLogger{
+			Every:        c.CmdLogEvery,
+			RedactValues: c.CmdLogRedact,
+		}
+	}
+	if c.KeyPrefix != "" {
+		opt.KeyRewriter = redis.PrefixRewriter(c.KeyPrefix)
+	}
+
+	if len(c.AllowCommands) > 0 {
+		commandFilter = NewAllowFilter(c.AllowCommands...)
+	} else if len(c.DenyCommands) > 0 {
+		commandFilter = NewDenyFilter(c.DenyCommands...)
 	}
 
 	ps := &ProxyServer{
@@ -53,6 +95,7 @@ func NewProxyServer(c *ProxyConfig) *ProxyServer {
 		Startup:     time.Now(),
 		TimeChan:    make(chan int64, 1024),
 		QpsChan:     make(chan int64, 1024),
+		Stats:       stats,
 	}
 
 	go ps.ExpireClient()
@@ -77,7 +120,7 @@ func (ps *ProxyServer) Dispatch(req *redis.Request) redis.Cmder {
 			return callResult[0].Interface().(redis.Cmder)
 		}
 	} else {
-		return ps.Backend.OnReflectUnvalid(req)
+		return ps.Backend.ProcessBuilt(req)
 	}
 	return ps.Backend.OnUnDenfined(req)
 }
@@ -115,6 +158,10 @@ func (ps *ProxyServer) Close() {
 	}
 	log.Info("Proxy Server Close Listener ")
 	close(ps.Quit)
+	// sessions still open get ErrProxyClosing from now on
+	if err := ps.Backend.Close(); err != nil {
+		log.Warning("Close Backend err ", err)
+	}
 	ps.Wg.Wait()
 	log.Warning("Proxy Server Close ....")
 }
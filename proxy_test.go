@@ -0,0 +1,36 @@
+package smartproxy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dongzerun/smartproxy/redis"
+)
+
+// Commands passing precheck and not handled by the session must have a
+// method for Dispatch, or they are rejected after the check.
+func TestDispatchMethods(t *testing.T) {
+	backend := reflect.ValueOf(&redis.ClusterClient{})
+	for name := range reqrules {
+		if isSpecCommand(name) {
+			continue
+		}
+		if !backend.MethodByName("On" + name).IsValid() {
+			t.Errorf("%s has no Dispatch method", name)
+		}
+	}
+}
+
+func TestStatName(t *testing.T) {
+	for name, want := range map[string]string{
+		"GET":    "GET",
+		"PROXY":  "PROXY",
+		"PING":   "PING",
+		"NOSUCH": "UNKNOWN",
+		"":       "UNKNOWN",
+	} {
+		if got := statName(name); got != want {
+			t.Errorf("%q: got %q, wanted %q", name, got, want)
+		}
+	}
+}
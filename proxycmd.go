@@ -36,6 +36,14 @@ func (s *Session) PROXY(req *redis.Request) {
 			return
 		}
 		s.proxyConf(req)
+	case "slots":
+		// proxy slots, the routing table of the proxy
+		if len(req.Args()) != 1 {
+			err := fmt.Sprintf("-%s\r\n", WrongArgumentCount)
+			s.write2client([]byte(err))
+			return
+		}
+		s.write2client(s.Proxy.Backend.SlotsCmd().Reply())
 	default:
 		log.Warning("Unknow proxy op type: ", req.Args())
 		err := fmt.Sprintf("-%s\r\n", UnknowProxyOpType)
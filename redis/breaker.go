@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrNodeUnavailable is returned without touching the network while the
+// circuit breaker of a node is open.
+var ErrNodeUnavailable = errorf("ERR node unavailable")
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker guards a single backend node. It opens after threshold
+// consecutive transport failures, rejects commands for cooldown and then
+// lets a single probe through (half-open). The probe result closes or
+// reopens the breaker.
+type circuitBreaker struct {
+	mx sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	now func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a command may be sent to the node. A nil
+// breaker, breakers are disabled, allows all commands.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	defer b.mx.Unlock()
+	b.mx.Lock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// done records the result of a command allowed by allow.
+func (b *circuitBreaker) done(err error) {
+	if b == nil {
+		return
+	}
+	defer b.mx.Unlock()
+	b.mx.Lock()
+
+	if err == nil || !isNetworkError(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) current() int {
+	defer b.mx.Unlock()
+	b.mx.Lock()
+	return b.state
+}
@@ -0,0 +1,160 @@
+package redis
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(2, time.Second)
+	b.now = func() time.Time { return now }
+
+	// A single failure keeps the breaker closed.
+	if !b.allow() {
+		t.Fatal("closed breaker must allow")
+	}
+	b.done(io.EOF)
+	if b.current() != breakerClosed {
+		t.Fatalf("got state %d, wanted closed", b.current())
+	}
+
+	// Redis errors are not transport failures.
+	b.allow()
+	b.done(errorf("WRONGTYPE Operation against a key"))
+	b.allow()
+	b.done(io.EOF)
+	if b.current() != breakerClosed {
+		t.Fatalf("got state %d, wanted closed", b.current())
+	}
+
+	b.allow()
+	b.done(io.EOF)
+	if b.current() != breakerOpen {
+		t.Fatalf("got state %d, wanted open", b.current())
+	}
+	if b.allow() {
+		t.Fatal("open breaker must not allow")
+	}
+
+	// After cooldown a single probe goes through.
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("breaker must allow a probe after cooldown")
+	}
+	if b.current() != breakerHalfOpen {
+		t.Fatalf("got state %d, wanted half-open", b.current())
+	}
+	if b.allow() {
+		t.Fatal("half-open breaker must allow only one probe")
+	}
+
+	// Failed probe reopens the breaker.
+	b.done(io.EOF)
+	if b.current() != breakerOpen {
+		t.Fatalf("got state %d, wanted open", b.current())
+	}
+
+	now = now.Add(time.Second)
+	b.allow()
+	b.done(nil)
+	if b.current() != breakerClosed {
+		t.Fatalf("got state %d, wanted closed", b.current())
+	}
+	if !b.allow() {
+		t.Fatal("closed breaker must allow")
+	}
+}
+
+func TestNodeUnavailableReply(t *testing.T) {
+	cmd := NewStringCmd("GET", "key")
+	cmd.setErr(ErrNodeUnavailable)
+	if got := string(cmd.Reply()); got != "-ERR node unavailable\r\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestClusterBreakerPipeline(t *testing.T) {
+	addr := "10.0.0.1:7000"
+	c := newTestClusterClient(&ClusterOptions{Addrs: []string{addr}, BreakerThreshold: 1})
+	c.setSlots([]ClusterSlotInfo{{0, 16383, []string{addr}}})
+	p := newRedialPool()
+	c.clients[addr] = newClient(&Options{Addr: addr}, p)
+	c.breakers[addr] = newCircuitBreaker(1, time.Minute)
+
+	get := NewStringCmd("GET", "a")
+	go func() {
+		// The node breaks the connection before replying.
+		server := <-p.servers
+		io.ReadFull(server, make([]byte, len(AppendCommand(nil, get.args()))))
+		server.Close()
+	}()
+	pipe := c.Pipeline()
+	pipe.Process(get)
+	pipe.Exec()
+	if b := c.getBreaker(addr); b.current() != breakerOpen {
+		t.Fatalf("got state %d, wanted open", b.current())
+	}
+	// The retry on a random node doesn't probe the open node.
+	if get.Err() != ErrNodeUnavailable {
+		t.Errorf("got %v, wanted %v", get.Err(), ErrNodeUnavailable)
+	}
+
+	sent := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 512)
+		n, _ := (<-p.servers).Read(buf)
+		sent <- buf[:n]
+	}()
+	get = NewStringCmd("GET", "a")
+	pipe.Process(get)
+	if _, err := pipe.Exec(); err != ErrNodeUnavailable {
+		t.Errorf("got %v, wanted %v", err, ErrNodeUnavailable)
+	}
+	if get.Err() != ErrNodeUnavailable {
+		t.Errorf("got %v, wanted %v", get.Err(), ErrNodeUnavailable)
+	}
+	select {
+	case b := <-sent:
+		t.Errorf("open node got %q", b)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestClusterBreakerAsk(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{BreakerThreshold: 1})
+	c.commandable.process = c.process
+	c.setSlots([]ClusterSlotInfo{{0, 16383, []string{"10.0.0.1:7000"}}})
+	client, server, _ := newPipeClient(&Options{Addr: "10.0.0.1:7000"})
+	c.clients["10.0.0.1:7000"] = client
+	// The node importing the slot is down.
+	target, targetServer, _ := newPipeClient(&Options{Addr: "10.0.0.2:7000"})
+	c.clients["10.0.0.2:7000"] = target
+	b := newCircuitBreaker(1, time.Minute)
+	b.allow()
+	b.done(io.EOF)
+	c.breakers["10.0.0.2:7000"] = b
+
+	get := NewStringCmd("GET", "a")
+	go func() {
+		io.ReadFull(server, make([]byte, len(AppendCommand(nil, get.args()))))
+		io.WriteString(server, "-ASK 15495 10.0.0.2:7000\r\n")
+	}()
+	sent := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 512)
+		n, _ := targetServer.Read(buf)
+		sent <- buf[:n]
+	}()
+
+	c.Process(get)
+	if get.Err() != ErrNodeUnavailable {
+		t.Errorf("got %v, wanted %v", get.Err(), ErrNodeUnavailable)
+	}
+	select {
+	case b := <-sent:
+		t.Errorf("open node got %q", b)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,239 @@
+package redis
+
+import (
+	"strings"
+	"time"
+)
+
+var errEmptyCommand = errorf("ERR empty command")
+
+// cmdSpec describes how to build the Cmder of a command.
+type cmdSpec struct {
+	build func(args ...string) Cmder
+	// keyPos is the index of the key used for slot routing, 0 for
+	// keyless commands.
+	keyPos int
+}
+
+func newStringCmd(args ...string) Cmder              { return NewStringCmd(args...) }
+func newStatusCmd(args ...string) Cmder              { return NewStatusCmd(args...) }
+func newUint64Cmd(args ...string) Cmder              { return NewUint64Cmd(args...) }
+func newIntCmd(args ...string) Cmder                 { return NewIntCmd(args...) }
+func newBoolCmd(args ...string) Cmder                { return NewBoolCmd(args...) }
+func newFloatCmd(args ...string) Cmder               { return NewFloatCmd(args...) }
+func newSliceCmd(args ...string) Cmder               { return NewSliceCmd(args...) }
+func newStringSliceCmd(args ...string) Cmder         { return NewStringSliceCmd(args...) }
+func newNullableStringSliceCmd(args ...string) Cmder { return NewNullableStringSliceCmd(args...) }
+func newIntSliceCmd(args ...string) Cmder            { return NewIntSliceCmd(args...) }
+func newLposCmd(args ...string) Cmder                { return NewLposCmd(args...) }
+func newLcsCmd(args ...string) Cmder                 { return NewLcsCmd(args...) }
+func newSetCmd(args ...string) Cmder                 { return newRawSetCmd(args...) }
+func newZAddCmd(args ...string) Cmder                { return newRawZAddCmd(args...) }
+func newFloatSliceCmd(args ...string) Cmder          { return NewFloatSliceCmd(args...) }
+func newStringStringMapCmd(args ...string) Cmder     { return NewOrderedStringStringMapCmd(args...) }
+func newInfoCmd(args ...string) Cmder                { return NewInfoCmd(args...) }
+func newSecondsCmd(args ...string) Cmder             { return NewDurationCmd(time.Second, args...) }
+func newMillisecondsCmd(args ...string) Cmder        { return NewDurationCmd(time.Millisecond, args...) }
+
+// newRandCmd builds HRANDFIELD, SRANDMEMBER and ZRANDMEMBER, which
+// reply with an element without count, with elements given one, maybe
+// repeated if it is negative, and with pairs given WITHVALUES or
+// WITHSCORES.
+func newRandCmd(args ...string) Cmder {
+	if len(args) < 3 {
+		return NewStringCmd(args...)
+	}
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(arg) {
+		case "WITHVALUES", "WITHSCORES":
+			return NewKeyValueSliceCmd(args...)
+		}
+	}
+	return NewStringSliceCmd(args...)
+}
+
+// newXInfoCmd builds XINFO, STREAM and GROUPS get their structured
+// replies and the other subcommands a generic slice.
+func newXInfoCmd(args ...string) Cmder {
+	if len(args) > 1 {
+		switch strings.ToUpper(args[1]) {
+		case "STREAM":
+			return &XInfoStreamCmd{baseCmd: baseCmd{_args: args}}
+		case "GROUPS":
+			return &XInfoGroupsCmd{baseCmd: baseCmd{_args: args}}
+		}
+	}
+	return NewSliceCmd(args...)
+}
+
+// finityBuilder builds the finity zset commands which reply with the
+// elements when ELEMENTS is given.
+func finityBuilder(build func(args ...string) Cmder) func(args ...string) Cmder {
+	return func(args ...string) Cmder {
+		for _, arg := range args {
+			if strings.ToUpper(arg) == "ELEMENTS" {
+				return NewSliceCmd(args...)
+			}
+		}
+		return build(args...)
+	}
+}
+
+var cmdSpecs = map[string]cmdSpec{
+	// connection and server
+	"PING":   {newStatusCmd, 0},
+	"ECHO":   {newStringCmd, 0},
+	"INFO":   {newInfoCmd, 0},
+	"TIME":   {newStringSliceCmd, 0},
+	"DBSIZE": {newIntCmd, 0},
+	// key
+	"DEL":       {newIntCmd, 1},
+	"UNLINK":    {newIntCmd, 1},
+	"TOUCH":     {newIntCmd, 1},
+	"TYPE":      {newStatusCmd, 1},
+	"EXISTS":    {newBoolCmd, 1},
+	"EXPIRE":    {newBoolCmd, 1},
+	"EXPIREAT":  {newBoolCmd, 1},
+	"TTL":       {newSecondsCmd, 1},
+	"PTTL":      {newMillisecondsCmd, 1},
+	"PERSIST":   {newBoolCmd, 1},
+	"PEXPIRE":   {newBoolCmd, 1},
+	"PEXPIREAT": {newBoolCmd, 1},
+	"RENAME":    {newStatusCmd, 1},
+	"RENAMENX":  {newBoolCmd, 1},
+	"COPY":      {newBoolCmd, 1},
+	"DUMP":      {newStringCmd, 1},
+	"RESTORE":   {newStatusCmd, 1},
+	// bit
+	"SETBIT":      {newIntCmd, 1},
+	"BITCOUNT":    {newUint64Cmd, 1},
+	"BITFIELD":    {newIntSliceCmd, 1},
+	"BITPOS":      {newIntCmd, 1},
+	"GETBIT":      {newIntCmd, 1},
+	"BITFIELD_RO": {newIntSliceCmd, 1},
+	// string
+	"GET":         {newStringCmd, 1},
+	"MGET":        {newNullableStringSliceCmd, 1},
+	"GETRANGE":    {newStringCmd, 1},
+	"GETSET":      {newStringCmd, 1},
+	"GETDEL":      {newStringCmd, 1},
+	"GETEX":       {newStringCmd, 1},
+	"SET":         {newSetCmd, 1},
+	"MSET":        {newStatusCmd, 1},
+	"SETEX":       {newStatusCmd, 1},
+	"SETNX":       {newBoolCmd, 1},
+	"PSETEX":      {newStatusCmd, 1},
+	"SETRANGE":    {newIntCmd, 1},
+	"STRLEN":      {newIntCmd, 1},
+	"INCR":        {newIntCmd, 1},
+	"DECR":        {newIntCmd, 1},
+	"INCRBY":      {newIntCmd, 1},
+	"DECRBY":      {newIntCmd, 1},
+	"INCRBYFLOAT": {newFloatCmd, 1},
+	"APPEND":      {newIntCmd, 1},
+	"LCS":         {newLcsCmd, 1},
+	// hash
+	"HGET":         {newStringCmd, 1},
+	"HSET":         {newIntCmd, 1},
+	"HMGET":        {newSliceCmd, 1},
+	"HMSET":        {newStatusCmd, 1},
+	"HGETALL":      {newStringStringMapCmd, 1},
+	"HEXPIRE":      {newIntSliceCmd, 1},
+	"HPEXPIRE":     {newIntSliceCmd, 1},
+	"HEXPIREAT":    {newIntSliceCmd, 1},
+	"HPEXPIREAT":   {newIntSliceCmd, 1},
+	"HTTL":         {newIntSliceCmd, 1},
+	"HPTTL":        {newIntSliceCmd, 1},
+	"HPERSIST":     {newIntSliceCmd, 1},
+	"HLEN":         {newIntCmd, 1},
+	"HDEL":         {newIntCmd, 1},
+	"HEXISTS":      {newBoolCmd, 1},
+	"HINCRBY":      {newIntCmd, 1},
+	"HINCRBYFLOAT": {newFloatCmd, 1},
+	"HKEYS":        {newStringSliceCmd, 1},
+	"HSETNX":       {newBoolCmd, 1},
+	"HVALS":        {newStringSliceCmd, 1},
+	"HRANDFIELD":   {newRandCmd, 1},
+	// hyperloglog
+	"PFADD":   {newBoolCmd, 1},
+	"PFCOUNT": {newIntCmd, 1},
+	"PFMERGE": {newStatusCmd, 1},
+	// set
+	"SADD":        {newIntCmd, 1},
+	"SCARD":       {newIntCmd, 1},
+	"SISMEMBER":   {newBoolCmd, 1},
+	"SMEMBERS":    {newStringSliceCmd, 1},
+	"SREM":        {newIntCmd, 1},
+	"SPOP":        {newStringCmd, 1},
+	"SRANDMEMBER": {newRandCmd, 1},
+	"SMOVE":       {newBoolCmd, 1},
+	// list
+	"LPUSH":     {newIntCmd, 1},
+	"RPUSH":     {newIntCmd, 1},
+	"LPOP":      {newStringCmd, 1},
+	"RPOP":      {newStringCmd, 1},
+	"LINDEX":    {newStringCmd, 1},
+	"LINSERT":   {newIntCmd, 1},
+	"LTRIM":     {newStatusCmd, 1},
+	"LRANGE":    {newStringSliceCmd, 1},
+	"LLEN":      {newIntCmd, 1},
+	"LPOS":      {newLposCmd, 1},
+	"LPUSHX":    {newIntCmd, 1},
+	"RPUSHX":    {newIntCmd, 1},
+	"LSET":      {newStatusCmd, 1},
+	"LREM":      {newIntCmd, 1},
+	"RPOPLPUSH": {newStringCmd, 1},
+	// zset
+	"ZADD":             {newZAddCmd, 1},
+	"ZCARD":            {newIntCmd, 1},
+	"ZRANDMEMBER":      {newRandCmd, 1},
+	"ZCOUNT":           {newIntCmd, 1},
+	"ZRANK":            {newIntCmd, 1},
+	"ZREVRANK":         {newIntCmd, 1},
+	"ZRANGE":           {newStringSliceCmd, 1},
+	"ZREVRANGE":        {newStringSliceCmd, 1},
+	"ZRANGEBYSCORE":    {newStringSliceCmd, 1},
+	"ZREVRANGEBYSCORE": {newStringSliceCmd, 1},
+	"ZREM":             {newIntCmd, 1},
+	"ZREMRANGEBYRANK":  {newIntCmd, 1},
+	"ZREMRANGEBYSCORE": {newIntCmd, 1},
+	"ZINCRBY":          {newFloatCmd, 1},
+	"ZSCORE":           {newFloatCmd, 1},
+	"ZMSCORE":          {newFloatSliceCmd, 1},
+	"ZRANGEBYLEX":      {newStringSliceCmd, 1},
+	"ZLEXCOUNT":        {newIntCmd, 1},
+	"ZREMRANGEBYLEX":   {newIntCmd, 1},
+	// stream
+	"XINFO": {newXInfoCmd, 2},
+	// finite zset
+	"XADD":        {finityBuilder(newIntCmd), 1},
+	"XINCRBY":     {finityBuilder(newFloatCmd), 1},
+	"XSETOPTIONS": {finityBuilder(newIntCmd), 1},
+	"XRANGE":      {newStringSliceCmd, 1},
+	"XREVRANGE":   {newStringSliceCmd, 1},
+	"XSCORE":      {newFloatCmd, 1},
+	"XREM":        {newIntCmd, 1},
+	"XCARD":       {newIntCmd, 1},
+	"XGETFINITY":  {newIntCmd, 1},
+	"XGETPRUNING": {newStringCmd, 1},
+}
+
+// BuildCmd returns the Cmder for args with the reply type and key
+// position of the command. Unknown commands get a generic Cmd routed by
+// their first argument. The proxy dispatches the commands without an On
+// method through it, see ProcessBuilt.
+func BuildCmd(args []string) (Cmder, error) {
+	if len(args) == 0 {
+		return nil, errEmptyCommand
+	}
+
+	spec, ok := cmdSpecs[strings.ToUpper(args[0])]
+	if !ok {
+		cmd := NewCmd(args...)
+		cmd._clusterKeyPos = 1
+		return cmd, nil
+	}
+	cmd := spec.build(args...)
+	cmd.setClusterKeyPos(spec.keyPos)
+	return cmd, nil
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBuildCmd(t *testing.T) {
+	tests := []struct {
+		args []string
+		want Cmder
+		key  string
+	}{
+		{[]string{"GET", "k"}, &StringCmd{}, "k"},
+		{[]string{"get", "k"}, &StringCmd{}, "k"},
+		{[]string{"HGETALL", "h"}, &StringStringMapCmd{}, "h"},
+		{[]string{"INCR", "k"}, &IntCmd{}, "k"},
+		{[]string{"BITCOUNT", "k"}, &Uint64Cmd{}, "k"},
+		{[]string{"EXISTS", "k"}, &BoolCmd{}, "k"},
+		{[]string{"ZSCORE", "z", "m"}, &FloatCmd{}, "z"},
+		{[]string{"LRANGE", "l", "0", "-1"}, &StringSliceCmd{}, "l"},
+		{[]string{"MGET", "a", "b"}, &NullableStringSliceCmd{}, "a"},
+		{[]string{"HMGET", "h", "a", "b"}, &SliceCmd{}, "h"},
+		{[]string{"SET", "k", "v"}, &SetCmd{}, "k"},
+		{[]string{"XADD", "x", "1", "m"}, &IntCmd{}, "x"},
+		{[]string{"XADD", "x", "ELEMENTS", "1", "m"}, &SliceCmd{}, "x"},
+		{[]string{"SRANDMEMBER", "s"}, &StringCmd{}, "s"},
+		{[]string{"SRANDMEMBER", "s", "-5"}, &StringSliceCmd{}, "s"},
+		{[]string{"HRANDFIELD", "h", "2", "withvalues"}, &KeyValueSliceCmd{}, "h"},
+		{[]string{"ZRANDMEMBER", "z", "2", "WITHSCORES"}, &KeyValueSliceCmd{}, "z"},
+		{[]string{"PING"}, &StatusCmd{}, ""},
+		{[]string{"ECHO", "hello"}, &StringCmd{}, ""},
+		{[]string{"NOSUCHCMD", "k"}, &Cmd{}, "k"},
+	}
+	for _, test := range tests {
+		cmd, err := BuildCmd(test.args)
+		if err != nil {
+			t.Errorf("%q: %s", test.args, err)
+			continue
+		}
+		if got, want := fmt.Sprintf("%T", cmd), fmt.Sprintf("%T", test.want); got != want {
+			t.Errorf("%q: got %s, wanted %s", test.args, got, want)
+		}
+		if cmd.clusterKey() != test.key {
+			t.Errorf("%q: got key %q, wanted %q", test.args, cmd.clusterKey(), test.key)
+		}
+	}
+
+	if _, err := BuildCmd(nil); err != errEmptyCommand {
+		t.Errorf("got %v, wanted %v", err, errEmptyCommand)
+	}
+
+	cmd, _ := BuildCmd([]string{"PTTL", "k"})
+	if d := cmd.(*DurationCmd).precision; d != time.Millisecond {
+		t.Errorf("PTTL: got precision %s", d)
+	}
+}
+
+func TestProcessBuilt(t *testing.T) {
+	var processed Cmder
+	c := &commandable{process: func(cmd Cmder) { processed = cmd }}
+
+	cmd := c.ProcessBuilt(NewRequest([]string{"HGETALL", "h"}))
+	if _, ok := cmd.(*StringStringMapCmd); !ok || processed != cmd {
+		t.Errorf("got %T, processed %v", cmd, processed)
+	}
+
+	processed = nil
+	if cmd := c.ProcessBuilt(NewRequest(nil)); cmd.Err() != errEmptyCommand || processed != nil {
+		t.Errorf("got %v, processed %v", cmd.Err(), processed)
+	}
+}
@@ -19,25 +19,40 @@ type ClusterClient struct {
 	slotsMx sync.RWMutex // Protects slots and addrs.
 
 	clients   map[string]*Client
+	breakers  map[string]*circuitBreaker
 	closed    bool
-	clientsMx sync.RWMutex // Protects clients and closed.
+	clientsMx sync.RWMutex // Protects clients, breakers and closed.
 
-	opt *ClusterOptions
+	opt      *ClusterOptions
+	resolver SlotResolver
+	// Coalesces identical reads, nil unless opt.CoalesceReads.
+	flights *flightGroup
 
-	// Reports where slots reloading is in progress.
+	// Reports where slots reloading is scheduled or in progress.
 	reloading uint32
+	// Reloads the slots and clears reloading, reloadSlots but in tests.
+	reload func()
 }
 
 // NewClusterClient returns a new Redis Cluster client as described in
 // http://redis.io/topics/cluster-spec.
 func NewClusterClient(opt *ClusterOptions) *ClusterClient {
 	client := &ClusterClient{
-		addrs:   opt.Addrs,
-		slots:   make([][]string, hashSlots),
-		clients: make(map[string]*Client),
-		opt:     opt,
+		addrs:    opt.Addrs,
+		slots:    make([][]string, hashSlots),
+		clients:  make(map[string]*Client),
+		breakers: make(map[string]*circuitBreaker),
+		opt:      opt,
 	}
 	client.commandable.process = client.process
+	client.reload = client.reloadSlots
+	if opt.CoalesceReads {
+		client.flights = newFlightGroup()
+	}
+	client.resolver = opt.SlotResolver
+	if client.resolver == nil {
+		client.resolver = &clusterSlotsResolver{client}
+	}
 	client.reloadSlots()
 	go client.reaper()
 	return client
@@ -81,7 +96,7 @@ func (c *ClusterClient) getClient(addr string) (*Client, error) {
 	c.clientsMx.Lock()
 	if c.closed {
 		c.clientsMx.Unlock()
-		return nil, errClosed
+		return nil, ErrProxyClosing
 	}
 
 	client, ok = c.clients[addr]
@@ -90,12 +105,43 @@ func (c *ClusterClient) getClient(addr string) (*Client, error) {
 		opt.Addr = addr
 		client = NewClient(opt)
 		c.clients[addr] = client
+		if c.opt.BreakerThreshold > 0 {
+			c.breakers[addr] = newCircuitBreaker(c.opt.BreakerThreshold, c.opt.getBreakerCooldown())
+		}
 	}
 	c.clientsMx.Unlock()
 
 	return client, nil
 }
 
+// getBreaker returns the circuit breaker of addr or nil if breakers
+// are disabled.
+func (c *ClusterClient) getBreaker(addr string) *circuitBreaker {
+	c.clientsMx.RLock()
+	b := c.breakers[addr]
+	c.clientsMx.RUnlock()
+	return b
+}
+
+// processNode sends cmd to client unless the node's breaker is open.
+// With ask cmd is preceded by ASKING.
+func (c *ClusterClient) processNode(client *Client, cmd Cmder, ask bool) {
+	b := c.getBreaker(client.opt.Addr)
+	if !b.allow() {
+		cmd.setErr(ErrNodeUnavailable)
+		return
+	}
+	if ask {
+		pipe := client.Pipeline()
+		pipe.Process(NewCmd("ASKING"))
+		pipe.Process(cmd)
+		_, _ = pipe.Exec()
+	} else {
+		client.Process(cmd)
+	}
+	b.done(cmd.Err())
+}
+
 func (c *ClusterClient) slotAddrs(slot int) []string {
 	c.slotsMx.RLock()
 	addrs := c.slots[slot]
@@ -104,11 +150,12 @@ func (c *ClusterClient) slotAddrs(slot int) []string {
 }
 
 func (c *ClusterClient) slotMasterAddr(slot int) string {
-	addrs := c.slotAddrs(slot)
-	if len(addrs) > 0 {
-		return addrs[0]
+	addr, _, err := c.resolver.Resolve(slot)
+	if err != nil {
+		log.Warningf("redis: resolve slot %d failed: %s", slot, err)
+		return ""
 	}
-	return ""
+	return addr
 }
 
 // randomClient returns a Client for the first live node.
@@ -119,7 +166,11 @@ func (c *ClusterClient) randomClient() (client *Client, err error) {
 		if err != nil {
 			continue
 		}
-		err = client.ClusterInfo().Err()
+		// Nodes behind an open breaker are not probed.
+		info := NewStringCmd("CLUSTER", "info")
+		info._clusterKeyPos = 0
+		c.processNode(client, info, false)
+		err = info.Err()
 		if err == nil {
 			return client, nil
 		}
@@ -127,9 +178,55 @@ func (c *ClusterClient) randomClient() (client *Client, err error) {
 	return nil, err
 }
 
+// isClosed reports whether c was closed.
+func (c *ClusterClient) isClosed() bool {
+	c.clientsMx.RLock()
+	defer c.clientsMx.RUnlock()
+	return c.closed
+}
+
 func (c *ClusterClient) process(cmd Cmder) {
+	if c.isClosed() {
+		cmd.setErr(ErrProxyClosing)
+		return
+	}
+
+	if c.flights != nil && cmd.IsReadOnly() {
+		c.flights.do(cmd, c.processCmd)
+		return
+	}
+	c.processCmd(cmd)
+}
+
+func (c *ClusterClient) processCmd(cmd Cmder) {
 	var ask bool
 
+	// Deferred first, so it sees the keys of the client.
+	if t := c.opt.ReplyTransformer; t != nil {
+		defer transformReply(cmd, t)
+	}
+	// Keys are rewritten before routing, they hash to another slot.
+	if rw := c.opt.KeyRewriter; rw != nil {
+		rewriteKeys(cmd, rw)
+		defer unrewriteKeys(cmd, rw)
+	}
+
+	// Pinned commands, e.g. admin ones for a replica, bypass routing.
+	if addr := cmd.Addr(); addr != "" {
+		client, err := c.getClient(addr)
+		if err != nil {
+			cmd.setErr(err)
+			return
+		}
+		c.processNode(client, cmd, false)
+		return
+	}
+
+	if !sameSlot(cmd.clusterKeys()) {
+		cmd.setErr(ErrCrossSlot)
+		return
+	}
+
 	slot := hashSlot(cmd.clusterKey())
 
 	addr := c.slotMasterAddr(slot)
@@ -139,31 +236,39 @@ func (c *ClusterClient) process(cmd Cmder) {
 		return
 	}
 
+	var retries int
 	for attempt := 0; attempt <= c.opt.getMaxRedirects(); attempt++ {
 		if attempt > 0 {
-			cmd.reset()
+			resetCmds(cmd)
 		}
 
-		if ask {
-			pipe := client.Pipeline()
-			pipe.Process(NewCmd("ASKING"))
-			pipe.Process(cmd)
-			_, _ = pipe.Exec()
-			ask = false
-		} else {
-			client.Process(cmd)
-		}
+		c.processNode(client, cmd, ask)
+		ask = false
 
 		// If there is no (real) error, we are done!
 		err := cmd.Err()
-		if err == nil || err == Nil || err == TxFailedErr {
+		if err == nil || err == Nil || err == TxFailedErr || err == ErrNodeUnavailable {
+			return
+		}
+		// Close broke the connection under the command, Redis errors
+		// are replies and stand.
+		if _, ok := err.(redisError); !ok && c.isClosed() {
+			cmd.setErr(ErrProxyClosing)
 			return
 		}
 
-		// On network errors try random node.
-		if isNetworkError(err) {
+		// On network errors try random node, the reads only: a write
+		// may have been applied before its connection failed.
+		if shouldRetry(err) {
+			if retries >= c.opt.getRetries(cmd) {
+				return
+			}
+			retries++
 			client, err = c.randomClient()
 			if err != nil {
+				if err == ErrProxyClosing {
+					cmd.setErr(err)
+				}
 				return
 			}
 			continue
@@ -171,13 +276,13 @@ func (c *ClusterClient) process(cmd Cmder) {
 
 		var moved bool
 		var addr string
-		moved, ask, addr = isMovedError(err)
+		moved, ask, addr = c.redirect(err, slot)
 		if moved || ask {
-			if moved && c.slotMasterAddr(slot) != addr {
-				c.lazyReloadSlots()
-			}
 			client, err = c.getClient(addr)
 			if err != nil {
+				if err == ErrProxyClosing {
+					cmd.setErr(err)
+				}
 				return
 			}
 			continue
@@ -194,6 +299,7 @@ func (c *ClusterClient) resetClients() (err error) {
 			err = e
 		}
 		delete(c.clients, addr)
+		delete(c.breakers, addr)
 	}
 	return err
 }
@@ -225,6 +331,243 @@ func (c *ClusterClient) setSlots(slots []ClusterSlotInfo) {
 	c.slotsMx.Unlock()
 }
 
+// Slots returns the routing table of c as CLUSTER SLOTS does, the
+// consecutive slots served by the same nodes as one range. It is what c
+// learned from the cluster, no node is queried.
+func (c *ClusterClient) Slots() []ClusterSlotInfo {
+	c.slotsMx.RLock()
+	defer c.slotsMx.RUnlock()
+
+	var infos []ClusterSlotInfo
+	for slot, addrs := range c.slots {
+		if len(addrs) == 0 {
+			continue
+		}
+		if n := len(infos); n > 0 && infos[n-1].End == slot-1 && equalAddrs(infos[n-1].Addrs, addrs) {
+			infos[n-1].End = slot
+			continue
+		}
+		infos = append(infos, ClusterSlotInfo{slot, slot, append([]string(nil), addrs...)})
+	}
+	return infos
+}
+
+// SlotsCmd returns a CLUSTER SLOTS answered with Slots, e.g. for a proxy
+// to show clients how it routes slots.
+func (c *ClusterClient) SlotsCmd() *ClusterSlotCmd {
+	cmd := NewClusterSlotCmd("CLUSTER", "SLOTS")
+	cmd.val = c.Slots()
+	return cmd
+}
+
+// SlotKeys are the keys of a slot, split by SplitBySlot.
+type SlotKeys struct {
+	Slot int
+	Keys []string
+	// Positions of Keys in the keys split.
+	Pos []int
+}
+
+// SplitBySlot groups keys by slot, in the order the slots first appear,
+// so a command over keys in several slots can be sent as a command per
+// slot and the replies put back in the order of keys.
+func SplitBySlot(keys []string) []SlotKeys {
+	return splitBySlot(keys, hashSlot)
+}
+
+func splitBySlot(keys []string, slotOf func(key string) int) []SlotKeys {
+	var groups []SlotKeys
+	index := make(map[int]int)
+	for pos, key := range keys {
+		slot := slotOf(key)
+		i, ok := index[slot]
+		if !ok {
+			i = len(groups)
+			index[slot] = i
+			groups = append(groups, SlotKeys{Slot: slot})
+		}
+		groups[i].Keys = append(groups[i].Keys, key)
+		groups[i].Pos = append(groups[i].Pos, pos)
+	}
+	return groups
+}
+
+// splitBySlot is SplitBySlot by the slots the keys are routed to, i.e.
+// of the keys rewritten by Options.KeyRewriter. The groups hold the keys
+// of the client, processCmd rewrites them.
+func (c *ClusterClient) splitBySlot(keys []string) []SlotKeys {
+	rw := c.opt.KeyRewriter
+	if rw == nil {
+		return SplitBySlot(keys)
+	}
+	return splitBySlot(keys, func(key string) int {
+		return hashSlot(rw.Rewrite(key))
+	})
+}
+
+// scatter processes a command per slot of keys built by newCmd, see
+// processAll.
+func (c *ClusterClient) scatter(groups []SlotKeys, newCmd func(keys []string) Cmder) []Cmder {
+	cmds := make([]Cmder, len(groups))
+	for i, group := range groups {
+		cmds[i] = newCmd(group.Keys)
+	}
+	c.processAll(cmds)
+	return cmds
+}
+
+// processAll processes cmds, up to ClusterOptions.MulOpParallel at once.
+func (c *ClusterClient) processAll(cmds []Cmder) {
+	sem := make(chan struct{}, c.opt.getMulOpParallel())
+	var wg sync.WaitGroup
+	for _, cmd := range cmds {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(cmd Cmder) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			c.process(cmd)
+		}(cmd)
+	}
+	wg.Wait()
+}
+
+// sumBySlot sends name with keys as one command per slot, at once, and
+// replies the sum of their counts, like a single server would for keys
+// in several slots. The first failed command fails the sum.
+func (c *ClusterClient) sumBySlot(name string, keys []string) *IntCmd {
+	cmds := c.scatter(c.splitBySlot(keys), func(keys []string) Cmder {
+		return newMultiKeyIntCmd(name, keys)
+	})
+
+	sum := newMultiKeyIntCmd(name, keys)
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			sum.setErr(err)
+			return sum
+		}
+		sum.val += cmd.(*IntCmd).Val()
+	}
+	return sum
+}
+
+// MGet is MGET over keys in any slots, sent as an MGET per slot. The
+// values are gathered back in the order of keys, nil for the missing
+// ones. The first failed MGET fails the whole.
+func (c *ClusterClient) MGet(keys ...string) *NullableStringSliceCmd {
+	groups := c.splitBySlot(keys)
+	cmds := c.scatter(groups, func(keys []string) Cmder {
+		return NewMGetCmd(keys...)
+	})
+
+	mget := NewMGetCmd(keys...)
+	val := make([]*string, len(keys))
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			mget.setErr(err)
+			return mget
+		}
+		vals := cmd.(*NullableStringSliceCmd).Val()
+		if len(vals) != len(groups[i].Pos) {
+			mget.setErr(unexpectedReplyType(cmd, vals))
+			return mget
+		}
+		for j, pos := range groups[i].Pos {
+			val[pos] = vals[j]
+		}
+	}
+	mget.val = val
+	return mget
+}
+
+func (c *ClusterClient) OnMGET(req *Request) *NullableStringSliceCmd {
+	return c.MGet(req.cmd[1:]...)
+}
+
+// Unlink is UNLINK split by slot, see sumBySlot.
+func (c *ClusterClient) Unlink(keys ...string) *IntCmd {
+	return c.sumBySlot("UNLINK", keys)
+}
+
+func (c *ClusterClient) OnUNLINK(req *Request) *IntCmd {
+	return c.sumBySlot("UNLINK", req.cmd[1:])
+}
+
+// Touch is TOUCH split by slot, see sumBySlot.
+func (c *ClusterClient) Touch(keys ...string) *IntCmd {
+	return c.sumBySlot("TOUCH", keys)
+}
+
+func (c *ClusterClient) OnTOUCH(req *Request) *IntCmd {
+	return c.sumBySlot("TOUCH", req.cmd[1:])
+}
+
+// scriptLoadFor loads script on the master of the slot of key, where
+// EVALSHA with key is routed.
+func (c *ClusterClient) scriptLoadFor(key, script string) *StringCmd {
+	if rw := c.opt.KeyRewriter; rw != nil {
+		key = rw.Rewrite(key)
+	}
+	cmd := NewScriptLoadCmd(script)
+	cmd.SetAddr(c.slotMasterAddr(hashSlot(key)))
+	c.process(cmd)
+	return cmd
+}
+
+// masterAddrs returns the addresses of the masters serving slots.
+func (c *ClusterClient) masterAddrs() []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, info := range c.Slots() {
+		if addr := info.Addrs[0]; !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// InfoAll sends INFO [section ...] to every master and merges the
+// replies with MergeInfo, so a client of the proxy sees the cluster as
+// one server. It fails with ErrNoMasters before the slots are known.
+func (c *ClusterClient) InfoAll(sections ...string) *InfoCmd {
+	addrs := c.masterAddrs()
+	if len(addrs) == 0 {
+		cmd := NewInfoCmd(append([]string{"INFO"}, sections...)...)
+		cmd.setErr(ErrNoMasters)
+		return cmd
+	}
+	cmds := make([]*InfoCmd, len(addrs))
+	all := make([]Cmder, len(addrs))
+	for i, addr := range addrs {
+		cmds[i] = NewInfoCmd(append([]string{"INFO"}, sections...)...)
+		cmds[i].SetAddr(addr)
+		all[i] = cmds[i]
+	}
+	c.processAll(all)
+	return MergeInfo(addrs, cmds)
+}
+
+// OnINFO answers INFO with InfoAll rather than the INFO of whichever
+// node a keyless command is routed to.
+func (c *ClusterClient) OnINFO(req *Request) *InfoCmd {
+	return c.InfoAll(req.cmd[1:]...)
+}
+
+func equalAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *ClusterClient) reloadSlots() {
 	defer atomic.StoreUint32(&c.reloading, 0)
 	var (
@@ -252,11 +595,24 @@ func (c *ClusterClient) reloadSlots() {
 	c.setSlots(slots)
 }
 
+// redirect parses err as a MOVED or ASK redirection of a command for
+// slot. A MOVED to another node than the one slot is mapped to means the
+// slots changed, a reload of the slots is scheduled.
+func (c *ClusterClient) redirect(err error, slot int) (moved, ask bool, addr string) {
+	moved, ask, addr = isMovedError(err)
+	if moved && c.slotMasterAddr(slot) != addr {
+		c.lazyReloadSlots()
+	}
+	return moved, ask, addr
+}
+
+// lazyReloadSlots schedules a reload of the slots after the debounce
+// window, unless one is scheduled or in progress already.
 func (c *ClusterClient) lazyReloadSlots() {
 	if !atomic.CompareAndSwapUint32(&c.reloading, 0, 1) {
 		return
 	}
-	go c.reloadSlots()
+	time.AfterFunc(c.opt.getReloadDebounce(), c.reload)
 }
 
 // reaper closes idle connections to the cluster.
@@ -287,6 +643,29 @@ func (c *ClusterClient) reaper() {
 
 //------------------------------------------------------------------------------
 
+// SlotResolver maps a hash slot to the nodes serving it. An empty
+// master address makes the client pick a random node and follow the
+// redirects.
+type SlotResolver interface {
+	Resolve(slot int) (masterAddr string, replicaAddrs []string, err error)
+}
+
+// clusterSlotsResolver is the default SlotResolver, it serves the slot
+// table loaded by CLUSTER SLOTS.
+type clusterSlotsResolver struct {
+	c *ClusterClient
+}
+
+func (r *clusterSlotsResolver) Resolve(slot int) (string, []string, error) {
+	addrs := r.c.slotAddrs(slot)
+	if len(addrs) == 0 {
+		return "", nil, nil
+	}
+	return addrs[0], addrs[1:], nil
+}
+
+//------------------------------------------------------------------------------
+
 // ClusterOptions are used to configure a cluster client and should be
 // passed to NewClusterClient.
 type ClusterOptions struct {
@@ -298,17 +677,108 @@ type ClusterOptions struct {
 	// Default is 16
 	MaxRedirects int
 
+	// Resolves slots to nodes instead of the CLUSTER SLOTS table,
+	// e.g. from a control plane service.
+	SlotResolver SlotResolver
+	// How long a MOVED waits before reloading the CLUSTER SLOTS table,
+	// so that the MOVEDs of a resharding arriving meanwhile share that
+	// single reload.
+	// Default is 100 milliseconds.
+	ReloadDebounce time.Duration
+
 	// Following options are copied from Options struct.
 
 	Password string
+	Protocol int
+	NoEvict  bool
+	NoTouch  bool
+
+	DialTimeout    time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	WriteChunkSize int
+	ReadBufferSize int
+	MaxBulkSize    int
+	MaxArrayLen    int64
+	StrictNewlines bool
+
+	PoolSize          int
+	PoolTimeout       time.Duration
+	IdleTimeout       time.Duration
+	KeepAliveInterval time.Duration
+
+	// The maximum number of commands in flight to every node, see
+	// Options.MaxInFlight.
+	// Default is no limit.
+	MaxInFlight     int
+	InFlightTimeout time.Duration
+
+	// The number of consecutive network errors after which a node is
+	// considered down and commands to it fail fast.
+	// Default is 0, breakers are disabled.
+	BreakerThreshold int
+	// How long a broken node is left alone before a single probe
+	// command is let through.
+	// Default is 5 seconds.
+	BreakerCooldown time.Duration
+
+	// Retries the read-only commands failed by a connection error, see
+	// Options.RetryPolicy.
+	// Default is to not retry failed commands.
+	RetryPolicy *RetryPolicy
+
+	// Observer is notified about every command processed by a node.
+	Observer Observer
+	// CommandLogger logs a sample of the commands processed by the nodes.
+	// Default is to not log commands.
+	CommandLogger *CommandLogger
+
+	// Rewrites the keys of commands before they are routed, see
+	// Options.KeyRewriter. Nodes get the rewritten keys.
+	KeyRewriter KeyRewriter
+	// Rewrites the values of successful replies, see
+	// Options.ReplyTransformer.
+	ReplyTransformer ReplyTransformer
+
+	// Identical read-only commands in flight at the same time are sent
+	// once and share the reply, e.g. GETs of a hot key.
+	// Default is false.
+	CoalesceReads bool
+
+	// The most commands a multi-key command split by slot, e.g. MGET,
+	// processes at once.
+	// Default is 10.
+	MulOpParallel int
+}
 
-	DialTimeout  time.Duration
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+func (opt *ClusterOptions) getReloadDebounce() time.Duration {
+	if opt.ReloadDebounce == 0 {
+		return 100 * time.Millisecond
+	}
+	return opt.ReloadDebounce
+}
 
-	PoolSize    int
-	PoolTimeout time.Duration
-	IdleTimeout time.Duration
+// getRetries returns the number of times cmd failed by a connection
+// error is sent again, see RetryPolicy.
+func (opt *ClusterOptions) getRetries(cmd Cmder) int {
+	if opt.RetryPolicy == nil {
+		return 0
+	}
+	return opt.RetryPolicy.retries(cmd)
+}
+
+func (opt *ClusterOptions) getMulOpParallel() int {
+	if opt.MulOpParallel <= 0 {
+		return 10
+	}
+	return opt.MulOpParallel
+}
+
+func (opt *ClusterOptions) getBreakerCooldown() time.Duration {
+	if opt.BreakerCooldown == 0 {
+		return 5 * time.Second
+	}
+	return opt.BreakerCooldown
 }
 
 func (opt *ClusterOptions) getMaxRedirects() int {
@@ -324,14 +794,30 @@ func (opt *ClusterOptions) getMaxRedirects() int {
 func (opt *ClusterOptions) clientOptions() *Options {
 	return &Options{
 		Password: opt.Password,
-
-		DialTimeout:  opt.DialTimeout,
-		ReadTimeout:  opt.ReadTimeout,
-		WriteTimeout: opt.WriteTimeout,
-
-		PoolSize:    opt.PoolSize,
-		PoolTimeout: opt.PoolTimeout,
-		IdleTimeout: opt.IdleTimeout,
+		Protocol: opt.Protocol,
+		NoEvict:  opt.NoEvict,
+		NoTouch:  opt.NoTouch,
+
+		DialTimeout:    opt.DialTimeout,
+		ReadTimeout:    opt.ReadTimeout,
+		WriteTimeout:   opt.WriteTimeout,
+		WriteChunkSize: opt.WriteChunkSize,
+		ReadBufferSize: opt.ReadBufferSize,
+		MaxBulkSize:    opt.MaxBulkSize,
+		MaxArrayLen:    opt.MaxArrayLen,
+		StrictNewlines: opt.StrictNewlines,
+
+		PoolSize:          opt.PoolSize,
+		PoolTimeout:       opt.PoolTimeout,
+		IdleTimeout:       opt.IdleTimeout,
+		KeepAliveInterval: opt.KeepAliveInterval,
+		MaxInFlight:       opt.MaxInFlight,
+		InFlightTimeout:   opt.InFlightTimeout,
+
+		RetryPolicy: opt.RetryPolicy,
+
+		Observer:      opt.Observer,
+		CommandLogger: opt.CommandLogger,
 	}
 }
 
@@ -357,3 +843,14 @@ func hashSlot(key string) int {
 	}
 	return int(crc16sum(key)) % hashSlots
 }
+
+// sameSlot reports whether all keys hash to the same slot, a command
+// whose keys don't can't be routed to a single node.
+func sameSlot(keys []string) bool {
+	for i := 1; i < len(keys); i++ {
+		if hashSlot(keys[i]) != hashSlot(keys[0]) {
+			return false
+		}
+	}
+	return true
+}
@@ -44,10 +44,18 @@ func (pipe *ClusterPipeline) Exec() (cmds []Cmder, retErr error) {
 	cmds = pipe.cmds
 	pipe.cmds = make([]Cmder, 0, 10)
 
+	if pipe.cluster.isClosed() {
+		FailAll(cmds, ErrProxyClosing)
+		return cmds, ErrProxyClosing
+	}
+
+	valid, retErr := validCmds(cmds)
 	cmdsMap := make(map[string][]Cmder)
-	for _, cmd := range cmds {
-		slot := hashSlot(cmd.clusterKey())
-		addr := pipe.cluster.slotMasterAddr(slot)
+	for _, cmd := range valid {
+		addr := cmd.Addr()
+		if addr == "" {
+			addr = pipe.cluster.slotMasterAddr(hashSlot(cmd.clusterKey()))
+		}
 		cmdsMap[addr] = append(cmdsMap[addr], cmd)
 	}
 
@@ -62,18 +70,35 @@ func (pipe *ClusterPipeline) Exec() (cmds []Cmder, retErr error) {
 				continue
 			}
 
+			if err := client.inflight.acquire(len(cmds)); err != nil {
+				setCmdsErr(cmds, err)
+				retErr = err
+				continue
+			}
+			b := pipe.cluster.getBreaker(client.opt.Addr)
+			if !b.allow() {
+				client.inflight.release(len(cmds))
+				setCmdsErr(cmds, ErrNodeUnavailable)
+				retErr = ErrNodeUnavailable
+				continue
+			}
 			cn, err := client.conn()
 			if err != nil {
+				b.done(err)
+				client.inflight.release(len(cmds))
 				setCmdsErr(cmds, err)
 				retErr = err
 				continue
 			}
 
+			cn.applyTimeouts(client.opt, cmds...)
 			failedCmds, err = pipe.execClusterCmds(cn, cmds, failedCmds)
+			b.done(err)
 			if err != nil {
 				retErr = err
 			}
 			client.putConn(cn, err)
+			client.inflight.release(len(cmds))
 		}
 
 		cmdsMap = failedCmds
@@ -99,20 +124,25 @@ func (pipe *ClusterPipeline) execClusterCmds(
 
 	var firstCmdErr error
 	for i, cmd := range cmds {
-		err := cmd.parseReply(cn.rd)
+		// Redirections skip the parser of the command.
+		redirected, err := readRedirect(cn.rd)
+		if redirected {
+			cmd.setErr(err)
+		} else {
+			err = cmd.parseReply(cn.rd)
+		}
 		if err == nil {
 			continue
 		}
 		if isNetworkError(err) {
-			cmd.reset()
+			resetCmds(cmd)
 			failedCmds[""] = append(failedCmds[""], cmds[i:]...)
-			break
-		} else if moved, ask, addr := isMovedError(err); moved {
-			pipe.cluster.lazyReloadSlots()
-			cmd.reset()
+			return failedCmds, err
+		} else if moved, ask, addr := pipe.cluster.redirect(err, hashSlot(cmd.clusterKey())); moved {
+			resetCmds(cmd)
 			failedCmds[addr] = append(failedCmds[addr], cmd)
 		} else if ask {
-			cmd.reset()
+			resetCmds(cmd)
 			failedCmds[addr] = append(failedCmds[addr], NewCmd("ASKING"), cmd)
 		} else if firstCmdErr == nil {
 			firstCmdErr = err
@@ -0,0 +1,458 @@
+package redis
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeResolver map[int][]string
+
+func (r fakeResolver) Resolve(slot int) (string, []string, error) {
+	addrs, ok := r[slot]
+	if !ok {
+		return "", nil, errors.New("unknown slot")
+	}
+	return addrs[0], addrs[1:], nil
+}
+
+func newTestClusterClient(opt *ClusterOptions) *ClusterClient {
+	c := &ClusterClient{
+		slots:    make([][]string, hashSlots),
+		clients:  make(map[string]*Client),
+		breakers: make(map[string]*circuitBreaker),
+		opt:      opt,
+		resolver: opt.SlotResolver,
+	}
+	c.reload = c.reloadSlots
+	if c.resolver == nil {
+		c.resolver = &clusterSlotsResolver{c}
+	}
+	return c
+}
+
+func TestClusterSlotsResolver(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	c.setSlots([]ClusterSlotInfo{
+		{0, 100, []string{"127.0.0.1:7000", "127.0.0.1:7001"}},
+		{101, 16383, []string{"127.0.0.1:7002"}},
+	})
+
+	master, replicas, err := c.resolver.Resolve(50)
+	if err != nil || master != "127.0.0.1:7000" || !reflect.DeepEqual(replicas, []string{"127.0.0.1:7001"}) {
+		t.Errorf("got %q %q %v", master, replicas, err)
+	}
+	if addr := c.slotMasterAddr(101); addr != "127.0.0.1:7002" {
+		t.Errorf("got %q, wanted 127.0.0.1:7002", addr)
+	}
+
+	c.setSlots(nil)
+	if addr := c.slotMasterAddr(50); addr != "" {
+		t.Errorf("got %q for an unknown slot", addr)
+	}
+}
+
+func TestCustomSlotResolver(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{
+		SlotResolver: fakeResolver{
+			hashSlot("foo"): {"10.0.0.1:6379", "10.0.0.2:6379"},
+		},
+	})
+	// The CLUSTER SLOTS table must be ignored.
+	c.setSlots([]ClusterSlotInfo{{0, 16383, []string{"127.0.0.1:7000"}}})
+
+	if addr := c.slotMasterAddr(hashSlot("foo")); addr != "10.0.0.1:6379" {
+		t.Errorf("got %q, wanted 10.0.0.1:6379", addr)
+	}
+	if addr := c.slotMasterAddr(hashSlot("bar")); addr != "" {
+		t.Errorf("resolver error must fall back to a random node, got %q", addr)
+	}
+}
+
+func TestClusterCloseInFlight(t *testing.T) {
+	addr := "10.0.0.1:7000"
+	c := newTestClusterClient(&ClusterOptions{Addrs: []string{addr}})
+	c.commandable.process = c.process
+	c.setSlots([]ClusterSlotInfo{{0, 16383, []string{addr}}})
+	client, server, _ := newPipeClient(&Options{Addr: addr})
+	c.clients[addr] = client
+
+	get := NewStringCmd("GET", "a")
+	go func() {
+		// The node reads the command and never replies, until Close.
+		io.ReadFull(server, make([]byte, len(AppendCommand(nil, get.args()))))
+		c.Close()
+	}()
+	c.Process(get)
+	if get.Err() != ErrProxyClosing {
+		t.Errorf("got %v, wanted %v", get.Err(), ErrProxyClosing)
+	}
+}
+
+func TestClusterClosedFailsFast(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	c.Close()
+
+	get := NewStringCmd("GET", "a")
+	c.process(get)
+	if get.Err() != ErrProxyClosing {
+		t.Errorf("got %v, wanted %v", get.Err(), ErrProxyClosing)
+	}
+	if got := string(get.Reply()); got != "-ERR proxy is shutting down\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	pipe := c.Pipeline()
+	pipe.Process(NewStringCmd("GET", "a"))
+	pipe.Process(NewIntCmd("INCR", "b"))
+	cmds, err := pipe.Exec()
+	if err != ErrProxyClosing {
+		t.Errorf("got %v, wanted %v", err, ErrProxyClosing)
+	}
+	for _, cmd := range cmds {
+		if cmd.Err() != ErrProxyClosing {
+			t.Errorf("%q: got %v, wanted %v", cmd.args(), cmd.Err(), ErrProxyClosing)
+		}
+	}
+
+	batch := []Cmder{NewStringCmd("GET", "a"), NewStatusCmd("SET", "b", "v"), NewSliceCmd("MGET", "c")}
+	FailAll(batch, ErrProxyClosing)
+	for _, cmd := range batch {
+		if cmd.Err() != ErrProxyClosing {
+			t.Errorf("%q: got %v, wanted %v", cmd.args(), cmd.Err(), ErrProxyClosing)
+		}
+	}
+}
+
+func TestClusterPinnedCommand(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	c.commandable.process = c.process
+	c.setSlots([]ClusterSlotInfo{{0, 16383, []string{"master:7000", "replica:7001"}}})
+	// The master has no server, a command routed there would block.
+	c.clients["master:7000"], _, _ = newPipeClient(&Options{Addr: "master:7000"})
+	replica, server, _ := newPipeClient(&Options{Addr: "replica:7001"})
+	c.clients["replica:7001"] = replica
+
+	want := AppendCommand(nil, []string{"CLUSTER", "FAILOVER", "FORCE"})
+	got := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, len(want))
+		io.ReadFull(server, buf)
+		got <- buf
+		io.WriteString(server, "+OK\r\n")
+	}()
+
+	if err := c.ClusterFailoverNode("replica:7001", true).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if b := <-got; string(b) != string(want) {
+		t.Errorf("replica got %q, wanted %q", b, want)
+	}
+}
+
+func TestClusterSlotsSnapshot(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	if slots := c.Slots(); len(slots) != 0 {
+		t.Fatalf("got %v before the first reload", slots)
+	}
+
+	c.setSlots([]ClusterSlotInfo{
+		{0, 8191, []string{"10.0.0.1:7000", "10.0.0.2:7001"}},
+		{8192, 16383, []string{"10.0.0.3:7002"}},
+	})
+	want := []ClusterSlotInfo{
+		{0, 8191, []string{"10.0.0.1:7000", "10.0.0.2:7001"}},
+		{8192, 16383, []string{"10.0.0.3:7002"}},
+	}
+	if got := c.Slots(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, wanted %v", got, want)
+	}
+
+	// Slots 100-199 migrated to a new master, the replica failed over.
+	c.setSlots([]ClusterSlotInfo{
+		{0, 99, []string{"10.0.0.2:7001"}},
+		{100, 199, []string{"10.0.0.4:7003"}},
+		{200, 8191, []string{"10.0.0.2:7001"}},
+		{8192, 16383, []string{"10.0.0.3:7002"}},
+	})
+	want = []ClusterSlotInfo{
+		{0, 99, []string{"10.0.0.2:7001"}},
+		{100, 199, []string{"10.0.0.4:7003"}},
+		{200, 8191, []string{"10.0.0.2:7001"}},
+		{8192, 16383, []string{"10.0.0.3:7002"}},
+	}
+	cmd := c.SlotsCmd()
+	if !reflect.DeepEqual(cmd.Val(), want) {
+		t.Fatalf("got %v, wanted %v", cmd.Val(), want)
+	}
+
+	reply := string(cmd.Reply())
+	if !strings.HasPrefix(reply, "*4\r\n*3\r\n:0\r\n:99\r\n*2\r\n$8\r\n10.0.0.2\r\n:7001\r\n*3\r\n:100\r\n") {
+		t.Errorf("got %q", reply)
+	}
+	parsed := NewClusterSlotCmd("CLUSTER", "SLOTS")
+	if err := parsed.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.Val(), want) {
+		t.Errorf("got %v back, wanted %v", parsed.Val(), want)
+	}
+}
+
+func TestMovedReloadsSlotsOnce(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{ReloadDebounce: 50 * time.Millisecond})
+	c.setSlots([]ClusterSlotInfo{{0, 16383, []string{"10.0.0.1:7000"}}})
+	var reloads int32
+	c.reload = func() {
+		atomic.AddInt32(&reloads, 1)
+		atomic.StoreUint32(&c.reloading, 0)
+	}
+
+	const n = 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			moved, ask, addr := c.redirect(errorf("MOVED %d 10.0.0.2:7001", i), i)
+			if !moved || ask || addr != "10.0.0.2:7001" {
+				t.Errorf("got %v %v %q", moved, ask, addr)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&reloads); got != 0 {
+		t.Fatalf("got %d reloads within the debounce window, wanted none yet", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if got := atomic.LoadInt32(&reloads); got != 1 {
+		t.Fatalf("got %d reloads, wanted 1", got)
+	}
+
+	// A MOVED to the node the slot is mapped to changes nothing.
+	c.redirect(errorf("MOVED 1 10.0.0.1:7000"), 1)
+	c.redirect(errorf("ASK 1 10.0.0.2:7001"), 1)
+	time.Sleep(100 * time.Millisecond)
+	if got := atomic.LoadInt32(&reloads); got != 1 {
+		t.Errorf("got %d reloads, wanted still 1", got)
+	}
+}
+
+func TestClusterInfoAll(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	c.commandable.process = c.process
+	c.setSlots([]ClusterSlotInfo{
+		{0, 8191, []string{"10.0.0.1:7000", "10.0.0.3:7000"}},
+		{8192, 16383, []string{"10.0.0.2:7000"}},
+	})
+	for i, addr := range []string{"10.0.0.1:7000", "10.0.0.2:7000"} {
+		client, server, _ := newPipeClient(&Options{Addr: addr})
+		c.clients[addr] = client
+		reply := "# Stats\r\ntotal_commands_processed:" + strconv.Itoa(i+1) + "\r\n"
+		go func() {
+			req := AppendCommand(nil, []string{"INFO", "stats"})
+			io.ReadFull(server, make([]byte, len(req)))
+			io.WriteString(server, "$"+strconv.Itoa(len(reply))+"\r\n"+reply+"\r\n")
+		}()
+	}
+
+	cmd := c.OnINFO(NewRequest([]string{"INFO", "stats"}))
+	if v, ok := cmd.Get("Stats", "total_commands_processed"); cmd.Err() != nil || v != "3" {
+		t.Errorf("got %q, %v, %v", v, ok, cmd.Err())
+	}
+
+	empty := newTestClusterClient(&ClusterOptions{})
+	if err := empty.InfoAll().Err(); err != ErrNoMasters {
+		t.Errorf("got %v, wanted %v", err, ErrNoMasters)
+	}
+}
+
+func TestClusterSumBySlot(t *testing.T) {
+	unlink := NewUnlinkCmd("{a}1", "b", "{a}2")
+	if want := []string{"UNLINK", "{a}1", "b", "{a}2"}; !reflect.DeepEqual(unlink.args(), want) {
+		t.Errorf("got %q, wanted %q", unlink.args(), want)
+	}
+	if keys := NewTouchCmd("a", "b").clusterKeys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("got keys %q", keys)
+	}
+	want := []SlotKeys{
+		{hashSlot("a"), []string{"{a}1", "{a}2"}, []int{0, 2}},
+		{hashSlot("b"), []string{"b"}, []int{1}},
+	}
+	if got := SplitBySlot([]string{"{a}1", "b", "{a}2"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+
+	c := newTestClusterClient(&ClusterOptions{})
+	c.commandable.process = c.process
+	// "a" hashes to slot 15495, "b" to 3300.
+	c.setSlots([]ClusterSlotInfo{
+		{0, 8191, []string{"10.0.0.1:7000"}},
+		{8192, 16383, []string{"10.0.0.2:7000"}},
+	})
+	for _, node := range []struct {
+		addr  string
+		req   []string
+		reply string
+	}{
+		{"10.0.0.1:7000", []string{"UNLINK", "b"}, ":1\r\n"},
+		{"10.0.0.2:7000", []string{"UNLINK", "{a}1", "{a}2"}, ":2\r\n"},
+	} {
+		client, server, _ := newPipeClient(&Options{Addr: node.addr})
+		c.clients[node.addr] = client
+		go func(req []string, reply string) {
+			want := AppendCommand(nil, req)
+			buf := make([]byte, len(want))
+			io.ReadFull(server, buf)
+			if string(buf) != string(want) {
+				t.Errorf("got %q, wanted %q", buf, want)
+			}
+			io.WriteString(server, reply)
+		}(node.req, node.reply)
+	}
+
+	cmd := c.OnUNLINK(NewRequest([]string{"UNLINK", "{a}1", "b", "{a}2"}))
+	if n, err := cmd.Result(); err != nil || n != 3 {
+		t.Errorf("got %d, %v, wanted 3", n, err)
+	}
+	if got := string(cmd.Reply()); got != ":3\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestClusterMGetGather(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	c.commandable.process = c.process
+	// "a" hashes to slot 15495, "b" to 3300.
+	c.setSlots([]ClusterSlotInfo{
+		{0, 8191, []string{"10.0.0.1:7000"}},
+		{8192, 16383, []string{"10.0.0.2:7000"}},
+	})
+	for _, node := range []struct {
+		addr  string
+		req   []string
+		reply string
+	}{
+		{"10.0.0.1:7000", []string{"MGET", "b"}, "*1\r\n$2\r\nvb\r\n"},
+		{"10.0.0.2:7000", []string{"MGET", "{a}1", "{a}2"}, "*2\r\n$-1\r\n$3\r\nva2\r\n"},
+	} {
+		client, server, _ := newPipeClient(&Options{Addr: node.addr})
+		c.clients[node.addr] = client
+		go func(req []string, reply string) {
+			want := AppendCommand(nil, req)
+			buf := make([]byte, len(want))
+			io.ReadFull(server, buf)
+			if string(buf) != string(want) {
+				t.Errorf("got %q, wanted %q", buf, want)
+			}
+			io.WriteString(server, reply)
+		}(node.req, node.reply)
+	}
+
+	cmd := c.OnMGET(NewRequest([]string{"MGET", "{a}1", "b", "{a}2"}))
+	if err := cmd.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := "*3\r\n$-1\r\n$2\r\nvb\r\n$3\r\nva2\r\n"
+	if got := string(cmd.Reply()); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if keys := cmd.clusterKeys(); !reflect.DeepEqual(keys, []string{"{a}1", "b", "{a}2"}) {
+		t.Errorf("got keys %q", keys)
+	}
+}
+
+func TestClusterMGetKeyPrefix(t *testing.T) {
+	// "k8" and "k1306" share slot 8331, prefixed they are in 10859 and
+	// 3234: MGET is split by the slots of the prefixed keys.
+	c := newTestClusterClient(&ClusterOptions{
+		KeyRewriter:   PrefixRewriter("t:"),
+		MulOpParallel: 1,
+	})
+	c.commandable.process = c.process
+	c.setSlots([]ClusterSlotInfo{
+		{0, 8191, []string{"10.0.0.1:7000"}},
+		{8192, 16383, []string{"10.0.0.2:7000"}},
+	})
+	var active, maxActive int32
+	for _, node := range []struct {
+		addr  string
+		req   []string
+		reply string
+	}{
+		{"10.0.0.1:7000", []string{"MGET", "t:k1306"}, "*1\r\n$2\r\nv2\r\n"},
+		{"10.0.0.2:7000", []string{"MGET", "t:k8"}, "*1\r\n$2\r\nv1\r\n"},
+	} {
+		client, server, _ := newPipeClient(&Options{Addr: node.addr})
+		c.clients[node.addr] = client
+		go func(req []string, reply string) {
+			want := AppendCommand(nil, req)
+			buf := make([]byte, len(want))
+			io.ReadFull(server, buf)
+			if string(buf) != string(want) {
+				t.Errorf("got %q, wanted %q", buf, want)
+			}
+			if n := atomic.AddInt32(&active, 1); n > atomic.LoadInt32(&maxActive) {
+				atomic.StoreInt32(&maxActive, n)
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			io.WriteString(server, reply)
+		}(node.req, node.reply)
+	}
+
+	cmd := c.OnMGET(NewRequest([]string{"MGET", "k8", "k1306"}))
+	if err := cmd.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := "*2\r\n$2\r\nv1\r\n$2\r\nv2\r\n"
+	if got := string(cmd.Reply()); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if n := atomic.LoadInt32(&maxActive); n != 1 {
+		t.Errorf("got %d MGETs at once, wanted 1", n)
+	}
+}
+
+func TestClusterWriteNotRetried(t *testing.T) {
+	addr := "10.0.0.1:7000"
+	c := newTestClusterClient(&ClusterOptions{
+		Addrs:       []string{addr},
+		RetryPolicy: &RetryPolicy{MaxRetries: 2},
+	})
+	c.commandable.process = c.process
+	c.setSlots([]ClusterSlotInfo{{0, 16383, []string{addr}}})
+	p := newRedialPool()
+	c.clients[addr] = newClient(&Options{Addr: addr}, p)
+
+	set := NewStatusCmd("SET", "k", "v")
+	req := make([]byte, len(AppendCommand(nil, set.args())))
+	resent := make(chan bool)
+	go func() {
+		// The node drops the connection after reading the SET.
+		server := <-p.servers
+		io.ReadFull(server, req)
+		server.Close()
+
+		server = <-p.servers
+		_, err := io.ReadFull(server, make([]byte, 1))
+		resent <- err == nil
+	}()
+
+	c.Process(set)
+	if set.Err() != io.EOF {
+		t.Errorf("got %v, wanted %v", set.Err(), io.EOF)
+	}
+	// Unblocks the server if nothing was sent again.
+	p.cn.Close()
+	if <-resent {
+		t.Error("SET was sent again after its connection failed")
+	}
+}
@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/ngaut/logging"
+)
+
+// redacted replaces the argument values a CommandLogger must not log.
+const redacted = "(redacted)"
+
+// CommandLog is a command sampled by a CommandLogger.
+type CommandLog struct {
+	Name string
+	// The arguments after the name, credentials are always redacted.
+	Args      []string
+	ReplySize int
+	Duration  time.Duration
+	Err       error
+}
+
+// CommandLogger logs a sample of the commands processed by a client and
+// their replies, for debugging without flooding the logs. It is safe for
+// concurrent use, clients sharing it share the sampling.
+type CommandLogger struct {
+	// Every logs one in Every commands.
+	// Default is to log every command.
+	Every int
+	// RedactValues replaces every argument but the keys, e.g. to keep
+	// user data out of the logs.
+	// Default is to redact credentials only.
+	RedactValues bool
+	// Log is called with the sampled commands.
+	// Default is to log them at the info level.
+	Log func(*CommandLog)
+
+	n uint64
+}
+
+func (l *CommandLogger) sampled() bool {
+	n := atomic.AddUint64(&l.n, 1)
+	return l.Every <= 1 || (n-1)%uint64(l.Every) == 0
+}
+
+// LogCommand logs cmd processed in dur if it is sampled.
+func (l *CommandLogger) LogCommand(cmd Cmder, dur time.Duration) {
+	if !l.sampled() {
+		return
+	}
+	entry := &CommandLog{
+		Name:      cmd.Name(),
+		Args:      l.redact(cmd),
+		ReplySize: len(cmd.Reply()),
+		Duration:  dur,
+		Err:       cmd.Err(),
+	}
+	if l.Log != nil {
+		l.Log(entry)
+		return
+	}
+	log.Infof("redis: %s %s reply=%dB took=%s err=%v",
+		entry.Name, strings.Join(entry.Args, " "), entry.ReplySize, entry.Duration, entry.Err)
+}
+
+// redact returns the arguments of cmd after its name, with credentials
+// and, if RedactValues is set, all but the keys replaced.
+func (l *CommandLogger) redact(cmd Cmder) []string {
+	args := cmd.args()
+	if len(args) == 0 {
+		return nil
+	}
+	out := make([]string, len(args)-1)
+	copy(out, args[1:])
+
+	if l.RedactValues {
+		keys := make(map[int]bool)
+		for _, i := range cmd.keyIndexes() {
+			keys[i] = true
+		}
+		for i := range out {
+			if !keys[i+1] && !isSubcommand(cmd.Name(), i+1) {
+				out[i] = redacted
+			}
+		}
+	}
+	redactCredentials(cmd.Name(), out)
+	return out
+}
+
+// isSubcommand reports whether the argument at i of the command name is
+// a subcommand, which is kept by RedactValues.
+func isSubcommand(name string, i int) bool {
+	if i != 1 {
+		return false
+	}
+	switch name {
+	case "ACL", "CLIENT", "CLUSTER", "COMMAND", "CONFIG", "DEBUG",
+		"FUNCTION", "MEMORY", "OBJECT", "SCRIPT", "SLOWLOG", "XGROUP", "XINFO":
+		return true
+	}
+	return false
+}
+
+// redactCredentials replaces the passwords in args, the arguments after
+// the command name.
+func redactCredentials(name string, args []string) {
+	switch name {
+	case "AUTH":
+		redactFrom(args, 0, len(args))
+	case "HELLO":
+		// HELLO [protover [AUTH username password] [SETNAME clientname]]
+		for i, arg := range args {
+			if strings.EqualFold(arg, "AUTH") {
+				redactFrom(args, i+1, 2)
+			}
+		}
+	case "MIGRATE":
+		for i, arg := range args {
+			switch strings.ToUpper(arg) {
+			case "AUTH":
+				redactFrom(args, i+1, 1)
+			case "AUTH2":
+				redactFrom(args, i+1, 2)
+			}
+		}
+	case "CONFIG":
+		if len(args) == 0 || !strings.EqualFold(args[0], "SET") {
+			return
+		}
+		for i := 1; i+1 < len(args); i += 2 {
+			switch strings.ToLower(args[i]) {
+			case "requirepass", "masterauth", "masteruser":
+				redactFrom(args, i+1, 1)
+			}
+		}
+	case "ACL":
+		// ACL SETUSER username rules..., rules hold the passwords.
+		if len(args) > 0 && strings.EqualFold(args[0], "SETUSER") {
+			redactFrom(args, 2, len(args))
+		}
+	}
+}
+
+// redactFrom replaces up to n arguments from i.
+func redactFrom(args []string, i, n int) {
+	for ; n > 0 && i < len(args); i, n = i+1, n-1 {
+		args[i] = redacted
+	}
+}
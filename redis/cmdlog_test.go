@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logSink collects the commands logged by a CommandLogger.
+type logSink struct {
+	mu   sync.Mutex
+	logs []*CommandLog
+}
+
+func (s *logSink) log(l *CommandLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, l)
+}
+
+func TestCommandLoggerSampling(t *testing.T) {
+	sink := &logSink{}
+	l := &CommandLogger{Every: 10, Log: sink.log}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cmd := NewStringCmd("GET", "key")
+				cmd.val = "value"
+				l.LogCommand(cmd, time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(sink.logs); n < 90 || n > 110 {
+		t.Fatalf("logged %d of 1000 commands, want about 100", n)
+	}
+	got := sink.logs[0]
+	if got.Name != "GET" || !reflect.DeepEqual(got.Args, []string{"key"}) ||
+		got.ReplySize != len("$5\r\nvalue\r\n") || got.Duration != time.Millisecond {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestCommandLoggerRedaction(t *testing.T) {
+	tests := []struct {
+		args   []string
+		values bool
+		want   []string
+	}{
+		{[]string{"AUTH", "secret"}, false, []string{"(redacted)"}},
+		{[]string{"AUTH", "user", "secret"}, false, []string{"(redacted)", "(redacted)"}},
+		{[]string{"HELLO", "3", "AUTH", "user", "secret", "SETNAME", "c"}, false,
+			[]string{"3", "AUTH", "(redacted)", "(redacted)", "SETNAME", "c"}},
+		{[]string{"MIGRATE", "h", "6379", "k", "0", "1000", "AUTH2", "user", "secret"}, false,
+			[]string{"h", "6379", "k", "0", "1000", "AUTH2", "(redacted)", "(redacted)"}},
+		{[]string{"CONFIG", "SET", "maxmemory", "1gb", "requirepass", "secret"}, false,
+			[]string{"SET", "maxmemory", "1gb", "requirepass", "(redacted)"}},
+		{[]string{"ACL", "SETUSER", "alice", "on", ">secret"}, false,
+			[]string{"SETUSER", "alice", "(redacted)", "(redacted)"}},
+		{[]string{"SET", "key", "value"}, false, []string{"key", "value"}},
+		{[]string{"SET", "key", "value"}, true, []string{"key", "(redacted)"}},
+		{[]string{"MSET", "k1", "v1", "k2", "v2"}, true,
+			[]string{"k1", "(redacted)", "k2", "(redacted)"}},
+		{[]string{"CONFIG", "SET", "requirepass", "secret"}, true,
+			[]string{"SET", "(redacted)", "(redacted)"}},
+	}
+	for _, test := range tests {
+		sink := &logSink{}
+		l := &CommandLogger{RedactValues: test.values, Log: sink.log}
+		l.LogCommand(NewStatusCmd(test.args...), 0)
+		if got := sink.logs[0].Args; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, wanted %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestCommandLoggerOption(t *testing.T) {
+	sink := &logSink{}
+	client, server, _ := newPipeClient(&Options{
+		CommandLogger: &CommandLogger{Log: sink.log},
+	})
+	go func() {
+		buf := make([]byte, len(AppendCommand(nil, []string{"AUTH", "secret"})))
+		io.ReadFull(server, buf)
+		io.WriteString(server, "+OK\r\n")
+	}()
+
+	if err := client.Auth("secret").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.logs) != 1 || sink.logs[0].Name != "AUTH" ||
+		!reflect.DeepEqual(sink.logs[0].Args, []string{"(redacted)"}) || sink.logs[0].ReplySize != 5 {
+		t.Fatalf("got %+v", sink.logs)
+	}
+}
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"sync"
+
+	"github.com/dongzerun/smartproxy/util"
+)
+
+// flight is a read-only command being processed, its duplicates wait for
+// it and share its reply.
+type flight struct {
+	done chan struct{}
+	cmd  Cmder
+	// Number of duplicates waiting, guarded by flightGroup.mx.
+	waiters int
+}
+
+// flightGroup coalesces identical read-only commands in flight, so a hot
+// key read by many clients at once costs a single round-trip to Redis.
+type flightGroup struct {
+	mx      sync.Mutex
+	flights map[string]*flight
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// flightKey identifies cmd by its node, database and arguments, encoded
+// as sent so that arguments can't run into each other.
+func flightKey(cmd Cmder) string {
+	buf := append([]byte(cmd.Addr()), '/')
+	if db, ok := cmd.DB(); ok {
+		buf = append(buf, util.Itoa(int(db))...)
+	}
+	return string(AppendCommand(buf, cmd.args()))
+}
+
+// do processes cmd with process, unless an identical command is in
+// flight: then it waits for it and copies its reply. Commands whose
+// value can't be shared are always processed.
+func (g *flightGroup) do(cmd Cmder, process func(Cmder)) {
+	vs, ok := cmd.(valueSetter)
+	if !ok {
+		process(cmd)
+		return
+	}
+
+	key := flightKey(cmd)
+	g.mx.Lock()
+	if f, ok := g.flights[key]; ok {
+		f.waiters++
+		g.mx.Unlock()
+		<-f.done
+		if !shareReply(f.cmd, cmd, vs) {
+			process(cmd)
+		}
+		return
+	}
+	f := &flight{done: make(chan struct{}), cmd: cmd}
+	g.flights[key] = f
+	g.mx.Unlock()
+
+	process(cmd)
+
+	g.mx.Lock()
+	delete(g.flights, key)
+	g.mx.Unlock()
+	close(f.done)
+}
+
+// shareReply copies the reply of src to dst, false if dst has another
+// type of value.
+func shareReply(src, dst Cmder, vs valueSetter) bool {
+	if err := src.Err(); err != nil {
+		dst.setErr(err)
+		return true
+	}
+	// The value of an ordered map is the map, share the pairs too.
+	if from, ok := src.(*StringStringMapCmd); ok {
+		if to, ok := dst.(*StringStringMapCmd); ok {
+			to.val, to.pairs = from.val, from.pairs
+			return true
+		}
+	}
+	from, ok := src.(valueSetter)
+	return ok && vs.setValue(from.value())
+}
+
+// waiting returns the number of duplicates waiting for the command with
+// key.
+func (g *flightGroup) waiting(key string) int {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f.waiters
+	}
+	return 0
+}
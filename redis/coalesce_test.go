@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	const n = 10
+	g := newFlightGroup()
+
+	var sends int32
+	release := make(chan struct{})
+	process := func(cmd Cmder) {
+		atomic.AddInt32(&sends, 1)
+		<-release
+		cmd.(*StringCmd).val = "hot"
+	}
+
+	cmds := make([]*StringCmd, n)
+	var wg sync.WaitGroup
+	for i := range cmds {
+		cmds[i] = NewStringCmd("GET", "k")
+		wg.Add(1)
+		go func(cmd *StringCmd) {
+			defer wg.Done()
+			g.do(cmd, process)
+		}(cmds[i])
+	}
+
+	key := flightKey(cmds[0])
+	for deadline := time.Now().Add(time.Second); g.waiting(key) < n-1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d waiters, wanted %d", g.waiting(key), n-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if sends != 1 {
+		t.Errorf("got %d sends, wanted 1", sends)
+	}
+	for i, cmd := range cmds {
+		if got := string(cmd.Reply()); got != "$3\r\nhot\r\n" {
+			t.Errorf("cmd %d replied %q", i, got)
+		}
+	}
+
+	// Finished flights are not shared.
+	cmd := NewStringCmd("GET", "k")
+	g.do(cmd, process)
+	if sends != 2 {
+		t.Errorf("got %d sends, wanted 2", sends)
+	}
+}
+
+func TestFlightGroupSharesErrors(t *testing.T) {
+	g := newFlightGroup()
+	release := make(chan struct{})
+	leader := NewStringCmd("GET", "k")
+	go g.do(leader, func(cmd Cmder) {
+		<-release
+		cmd.setErr(Nil)
+	})
+
+	key := flightKey(leader)
+	inFlight := func() bool {
+		g.mx.Lock()
+		defer g.mx.Unlock()
+		return g.flights[key] != nil
+	}
+	for !inFlight() {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	dup := NewStringCmd("GET", "k")
+	go func() {
+		g.do(dup, func(Cmder) { t.Error("duplicate must not be sent") })
+		close(done)
+	}()
+	for g.waiting(key) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done
+	if dup.Err() != Nil {
+		t.Errorf("got %v, wanted %v", dup.Err(), Nil)
+	}
+}
+
+func TestFlightKey(t *testing.T) {
+	a := NewStringCmd("GET", "a b")
+	b := NewCmd("GET", "a", "b")
+	if flightKey(a) == flightKey(b) {
+		t.Error("different arguments must not share a flight")
+	}
+	c := NewStringCmd("GET", "a b")
+	c.SetDB(1)
+	if flightKey(a) == flightKey(c) {
+		t.Error("different databases must not share a flight")
+	}
+}
@@ -3,11 +3,13 @@ package redis
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dongzerun/smartproxy/redis/bufio.v1"
 	"github.com/dongzerun/smartproxy/util"
 	log "github.com/ngaut/logging"
 )
@@ -17,29 +19,62 @@ var (
 	_ Cmder = (*SliceCmd)(nil)
 	_ Cmder = (*StatusCmd)(nil)
 	_ Cmder = (*IntCmd)(nil)
+	_ Cmder = (*Uint64Cmd)(nil)
 	_ Cmder = (*DurationCmd)(nil)
 	_ Cmder = (*BoolCmd)(nil)
 	_ Cmder = (*StringCmd)(nil)
+	_ Cmder = (*SetCmd)(nil)
 	_ Cmder = (*FloatCmd)(nil)
 	_ Cmder = (*StringSliceCmd)(nil)
+	_ Cmder = (*NullableStringSliceCmd)(nil)
+	_ Cmder = (*SortCmd)(nil)
+	_ Cmder = (*LposCmd)(nil)
+	_ Cmder = (*LcsCmd)(nil)
+	_ Cmder = (*MPopCmd)(nil)
 	_ Cmder = (*BoolSliceCmd)(nil)
 	_ Cmder = (*StringStringMapCmd)(nil)
 	_ Cmder = (*StringIntMapCmd)(nil)
+	_ Cmder = (*KeyValueSliceCmd)(nil)
+	_ Cmder = (*ZAddCmd)(nil)
 	_ Cmder = (*ZSliceCmd)(nil)
 	_ Cmder = (*ScanCmd)(nil)
 	_ Cmder = (*ClusterSlotCmd)(nil)
+	_ Cmder = (*MapStringSliceCmd)(nil)
+	_ Cmder = (*ClusterShardsCmd)(nil)
+	_ Cmder = (*XInfoStreamCmd)(nil)
+	_ Cmder = (*XInfoGroupsCmd)(nil)
+	_ Cmder = (*ObjectCmd)(nil)
+	_ Cmder = (*DebugObjectCmd)(nil)
+	_ Cmder = (*DebugCmd)(nil)
+	_ Cmder = (*IntSliceCmd)(nil)
+	_ Cmder = (*FloatSliceCmd)(nil)
+	_ Cmder = (*HelloCmd)(nil)
+	_ Cmder = (*ClientInfoCmd)(nil)
+	_ Cmder = (*ExecCmd)(nil)
+	_ Cmder = (*SubscribeCmd)(nil)
 )
 
 type Cmder interface {
 	args() []string
-	parseReply(*bufio.Reader) error
+	parseReply(*reader) error
 	setErr(error)
 	reset()
 
 	writeTimeout() *time.Duration
 	readTimeout() *time.Duration
+	setTimeouts(rd, wr *time.Duration)
 	clusterKey() string
-
+	setClusterKeyPos(int)
+	clusterKeys() []string
+	keyIndexes() []int
+
+	Name() string
+	IsReadOnly() bool
+	DB() (int64, bool)
+	SetDB(int64)
+	Addr() string
+	SetAddr(string)
+	Validate() error
 	Err() error
 	String() string
 
@@ -52,9 +87,19 @@ func setCmdsErr(cmds []Cmder, e error) {
 	}
 }
 
-func resetCmds(cmds []Cmder) {
+// FailAll sets err on every command of cmds, e.g. ErrProxyClosing on
+// the ones in flight when the proxy shuts down.
+func FailAll(cmds []Cmder, err error) {
+	setCmdsErr(cmds, err)
+}
+
+// resetCmds prepares cmds for another attempt. The timeouts are kept,
+// they belong to the command and not to the attempt.
+func resetCmds(cmds ...Cmder) {
 	for _, cmd := range cmds {
+		rd, wr := cmd.readTimeout(), cmd.writeTimeout()
 		cmd.reset()
+		cmd.setTimeouts(rd, wr)
 	}
 }
 
@@ -70,6 +115,21 @@ func cmdString(cmd Cmder, val interface{}) string {
 
 }
 
+// FormatNil formats the nil bulk reply.
+func FormatNil() []byte {
+	return []byte("$-1\r\n")
+}
+
+// FormatError formats the reply of a failed command: Nil is the nil bulk
+// reply, any other error an error reply with its message, redirections
+// and CROSSSLOT errors included.
+func FormatError(err error) []byte {
+	if err == Nil {
+		return FormatNil()
+	}
+	return []byte("-" + err.Error() + "\r\n")
+}
+
 //------------------------------------------------------------------------------
 
 type baseCmd struct {
@@ -78,8 +138,21 @@ type baseCmd struct {
 	err error
 
 	_clusterKeyPos int
+	// Number of keys starting at _clusterKeyPos, 0 if the cluster key
+	// is the only one.
+	_keyCount int
 
 	_writeTimeout, _readTimeout *time.Duration
+
+	// Database the command must run on, nil for the one of the client.
+	_db *int64
+	// Address of the node the command must run on, "" to route it by
+	// slot.
+	_addr string
+
+	// Indexes of the keys for commands whose keys follow options, like
+	// SORT, they take precedence over everything else.
+	_keyIndexes []int
 }
 
 func (cmd *baseCmd) Err() error {
@@ -93,6 +166,77 @@ func (cmd *baseCmd) args() []string {
 	return cmd._args
 }
 
+// Name returns the upper cased command name, or "" without arguments.
+func (cmd *baseCmd) Name() string {
+	if len(cmd._args) > 0 {
+		return strings.ToUpper(cmd._args[0])
+	}
+	return ""
+}
+
+// DB returns the database cmd runs on, false if it runs on the one
+// configured for the client.
+func (cmd *baseCmd) DB() (int64, bool) {
+	if cmd._db == nil {
+		return 0, false
+	}
+	return *cmd._db, true
+}
+
+// SetDB makes cmd run on database db, the connection it is sent on is
+// switched to db first if another one is selected there.
+func (cmd *baseCmd) SetDB(db int64) {
+	cmd._db = &db
+}
+
+// Validate checks the number of arguments of cmd against the arity of
+// its command, if known, so that a malformed request is never sent.
+func (cmd *baseCmd) Validate() error {
+	if len(cmd._args) == 0 {
+		return errEmptyCommand
+	}
+	info, ok := lookupKeySpec(cmd._args, cmd.Name())
+	if !ok {
+		return nil
+	}
+	n := len(cmd._args)
+	if (info.Arity > 0 && n != info.Arity) || (info.Arity < 0 && n < -info.Arity) {
+		return errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd._args[0]))
+	}
+	return nil
+}
+
+// validCmds returns the valid ones of cmds, the others get their
+// validation error, the first of which is returned.
+func validCmds(cmds []Cmder) ([]Cmder, error) {
+	var firstErr error
+	valid := cmds[:0:0]
+	for _, cmd := range cmds {
+		if err := cmd.Validate(); err != nil {
+			cmd.setErr(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		valid = append(valid, cmd)
+	}
+	return valid, firstErr
+}
+
+// Addr returns the address of the node cmd is pinned to, "" if a
+// cluster client routes it by slot.
+func (cmd *baseCmd) Addr() string {
+	return cmd._addr
+}
+
+// SetAddr pins cmd to the node at addr, a cluster client sends it there
+// regardless of its keys and doesn't follow redirections. Clients of a
+// single node ignore it.
+func (cmd *baseCmd) SetAddr(addr string) {
+	cmd._addr = addr
+}
+
 func (cmd *baseCmd) readTimeout() *time.Duration {
 	return cmd._readTimeout
 }
@@ -105,17 +249,96 @@ func (cmd *baseCmd) writeTimeout() *time.Duration {
 	return cmd._writeTimeout
 }
 
+// clusterKey returns the key used for slot routing, the first one of
+// keyIndexes.
 func (cmd *baseCmd) clusterKey() string {
-	if cmd._clusterKeyPos > 0 && cmd._clusterKeyPos < len(cmd._args) {
-		return cmd._args[cmd._clusterKeyPos]
+	if indexes := cmd.keyIndexes(); len(indexes) > 0 {
+		return cmd._args[indexes[0]]
 	}
 	return ""
 }
 
+func (cmd *baseCmd) setClusterKeyPos(pos int) {
+	cmd._clusterKeyPos = pos
+}
+
+// clusterKeys returns all the keys of the command, they have to hash to the
+// same cluster slot.
+func (cmd *baseCmd) clusterKeys() []string {
+	indexes := cmd.keyIndexes()
+	if len(indexes) == 0 {
+		return nil
+	}
+	keys := make([]string, len(indexes))
+	for i, index := range indexes {
+		keys[i] = cmd._args[index]
+	}
+	return keys
+}
+
+// keyIndexes returns the indexes of the keys in the arguments, from
+// _keyIndexes if set, commandInfos if the command is listed there, else
+// _keyCount keys from _clusterKeyPos, or just the one there if _keyCount
+// is 0.
+func (cmd *baseCmd) keyIndexes() []int {
+	if cmd._keyIndexes != nil {
+		return cmd._keyIndexes
+	}
+	if info, ok := lookupKeySpec(cmd._args, cmd.Name()); ok {
+		return info.keyIndexes(cmd._args)
+	}
+	if cmd._clusterKeyPos <= 0 || cmd._clusterKeyPos >= len(cmd._args) {
+		return nil
+	}
+	if cmd._keyCount == 0 {
+		return []int{cmd._clusterKeyPos}
+	}
+	end := cmd._clusterKeyPos + cmd._keyCount
+	if end > len(cmd._args) {
+		end = len(cmd._args)
+	}
+	indexes := make([]int, 0, end-cmd._clusterKeyPos)
+	for i := cmd._clusterKeyPos; i < end; i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// IsReadOnly reports whether the command only reads, so it can be sent
+// to a replica. It is from the readonly flag in commandInfos, commands
+// not listed there are taken as writes.
+func (cmd *baseCmd) IsReadOnly() bool {
+	info, ok := lookupKeySpec(cmd._args, cmd.Name())
+	return ok && info.hasFlag("readonly")
+}
+
+// setBlockingReadTimeout sets the read timeout of a blocking command
+// from its last argument, the server side timeout in seconds. Zero
+// blocks forever, so reads get no deadline.
+func (cmd *baseCmd) setBlockingReadTimeout() {
+	sec, err := strconv.ParseFloat(cmd._args[len(cmd._args)-1], 64)
+	if err != nil || sec < 0 {
+		// Redis rejects the command right away.
+		return
+	}
+	cmd.setReadTimeout(readTimeout(time.Duration(sec * float64(time.Second))))
+}
+
 func (cmd *baseCmd) setWriteTimeout(d time.Duration) {
 	cmd._writeTimeout = &d
 }
 
+// setTimeouts sets both timeouts, nil for the client defaults.
+func (cmd *baseCmd) setTimeouts(rd, wr *time.Duration) {
+	cmd._readTimeout, cmd._writeTimeout = rd, wr
+}
+
+// resetTimeouts drops the timeouts, a reused command must not inherit
+// the deadline of a blocking command it was before.
+func (cmd *baseCmd) resetTimeouts() {
+	cmd.setTimeouts(nil, nil)
+}
+
 func (cmd *baseCmd) setErr(e error) {
 	cmd.err = e
 }
@@ -132,9 +355,42 @@ func NewCmd(args ...string) *Cmd {
 	return &Cmd{baseCmd: baseCmd{_args: args}}
 }
 
+// NewScriptLoadCmd returns SCRIPT LOAD of script, its reply is the sha1
+// digest for EVALSHA.
+func NewScriptLoadCmd(script string) *StringCmd {
+	cmd := NewStringCmd("SCRIPT", "LOAD", script)
+	cmd._clusterKeyPos = 0
+	return cmd
+}
+
+// NewEvalCmd returns EVAL of script, routed by its keys.
+func NewEvalCmd(script string, keys []string, args []string) *Cmd {
+	return newScriptCmd("EVAL", script, keys, args)
+}
+
+// NewEvalShaCmd returns EVALSHA of the script with the sha1 digest,
+// routed by its keys.
+func NewEvalShaCmd(sha string, keys []string, args []string) *Cmd {
+	return newScriptCmd("EVALSHA", sha, keys, args)
+}
+
+func newScriptCmd(name, script string, keys []string, args []string) *Cmd {
+	cmdArgs := make([]string, 0, 3+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, name, script, strconv.Itoa(len(keys)))
+	cmdArgs = append(cmdArgs, keys...)
+	cmdArgs = append(cmdArgs, args...)
+	cmd := NewCmd(cmdArgs...)
+	if len(keys) > 0 {
+		cmd._clusterKeyPos = 3
+		cmd._keyCount = len(keys)
+	}
+	return cmd
+}
+
 func (cmd *Cmd) reset() {
 	cmd.val = nil
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
 func (cmd *Cmd) Val() interface{} {
@@ -149,14 +405,20 @@ func (cmd *Cmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *Cmd) parseReply(rd *bufio.Reader) error {
+func (cmd *Cmd) parseReply(rd *reader) error {
 	cmd.val, cmd.err = parseReply(rd, parseSlice)
 	return cmd.err
 }
 
+// Reply formats the value the way formatSlice formats an element, a
+// status reply is replied as a bulk string.
 func (cmd *Cmd) Reply() []byte {
-
-	return nil
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	b := bytes.Buffer{}
+	formatValue(&b, cmd.val)
+	return b.Bytes()
 }
 
 //------------------------------------------------------------------------------
@@ -174,6 +436,18 @@ func NewSliceCmd(args ...string) *SliceCmd {
 func (cmd *SliceCmd) reset() {
 	cmd.val = nil
 	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Len returns the number of elements in the reply, 0 for a nil reply.
+func (cmd *SliceCmd) Len() int {
+	return len(cmd.val)
+}
+
+// IsEmpty reports whether the reply holds no elements, which is true for
+// both an empty and a nil reply.
+func (cmd *SliceCmd) IsEmpty() bool {
+	return len(cmd.val) == 0
 }
 
 func (cmd *SliceCmd) Val() []interface{} {
@@ -188,26 +462,24 @@ func (cmd *SliceCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *SliceCmd) parseReply(rd *bufio.Reader) error {
+func (cmd *SliceCmd) parseReply(rd *reader) error {
 	v, err := parseReply(rd, parseSlice)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.([]interface{})
+	val, ok := v.([]interface{})
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
 	return nil
 }
 
 func (cmd *SliceCmd) Reply() []byte {
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
-
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
 	}
 	// [nice.com 80 <nil> 1.2]
 	return FormatSlice(cmd.Val())
@@ -215,51 +487,73 @@ func (cmd *SliceCmd) Reply() []byte {
 
 func FormatSlice(val []interface{}) []byte {
 	b := bytes.Buffer{}
+	formatSlice(&b, val)
+	return b.Bytes()
+}
+
+// unformattable is called with a value formatSlice can't write, which
+// is then replied as nil. The tests replace it to fail on such values.
+var unformattable = func(v interface{}) {
+	log.Errorf("redis: can't format %T in a multi bulk reply, replied as nil", v)
+}
+
+// formatSlice writes val as a multi bulk reply to b, integers are written
+// as integer replies and nested slices as nested multi bulk replies, the
+// way parseSlice reads them. parseSlice only returns these types, any
+// other is a bug of the command building val; failing mid-reply would
+// corrupt it, so the value is written as nil.
+func formatSlice(b *bytes.Buffer, val []interface{}) {
 	b.WriteByte('*')
 	b.WriteString(util.Itoa(len(val)))
 	b.WriteString("\r\n")
 	for _, v := range val {
-		if v == nil {
-			b.WriteString("$-1\r\n")
-			continue
-		}
-		switch v.(type) {
-		case int:
-			d := formatInt(int64(v.(int)))
-			b.WriteByte('$')
-			b.WriteString(util.Itoa(len(d)))
-			b.WriteString("\r\n")
-			b.WriteString(d)
-			b.WriteString("\r\n")
-		case int64:
-			d := formatInt(v.(int64))
-			b.WriteByte('$')
-			b.WriteString(util.Itoa(len(d)))
-			b.WriteString("\r\n")
-			b.WriteString(d)
-			b.WriteString("\r\n")
-		case string:
-			d := v.(string)
-			b.WriteByte('$')
-			b.WriteString(util.Itoa(len(d)))
-			b.WriteString("\r\n")
-			b.WriteString(d)
-			b.WriteString("\r\n")
-		case float64:
-			d := formatFloat(v.(float64))
-			b.WriteByte('$')
-			b.WriteString(util.Itoa(len(d)))
-			b.WriteString("\r\n")
-			b.WriteString(d)
-			b.WriteString("\r\n")
-		default:
-			log.Warningf("got %T , expected string or int or float ", v)
-			d := fmt.Sprintf("-%s\r\n", TypeAssertedErr.Error())
-			return []byte(d)
-		}
+		formatValue(b, v)
 	}
-	return b.Bytes()
+}
 
+// formatValue writes v, an element of a multi bulk reply, to b.
+func formatValue(b *bytes.Buffer, v interface{}) {
+	if v == nil {
+		b.WriteString("$-1\r\n")
+		return
+	}
+	switch v.(type) {
+	case int:
+		b.WriteByte(':')
+		b.WriteString(formatInt(int64(v.(int))))
+		b.WriteString("\r\n")
+	case int64:
+		b.WriteByte(':')
+		b.WriteString(formatInt(v.(int64)))
+		b.WriteString("\r\n")
+	case uint64:
+		// Bulk string, it may not fit an integer reply.
+		d := formatUint(v.(uint64))
+		b.WriteByte('$')
+		b.WriteString(util.Itoa(len(d)))
+		b.WriteString("\r\n")
+		b.WriteString(d)
+		b.WriteString("\r\n")
+	case string:
+		d := v.(string)
+		b.WriteByte('$')
+		b.WriteString(util.Itoa(len(d)))
+		b.WriteString("\r\n")
+		b.WriteString(d)
+		b.WriteString("\r\n")
+	case float64:
+		d := formatFloat(v.(float64))
+		b.WriteByte('$')
+		b.WriteString(util.Itoa(len(d)))
+		b.WriteString("\r\n")
+		b.WriteString(d)
+		b.WriteString("\r\n")
+	case []interface{}:
+		formatSlice(b, v.([]interface{}))
+	default:
+		unformattable(v)
+		b.WriteString("$-1\r\n")
+	}
 }
 
 //------------------------------------------------------------------------------
@@ -278,9 +572,129 @@ func newKeylessStatusCmd(args ...string) *StatusCmd {
 	return &StatusCmd{baseCmd: baseCmd{_args: args}}
 }
 
+// NewFailoverCmd returns a FAILOVER of a standalone master to one of
+// its replicas, args are its options like "TO", host, port and "FORCE".
+func NewFailoverCmd(args ...string) *StatusCmd {
+	return newKeylessStatusCmd(append([]string{"FAILOVER"}, args...)...)
+}
+
+// NewClusterFailoverCmd returns a CLUSTER FAILOVER, to be pinned with
+// SetAddr to the replica taking over. With force the replica doesn't
+// wait for its master to agree.
+func NewClusterFailoverCmd(force bool) *StatusCmd {
+	if force {
+		return newKeylessStatusCmd("CLUSTER", "FAILOVER", "FORCE")
+	}
+	return newKeylessStatusCmd("CLUSTER", "FAILOVER")
+}
+
+// NewClusterTakeoverCmd returns a CLUSTER FAILOVER TAKEOVER, the replica
+// takes over without the agreement of the other masters either.
+func NewClusterTakeoverCmd() *StatusCmd {
+	return newKeylessStatusCmd("CLUSTER", "FAILOVER", "TAKEOVER")
+}
+
+// NewHMSetCmd is HMSET key field value [field value ...], like
+// NewHSetCmd with an OK reply.
+func NewHMSetCmd(key string, fv ...string) *StatusCmd {
+	args, err := hashPairs("HMSET", key, fv)
+	cmd := NewStatusCmd(args...)
+	if err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// NewHMSetMapCmd is NewHMSetCmd with the fields and values of fields.
+func NewHMSetMapCmd(key string, fields map[string]string) *StatusCmd {
+	return NewHMSetCmd(key, mapPairs(fields)...)
+}
+
+// NewPFMergeCmd is PFMERGE destkey [sourcekey ...]. Like NewPFCountCmd,
+// all the keys must be in the same slot.
+func NewPFMergeCmd(dest string, sources ...string) *StatusCmd {
+	return &StatusCmd{baseCmd: baseCmd{
+		_args:          append([]string{"PFMERGE", dest}, sources...),
+		_clusterKeyPos: 1,
+		_keyCount:      1 + len(sources),
+	}}
+}
+
+// NewRenameCmd is RENAME key newkey. Like NewRenameNXCmd, both keys
+// must be in the same slot.
+func NewRenameCmd(key, newkey string) *StatusCmd {
+	return &StatusCmd{baseCmd: baseCmd{
+		_args:          []string{"RENAME", key, newkey},
+		_clusterKeyPos: 1,
+		_keyCount:      2,
+	}}
+}
+
+func NewAuthCmd(password string) *StatusCmd {
+	return newKeylessStatusCmd("AUTH", password)
+}
+
+func NewSelectCmd(db int) *StatusCmd {
+	return newKeylessStatusCmd("SELECT", strconv.Itoa(db))
+}
+
+// NewResetCmd is RESET, replied with +RESET. The server leaves MULTI and
+// any subscription, selects db 0 and drops the authentication, the
+// client sets the connection up again with its options.
+func NewResetCmd() *StatusCmd {
+	return newKeylessStatusCmd("RESET")
+}
+
+// NewClientNoEvictCmd is CLIENT NO-EVICT ON|OFF, which excludes the
+// connection it is sent on from client eviction under maxmemory-clients.
+// It is keyless and sets only the connection it goes through, use
+// Options.NoEvict to set every connection of a client. A mode other
+// than ON or OFF sets the error of the command, which must not be
+// processed then.
+func NewClientNoEvictCmd(mode string) *StatusCmd {
+	return newClientModeCmd("NO-EVICT", mode)
+}
+
+// NewClientNoTouchCmd is CLIENT NO-TOUCH ON|OFF, commands sent on the
+// connection then leave the LRU/LFU of the keys as is. Like
+// NewClientNoEvictCmd it sets only its connection, see Options.NoTouch.
+func NewClientNoTouchCmd(mode string) *StatusCmd {
+	return newClientModeCmd("NO-TOUCH", mode)
+}
+
+func newClientModeCmd(subcommand, mode string) *StatusCmd {
+	mode = strings.ToUpper(mode)
+	cmd := newKeylessStatusCmd("CLIENT", subcommand, mode)
+	if mode != "ON" && mode != "OFF" {
+		cmd.setErr(errSetSyntax)
+	}
+	return cmd
+}
+
+// NewTypeCmd is TYPE key. The type is a status reply like +string or
+// +none, and is replied as one whatever framing the server used.
+func NewTypeCmd(key string) *StatusCmd {
+	return NewStatusCmd("TYPE", key)
+}
+
+// NewRestoreCmd is RESTORE key ttl payload [REPLACE], ttl is in
+// milliseconds, 0 for no expire. payload is the reply of DUMP.
+func NewRestoreCmd(key string, ttl int64, payload []byte, replace bool) *StatusCmd {
+	args := []string{"RESTORE", key, formatInt(ttl), string(payload)}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	return NewStatusCmd(args...)
+}
+
+func NewPingCmd() *StatusCmd {
+	return newKeylessStatusCmd("PING")
+}
+
 func (cmd *StatusCmd) reset() {
 	cmd.val = ""
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
 func (cmd *StatusCmd) Val() string {
@@ -295,30 +709,35 @@ func (cmd *StatusCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *StatusCmd) parseReply(rd *bufio.Reader) error {
+func (cmd *StatusCmd) parseReply(rd *reader) error {
 	v, err := parseReply(rd, nil)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.(string)
+	val, ok := v.(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
 	return nil
 }
 
 func (cmd *StatusCmd) Reply() []byte {
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
 	}
 	return FormatStatus(cmd.Val())
 }
 
+// FormatStatus formats val as a status reply. A status can't hold CR or
+// LF, such a val, e.g. a bulk reply read by a StatusCmd, is formatted as
+// a bulk string so its bytes round-trip.
 func FormatStatus(val string) []byte {
+	if strings.ContainsAny(val, "\r\n") {
+		return FormatString(val)
+	}
 	b := bytes.Buffer{}
 	b.WriteString("+")
 	b.WriteString(val)
@@ -338,9 +757,146 @@ func NewIntCmd(args ...string) *IntCmd {
 	return &IntCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
 }
 
+// NewBitCountCmd is BITCOUNT key [start end [BYTE|BIT]]. The range is
+// left out unless both start and end are given, unit is BYTE or BIT and
+// only sent with a range, "" for the server default.
+func NewBitCountCmd(key string, start, end *int64, unit string) *IntCmd {
+	args := []string{"BITCOUNT", key}
+	if start != nil && end != nil {
+		args = append(args, formatInt(*start), formatInt(*end))
+		if unit != "" {
+			args = append(args, strings.ToUpper(unit))
+		}
+	}
+	return NewIntCmd(args...)
+}
+
+// NewBitPosCmd is BITPOS key bit [start [end [BYTE|BIT]]]. end is only
+// sent with start and unit with both, "" for the server default. The
+// reply is the position of the first bit set to bit, -1 if there is
+// none.
+func NewBitPosCmd(key string, bit int64, start, end *int64, unit string) *IntCmd {
+	args := []string{"BITPOS", key, formatInt(bit)}
+	if start != nil {
+		args = append(args, formatInt(*start))
+		if end != nil {
+			args = append(args, formatInt(*end))
+			if unit != "" {
+				args = append(args, strings.ToUpper(unit))
+			}
+		}
+	}
+	return NewIntCmd(args...)
+}
+
+// checkHashPairs checks the arguments of HSET or HMSET, the command
+// name and key followed by field and value pairs.
+func checkHashPairs(args []string) error {
+	if len(args) < 4 || len(args)%2 != 0 {
+		return errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0]))
+	}
+	return nil
+}
+
+// hashPairs returns name key field value..., with an error if fv is
+// not made of field and value pairs.
+func hashPairs(name, key string, fv []string) ([]string, error) {
+	args := append([]string{name, key}, fv...)
+	return args, checkHashPairs(args)
+}
+
+// mapPairs returns the fields of m and their values, sorted by field so
+// the same map always makes the same command.
+func mapPairs(m map[string]string) []string {
+	fields := make([]string, 0, len(m))
+	for f := range m {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	fv := make([]string, 0, 2*len(fields))
+	for _, f := range fields {
+		fv = append(fv, f, m[f])
+	}
+	return fv
+}
+
+// NewHSetCmd is HSET key field value [field value ...], the reply is the
+// number of fields added. fv not made of field and value pairs sets the
+// error of the command, which must not be processed then.
+func NewHSetCmd(key string, fv ...string) *IntCmd {
+	args, err := hashPairs("HSET", key, fv)
+	cmd := NewIntCmd(args...)
+	if err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// NewHSetMapCmd is NewHSetCmd with the fields and values of fields.
+func NewHSetMapCmd(key string, fields map[string]string) *IntCmd {
+	return NewHSetCmd(key, mapPairs(fields)...)
+}
+
+// NewUnlinkCmd is UNLINK key [key ...], the number of keys removed.
+// Unlike DEL the values are freed in the background. The keys must be
+// in the same slot, ClusterClient.Unlink splits them by slot instead.
+func NewUnlinkCmd(keys ...string) *IntCmd {
+	return newMultiKeyIntCmd("UNLINK", keys)
+}
+
+// NewTouchCmd is TOUCH key [key ...], the number of keys which exist,
+// their last access time is updated. Like NewUnlinkCmd, see
+// ClusterClient.Touch for keys in several slots.
+func NewTouchCmd(keys ...string) *IntCmd {
+	return newMultiKeyIntCmd("TOUCH", keys)
+}
+
+func newMultiKeyIntCmd(name string, keys []string) *IntCmd {
+	return &IntCmd{baseCmd: baseCmd{
+		_args:          append([]string{name}, keys...),
+		_clusterKeyPos: 1,
+		_keyCount:      len(keys),
+	}}
+}
+
+// NewPFCountCmd is PFCOUNT key [key ...], the estimated cardinality of
+// the union of the keys. The keys must be in the same slot, a cluster
+// client fails it with ErrCrossSlot otherwise.
+func NewPFCountCmd(keys ...string) *IntCmd {
+	return &IntCmd{baseCmd: baseCmd{
+		_args:          append([]string{"PFCOUNT"}, keys...),
+		_clusterKeyPos: 1,
+		_keyCount:      len(keys),
+	}}
+}
+
+// NewMemoryUsageCmd is MEMORY USAGE key [SAMPLES count], the reply is nil
+// for a missing key.
+func NewMemoryUsageCmd(key string, samples ...int) *IntCmd {
+	args := []string{"MEMORY", "USAGE", key}
+	if len(samples) > 0 {
+		args = append(args, "SAMPLES", strconv.Itoa(samples[0]))
+	}
+	return &IntCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 2}}
+}
+
+// NewWaitCmd blocks until numReplicas replicas acknowledged the writes
+// of the connection, or timeout elapsed. Its read timeout leaves room
+// for the server side wait, a zero timeout waits forever.
+func NewWaitCmd(numReplicas int, timeout time.Duration) *IntCmd {
+	cmd := &IntCmd{baseCmd: baseCmd{_args: []string{
+		"WAIT",
+		strconv.Itoa(numReplicas),
+		formatMs(timeout),
+	}}}
+	cmd.setReadTimeout(readTimeout(timeout))
+	return cmd
+}
+
 func (cmd *IntCmd) reset() {
 	cmd.val = 0
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
 func (cmd *IntCmd) Val() int64 {
@@ -355,26 +911,24 @@ func (cmd *IntCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *IntCmd) parseReply(rd *bufio.Reader) error {
+func (cmd *IntCmd) parseReply(rd *reader) error {
 	v, err := parseReply(rd, nil)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.(int64)
+	val, ok := v.(int64)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
 	return nil
 }
 
 func (cmd *IntCmd) Reply() []byte {
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
-
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
 	}
 	return FormatInt(cmd.Val())
 }
@@ -389,88 +943,260 @@ func FormatInt(val int64) []byte {
 
 //------------------------------------------------------------------------------
 
-type DurationCmd struct {
+// Uint64Cmd is an IntCmd for values which may exceed math.MaxInt64.
+type Uint64Cmd struct {
 	baseCmd
 
-	val       time.Duration
-	precision time.Duration
+	val uint64
 }
 
-func NewDurationCmd(precision time.Duration, args ...string) *DurationCmd {
-	return &DurationCmd{
-		precision: precision,
-		baseCmd:   baseCmd{_args: args, _clusterKeyPos: 1},
-	}
+func NewUint64Cmd(args ...string) *Uint64Cmd {
+	return &Uint64Cmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
 }
 
-func (cmd *DurationCmd) reset() {
+func (cmd *Uint64Cmd) reset() {
 	cmd.val = 0
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
-func (cmd *DurationCmd) Val() time.Duration {
+func (cmd *Uint64Cmd) Val() uint64 {
 	return cmd.val
 }
 
-func (cmd *DurationCmd) Result() (time.Duration, error) {
+func (cmd *Uint64Cmd) Result() (uint64, error) {
 	return cmd.val, cmd.err
 }
 
-func (cmd *DurationCmd) String() string {
+func (cmd *Uint64Cmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *DurationCmd) parseReply(rd *bufio.Reader) error {
-	v, err := parseReply(rd, nil)
+func (cmd *Uint64Cmd) parseReply(rd *reader) error {
+	v, err := parseUintReply(rd)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = time.Duration(v.(int64)) * cmd.precision
+	cmd.val = v
 	return nil
 }
 
-func (cmd *DurationCmd) Reply() []byte {
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
-
+func (cmd *Uint64Cmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
 	}
-	return FormatDuration(cmd.Val(), cmd.precision)
+	return FormatUint(cmd.Val())
 }
 
-func FormatDuration(val time.Duration, pre time.Duration) []byte {
+func FormatUint(val uint64) []byte {
 	b := bytes.Buffer{}
 	b.WriteByte(':')
-	if pre == time.Millisecond {
-		b.WriteString(formatMs(val))
-	} else {
-		b.WriteString(formatSec(val))
-	}
+	b.WriteString(formatUint(val))
 	b.WriteString("\r\n")
 	return b.Bytes()
 }
 
 //------------------------------------------------------------------------------
 
-type BoolCmd struct {
+type DurationCmd struct {
 	baseCmd
 
-	val bool
+	val       time.Duration
+	precision time.Duration
 }
 
-func NewBoolCmd(args ...string) *BoolCmd {
-	return &BoolCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+// NewDurationCmd returns a command replying an integer in units of
+// precision, which must be time.Second (TTL, OBJECT IDLETIME) or
+// time.Millisecond (PTTL). Redis has no other resolutions.
+func NewDurationCmd(precision time.Duration, args ...string) *DurationCmd {
+	if !validPrecision(precision) {
+		panic(fmt.Sprintf("redis: unsupported duration precision %s", precision))
+	}
+	return &DurationCmd{
+		precision: precision,
+		baseCmd:   baseCmd{_args: args, _clusterKeyPos: 1},
+	}
 }
 
-func (cmd *BoolCmd) reset() {
-	cmd.val = false
-	cmd.err = nil
+// checkExpireFlag checks flag is one of the conditions of the EXPIRE
+// family, NX, XX, GT or LT, or empty for none, and returns it upper
+// cased.
+func checkExpireFlag(flag string) (string, error) {
+	switch f := strings.ToUpper(flag); f {
+	case "", "NX", "XX", "GT", "LT":
+		return f, nil
+	}
+	return "", errorf("ERR Unsupported option %s", flag)
+}
+
+func newExpireCmd(name, key string, n int64, flag string) *BoolCmd {
+	cmd := NewBoolCmd(name, key, strconv.FormatInt(n, 10))
+	f, err := checkExpireFlag(flag)
+	if err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	if f != "" {
+		cmd._args = append(cmd._args, f)
+	}
+	return cmd
+}
+
+// NewExpireCmd is EXPIRE key seconds [NX|XX|GT|LT], flag is empty for
+// none. The reply is true if the timeout was set. An invalid flag sets
+// the error of the command, which must not be processed then.
+func NewExpireCmd(key string, seconds int64, flag string) *BoolCmd {
+	return newExpireCmd("EXPIRE", key, seconds, flag)
+}
+
+// NewPExpireCmd is PEXPIRE, like NewExpireCmd in milliseconds.
+func NewPExpireCmd(key string, milliseconds int64, flag string) *BoolCmd {
+	return newExpireCmd("PEXPIRE", key, milliseconds, flag)
+}
+
+// NewExpireAtCmd is EXPIREAT, like NewExpireCmd with a unix time in
+// seconds.
+func NewExpireAtCmd(key string, unixTime int64, flag string) *BoolCmd {
+	return newExpireCmd("EXPIREAT", key, unixTime, flag)
+}
+
+// NewPExpireAtCmd is PEXPIREAT, like NewExpireCmd with a unix time in
+// milliseconds.
+func NewPExpireAtCmd(key string, unixTimeMs int64, flag string) *BoolCmd {
+	return newExpireCmd("PEXPIREAT", key, unixTimeMs, flag)
+}
+
+// NewTTLCmd is TTL key, in seconds.
+func NewTTLCmd(key string) *DurationCmd {
+	return NewDurationCmd(time.Second, "TTL", key)
+}
+
+// NewPTTLCmd is PTTL key, in milliseconds.
+func NewPTTLCmd(key string) *DurationCmd {
+	return NewDurationCmd(time.Millisecond, "PTTL", key)
+}
+
+// The negative replies of TTL and PTTL, which DurationCmd keeps as is
+// instead of scaling them by the precision.
+const (
+	// TTLNoExpire is the TTL of a key without an expire.
+	TTLNoExpire time.Duration = -1
+	// TTLNoKey is the TTL of a missing key.
+	TTLNoKey time.Duration = -2
+)
+
+func (cmd *DurationCmd) reset() {
+	cmd.val = 0
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *DurationCmd) Val() time.Duration {
+	return cmd.val
+}
+
+func (cmd *DurationCmd) Result() (time.Duration, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *DurationCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *DurationCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, nil)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	if n < 0 {
+		cmd.val = time.Duration(n)
+		return nil
+	}
+	cmd.val = time.Duration(n) * cmd.precision
+	return nil
+}
+
+func (cmd *DurationCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if cmd.val < 0 {
+		return FormatInt(int64(cmd.val))
+	}
+	return FormatDuration(cmd.Val(), cmd.precision)
+}
+
+func validPrecision(pre time.Duration) bool {
+	return pre == time.Second || pre == time.Millisecond
+}
+
+func FormatDuration(val time.Duration, pre time.Duration) []byte {
+	b := bytes.Buffer{}
+	b.WriteByte(':')
+	switch pre {
+	case time.Millisecond:
+		b.WriteString(formatMs(val))
+	case time.Second:
+		b.WriteString(formatSec(val))
+	default:
+		panic(fmt.Sprintf("redis: unsupported duration precision %s", pre))
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+//------------------------------------------------------------------------------
+
+type BoolCmd struct {
+	baseCmd
+
+	val bool
+	// The protocol version of the client the reply goes to.
+	proto int
+}
+
+func NewBoolCmd(args ...string) *BoolCmd {
+	return &BoolCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+// NewRenameNXCmd is RENAMENX key newkey, true if key was renamed. Both
+// keys must be in the same slot, a cluster client fails it with
+// ErrCrossSlot otherwise.
+func NewRenameNXCmd(key, newkey string) *BoolCmd {
+	return &BoolCmd{baseCmd: baseCmd{
+		_args:          []string{"RENAMENX", key, newkey},
+		_clusterKeyPos: 1,
+		_keyCount:      2,
+	}}
+}
+
+// NewPFAddCmd is PFADD key [element ...], true if the estimated
+// cardinality changed.
+func NewPFAddCmd(key string, elements ...string) *BoolCmd {
+	return NewBoolCmd(append([]string{"PFADD", key}, elements...)...)
+}
+
+// NewSMoveCmd is SMOVE source destination member, true if member was
+// moved. Like NewRenameNXCmd, both keys must be in the same slot.
+func NewSMoveCmd(source, destination, member string) *BoolCmd {
+	return &BoolCmd{baseCmd: baseCmd{
+		_args:          []string{"SMOVE", source, destination, member},
+		_clusterKeyPos: 1,
+		_keyCount:      2,
+	}}
+}
+
+func (cmd *BoolCmd) reset() {
+	cmd.val = false
+	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
 func (cmd *BoolCmd) Val() bool {
@@ -481,11 +1207,17 @@ func (cmd *BoolCmd) Result() (bool, error) {
 	return cmd.val, cmd.err
 }
 
+// SetProto sets the protocol version negotiated by the client the reply
+// goes to. RESP3 clients get a boolean reply, others an integer one.
+func (cmd *BoolCmd) SetProto(proto int) {
+	cmd.proto = proto
+}
+
 func (cmd *BoolCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *BoolCmd) parseReply(rd *bufio.Reader) error {
+func (cmd *BoolCmd) parseReply(rd *reader) error {
 	v, err := parseReply(rd, nil)
 	// `SET key value NX` returns nil when key already exists.
 	if err == Nil {
@@ -504,19 +1236,16 @@ func (cmd *BoolCmd) parseReply(rd *bufio.Reader) error {
 		cmd.val = vv == "OK"
 		return nil
 	default:
-		return fmt.Errorf("got %T, wanted int64 or string")
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
 	}
 }
 func (cmd *BoolCmd) Reply() []byte {
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
-
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if cmd.proto > 2 {
+		return FormatResp3Bool(cmd.Val())
 	}
 	return FormatBool(cmd.Val())
 }
@@ -533,6 +1262,14 @@ func FormatBool(val bool) []byte {
 	return b.Bytes()
 }
 
+// FormatResp3Bool formats val as a RESP3 boolean, #t or #f.
+func FormatResp3Bool(val bool) []byte {
+	if val {
+		return []byte("#t\r\n")
+	}
+	return []byte("#f\r\n")
+}
+
 //------------------------------------------------------------------------------
 
 type StringCmd struct {
@@ -545,9 +1282,132 @@ func NewStringCmd(args ...string) *StringCmd {
 	return &StringCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
 }
 
+func NewBRPopLPushCmd(source, destination string, timeout time.Duration) *StringCmd {
+	cmd := NewStringCmd("BRPOPLPUSH", source, destination, formatSec(timeout))
+	cmd.setBlockingReadTimeout()
+	return cmd
+}
+
+func NewBLMoveCmd(source, destination, srcpos, destpos string, timeout time.Duration) *StringCmd {
+	cmd := NewStringCmd("BLMOVE", source, destination, srcpos, destpos, formatSec(timeout))
+	cmd.setBlockingReadTimeout()
+	return cmd
+}
+
+// NewDumpCmd is DUMP key, the reply is the serialized value, which is
+// binary, read it with Bytes.
+func NewDumpCmd(key string) *StringCmd {
+	return NewStringCmd("DUMP", key)
+}
+
+// NewHRandFieldCmd is HRANDFIELD key, the reply is a random field, Nil
+// if key doesn't exist.
+func NewHRandFieldCmd(key string) *StringCmd {
+	return NewStringCmd("HRANDFIELD", key)
+}
+
+// NewHRandFieldCountCmd is HRANDFIELD key count. A positive count gets
+// distinct fields, a negative one -count fields maybe repeated.
+func NewHRandFieldCountCmd(key string, count int64) *StringSliceCmd {
+	return NewStringSliceCmd("HRANDFIELD", key, strconv.FormatInt(count, 10))
+}
+
+// NewHRandFieldWithValuesCmd is HRANDFIELD key count WITHVALUES, the
+// fields with their values.
+func NewHRandFieldWithValuesCmd(key string, count int64) *KeyValueSliceCmd {
+	return NewKeyValueSliceCmd("HRANDFIELD", key, strconv.FormatInt(count, 10), "WITHVALUES")
+}
+
+// NewSRandMemberCmd is SRANDMEMBER key, the reply is a random member,
+// Nil if key doesn't exist.
+func NewSRandMemberCmd(key string) *StringCmd {
+	return NewStringCmd("SRANDMEMBER", key)
+}
+
+// NewSRandMemberCountCmd is SRANDMEMBER key count, count is like for
+// NewHRandFieldCountCmd.
+func NewSRandMemberCountCmd(key string, count int64) *StringSliceCmd {
+	return NewStringSliceCmd("SRANDMEMBER", key, strconv.FormatInt(count, 10))
+}
+
+// NewZRandMemberCmd is ZRANDMEMBER key, the reply is a random member,
+// Nil if key doesn't exist.
+func NewZRandMemberCmd(key string) *StringCmd {
+	return NewStringCmd("ZRANDMEMBER", key)
+}
+
+// NewZRandMemberCountCmd is ZRANDMEMBER key count, count is like for
+// NewHRandFieldCountCmd.
+func NewZRandMemberCountCmd(key string, count int64) *StringSliceCmd {
+	return NewStringSliceCmd("ZRANDMEMBER", key, strconv.FormatInt(count, 10))
+}
+
+// NewZRandMemberWithScoresCmd is ZRANDMEMBER key count WITHSCORES, the
+// members with their scores.
+func NewZRandMemberWithScoresCmd(key string, count int64) *KeyValueSliceCmd {
+	return NewKeyValueSliceCmd("ZRANDMEMBER", key, strconv.FormatInt(count, 10), "WITHSCORES")
+}
+
+// NewCopyCmd is COPY source destination [DB db] [REPLACE], db is nil
+// for the current one. The reply is true if source was copied. Both keys
+// have to be in the same cluster slot.
+func NewCopyCmd(source, destination string, db *int, replace bool) *BoolCmd {
+	args := []string{"COPY", source, destination}
+	if db != nil {
+		args = append(args, "DB", strconv.Itoa(*db))
+	}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	return NewBoolCmd(args...)
+}
+
+// NewAppendCmd is APPEND key value, the reply is the new length.
+func NewAppendCmd(key, value string) *IntCmd {
+	return NewIntCmd("APPEND", key, value)
+}
+
+// NewGetSetCmd is GETSET key value, the reply is the old value. A key
+// which didn't exist sets Nil and is replied as $-1.
+func NewGetSetCmd(key, value string) *StringCmd {
+	return NewStringCmd("GETSET", key, value)
+}
+
+// NewGetDelCmd is GETDEL key, the reply is the value the key had before
+// it was deleted. A key which didn't exist sets Nil and is replied as
+// $-1.
+func NewGetDelCmd(key string) *StringCmd {
+	return NewStringCmd("GETDEL", key)
+}
+
+// NewGetExCmd is GETEX key [EX seconds|PX ms|EXAT time|PXAT time|PERSIST],
+// the reply is the value like GET. Options which are invalid or
+// exclusive set the error of the command, which must not be processed
+// then.
+func NewGetExCmd(key string, options ...string) *StringCmd {
+	cmd := NewStringCmd(append([]string{"GETEX", key}, options...)...)
+	if err := parseGetExArgs(options); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// NewSetRangeCmd is SETRANGE key offset value, the reply is the new
+// length.
+func NewSetRangeCmd(key string, offset int64, value string) *IntCmd {
+	return NewIntCmd("SETRANGE", key, strconv.FormatInt(offset, 10), value)
+}
+
+// NewPingMsgCmd is PING with a message, Redis echoes msg as a bulk
+// string.
+func NewPingMsgCmd(msg string) *StringCmd {
+	return &StringCmd{baseCmd: baseCmd{_args: []string{"PING", msg}}}
+}
+
 func (cmd *StringCmd) reset() {
 	cmd.val = ""
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
 func (cmd *StringCmd) Val() string {
@@ -558,6 +1418,24 @@ func (cmd *StringCmd) Result() (string, error) {
 	return cmd.val, cmd.err
 }
 
+// Bytes returns the value as a byte slice. Replies are parsed into a
+// string, so the returned slice is a copy the caller may modify. Bulk
+// replies are length framed, any bytes round trip unchanged.
+func (cmd *StringCmd) Bytes() ([]byte, error) {
+	if cmd.err != nil {
+		return nil, cmd.err
+	}
+	return []byte(cmd.val), nil
+}
+
+// Scan parses the value into dest, see scan for supported types.
+func (cmd *StringCmd) Scan(dest interface{}) error {
+	if cmd.err != nil {
+		return cmd.err
+	}
+	return scan(cmd.val, dest)
+}
+
 func (cmd *StringCmd) Int64() (int64, error) {
 	if cmd.err != nil {
 		return 0, cmd.err
@@ -583,27 +1461,24 @@ func (cmd *StringCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *StringCmd) parseReply(rd *bufio.Reader) error {
+func (cmd *StringCmd) parseReply(rd *reader) error {
 	v, err := parseReply(rd, nil)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.(string)
+	val, ok := v.(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
 	return nil
 }
 
 func (cmd *StringCmd) Reply() []byte {
-
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
-
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
 	}
 	return FormatString(cmd.Val())
 }
@@ -620,6 +1495,214 @@ func FormatString(val string) []byte {
 
 //------------------------------------------------------------------------------
 
+// SetOptions are the options of SET. At most one of the expiry forms
+// may be set, and not both NX and XX.
+type SetOptions struct {
+	// EX and PX are a timeout in seconds and milliseconds, ExAt and
+	// PxAt a unix time in seconds and milliseconds. Zero is unset.
+	EX   int64
+	PX   int64
+	ExAt int64
+	PxAt int64
+	// KeepTTL keeps the timeout of the key.
+	KeepTTL bool
+
+	NX bool
+	XX bool
+	// Get replies with the old value instead of OK.
+	Get bool
+}
+
+var (
+	errSetSyntax     = errorf("ERR syntax error")
+	errSetExpireTime = errorf("ERR invalid expire time in 'set' command")
+)
+
+func (opt *SetOptions) validate() error {
+	n := 0
+	for _, set := range []bool{opt.EX != 0, opt.PX != 0, opt.ExAt != 0, opt.PxAt != 0, opt.KeepTTL} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 || (opt.NX && opt.XX) {
+		return errSetSyntax
+	}
+	if opt.EX < 0 || opt.PX < 0 || opt.ExAt < 0 || opt.PxAt < 0 {
+		return errSetExpireTime
+	}
+	return nil
+}
+
+// args returns the options in the canonical order: expiry, condition
+// and GET.
+func (opt *SetOptions) args() []string {
+	var args []string
+	switch {
+	case opt.EX != 0:
+		args = append(args, "EX", strconv.FormatInt(opt.EX, 10))
+	case opt.PX != 0:
+		args = append(args, "PX", strconv.FormatInt(opt.PX, 10))
+	case opt.ExAt != 0:
+		args = append(args, "EXAT", strconv.FormatInt(opt.ExAt, 10))
+	case opt.PxAt != 0:
+		args = append(args, "PXAT", strconv.FormatInt(opt.PxAt, 10))
+	case opt.KeepTTL:
+		args = append(args, "KEEPTTL")
+	}
+	if opt.NX {
+		args = append(args, "NX")
+	} else if opt.XX {
+		args = append(args, "XX")
+	}
+	if opt.Get {
+		args = append(args, "GET")
+	}
+	return args
+}
+
+// parseSetArgs parses the options of SET, i.e. everything after SET key
+// value.
+func parseSetArgs(options []string) (SetOptions, error) {
+	var opt SetOptions
+	for i := 0; i < len(options); i++ {
+		var n *int64
+		switch strings.ToUpper(options[i]) {
+		case "EX":
+			n = &opt.EX
+		case "PX":
+			n = &opt.PX
+		case "EXAT":
+			n = &opt.ExAt
+		case "PXAT":
+			n = &opt.PxAt
+		case "KEEPTTL":
+			if opt.KeepTTL {
+				return opt, errSetSyntax
+			}
+			opt.KeepTTL = true
+		case "NX":
+			opt.NX = true
+		case "XX":
+			opt.XX = true
+		case "GET":
+			opt.Get = true
+		default:
+			return opt, errSetSyntax
+		}
+		if n == nil {
+			continue
+		}
+		if *n != 0 || i+1 >= len(options) {
+			return opt, errSetSyntax
+		}
+		v, err := strconv.ParseInt(options[i+1], 10, 64)
+		if err != nil {
+			return opt, errNotInteger
+		}
+		if v <= 0 {
+			return opt, errSetExpireTime
+		}
+		*n = v
+		i++
+	}
+	return opt, opt.validate()
+}
+
+// SetCmd is SET. The reply is OK, Nil if NX or XX kept the value from
+// being set. With GET it is the old value instead, Nil if the key didn't
+// exist, and it is replied as a bulk string.
+type SetCmd struct {
+	baseCmd
+
+	get bool
+	val string
+}
+
+// NewSetCmd is SET key value with opt in the canonical order. Invalid
+// options set the error of the command, which must not be processed
+// then.
+func NewSetCmd(key, value string, opt SetOptions) *SetCmd {
+	args := append([]string{"SET", key, value}, opt.args()...)
+	cmd := &SetCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}, get: opt.Get}
+	if err := opt.validate(); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// newRawSetCmd is SET with the arguments of a client, the reply is the
+// old value if GET is one of them.
+func newRawSetCmd(args ...string) *SetCmd {
+	cmd := &SetCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+	for i := 3; i < len(args); i++ {
+		if strings.ToUpper(args[i]) == "GET" {
+			cmd.get = true
+		}
+	}
+	return cmd
+}
+
+func (cmd *SetCmd) reset() {
+	cmd.val = ""
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *SetCmd) Val() string {
+	return cmd.val
+}
+
+func (cmd *SetCmd) Result() (string, error) {
+	return cmd.val, cmd.err
+}
+
+// IsGet reports whether the reply is the old value.
+func (cmd *SetCmd) IsGet() bool {
+	return cmd.get
+}
+
+func (cmd *SetCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SetCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, nil)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *SetCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if cmd.get {
+		return FormatString(cmd.val)
+	}
+	return FormatStatus(cmd.val)
+}
+
+// NewSetExCmd is SETEX key seconds value.
+func NewSetExCmd(key string, seconds int64, value string) *StatusCmd {
+	return NewStatusCmd("SETEX", key, strconv.FormatInt(seconds, 10), value)
+}
+
+// NewPSetExCmd is PSETEX key milliseconds value.
+func NewPSetExCmd(key string, milliseconds int64, value string) *StatusCmd {
+	return NewStatusCmd("PSETEX", key, strconv.FormatInt(milliseconds, 10), value)
+}
+
+//------------------------------------------------------------------------------
+
 type FloatCmd struct {
 	baseCmd
 
@@ -633,6 +1716,7 @@ func NewFloatCmd(args ...string) *FloatCmd {
 func (cmd *FloatCmd) reset() {
 	cmd.val = 0
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
 func (cmd *FloatCmd) Val() float64 {
@@ -643,25 +1727,23 @@ func (cmd *FloatCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *FloatCmd) parseReply(rd *bufio.Reader) error {
+func (cmd *FloatCmd) parseReply(rd *reader) error {
 	v, err := parseReply(rd, nil)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val, cmd.err = strconv.ParseFloat(v.(string), 64)
+	str, ok := v.(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val, cmd.err = strconv.ParseFloat(str, 64)
 	return cmd.err
 }
 func (cmd *FloatCmd) Reply() []byte {
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
-
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
 	}
 	return FormatFloat(cmd.Val())
 }
@@ -689,9 +1771,37 @@ func NewStringSliceCmd(args ...string) *StringSliceCmd {
 	return &StringSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
 }
 
+func newBlockingPopCmd(name string, timeout time.Duration, keys ...string) *StringSliceCmd {
+	args := append([]string{name}, keys...)
+	args = append(args, formatSec(timeout))
+	cmd := NewStringSliceCmd(args...)
+	cmd.setBlockingReadTimeout()
+	return cmd
+}
+
+func NewBLPopCmd(timeout time.Duration, keys ...string) *StringSliceCmd {
+	return newBlockingPopCmd("BLPOP", timeout, keys...)
+}
+
+func NewBRPopCmd(timeout time.Duration, keys ...string) *StringSliceCmd {
+	return newBlockingPopCmd("BRPOP", timeout, keys...)
+}
+
 func (cmd *StringSliceCmd) reset() {
 	cmd.val = nil
 	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Len returns the number of elements in the reply, 0 for a nil reply.
+func (cmd *StringSliceCmd) Len() int {
+	return len(cmd.val)
+}
+
+// IsEmpty reports whether the reply holds no elements, which is true for
+// both an empty and a nil reply.
+func (cmd *StringSliceCmd) IsEmpty() bool {
+	return len(cmd.val) == 0
 }
 
 func (cmd *StringSliceCmd) Val() []string {
@@ -706,26 +1816,24 @@ func (cmd *StringSliceCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *StringSliceCmd) parseReply(rd *bufio.Reader) error {
+func (cmd *StringSliceCmd) parseReply(rd *reader) error {
 	v, err := parseReply(rd, parseStringSlice)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.([]string)
-	return nil
+	val, ok := v.([]string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
 }
 
 func (cmd *StringSliceCmd) Reply() []byte {
-	err := cmd.Err()
-
-	if err != nil {
-		if err.Error() == "redis: nil" {
-			return []byte("$-1\r\n")
-		}
-		d := fmt.Sprintf("-%s\r\n", err.Error())
-		return []byte(d)
-
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
 	}
 	return FormatStringSlice(cmd.Val())
 }
@@ -745,282 +1853,2861 @@ func FormatStringSlice(val []string) []byte {
 	return b.Bytes()
 }
 
+// FormatNilStringSlice formats val as a multi bulk reply, nil elements
+// are written as $-1.
+func FormatNilStringSlice(val []*string) []byte {
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(val)))
+	b.WriteString("\r\n")
+	for _, v := range val {
+		if v == nil {
+			b.WriteString("$-1\r\n")
+			continue
+		}
+		b.WriteByte('$')
+		b.WriteString(util.Itoa(len(*v)))
+		b.WriteString("\r\n")
+		b.WriteString(*v)
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
+
 //------------------------------------------------------------------------------
 
-type BoolSliceCmd struct {
+// NullableStringSliceCmd is a StringSliceCmd for replies with nil
+// elements, e.g. MGET on a missing key. Nil elements are kept as nil
+// pointers and replied as $-1.
+type NullableStringSliceCmd struct {
 	baseCmd
 
-	val []bool
+	val []*string
 }
 
-func NewBoolSliceCmd(args ...string) *BoolSliceCmd {
-	return &BoolSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+func NewNullableStringSliceCmd(args ...string) *NullableStringSliceCmd {
+	return &NullableStringSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
 }
 
-func (cmd *BoolSliceCmd) reset() {
+// NewNilStringSliceCmd returned a StringSliceCmd keeping nil elements,
+// it now returns a NullableStringSliceCmd whose Val holds the pointers
+// PtrVal returned.
+//
+// Deprecated: use NewNullableStringSliceCmd.
+func NewNilStringSliceCmd(args ...string) *NullableStringSliceCmd {
+	return NewNullableStringSliceCmd(args...)
+}
+
+// NewMGetCmd is MGET key [key ...], a value or nil per key. The keys
+// must be in the same slot, ClusterClient.MGet splits them by slot.
+func NewMGetCmd(keys ...string) *NullableStringSliceCmd {
+	return &NullableStringSliceCmd{baseCmd: baseCmd{
+		_args:          append([]string{"MGET"}, keys...),
+		_clusterKeyPos: 1,
+		_keyCount:      len(keys),
+	}}
+}
+
+func (cmd *NullableStringSliceCmd) reset() {
 	cmd.val = nil
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
-func (cmd *BoolSliceCmd) Val() []bool {
+func (cmd *NullableStringSliceCmd) Val() []*string {
 	return cmd.val
 }
 
-func (cmd *BoolSliceCmd) Result() ([]bool, error) {
-	return cmd.val, cmd.err
+// PtrVal returns Val.
+//
+// Deprecated: use Val.
+func (cmd *NullableStringSliceCmd) PtrVal() []*string {
+	return cmd.val
 }
 
-func (cmd *BoolSliceCmd) String() string {
+func (cmd *NullableStringSliceCmd) Result() ([]*string, error) {
+	return cmd.Val(), cmd.Err()
+}
+
+func (cmd *NullableStringSliceCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *BoolSliceCmd) parseReply(rd *bufio.Reader) error {
-	v, err := parseReply(rd, parseBoolSlice)
+func (cmd *NullableStringSliceCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseNilStringSlice)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.([]bool)
+	val, ok := v.([]*string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
 	return nil
 }
 
-func (cmd *BoolSliceCmd) Reply() []byte {
-
-	return nil
+func (cmd *NullableStringSliceCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatNilStringSlice(cmd.Val())
 }
 
 //------------------------------------------------------------------------------
 
-type StringStringMapCmd struct {
+// LposCmd is LPOS key element [RANK rank] [COUNT num] [MAXLEN len].
+// Without COUNT the reply is the index of the match, Nil if there is
+// none. With COUNT it is the indexes of the matches, maybe none.
+type LposCmd struct {
 	baseCmd
 
-	val map[string]string
+	count bool
+	val   []int64
 }
 
-func NewStringStringMapCmd(args ...string) *StringStringMapCmd {
-	return &StringStringMapCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+func NewLposCmd(args ...string) *LposCmd {
+	cmd := &LposCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+	for i := 3; i < len(args); i += 2 {
+		if strings.ToUpper(args[i]) == "COUNT" {
+			cmd.count = true
+		}
+	}
+	return cmd
 }
 
-func (cmd *StringStringMapCmd) reset() {
+func (cmd *LposCmd) reset() {
 	cmd.val = nil
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
-func (cmd *StringStringMapCmd) Val() map[string]string {
-	return cmd.val
+// Val returns the index of the first match without COUNT.
+func (cmd *LposCmd) Val() int64 {
+	if len(cmd.val) == 0 {
+		return 0
+	}
+	return cmd.val[0]
 }
 
-func (cmd *StringStringMapCmd) Result() (map[string]string, error) {
-	return cmd.val, cmd.err
+func (cmd *LposCmd) Result() (int64, error) {
+	return cmd.Val(), cmd.err
 }
 
-func (cmd *StringStringMapCmd) String() string {
-	return cmdString(cmd, cmd.val)
+// Vals returns the indexes of the matches with COUNT.
+func (cmd *LposCmd) Vals() []int64 {
+	return cmd.val
 }
 
-func (cmd *StringStringMapCmd) parseReply(rd *bufio.Reader) error {
-	v, err := parseReply(rd, parseStringStringMap)
+func (cmd *LposCmd) String() string {
+	if cmd.count {
+		return cmdString(cmd, cmd.val)
+	}
+	return cmdString(cmd, cmd.Val())
+}
+
+func (cmd *LposCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseIntSlice)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.(map[string]string)
-	return nil
+	switch vv := v.(type) {
+	case int64:
+		if !cmd.count {
+			cmd.val = []int64{vv}
+			return nil
+		}
+	case intSlice:
+		if cmd.count && vv.null == nil {
+			cmd.val = vv.vals
+			return nil
+		}
+	}
+	cmd.err = unexpectedReplyType(cmd, v)
+	return cmd.err
 }
 
-func (cmd *StringStringMapCmd) Reply() []byte {
-
-	return nil
+func (cmd *LposCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if !cmd.count {
+		return FormatInt(cmd.Val())
+	}
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(cmd.val)))
+	b.WriteString("\r\n")
+	for _, v := range cmd.val {
+		b.Write(FormatInt(v))
+	}
+	return b.Bytes()
 }
 
 //------------------------------------------------------------------------------
 
-type StringIntMapCmd struct {
+const (
+	lcsString = iota
+	lcsLen
+	lcsIdx
+)
+
+// LcsMatch is a match of LCS IDX, the ranges of the match in the first
+// and the second key. MatchLen is only set with WITHMATCHLEN.
+type LcsMatch struct {
+	Key1     [2]int64
+	Key2     [2]int64
+	MatchLen int64
+}
+
+// LcsCmd is LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN].
+// The reply is the longest common subsequence, its length with LEN, and
+// with IDX a map of the matches and the length.
+type LcsCmd struct {
 	baseCmd
 
-	val map[string]int64
+	mode int
+	str  string
+	n    int64
+	idx  []interface{}
+}
+
+func NewLcsCmd(args ...string) *LcsCmd {
+	cmd := &LcsCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LEN":
+			if cmd.mode != lcsIdx {
+				cmd.mode = lcsLen
+			}
+		case "IDX":
+			cmd.mode = lcsIdx
+		case "MINMATCHLEN":
+			i++
+		}
+	}
+	return cmd
 }
 
-func NewStringIntMapCmd(args ...string) *StringIntMapCmd {
-	return &StringIntMapCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+func (cmd *LcsCmd) reset() {
+	cmd.str = ""
+	cmd.n = 0
+	cmd.idx = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
-func (cmd *StringIntMapCmd) Val() map[string]int64 {
-	return cmd.val
+// Val returns the longest common subsequence, empty with LEN or IDX.
+func (cmd *LcsCmd) Val() string {
+	return cmd.str
 }
 
-func (cmd *StringIntMapCmd) Result() (map[string]int64, error) {
-	return cmd.val, cmd.err
+func (cmd *LcsCmd) Result() (string, error) {
+	return cmd.str, cmd.err
 }
 
-func (cmd *StringIntMapCmd) String() string {
-	return cmdString(cmd, cmd.val)
+// Len returns the length of the longest common subsequence.
+func (cmd *LcsCmd) Len() int64 {
+	if cmd.mode == lcsString {
+		return int64(len(cmd.str))
+	}
+	return cmd.n
 }
 
-func (cmd *StringIntMapCmd) reset() {
-	cmd.val = nil
-	cmd.err = nil
+// Matches returns the matches with IDX in the order Redis replies them,
+// the last one of the strings first.
+func (cmd *LcsCmd) Matches() []LcsMatch {
+	if cmd.mode != lcsIdx {
+		return nil
+	}
+	v, _ := XInfo(cmd.idx).Get("matches")
+	vals, _ := v.([]interface{})
+	matches := make([]LcsMatch, 0, len(vals))
+	for _, val := range vals {
+		m, _ := val.([]interface{})
+		if len(m) < 2 {
+			continue
+		}
+		match := LcsMatch{Key1: lcsRange(m[0]), Key2: lcsRange(m[1])}
+		if len(m) > 2 {
+			match.MatchLen, _ = m[2].(int64)
+		}
+		matches = append(matches, match)
+	}
+	return matches
 }
 
-func (cmd *StringIntMapCmd) parseReply(rd *bufio.Reader) error {
-	v, err := parseReply(rd, parseStringIntMap)
+func lcsRange(v interface{}) [2]int64 {
+	var r [2]int64
+	if vals, ok := v.([]interface{}); ok && len(vals) == 2 {
+		r[0], _ = vals[0].(int64)
+		r[1], _ = vals[1].(int64)
+	}
+	return r
+}
+
+func (cmd *LcsCmd) String() string {
+	switch cmd.mode {
+	case lcsLen:
+		return cmdString(cmd, cmd.n)
+	case lcsIdx:
+		return cmdString(cmd, cmd.idx)
+	}
+	return cmdString(cmd, cmd.str)
+}
+
+func (cmd *LcsCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseSlice)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.(map[string]int64)
-	return nil
+	switch vv := v.(type) {
+	case string:
+		if cmd.mode == lcsString {
+			cmd.str = vv
+			return nil
+		}
+	case int64:
+		if cmd.mode == lcsLen {
+			cmd.n = vv
+			return nil
+		}
+	case []interface{}:
+		if m, ok := toXInfo(vv); ok && cmd.mode == lcsIdx {
+			cmd.idx = m
+			cmd.n = m.GetInt("len")
+			return nil
+		}
+	}
+	cmd.err = unexpectedReplyType(cmd, v)
+	return cmd.err
 }
-func (cmd *StringIntMapCmd) Reply() []byte {
 
-	return nil
+func (cmd *LcsCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	switch cmd.mode {
+	case lcsLen:
+		return FormatInt(cmd.n)
+	case lcsIdx:
+		return FormatSlice(cmd.idx)
+	}
+	return FormatString(cmd.str)
 }
 
 //------------------------------------------------------------------------------
 
-type ZSliceCmd struct {
+// numKeysArgs returns name numkeys keys..., the arguments of the
+// commands taking a number of keys followed by the keys.
+func numKeysArgs(name string, keys []string, extra int) []string {
+	args := make([]string, 0, 2+len(keys)+extra)
+	args = append(args, name, strconv.Itoa(len(keys)))
+	return append(args, keys...)
+}
+
+// setNumKeys routes cmd by the n keys following numkeys at index 1.
+func (cmd *baseCmd) setNumKeys(n int) {
+	if n > 0 {
+		cmd._clusterKeyPos = 2
+		cmd._keyCount = n
+	} else {
+		cmd._clusterKeyPos = 0
+	}
+}
+
+// NewSInterCardCmd is SINTERCARD numkeys key... [LIMIT limit], limit is
+// left out if not positive. The keys have to be in the same cluster
+// slot.
+func NewSInterCardCmd(limit int64, keys ...string) *IntCmd {
+	args := numKeysArgs("SINTERCARD", keys, 2)
+	if limit > 0 {
+		args = append(args, "LIMIT", strconv.FormatInt(limit, 10))
+	}
+	cmd := NewIntCmd(args...)
+	cmd.setNumKeys(len(keys))
+	return cmd
+}
+
+// MPopCmd is LMPOP or ZMPOP. The reply is the key popped from and its
+// elements, or nil if all the keys are empty, which sets Nil and is
+// replied as *-1. The elements of ZMPOP are member and score pairs.
+type MPopCmd struct {
 	baseCmd
 
-	val []Z
+	key string
+	val []interface{}
 }
 
-func NewZSliceCmd(args ...string) *ZSliceCmd {
-	return &ZSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+// NewLMPopCmd is LMPOP numkeys key... LEFT|RIGHT [COUNT count], count
+// is left out if not positive.
+func NewLMPopCmd(direction string, count int64, keys ...string) *MPopCmd {
+	return newMPopCmd("LMPOP", direction, count, keys)
 }
 
-func (cmd *ZSliceCmd) reset() {
+// NewZMPopCmd is ZMPOP numkeys key... MIN|MAX [COUNT count], count is
+// left out if not positive.
+func NewZMPopCmd(order string, count int64, keys ...string) *MPopCmd {
+	return newMPopCmd("ZMPOP", order, count, keys)
+}
+
+func newMPopCmd(name, where string, count int64, keys []string) *MPopCmd {
+	args := numKeysArgs(name, keys, 3)
+	args = append(args, where)
+	if count > 0 {
+		args = append(args, "COUNT", strconv.FormatInt(count, 10))
+	}
+	cmd := &MPopCmd{baseCmd: baseCmd{_args: args}}
+	cmd.setNumKeys(len(keys))
+	return cmd
+}
+
+func (cmd *MPopCmd) reset() {
+	cmd.key = ""
 	cmd.val = nil
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
-func (cmd *ZSliceCmd) Val() []Z {
+// Key returns the key the elements were popped from.
+func (cmd *MPopCmd) Key() string {
+	return cmd.key
+}
+
+func (cmd *MPopCmd) Val() []interface{} {
 	return cmd.val
 }
 
-func (cmd *ZSliceCmd) Result() ([]Z, error) {
-	return cmd.val, cmd.err
+func (cmd *MPopCmd) Result() (string, []interface{}, error) {
+	return cmd.key, cmd.val, cmd.err
 }
 
-func (cmd *ZSliceCmd) String() string {
+func (cmd *MPopCmd) String() string {
 	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *ZSliceCmd) parseReply(rd *bufio.Reader) error {
-	v, err := parseReply(rd, parseZSlice)
+func (cmd *MPopCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseSlice)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.([]Z)
-	return nil
+	vv, ok := v.([]interface{})
+	if ok && len(vv) == 2 {
+		key, ok1 := vv[0].(string)
+		val, ok2 := vv[1].([]interface{})
+		if ok1 && ok2 {
+			cmd.key, cmd.val = key, val
+			return nil
+		}
+	}
+	cmd.err = unexpectedReplyType(cmd, v)
+	return cmd.err
 }
-func (cmd *ZSliceCmd) Reply() []byte {
 
-	return nil
+func (cmd *MPopCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		if err == Nil {
+			return []byte("*-1\r\n")
+		}
+		return FormatError(err)
+	}
+	return FormatSlice([]interface{}{cmd.key, cmd.val})
 }
 
 //------------------------------------------------------------------------------
 
-type ScanCmd struct {
+// SortCmd is SORT. Without STORE the reply is the sorted elements, or the
+// values of the GET patterns, nil when missing. With STORE it is the
+// number of elements stored.
+type SortCmd struct {
 	baseCmd
 
-	cursor int64
-	keys   []string
+	store bool
+	val   []*string
+	count int64
 }
 
-func NewScanCmd(args ...string) *ScanCmd {
-	return &ScanCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+// NewSortCmd builds SORT key with the options in sort. The BY and GET
+// patterns and the STORE destination count as keys, in a cluster they
+// have to hash to the slot of key, e.g. with a hash tag. A nil sort is
+// a bare SORT key.
+func NewSortCmd(key string, sort *Sort) *SortCmd {
+	if sort == nil {
+		sort = &Sort{}
+	}
+	args := []string{"SORT", key}
+	if sort.By != "" {
+		args = append(args, "BY", sort.By)
+	}
+	if sort.Offset != 0 || sort.Count != 0 {
+		args = append(args, "LIMIT", formatFloat(sort.Offset), formatFloat(sort.Count))
+	}
+	for _, get := range sort.Get {
+		args = append(args, "GET", get)
+	}
+	if sort.Order != "" {
+		args = append(args, sort.Order)
+	}
+	if sort.IsAlpha {
+		args = append(args, "ALPHA")
+	}
+	if sort.Store != "" {
+		args = append(args, "STORE", sort.Store)
+	}
+	cmd := &SortCmd{baseCmd: baseCmd{_args: args}}
+	cmd._keyIndexes, cmd.store = sortKeyIndexes(args)
+	return cmd
 }
 
-func (cmd *ScanCmd) reset() {
-	cmd.cursor = 0
-	cmd.keys = nil
+// sortKeyIndexes returns the indexes of the key, the BY and GET patterns
+// and the STORE destination of SORT args, and whether STORE is set. The
+// BY pattern is only one when it has a *, GET # is the element itself.
+func sortKeyIndexes(args []string) ([]int, bool) {
+	if len(args) < 2 {
+		return []int{}, false
+	}
+	indexes := []int{1}
+	store := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LIMIT":
+			i += 2
+		case "BY":
+			if i+1 < len(args) && strings.Contains(args[i+1], "*") {
+				indexes = append(indexes, i+1)
+			}
+			i++
+		case "GET":
+			if i+1 < len(args) && args[i+1] != "#" {
+				indexes = append(indexes, i+1)
+			}
+			i++
+		case "STORE":
+			if i+1 < len(args) {
+				indexes = append(indexes, i+1)
+				store = true
+			}
+			i++
+		}
+	}
+	return indexes, store
+}
+
+func (cmd *SortCmd) reset() {
+	cmd.val = nil
+	cmd.count = 0
 	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
-func (cmd *ScanCmd) Val() (int64, []string) {
-	return cmd.cursor, cmd.keys
+// IsStore reports whether the command has STORE, Count is the reply then
+// and Val the reply otherwise.
+func (cmd *SortCmd) IsStore() bool {
+	return cmd.store
 }
 
-func (cmd *ScanCmd) Result() (int64, []string, error) {
-	return cmd.cursor, cmd.keys, cmd.err
+func (cmd *SortCmd) Val() []*string {
+	return cmd.val
 }
 
-func (cmd *ScanCmd) String() string {
-	return cmdString(cmd, cmd.keys)
+func (cmd *SortCmd) Result() ([]*string, error) {
+	return cmd.val, cmd.err
 }
 
-func (cmd *ScanCmd) parseReply(rd *bufio.Reader) error {
-	vi, err := parseReply(rd, parseSlice)
+// Count returns the number of elements stored by SORT with STORE.
+func (cmd *SortCmd) Count() int64 {
+	return cmd.count
+}
+
+func (cmd *SortCmd) String() string {
+	if cmd.store {
+		return cmdString(cmd, cmd.count)
+	}
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SortCmd) parseReply(rd *reader) error {
+	var v interface{}
+	var err error
+	if cmd.store {
+		v, err = parseReply(rd, nil)
+	} else {
+		v, err = parseReply(rd, parseNilStringSlice)
+	}
 	if err != nil {
 		cmd.err = err
-		return cmd.err
+		return err
 	}
-	v := vi.([]interface{})
-
-	cmd.cursor, cmd.err = strconv.ParseInt(v[0].(string), 10, 64)
-	if cmd.err != nil {
-		return cmd.err
+	var ok bool
+	if cmd.store {
+		cmd.count, ok = v.(int64)
+	} else {
+		cmd.val, ok = v.([]*string)
 	}
-
-	keys := v[1].([]interface{})
-	for _, keyi := range keys {
-		cmd.keys = append(cmd.keys, keyi.(string))
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
 	}
-
 	return nil
 }
 
-func (cmd *ScanCmd) Reply() []byte {
-
-	return nil
+func (cmd *SortCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if cmd.store {
+		return FormatInt(cmd.count)
+	}
+	return FormatNilStringSlice(cmd.val)
 }
 
 //------------------------------------------------------------------------------
 
-type ClusterSlotInfo struct {
-	Start, End int
-	Addrs      []string
+// IntSliceCmd is an array of integers, e.g. the reply of BITFIELD. Nil
+// elements, like a BITFIELD overflow with OVERFLOW FAIL, are 0 in Val
+// and reported by IsNil.
+type IntSliceCmd struct {
+	baseCmd
+
+	val  []int64
+	null []bool
 }
 
-type ClusterSlotCmd struct {
-	baseCmd
+func NewIntSliceCmd(args ...string) *IntSliceCmd {
+	return &IntSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
 
-	val []ClusterSlotInfo
+// NewBitFieldROCmd is BITFIELD_RO key GET type offset [GET type offset
+// ...], fields are the type and offset pairs. Unlike BITFIELD it is read
+// only, so it can run on replicas. An odd number of fields sets the error
+// of the command, which must not be processed then.
+func NewBitFieldROCmd(key string, fields ...string) *IntSliceCmd {
+	args := []string{"BITFIELD_RO", key}
+	for i := 0; i+1 < len(fields); i += 2 {
+		args = append(args, "GET", fields[i], fields[i+1])
+	}
+	cmd := NewIntSliceCmd(args...)
+	if len(fields)%2 != 0 {
+		cmd.setErr(errorf("ERR syntax error"))
+	}
+	return cmd
 }
 
-func NewClusterSlotCmd(args ...string) *ClusterSlotCmd {
-	return &ClusterSlotCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+func (cmd *IntSliceCmd) reset() {
+	cmd.val = nil
+	cmd.null = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
 }
 
-func (cmd *ClusterSlotCmd) Val() []ClusterSlotInfo {
+func (cmd *IntSliceCmd) Val() []int64 {
 	return cmd.val
 }
 
-func (cmd *ClusterSlotCmd) Result() ([]ClusterSlotInfo, error) {
+func (cmd *IntSliceCmd) Result() ([]int64, error) {
 	return cmd.Val(), cmd.Err()
 }
 
-func (cmd *ClusterSlotCmd) String() string {
-	return cmdString(cmd, cmd.val)
+// IsNil reports whether the element i of the reply is nil.
+func (cmd *IntSliceCmd) IsNil(i int) bool {
+	return cmd.null != nil && cmd.null[i]
 }
 
-func (cmd *ClusterSlotCmd) reset() {
-	cmd.val = nil
-	cmd.err = nil
+func (cmd *IntSliceCmd) String() string {
+	return cmdString(cmd, cmd.val)
 }
 
-func (cmd *ClusterSlotCmd) parseReply(rd *bufio.Reader) error {
-	v, err := parseReply(rd, parseClusterSlotInfoSlice)
+func (cmd *IntSliceCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseIntSlice)
 	if err != nil {
 		cmd.err = err
 		return err
 	}
-	cmd.val = v.([]ClusterSlotInfo)
+	val, ok := v.(intSlice)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val, cmd.null = val.vals, val.null
 	return nil
 }
 
-func (cmd *ClusterSlotCmd) Reply() []byte {
-
-	return nil
+func (cmd *IntSliceCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(cmd.val)))
+	b.WriteString("\r\n")
+	for i, v := range cmd.val {
+		if cmd.IsNil(i) {
+			b.WriteString("$-1\r\n")
+			continue
+		}
+		b.Write(FormatInt(v))
+	}
+	return b.Bytes()
+}
+
+// The per field results of the HEXPIRE family, HTTL and HPTTL reply the
+// TTL itself or one of the negative ones.
+const (
+	// HFieldMissing is the result for a missing field or hash.
+	HFieldMissing = -2
+	// HFieldNoExpire is the result of HTTL, HPTTL and HPERSIST for a
+	// field without a TTL.
+	HFieldNoExpire = -1
+	// HExpireNotSet is the result of HEXPIRE when its condition is not
+	// met.
+	HExpireNotSet = 0
+	// HExpireSet is the result of HEXPIRE setting a TTL and of HPERSIST
+	// removing it.
+	HExpireSet = 1
+	// HExpireDeleted is the result of HEXPIRE with a time in the past,
+	// which deletes the field.
+	HExpireDeleted = 2
+)
+
+// errNoHashFields is the error of Redis for an empty FIELDS segment.
+var errNoHashFields = errorf("ERR Parameter `numFields` should be greater than 0")
+
+// appendHashFields appends the FIELDS numfields field... segment of the
+// HEXPIRE family to args.
+func appendHashFields(args []string, fields []string) []string {
+	args = append(args, "FIELDS", strconv.Itoa(len(fields)))
+	return append(args, fields...)
+}
+
+// newHashFieldsCmd returns name key args... FIELDS numfields fields...,
+// with the error of the command set if fields is empty.
+func newHashFieldsCmd(name, key string, args []string, fields []string) *IntSliceCmd {
+	cmd := NewIntSliceCmd(appendHashFields(append([]string{name, key}, args...), fields)...)
+	if len(fields) == 0 {
+		cmd.setErr(errNoHashFields)
+	}
+	return cmd
+}
+
+func newHExpireCmd(name, key string, n int64, flag string, fields []string) *IntSliceCmd {
+	f, err := checkExpireFlag(flag)
+	if err != nil {
+		cmd := NewIntSliceCmd(name, key)
+		cmd.setErr(err)
+		return cmd
+	}
+	args := []string{strconv.FormatInt(n, 10)}
+	if f != "" {
+		args = append(args, f)
+	}
+	return newHashFieldsCmd(name, key, args, fields)
+}
+
+// NewHExpireCmd is HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields
+// field..., flag is empty for none. The reply has a result per field,
+// like HExpireSet or HFieldMissing. An invalid flag or no fields set the
+// error of the command, which must not be processed then.
+func NewHExpireCmd(key string, seconds int64, flag string, fields ...string) *IntSliceCmd {
+	return newHExpireCmd("HEXPIRE", key, seconds, flag, fields)
+}
+
+// NewHPExpireCmd is HPEXPIRE, like NewHExpireCmd in milliseconds.
+func NewHPExpireCmd(key string, milliseconds int64, flag string, fields ...string) *IntSliceCmd {
+	return newHExpireCmd("HPEXPIRE", key, milliseconds, flag, fields)
+}
+
+// NewHExpireAtCmd is HEXPIREAT, like NewHExpireCmd with a unix time in
+// seconds.
+func NewHExpireAtCmd(key string, unixTime int64, flag string, fields ...string) *IntSliceCmd {
+	return newHExpireCmd("HEXPIREAT", key, unixTime, flag, fields)
+}
+
+// NewHPExpireAtCmd is HPEXPIREAT, like NewHExpireCmd with a unix time in
+// milliseconds.
+func NewHPExpireAtCmd(key string, unixTimeMs int64, flag string, fields ...string) *IntSliceCmd {
+	return newHExpireCmd("HPEXPIREAT", key, unixTimeMs, flag, fields)
+}
+
+// NewHTTLCmd is HTTL key FIELDS numfields field..., the TTL of every
+// field in seconds, or HFieldNoExpire or HFieldMissing.
+func NewHTTLCmd(key string, fields ...string) *IntSliceCmd {
+	return newHashFieldsCmd("HTTL", key, nil, fields)
+}
+
+// NewHPTTLCmd is HPTTL, like NewHTTLCmd in milliseconds.
+func NewHPTTLCmd(key string, fields ...string) *IntSliceCmd {
+	return newHashFieldsCmd("HPTTL", key, nil, fields)
+}
+
+// NewHPersistCmd is HPERSIST key FIELDS numfields field..., removing the
+// TTL of the fields. The reply has HExpireSet for every field whose TTL
+// was removed, or HFieldNoExpire or HFieldMissing.
+func NewHPersistCmd(key string, fields ...string) *IntSliceCmd {
+	return newHashFieldsCmd("HPERSIST", key, nil, fields)
+}
+
+//------------------------------------------------------------------------------
+
+// FloatSliceCmd is an array of floats where elements can be nil, e.g.
+// ZMSCORE on a missing member or GEODIST on missing places.
+type FloatSliceCmd struct {
+	baseCmd
+
+	val []*float64
+}
+
+func NewFloatSliceCmd(args ...string) *FloatSliceCmd {
+	return &FloatSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+func (cmd *FloatSliceCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *FloatSliceCmd) Val() []*float64 {
+	return cmd.val
+}
+
+func (cmd *FloatSliceCmd) Result() ([]*float64, error) {
+	return cmd.Val(), cmd.Err()
+}
+
+func (cmd *FloatSliceCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *FloatSliceCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseFloatSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.([]*float64)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *FloatSliceCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatFloatSlice(cmd.Val())
+}
+
+func FormatFloatSlice(val []*float64) []byte {
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(val)))
+	b.WriteString("\r\n")
+	for _, v := range val {
+		if v == nil {
+			b.WriteString("$-1\r\n")
+			continue
+		}
+		b.Write(FormatFloat(*v))
+	}
+	return b.Bytes()
+}
+
+//------------------------------------------------------------------------------
+
+type BoolSliceCmd struct {
+	baseCmd
+
+	val []bool
+}
+
+func NewBoolSliceCmd(args ...string) *BoolSliceCmd {
+	return &BoolSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+func (cmd *BoolSliceCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Len returns the number of elements in the reply, 0 for a nil reply.
+func (cmd *BoolSliceCmd) Len() int {
+	return len(cmd.val)
+}
+
+// IsEmpty reports whether the reply holds no elements, which is true for
+// both an empty and a nil reply.
+func (cmd *BoolSliceCmd) IsEmpty() bool {
+	return len(cmd.val) == 0
+}
+
+func (cmd *BoolSliceCmd) Val() []bool {
+	return cmd.val
+}
+
+func (cmd *BoolSliceCmd) Result() ([]bool, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *BoolSliceCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *BoolSliceCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseBoolSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.([]bool)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *BoolSliceCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+type StringStringMapCmd struct {
+	baseCmd
+
+	val map[string]string
+	// The pairs in the order the server returned them, duplicates
+	// included, if the command is ordered.
+	pairs   []KeyValue
+	ordered bool
+}
+
+func NewStringStringMapCmd(args ...string) *StringStringMapCmd {
+	return &StringStringMapCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+// NewOrderedStringStringMapCmd is like NewStringStringMapCmd, but the
+// command also keeps the pairs as returned, so that Reply formats them
+// in the upstream order without dropping duplicate fields. Val holds the
+// last value of a duplicate field.
+func NewOrderedStringStringMapCmd(args ...string) *StringStringMapCmd {
+	cmd := NewStringStringMapCmd(args...)
+	cmd.ordered = true
+	return cmd
+}
+
+func (cmd *StringStringMapCmd) reset() {
+	cmd.val = nil
+	cmd.pairs = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *StringStringMapCmd) Val() map[string]string {
+	return cmd.val
+}
+
+func (cmd *StringStringMapCmd) Result() (map[string]string, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *StringStringMapCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+// Pairs returns the pairs in the order the server returned them, nil
+// unless the command is ordered.
+func (cmd *StringStringMapCmd) Pairs() []KeyValue {
+	return cmd.pairs
+}
+
+func (cmd *StringStringMapCmd) parseReply(rd *reader) error {
+	if cmd.ordered {
+		return cmd.parseOrderedReply(rd)
+	}
+	v, err := parseReply(rd, parseStringStringMap)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.(map[string]string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *StringStringMapCmd) parseOrderedReply(rd *reader) error {
+	v, err := parseReply(rd, parseKeyValueSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	pairs, ok := v.([]KeyValue)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = make(map[string]string, len(pairs))
+	for _, kv := range pairs {
+		cmd.val[kv.Key] = kv.Value
+	}
+	cmd.pairs = pairs
+	return nil
+}
+
+func (cmd *StringStringMapCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if cmd.ordered {
+		return FormatKeyValueSlice(cmd.pairs)
+	}
+	return FormatStringStringMap(cmd.Val())
+}
+
+// FormatStringStringMap formats val as a flat field/value multi bulk
+// reply like HGETALL. Go maps are unordered, so is the reply.
+func FormatStringStringMap(val map[string]string) []byte {
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(val) * 2))
+	b.WriteString("\r\n")
+	for k, v := range val {
+		b.Write(FormatString(k))
+		b.Write(FormatString(v))
+	}
+	return b.Bytes()
+}
+
+//------------------------------------------------------------------------------
+
+// KeySlice is an entry of a map reply whose values are arrays, nested
+// arrays are kept as parsed by parseSlice.
+type KeySlice struct {
+	Key string
+	Val []interface{}
+}
+
+// MapStringSlice is a map reply whose values are arrays, in the order
+// the server returned the entries.
+type MapStringSlice []KeySlice
+
+// Get returns the value of key, nil if missing.
+func (m MapStringSlice) Get(key string) []interface{} {
+	for _, e := range m {
+		if e.Key == key {
+			return e.Val
+		}
+	}
+	return nil
+}
+
+func parseMapStringSlice(rd *reader, n int64) (interface{}, error) {
+	if n%2 != 0 {
+		return nil, fmt.Errorf("%w: odd number of map elements %d", ErrProtocol, n)
+	}
+	m := make(MapStringSlice, 0, n/2)
+	for i := int64(0); i < n; i += 2 {
+		kiface, err := parseReply(rd, nil)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := kiface.(string)
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected string", kiface)
+		}
+		viface, err := parseReply(rd, nil)
+		if err != nil {
+			return nil, err
+		}
+		val, ok := viface.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected array", viface)
+		}
+		m = append(m, KeySlice{Key: key, Val: val})
+	}
+	return m, nil
+}
+
+func parseMapStringSlices(rd *reader, n int64) (interface{}, error) {
+	vals := make([]MapStringSlice, 0, n)
+	for i := int64(0); i < n; i++ {
+		v, err := parseReply(rd, parseMapStringSlice)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := v.(MapStringSlice)
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected map", v)
+		}
+		vals = append(vals, m)
+	}
+	return vals, nil
+}
+
+func formatMapStringSlice(b *bytes.Buffer, val MapStringSlice) {
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(val) * 2))
+	b.WriteString("\r\n")
+	for _, e := range val {
+		b.Write(FormatString(e.Key))
+		formatSlice(b, e.Val)
+	}
+}
+
+// FormatMapStringSlice formats val as a flat key/value multi bulk reply,
+// the values as nested multi bulk replies.
+func FormatMapStringSlice(val MapStringSlice) []byte {
+	b := bytes.Buffer{}
+	formatMapStringSlice(&b, val)
+	return b.Bytes()
+}
+
+// MapStringSliceCmd is a map reply whose values are arrays, e.g. a shard
+// of CLUSTER SHARDS. The reply is replied as is.
+type MapStringSliceCmd struct {
+	baseCmd
+
+	val MapStringSlice
+}
+
+func NewMapStringSliceCmd(args ...string) *MapStringSliceCmd {
+	return &MapStringSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+func (cmd *MapStringSliceCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *MapStringSliceCmd) Val() MapStringSlice {
+	return cmd.val
+}
+
+func (cmd *MapStringSliceCmd) Result() (MapStringSlice, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *MapStringSliceCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *MapStringSliceCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseMapStringSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.(MapStringSlice)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *MapStringSliceCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatMapStringSlice(cmd.Val())
+}
+
+// ClusterShardsCmd is CLUSTER SHARDS, an array with a map per shard
+// holding its "slots" and "nodes".
+type ClusterShardsCmd struct {
+	baseCmd
+
+	val []MapStringSlice
+}
+
+func NewClusterShardsCmd() *ClusterShardsCmd {
+	return &ClusterShardsCmd{baseCmd: baseCmd{_args: []string{"CLUSTER", "SHARDS"}}}
+}
+
+func (cmd *ClusterShardsCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *ClusterShardsCmd) Val() []MapStringSlice {
+	return cmd.val
+}
+
+func (cmd *ClusterShardsCmd) Result() ([]MapStringSlice, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *ClusterShardsCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *ClusterShardsCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseMapStringSlices)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.([]MapStringSlice)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *ClusterShardsCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(cmd.val)))
+	b.WriteString("\r\n")
+	for _, m := range cmd.val {
+		formatMapStringSlice(&b, m)
+	}
+	return b.Bytes()
+}
+
+//------------------------------------------------------------------------------
+
+// XInfo is a map reply of XINFO as flat field and value pairs, in the
+// order of the server and with the nested replies kept as parsed, so it
+// is replied byte for byte.
+type XInfo []interface{}
+
+// Get returns the value of field, false if the reply doesn't have it.
+func (m XInfo) Get(field string) (interface{}, bool) {
+	for i := 0; i+1 < len(m); i += 2 {
+		if m[i] == field {
+			return m[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// GetInt returns the integer value of field, 0 if it has another type.
+func (m XInfo) GetInt(field string) int64 {
+	v, _ := m.Get(field)
+	n, _ := v.(int64)
+	return n
+}
+
+// GetString returns the string value of field, "" if it has another
+// type.
+func (m XInfo) GetString(field string) string {
+	v, _ := m.Get(field)
+	s, _ := v.(string)
+	return s
+}
+
+// XMessage is a stream entry, its field and value pairs in order.
+type XMessage struct {
+	ID     string
+	Values []string
+}
+
+// GetEntry returns the stream entry value of field, e.g. first-entry,
+// nil for an empty stream.
+func (m XInfo) GetEntry(field string) *XMessage {
+	v, _ := m.Get(field)
+	entry, ok := v.([]interface{})
+	if !ok || len(entry) != 2 {
+		return nil
+	}
+	id, ok := entry[0].(string)
+	if !ok {
+		return nil
+	}
+	values, _ := entry[1].([]interface{})
+	msg := &XMessage{ID: id, Values: make([]string, 0, len(values))}
+	for _, value := range values {
+		s, _ := value.(string)
+		msg.Values = append(msg.Values, s)
+	}
+	return msg
+}
+
+func toXInfo(v interface{}) (XInfo, bool) {
+	vals, ok := v.([]interface{})
+	if !ok || len(vals)%2 != 0 {
+		return nil, false
+	}
+	return XInfo(vals), true
+}
+
+// XInfoStreamCmd is XINFO STREAM, a map with the first and last entries
+// nested, and the groups and consumers too given FULL.
+type XInfoStreamCmd struct {
+	baseCmd
+
+	val XInfo
+}
+
+func NewXInfoStreamCmd(key string) *XInfoStreamCmd {
+	return &XInfoStreamCmd{baseCmd: baseCmd{_args: []string{"XINFO", "STREAM", key}, _clusterKeyPos: 2}}
+}
+
+func (cmd *XInfoStreamCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *XInfoStreamCmd) Val() XInfo {
+	return cmd.val
+}
+
+func (cmd *XInfoStreamCmd) Result() (XInfo, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *XInfoStreamCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *XInfoStreamCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := toXInfo(v)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *XInfoStreamCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatSlice(cmd.val)
+}
+
+// XInfoGroupsCmd is XINFO GROUPS, an array with a map per consumer
+// group.
+type XInfoGroupsCmd struct {
+	baseCmd
+
+	val []XInfo
+}
+
+func NewXInfoGroupsCmd(key string) *XInfoGroupsCmd {
+	return &XInfoGroupsCmd{baseCmd: baseCmd{_args: []string{"XINFO", "GROUPS", key}, _clusterKeyPos: 2}}
+}
+
+func (cmd *XInfoGroupsCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *XInfoGroupsCmd) Val() []XInfo {
+	return cmd.val
+}
+
+func (cmd *XInfoGroupsCmd) Result() ([]XInfo, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *XInfoGroupsCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *XInfoGroupsCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	vals, ok := v.([]interface{})
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	groups := make([]XInfo, 0, len(vals))
+	for _, val := range vals {
+		group, ok := toXInfo(val)
+		if !ok {
+			cmd.err = unexpectedReplyType(cmd, val)
+			return cmd.err
+		}
+		groups = append(groups, group)
+	}
+	cmd.val = groups
+	return nil
+}
+
+func (cmd *XInfoGroupsCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	groups := make([]interface{}, len(cmd.val))
+	for i, group := range cmd.val {
+		groups[i] = []interface{}(group)
+	}
+	return FormatSlice(groups)
+}
+
+//------------------------------------------------------------------------------
+
+type StringIntMapCmd struct {
+	baseCmd
+
+	val map[string]int64
+}
+
+func NewStringIntMapCmd(args ...string) *StringIntMapCmd {
+	return &StringIntMapCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+func (cmd *StringIntMapCmd) Val() map[string]int64 {
+	return cmd.val
+}
+
+func (cmd *StringIntMapCmd) Result() (map[string]int64, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *StringIntMapCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *StringIntMapCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *StringIntMapCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseStringIntMap)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.(map[string]int64)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+func (cmd *StringIntMapCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// KeyValueSliceCmd is like StringStringMapCmd, but keeps the pairs in
+// the order the server returned them.
+type KeyValueSliceCmd struct {
+	baseCmd
+
+	val []KeyValue
+}
+
+func NewKeyValueSliceCmd(args ...string) *KeyValueSliceCmd {
+	return &KeyValueSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+func (cmd *KeyValueSliceCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *KeyValueSliceCmd) Val() []KeyValue {
+	return cmd.val
+}
+
+func (cmd *KeyValueSliceCmd) Result() ([]KeyValue, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *KeyValueSliceCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *KeyValueSliceCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseKeyValueSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.([]KeyValue)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *KeyValueSliceCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatKeyValueSlice(cmd.Val())
+}
+
+func FormatKeyValueSlice(val []KeyValue) []byte {
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(val) * 2))
+	b.WriteString("\r\n")
+	for _, kv := range val {
+		b.Write(FormatString(kv.Key))
+		b.Write(FormatString(kv.Value))
+	}
+	return b.Bytes()
+}
+
+//------------------------------------------------------------------------------
+
+// ZAddOptions are the options of ZADD. NX excludes XX, GT and LT, GT
+// excludes LT, and INCR takes a single member.
+type ZAddOptions struct {
+	NX bool
+	XX bool
+	GT bool
+	LT bool
+	// CH counts the changed members too, not only the added ones.
+	CH bool
+	// Incr increments the score of the member and replies with it.
+	Incr bool
+}
+
+var (
+	errZAddNXXX = errorf("ERR XX and NX options at the same time are not compatible")
+	errZAddGTLT = errorf("ERR GT, LT, and/or NX options at the same time are not compatible")
+	errZAddIncr = errorf("ERR INCR option supports a single increment-element pair")
+)
+
+func (opt *ZAddOptions) validate(members int) error {
+	if opt.NX && opt.XX {
+		return errZAddNXXX
+	}
+	if (opt.GT && opt.LT) || (opt.NX && (opt.GT || opt.LT)) {
+		return errZAddGTLT
+	}
+	if opt.Incr && members != 1 {
+		return errZAddIncr
+	}
+	return nil
+}
+
+func (opt *ZAddOptions) args() []string {
+	var args []string
+	if opt.NX {
+		args = append(args, "NX")
+	} else if opt.XX {
+		args = append(args, "XX")
+	}
+	if opt.GT {
+		args = append(args, "GT")
+	} else if opt.LT {
+		args = append(args, "LT")
+	}
+	if opt.CH {
+		args = append(args, "CH")
+	}
+	if opt.Incr {
+		args = append(args, "INCR")
+	}
+	return args
+}
+
+// parseZAddArgs parses the options of ZADD, i.e. everything after ZADD
+// key, and returns them with the score and member pairs.
+func parseZAddArgs(args []string) (ZAddOptions, []string, error) {
+	var opt ZAddOptions
+	i := 0
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opt.NX = true
+		case "XX":
+			opt.XX = true
+		case "GT":
+			opt.GT = true
+		case "LT":
+			opt.LT = true
+		case "CH":
+			opt.CH = true
+		case "INCR":
+			opt.Incr = true
+		default:
+			break loop
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return opt, nil, errorf("ERR syntax error")
+	}
+	return opt, pairs, opt.validate(len(pairs) / 2)
+}
+
+// ZAddCmd is ZADD. The reply is the number of members added, or changed
+// with CH. With INCR it is the new score of the member instead, Nil if
+// NX, XX, GT or LT kept it from being updated.
+type ZAddCmd struct {
+	baseCmd
+
+	incr  bool
+	n     int64
+	score string
+}
+
+// NewZAddCmd is ZADD key with opt and members. Invalid options set the
+// error of the command, which must not be processed then.
+func NewZAddCmd(key string, opt ZAddOptions, members ...Z) *ZAddCmd {
+	args := append([]string{"ZADD", key}, opt.args()...)
+	for _, m := range members {
+		args = append(args, formatFloat(m.Score), m.Member)
+	}
+	cmd := &ZAddCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}, incr: opt.Incr}
+	if err := opt.validate(len(members)); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// newRawZAddCmd is ZADD with the arguments of a client, the reply is a
+// score if INCR is one of them.
+func newRawZAddCmd(args ...string) *ZAddCmd {
+	cmd := &ZAddCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+	if len(args) > 2 {
+		opt, _, _ := parseZAddArgs(args[2:])
+		cmd.incr = opt.Incr
+	}
+	return cmd
+}
+
+func (cmd *ZAddCmd) reset() {
+	cmd.n = 0
+	cmd.score = ""
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Val returns the number of members added or changed, without INCR.
+func (cmd *ZAddCmd) Val() int64 {
+	return cmd.n
+}
+
+func (cmd *ZAddCmd) Result() (int64, error) {
+	return cmd.n, cmd.err
+}
+
+// Score returns the new score of the member with INCR.
+func (cmd *ZAddCmd) Score() float64 {
+	f, _ := strconv.ParseFloat(cmd.score, 64)
+	return f
+}
+
+// IsIncr reports whether the reply is a score.
+func (cmd *ZAddCmd) IsIncr() bool {
+	return cmd.incr
+}
+
+func (cmd *ZAddCmd) String() string {
+	if cmd.incr {
+		return cmdString(cmd, cmd.score)
+	}
+	return cmdString(cmd, cmd.n)
+}
+
+func (cmd *ZAddCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, nil)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	switch vv := v.(type) {
+	case int64:
+		if !cmd.incr {
+			cmd.n = vv
+			return nil
+		}
+	case string:
+		if _, err := strconv.ParseFloat(vv, 64); cmd.incr && err == nil {
+			cmd.score = vv
+			return nil
+		}
+	}
+	cmd.err = unexpectedReplyType(cmd, v)
+	return cmd.err
+}
+
+func (cmd *ZAddCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if cmd.incr {
+		// The score as Redis formatted it, e.g. inf.
+		return FormatString(cmd.score)
+	}
+	return FormatInt(cmd.n)
+}
+
+//------------------------------------------------------------------------------
+
+type ZSliceCmd struct {
+	baseCmd
+
+	val []Z
+}
+
+func NewZSliceCmd(args ...string) *ZSliceCmd {
+	return &ZSliceCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+func (cmd *ZSliceCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Len returns the number of members in the reply, 0 for a nil reply.
+func (cmd *ZSliceCmd) Len() int {
+	return len(cmd.val)
+}
+
+// IsEmpty reports whether the reply holds no members, which is true for
+// both an empty and a nil reply.
+func (cmd *ZSliceCmd) IsEmpty() bool {
+	return len(cmd.val) == 0
+}
+
+func (cmd *ZSliceCmd) Val() []Z {
+	return cmd.val
+}
+
+func (cmd *ZSliceCmd) Result() ([]Z, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *ZSliceCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *ZSliceCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseZSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.([]Z)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+func (cmd *ZSliceCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	// The flat member and score pairs of WITHSCORES.
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(cmd.val) * 2))
+	b.WriteString("\r\n")
+	for _, z := range cmd.val {
+		b.Write(FormatString(z.Member))
+		b.Write(FormatString(formatScore(z.Score)))
+	}
+	return b.Bytes()
+}
+
+// formatScore formats a sorted set score like Redis, the infinities as
+// inf and -inf.
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return formatFloat(f)
+}
+
+// NewZRangeByScoreCmd is ZRANGEBYSCORE key min max [LIMIT offset count].
+// Bounds which are not scores set the error of the command, which must
+// not be processed then.
+func NewZRangeByScoreCmd(key string, opt ZRangeByScore) *StringSliceCmd {
+	cmd := NewStringSliceCmd(opt.args("ZRANGEBYSCORE", key, opt.Min, opt.Max, false)...)
+	if err := checkScoreRange(opt.Min, opt.Max); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// NewZRangeByScoreWithScoresCmd is NewZRangeByScoreCmd with WITHSCORES,
+// the reply is the members with their scores.
+func NewZRangeByScoreWithScoresCmd(key string, opt ZRangeByScore) *ZSliceCmd {
+	cmd := NewZSliceCmd(opt.args("ZRANGEBYSCORE", key, opt.Min, opt.Max, true)...)
+	if err := checkScoreRange(opt.Min, opt.Max); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// NewZRevRangeByScoreCmd is ZREVRANGEBYSCORE key max min [LIMIT offset
+// count], the members from opt.Max down to opt.Min.
+func NewZRevRangeByScoreCmd(key string, opt ZRangeByScore) *StringSliceCmd {
+	cmd := NewStringSliceCmd(opt.args("ZREVRANGEBYSCORE", key, opt.Max, opt.Min, false)...)
+	if err := checkScoreRange(opt.Min, opt.Max); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// NewZRevRangeByScoreWithScoresCmd is NewZRevRangeByScoreCmd with
+// WITHSCORES.
+func NewZRevRangeByScoreWithScoresCmd(key string, opt ZRangeByScore) *ZSliceCmd {
+	cmd := NewZSliceCmd(opt.args("ZREVRANGEBYSCORE", key, opt.Max, opt.Min, true)...)
+	if err := checkScoreRange(opt.Min, opt.Max); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+// NewZRangeByLexCmd is ZRANGEBYLEX key min max [LIMIT offset count],
+// which has no WITHSCORES. Bounds not starting with ( or [, nor - or +,
+// set the error of the command.
+func NewZRangeByLexCmd(key string, opt ZRangeByScore) *StringSliceCmd {
+	cmd := NewStringSliceCmd(opt.args("ZRANGEBYLEX", key, opt.Min, opt.Max, false)...)
+	if err := checkLexRange(opt.Min, opt.Max); err != nil {
+		cmd.setErr(err)
+	}
+	return cmd
+}
+
+//------------------------------------------------------------------------------
+
+type ScanCmd struct {
+	baseCmd
+
+	cursor int64
+	keys   []string
+}
+
+func NewScanCmd(args ...string) *ScanCmd {
+	return &ScanCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+// NewScanContinueCmd is SCAN cursor [MATCH match] [COUNT count], match
+// is left out if empty and count if not positive. cursor is 0 to start
+// an iteration, or the Cursor of the previous SCAN to resume it, which
+// can be stored to resume after a restart.
+func NewScanContinueCmd(cursor int64, match string, count int64) *ScanCmd {
+	args := []string{"SCAN", strconv.FormatInt(cursor, 10)}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.FormatInt(count, 10))
+	}
+	return NewScanCmd(args...)
+}
+
+func (cmd *ScanCmd) reset() {
+	cmd.cursor = 0
+	cmd.keys = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *ScanCmd) Val() (int64, []string) {
+	return cmd.cursor, cmd.keys
+}
+
+// Cursor returns the cursor to continue the iteration with, 0 when it
+// is complete.
+func (cmd *ScanCmd) Cursor() int64 {
+	return cmd.cursor
+}
+
+func (cmd *ScanCmd) Result() (int64, []string, error) {
+	return cmd.cursor, cmd.keys, cmd.err
+}
+
+func (cmd *ScanCmd) String() string {
+	return cmdString(cmd, cmd.keys)
+}
+
+func (cmd *ScanCmd) parseReply(rd *reader) error {
+	vi, err := parseReply(rd, parseSlice)
+	if err != nil {
+		cmd.err = err
+		return cmd.err
+	}
+	v, ok := vi.([]interface{})
+	if !ok || len(v) != 2 {
+		cmd.err = unexpectedReplyType(cmd, vi)
+		return cmd.err
+	}
+
+	cursor, ok := v[0].(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v[0])
+		return cmd.err
+	}
+	cmd.cursor, cmd.err = strconv.ParseInt(cursor, 10, 64)
+	if cmd.err != nil {
+		return cmd.err
+	}
+
+	keys, ok := v[1].([]interface{})
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v[1])
+		return cmd.err
+	}
+	for _, keyi := range keys {
+		key, ok := keyi.(string)
+		if !ok {
+			cmd.err = unexpectedReplyType(cmd, keyi)
+			return cmd.err
+		}
+		cmd.keys = append(cmd.keys, key)
+	}
+
+	return nil
+}
+
+func (cmd *ScanCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	keys := make([]interface{}, len(cmd.keys))
+	for i, key := range cmd.keys {
+		keys[i] = key
+	}
+	return FormatSlice([]interface{}{formatInt(cmd.cursor), keys})
+}
+
+//------------------------------------------------------------------------------
+
+type ClusterSlotInfo struct {
+	Start, End int
+	Addrs      []string
+}
+
+type ClusterSlotCmd struct {
+	baseCmd
+
+	val []ClusterSlotInfo
+}
+
+func NewClusterSlotCmd(args ...string) *ClusterSlotCmd {
+	return &ClusterSlotCmd{baseCmd: baseCmd{_args: args, _clusterKeyPos: 1}}
+}
+
+func (cmd *ClusterSlotCmd) Val() []ClusterSlotInfo {
+	return cmd.val
+}
+
+func (cmd *ClusterSlotCmd) Result() ([]ClusterSlotInfo, error) {
+	return cmd.Val(), cmd.Err()
+}
+
+func (cmd *ClusterSlotCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *ClusterSlotCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *ClusterSlotCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseClusterSlotInfoSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.([]ClusterSlotInfo)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+// Reply formats the slots like CLUSTER SLOTS, every node as its host and
+// port.
+func (cmd *ClusterSlotCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(cmd.val)))
+	b.WriteString("\r\n")
+	for _, info := range cmd.val {
+		b.WriteByte('*')
+		b.WriteString(util.Itoa(len(info.Addrs) + 2))
+		b.WriteString("\r\n")
+		b.Write(FormatInt(int64(info.Start)))
+		b.Write(FormatInt(int64(info.End)))
+		for _, addr := range info.Addrs {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				host, port = addr, "0"
+			}
+			n, _ := strconv.ParseInt(port, 10, 64)
+			b.WriteString("*2\r\n")
+			b.Write(FormatString(host))
+			b.Write(FormatInt(n))
+		}
+	}
+	return b.Bytes()
+}
+
+//------------------------------------------------------------------------------
+
+// ObjectCmd is OBJECT subcommand key. ENCODING replies the encoding name,
+// REFCOUNT, IDLETIME and FREQ reply integers.
+type ObjectCmd struct {
+	baseCmd
+
+	encoding string
+	n        int64
+}
+
+func NewObjectCmd(subcommand, key string) *ObjectCmd {
+	return &ObjectCmd{baseCmd: baseCmd{_args: []string{"OBJECT", subcommand, key}, _clusterKeyPos: 2}}
+}
+
+func (cmd *ObjectCmd) isEncoding() bool {
+	return strings.ToUpper(cmd._args[1]) == "ENCODING"
+}
+
+func (cmd *ObjectCmd) reset() {
+	cmd.encoding = ""
+	cmd.n = 0
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Encoding returns the reply of OBJECT ENCODING.
+func (cmd *ObjectCmd) Encoding() string {
+	return cmd.encoding
+}
+
+// Int returns the reply of OBJECT REFCOUNT, IDLETIME or FREQ.
+func (cmd *ObjectCmd) Int() int64 {
+	return cmd.n
+}
+
+// IdleTime returns the reply of OBJECT IDLETIME, which is in seconds.
+func (cmd *ObjectCmd) IdleTime() time.Duration {
+	return time.Duration(cmd.n) * time.Second
+}
+
+func (cmd *ObjectCmd) String() string {
+	if cmd.isEncoding() {
+		return cmdString(cmd, cmd.encoding)
+	}
+	return cmdString(cmd, cmd.n)
+}
+
+func (cmd *ObjectCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, nil)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+
+	var ok bool
+	if cmd.isEncoding() {
+		cmd.encoding, ok = v.(string)
+	} else {
+		cmd.n, ok = v.(int64)
+	}
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	return nil
+}
+
+func (cmd *ObjectCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	if cmd.isEncoding() {
+		return FormatString(cmd.encoding)
+	}
+	return FormatInt(cmd.n)
+}
+
+//------------------------------------------------------------------------------
+
+// DebugObjectCmd is DEBUG OBJECT key, its status reply is a list of
+// field:value pairs like "Value at:0x7f refcount:1 encoding:embstr".
+type DebugObjectCmd struct {
+	baseCmd
+
+	val string
+}
+
+func NewDebugObjectCmd(key string) *DebugObjectCmd {
+	return &DebugObjectCmd{baseCmd: baseCmd{_args: []string{"DEBUG", "OBJECT", key}, _clusterKeyPos: 2}}
+}
+
+func (cmd *DebugObjectCmd) reset() {
+	cmd.val = ""
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *DebugObjectCmd) Val() string {
+	return cmd.val
+}
+
+func (cmd *DebugObjectCmd) Result() (string, error) {
+	return cmd.val, cmd.err
+}
+
+// Field returns the value of field in the reply, "" if it is missing.
+func (cmd *DebugObjectCmd) Field(field string) string {
+	prefix := field + ":"
+	for _, f := range strings.Fields(cmd.val) {
+		if strings.HasPrefix(f, prefix) {
+			return f[len(prefix):]
+		}
+	}
+	return ""
+}
+
+func (cmd *DebugObjectCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *DebugObjectCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, nil)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	val, ok := v.(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.val = val
+	return nil
+}
+
+func (cmd *DebugObjectCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatStatus(cmd.val)
+}
+
+// DebugCmd is a DEBUG subcommand, e.g. SLEEP or JMAP, whose reply of
+// any type is replied as is. Bulk strings are binary safe.
+type DebugCmd struct {
+	baseCmd
+
+	status bool
+	val    interface{}
+}
+
+// NewDebugCmd is DEBUG subcommand args..., it is keyless. DEBUG SLEEP
+// seconds blocks the server on purpose, like WAIT its read timeout
+// leaves room for the sleep so the reply isn't given up on.
+func NewDebugCmd(subcommand string, args ...string) *DebugCmd {
+	cmdArgs := append([]string{"DEBUG", subcommand}, args...)
+	cmd := &DebugCmd{baseCmd: baseCmd{_args: cmdArgs}}
+	if strings.EqualFold(subcommand, "SLEEP") && len(args) > 0 {
+		cmd.setSleepReadTimeout(args[0])
+	}
+	return cmd
+}
+
+// maxSleepSeconds is the longest DEBUG SLEEP whose read timeout fits a
+// time.Duration.
+const maxSleepSeconds = float64(math.MaxInt64-int64(time.Second)) / float64(time.Second)
+
+// setSleepReadTimeout sets the read timeout of DEBUG SLEEP seconds.
+// Without a sleep Redis replies at once, the client defaults apply; so
+// they do to a sleep too long for a Duration, like inf.
+func (cmd *DebugCmd) setSleepReadTimeout(seconds string) {
+	sec, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || !(sec > 0) || sec > maxSleepSeconds {
+		return
+	}
+	cmd.setReadTimeout(readTimeout(time.Duration(sec * float64(time.Second))))
+}
+
+func (cmd *DebugCmd) reset() {
+	cmd.status = false
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *DebugCmd) Val() interface{} {
+	return cmd.val
+}
+
+func (cmd *DebugCmd) Result() (interface{}, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *DebugCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *DebugCmd) parseReply(rd *reader) error {
+	// A status and a bulk string parse to the same string, the type
+	// byte tells them apart for Reply.
+	if t, err := PeekReplyType(rd.Reader); err == nil {
+		cmd.status = t == ReplyStatus
+	}
+	v, err := parseReply(rd, parseSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	cmd.val = v
+	return nil
+}
+
+func (cmd *DebugCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	switch v := cmd.val.(type) {
+	case string:
+		if cmd.status {
+			return FormatStatus(v)
+		}
+		return FormatString(v)
+	case int64:
+		return FormatInt(v)
+	case []interface{}:
+		return FormatSlice(v)
+	}
+	return FormatError(unexpectedReplyType(cmd, cmd.val))
+}
+
+//------------------------------------------------------------------------------
+
+// HelloCmd is HELLO protover [AUTH username password]. It switches the
+// connection to protocol protover and replies the server properties,
+// e.g. server, version, proto, id, mode and role.
+type HelloCmd struct {
+	baseCmd
+
+	val map[string]interface{}
+	// The reply as received, to keep the order of the properties.
+	pairs []interface{}
+}
+
+// NewHelloCmd returns a HELLO switching to protocol ver. auth is the
+// username and password to authenticate with, a lone password is for
+// the default user.
+func NewHelloCmd(ver int, auth ...string) *HelloCmd {
+	args := []string{"HELLO", strconv.Itoa(ver)}
+	switch len(auth) {
+	case 0:
+	case 1:
+		args = append(args, "AUTH", "default", auth[0])
+	default:
+		args = append(args, "AUTH", auth[0], auth[1])
+	}
+	return &HelloCmd{baseCmd: baseCmd{_args: args}}
+}
+
+func (cmd *HelloCmd) reset() {
+	cmd.val = nil
+	cmd.pairs = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *HelloCmd) Val() map[string]interface{} {
+	return cmd.val
+}
+
+func (cmd *HelloCmd) Result() (map[string]interface{}, error) {
+	return cmd.val, cmd.err
+}
+
+// Proto returns the protocol version the server switched to, 0 if the
+// reply doesn't tell.
+func (cmd *HelloCmd) Proto() int {
+	proto, _ := cmd.val["proto"].(int64)
+	return int(proto)
+}
+
+func (cmd *HelloCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *HelloCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, parseSlice)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	pairs, ok := v.([]interface{})
+	if !ok || len(pairs)%2 != 0 {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	val := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			cmd.err = unexpectedReplyType(cmd, pairs[i])
+			return cmd.err
+		}
+		val[key] = pairs[i+1]
+	}
+	cmd.val, cmd.pairs = val, pairs
+	return nil
+}
+
+// Reply formats the properties as the flat array RESP2 clients get.
+func (cmd *HelloCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatSlice(cmd.pairs)
+}
+
+//------------------------------------------------------------------------------
+
+// ClientInfoCmd is CLIENT LIST or CLIENT INFO. The reply is a bulk string
+// with a line of space separated field=value pairs per connection, e.g.
+// "id=3 addr=127.0.0.1:50188 age=5 db=0 cmd=client|list".
+type ClientInfoCmd struct {
+	baseCmd
+
+	raw string
+	val []map[string]string
+}
+
+func NewClientListCmd() *ClientInfoCmd {
+	return &ClientInfoCmd{baseCmd: baseCmd{_args: []string{"CLIENT", "LIST"}}}
+}
+
+func NewClientInfoCmd() *ClientInfoCmd {
+	return &ClientInfoCmd{baseCmd: baseCmd{_args: []string{"CLIENT", "INFO"}}}
+}
+
+func (cmd *ClientInfoCmd) reset() {
+	cmd.raw = ""
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Val returns the fields of every connection in the reply.
+func (cmd *ClientInfoCmd) Val() []map[string]string {
+	return cmd.val
+}
+
+func (cmd *ClientInfoCmd) Result() ([]map[string]string, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *ClientInfoCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *ClientInfoCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, nil)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	raw, ok := v.(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.raw, cmd.val = raw, parseClientInfo(raw)
+	return nil
+}
+
+func parseClientInfo(raw string) []map[string]string {
+	var clients []map[string]string
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		client := make(map[string]string)
+		for _, field := range strings.Fields(line) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) == 2 {
+				client[kv[0]] = kv[1]
+			} else {
+				client[kv[0]] = ""
+			}
+		}
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Reply replies the bulk string as received.
+func (cmd *ClientInfoCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatString(cmd.raw)
+}
+
+//------------------------------------------------------------------------------
+
+// InfoSection is a section of INFO, e.g. Stats, its fields in order.
+type InfoSection struct {
+	Name   string
+	Fields []KeyValue
+}
+
+// InfoCmd is INFO [section ...]. The reply is a bulk string of sections
+// headed by "# Name" lines, each with a line of key:value per field.
+type InfoCmd struct {
+	baseCmd
+
+	raw string
+	val []InfoSection
+}
+
+func NewInfoCmd(args ...string) *InfoCmd {
+	return &InfoCmd{baseCmd: baseCmd{_args: args}}
+}
+
+func (cmd *InfoCmd) reset() {
+	cmd.raw = ""
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+// Val returns the sections in the reply.
+func (cmd *InfoCmd) Val() []InfoSection {
+	return cmd.val
+}
+
+func (cmd *InfoCmd) Result() ([]InfoSection, error) {
+	return cmd.val, cmd.err
+}
+
+// Get returns the value of key in section, false if there is none.
+func (cmd *InfoCmd) Get(section, key string) (string, bool) {
+	for _, s := range cmd.val {
+		if !strings.EqualFold(s.Name, section) {
+			continue
+		}
+		for _, f := range s.Fields {
+			if f.Key == key {
+				return f.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (cmd *InfoCmd) String() string {
+	return cmdString(cmd, cmd.raw)
+}
+
+func (cmd *InfoCmd) parseReply(rd *reader) error {
+	v, err := parseReply(rd, nil)
+	if err != nil {
+		cmd.err = err
+		return err
+	}
+	raw, ok := v.(string)
+	if !ok {
+		cmd.err = unexpectedReplyType(cmd, v)
+		return cmd.err
+	}
+	cmd.raw, cmd.val = raw, parseInfo(raw)
+	return nil
+}
+
+func parseInfo(raw string) []InfoSection {
+	var sections []InfoSection
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			sections = append(sections, InfoSection{Name: strings.TrimSpace(line[1:])})
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		if len(sections) == 0 {
+			sections = append(sections, InfoSection{})
+		}
+		s := &sections[len(sections)-1]
+		s.Fields = append(s.Fields, KeyValue{Key: line[:i], Value: line[i+1:]})
+	}
+	return sections
+}
+
+func formatInfo(sections []InfoSection) string {
+	var b strings.Builder
+	for i, s := range sections {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		if s.Name != "" {
+			b.WriteString("# ")
+			b.WriteString(s.Name)
+			b.WriteString("\r\n")
+		}
+		for _, f := range s.Fields {
+			b.WriteString(f.Key)
+			b.WriteByte(':')
+			b.WriteString(f.Value)
+			b.WriteString("\r\n")
+		}
+	}
+	return b.String()
+}
+
+// Reply replies the bulk string as received, or as merged by MergeInfo.
+func (cmd *InfoCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+	return FormatString(cmd.raw)
+}
+
+// infoCounterFields are the fields of INFO counting something over the
+// data or the clients of a node, which add up over the cluster. Besides
+// them only the total_* fields are summed; flags, timestamps and offsets
+// like cluster_enabled or rdb_last_save_time are not.
+var infoCounterFields = map[string]bool{
+	"blocked_clients":             true,
+	"connected_clients":           true,
+	"connected_slaves":            true,
+	"evicted_keys":                true,
+	"expired_keys":                true,
+	"instantaneous_ops_per_sec":   true,
+	"keyspace_hits":               true,
+	"keyspace_misses":             true,
+	"pubsub_channels":             true,
+	"pubsub_patterns":             true,
+	"rdb_changes_since_last_save": true,
+	"rejected_connections":        true,
+	"sync_full":                   true,
+	"sync_partial_err":            true,
+	"sync_partial_ok":             true,
+	"tracking_clients":            true,
+	"used_memory":                 true,
+	"used_memory_dataset":         true,
+	"used_memory_rss":             true,
+}
+
+func isInfoCounter(key string) bool {
+	return infoCounterFields[key] || strings.HasPrefix(key, "total_")
+}
+
+// MergeInfo merges the INFO replies of the nodes at addrs into one, as
+// if a single server answered. The counters, see infoCounterFields, are
+// summed. Other fields are kept if they are the same on every node, e.g. the version;
+// the ones which differ are listed in a section per node named after
+// the section and the address, e.g. "# Replication 10.0.0.1:7000". The
+// first failed reply fails the merge.
+func MergeInfo(addrs []string, cmds []*InfoCmd) *InfoCmd {
+	merged := NewInfoCmd("INFO")
+	type field struct{ section, key string }
+
+	var names []string
+	keys := make(map[string][]string)
+	values := make(map[field]map[int]string)
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			merged.setErr(err)
+			return merged
+		}
+		for _, s := range cmd.val {
+			if _, ok := keys[s.Name]; !ok {
+				names = append(names, s.Name)
+				keys[s.Name] = nil
+			}
+			for _, f := range s.Fields {
+				k := field{s.Name, f.Key}
+				if values[k] == nil {
+					values[k] = make(map[int]string, len(cmds))
+					keys[s.Name] = append(keys[s.Name], f.Key)
+				}
+				values[k][i] = f.Value
+			}
+		}
+	}
+
+	var sections []InfoSection
+	differ := make(map[string][]string)
+	for _, name := range names {
+		section := InfoSection{Name: name}
+		for _, key := range keys[name] {
+			if v, ok := mergeInfoField(key, values[field{name, key}], len(cmds)); ok {
+				section.Fields = append(section.Fields, KeyValue{Key: key, Value: v})
+			} else {
+				differ[name] = append(differ[name], key)
+			}
+		}
+		sections = append(sections, section)
+	}
+	for i, addr := range addrs {
+		for _, name := range names {
+			section := InfoSection{Name: strings.TrimSpace(name + " " + addr)}
+			for _, key := range differ[name] {
+				if v, ok := values[field{name, key}][i]; ok {
+					section.Fields = append(section.Fields, KeyValue{Key: key, Value: v})
+				}
+			}
+			if len(section.Fields) > 0 {
+				sections = append(sections, section)
+			}
+		}
+	}
+
+	merged.val = sections
+	merged.raw = formatInfo(sections)
+	return merged
+}
+
+// mergeInfoField returns the merged value of key given its values by
+// node, false if it must be listed per node.
+func mergeInfoField(key string, vals map[int]string, nodes int) (string, bool) {
+	if isInfoCounter(key) {
+		var sum int64
+		summed := true
+		for _, v := range vals {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				summed = false
+				break
+			}
+			sum += n
+		}
+		if summed {
+			return formatInt(sum), true
+		}
+	}
+
+	if len(vals) != nodes {
+		return "", false
+	}
+	first := vals[0]
+	for _, v := range vals {
+		if v != first {
+			return "", false
+		}
+	}
+	return first, true
+}
+
+//------------------------------------------------------------------------------
+
+// ExecCmd is the EXEC closing a transaction. Redis replies the queued
+// commands with +QUEUED and EXEC with an array holding their results,
+// which ExecCmd hands out to the queued commands in order.
+type ExecCmd struct {
+	baseCmd
+
+	cmds []Cmder
+}
+
+func NewExecCmd(cmds ...Cmder) *ExecCmd {
+	return &ExecCmd{baseCmd: baseCmd{_args: []string{"EXEC"}}, cmds: cmds}
+}
+
+// Val returns the queued commands.
+func (cmd *ExecCmd) Val() []Cmder {
+	return cmd.cmds
+}
+
+func (cmd *ExecCmd) Result() ([]Cmder, error) {
+	return cmd.cmds, cmd.err
+}
+
+func (cmd *ExecCmd) String() string {
+	return cmdString(cmd, nil)
+}
+
+// clusterKey routes the transaction by the first queued command which
+// has a key.
+func (cmd *ExecCmd) clusterKey() string {
+	for _, c := range cmd.cmds {
+		if key := c.clusterKey(); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+func (cmd *ExecCmd) clusterKeys() []string {
+	var keys []string
+	for _, c := range cmd.cmds {
+		keys = append(keys, c.clusterKeys()...)
+	}
+	return keys
+}
+
+func (cmd *ExecCmd) reset() {
+	cmd.err = nil
+	cmd.resetTimeouts()
+	resetCmds(cmd.cmds...)
+}
+
+// parseQueued parses the replies of MULTI and of the queued commands.
+// A command Redis refused to queue keeps its error, the transaction is
+// then aborted by EXEC.
+func (cmd *ExecCmd) parseQueued(rd *reader) error {
+	if _, err := parseReply(rd, nil); err != nil {
+		return err
+	}
+	for _, c := range cmd.cmds {
+		_, err := parseReply(rd, nil)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(redisError); !ok {
+			return err
+		}
+		c.setErr(err)
+	}
+	return nil
+}
+
+// parseReply parses the EXEC reply. Errors of the whole transaction,
+// EXECABORT or a WATCHed key being modified (*-1), are set on every
+// queued command. Otherwise every command parses its own element and
+// error of the first failed command is returned.
+func (cmd *ExecCmd) parseReply(rd *reader) error {
+	line, err := readLine(rd)
+	if err != nil {
+		cmd.err = err
+		setCmdsErr(cmd.cmds, err)
+		return err
+	}
+	if len(line) == 0 {
+		cmd.err = errEmptyLine
+		setCmdsErr(cmd.cmds, cmd.err)
+		return cmd.err
+	}
+
+	switch {
+	case line[0] == '-':
+		cmd.err = errorf(string(line[1:]))
+		for _, c := range cmd.cmds {
+			if c.Err() == nil {
+				c.setErr(cmd.err)
+			}
+		}
+		return cmd.err
+	case len(line) == 3 && line[0] == '*' && line[1] == '-' && line[2] == '1':
+		cmd.err = TxFailedErr
+		setCmdsErr(cmd.cmds, TxFailedErr)
+		return TxFailedErr
+	case line[0] != '*':
+		cmd.err = fmt.Errorf("redis: expected '*', but got line %q", line)
+		setCmdsErr(cmd.cmds, cmd.err)
+		return cmd.err
+	}
+
+	n, err := parseLen(line)
+	if err != nil {
+		cmd.err = err
+		setCmdsErr(cmd.cmds, err)
+		return err
+	}
+	if n != int64(len(cmd.cmds)) {
+		cmd.err = fmt.Errorf("redis: got %d replies for %d queued commands", n, len(cmd.cmds))
+		setCmdsErr(cmd.cmds, cmd.err)
+		return cmd.err
+	}
+
+	var firstCmdErr error
+	for i, c := range cmd.cmds {
+		err := c.parseReply(rd)
+		if err == nil {
+			continue
+		}
+		if firstCmdErr == nil {
+			firstCmdErr = err
+		}
+		if isNetworkError(err) {
+			cmd.err = err
+			setCmdsErr(cmd.cmds[i+1:], err)
+			break
+		}
+	}
+	return firstCmdErr
+}
+
+func (cmd *ExecCmd) Reply() []byte {
+	err := cmd.Err()
+	if err == TxFailedErr {
+		return []byte("*-1\r\n")
+	}
+	if err != nil {
+		return FormatError(err)
+	}
+
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(cmd.cmds)))
+	b.WriteString("\r\n")
+	for _, c := range cmd.cmds {
+		b.Write(c.Reply())
+	}
+	return b.Bytes()
 }
@@ -0,0 +1,1517 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongzerun/smartproxy/redis/bufio.v1"
+)
+
+func init() {
+	// A value formatSlice can't write is a bug, fail the test hitting it.
+	unformattable = panicUnformattable
+}
+
+func panicUnformattable(v interface{}) {
+	panic(fmt.Sprintf("redis: can't format %T in a multi bulk reply", v))
+}
+
+func newTestReader(s string) *reader {
+	return newReader(bufio.NewReader(strings.NewReader(s)), nil)
+}
+
+func TestNullableStringSliceCmdMGet(t *testing.T) {
+	reply := "*4\r\n$1\r\na\r\n$-1\r\n$0\r\n\r\n$-1\r\n"
+
+	cmd := NewNullableStringSliceCmd("MGET", "a", "missing", "empty", "missing2")
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+
+	ptrs := cmd.Val()
+	if len(ptrs) != 4 {
+		t.Fatalf("got %d elements, wanted 4", len(ptrs))
+	}
+	if ptrs[0] == nil || *ptrs[0] != "a" {
+		t.Errorf("element 0: got %v, wanted a", ptrs[0])
+	}
+	if ptrs[1] != nil || ptrs[3] != nil {
+		t.Errorf("missing keys must stay nil, got %v %v", ptrs[1], ptrs[3])
+	}
+	if ptrs[2] == nil || *ptrs[2] != "" {
+		t.Errorf("empty value must not be nil, got %v", ptrs[2])
+	}
+
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+}
+
+func TestStringSliceCmdRejectsNil(t *testing.T) {
+	cmd := NewStringSliceCmd("LRANGE", "k", "0", "-1")
+	if err := cmd.parseReply(newTestReader("*2\r\n$1\r\na\r\n$-1\r\n")); err != Nil {
+		t.Fatalf("got %v, wanted %v", err, Nil)
+	}
+}
+
+func TestKeyValueSliceCmdKeepsOrder(t *testing.T) {
+	reply := "*6\r\n$4\r\nzeta\r\n$1\r\n1\r\n$5\r\nalpha\r\n$1\r\n2\r\n$3\r\nmid\r\n$0\r\n\r\n"
+
+	cmd := NewKeyValueSliceCmd("CONFIG", "GET", "*")
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+
+	want := []KeyValue{{"zeta", "1"}, {"alpha", "2"}, {"mid", ""}}
+	got := cmd.Val()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, wanted %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("pair %d: got %v, wanted %v", i, got[i], want[i])
+		}
+	}
+
+	if b := string(cmd.Reply()); b != reply {
+		t.Errorf("Reply: got %q, wanted %q", b, reply)
+	}
+}
+
+func TestStringCmdBytes(t *testing.T) {
+	value := "\x00\xff\xfe\r\n\x80"
+	cmd := NewStringCmd("GET", "key")
+	if err := cmd.parseReply(newTestReader("$6\r\n" + value + "\r\n")); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	b, err := cmd.Bytes()
+	if err != nil || string(b) != value {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	b[0] = 'x'
+	if cmd.Val() != value {
+		t.Error("Bytes must return a copy")
+	}
+
+	cmd = NewStringCmd("GET", "missing")
+	cmd.parseReply(newTestReader("$-1\r\n"))
+	if b, err := cmd.Bytes(); err != Nil || b != nil {
+		t.Errorf("got %q, %v, wanted %v", b, err, Nil)
+	}
+}
+
+type binaryValue struct {
+	b []byte
+}
+
+func (v *binaryValue) UnmarshalBinary(b []byte) error {
+	v.b = b
+	return nil
+}
+
+func TestStringCmdScan(t *testing.T) {
+	newCmd := func(val string) *StringCmd {
+		cmd := NewStringCmd("GET", "key")
+		cmd.val = val
+		return cmd
+	}
+
+	var s string
+	if err := newCmd("hello").Scan(&s); err != nil || s != "hello" {
+		t.Errorf("string: got %q, %v", s, err)
+	}
+	var i int
+	if err := newCmd("-42").Scan(&i); err != nil || i != -42 {
+		t.Errorf("int: got %d, %v", i, err)
+	}
+	var i64 int64
+	if err := newCmd("9223372036854775807").Scan(&i64); err != nil || i64 != 9223372036854775807 {
+		t.Errorf("int64: got %d, %v", i64, err)
+	}
+	var f float64
+	if err := newCmd("1.5").Scan(&f); err != nil || f != 1.5 {
+		t.Errorf("float64: got %v, %v", f, err)
+	}
+	var b bool
+	if err := newCmd("1").Scan(&b); err != nil || !b {
+		t.Errorf("bool: got %v, %v", b, err)
+	}
+	var bv binaryValue
+	if err := newCmd("\x00\x01").Scan(&bv); err != nil || string(bv.b) != "\x00\x01" {
+		t.Errorf("BinaryUnmarshaler: got %q, %v", bv.b, err)
+	}
+
+	if err := newCmd("abc").Scan(&i); err == nil {
+		t.Error("int: wanted a parse error")
+	}
+	var u uint8
+	if err := newCmd("1").Scan(&u); err == nil || !strings.Contains(err.Error(), "*uint8") {
+		t.Errorf("got %v, wanted unsupported type error", err)
+	}
+
+	cmd := newCmd("")
+	cmd.err = Nil
+	if err := cmd.Scan(&s); err != Nil {
+		t.Errorf("got %v, wanted %v", err, Nil)
+	}
+}
+
+func TestDurationCmdPrecision(t *testing.T) {
+	tests := []struct {
+		precision time.Duration
+		reply     string
+		want      time.Duration
+	}{
+		{time.Second, ":42\r\n", 42 * time.Second},
+		{time.Millisecond, ":1500\r\n", 1500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		cmd := NewDurationCmd(test.precision, "TTL", "key")
+		if err := cmd.parseReply(newTestReader(test.reply)); err != nil {
+			t.Fatalf("parseReply: %s", err)
+		}
+		if cmd.Val() != test.want {
+			t.Errorf("got %s, wanted %s", cmd.Val(), test.want)
+		}
+		if got := string(cmd.Reply()); got != test.reply {
+			t.Errorf("Reply: got %q, wanted %q", got, test.reply)
+		}
+	}
+
+	for _, precision := range []time.Duration{0, time.Microsecond, time.Minute} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("precision %s must panic", precision)
+				}
+			}()
+			NewDurationCmd(precision, "TTL", "key")
+		}()
+	}
+}
+
+func TestCmdName(t *testing.T) {
+	tests := []struct {
+		cmd  Cmder
+		want string
+	}{
+		{NewStringCmd("get", "key"), "GET"},
+		{NewIntCmd("IncrBy", "key", "1"), "INCRBY"},
+		{NewExecCmd(), "EXEC"},
+		{NewCmd(), ""},
+	}
+	for _, test := range tests {
+		if got := test.cmd.Name(); got != test.want {
+			t.Errorf("%v: got %q, wanted %q", test.cmd.args(), got, test.want)
+		}
+	}
+}
+
+func TestUint64Cmd(t *testing.T) {
+	// math.MaxInt64 + 1 overflows IntCmd.
+	const big = "9223372036854775808"
+	for _, reply := range []string{":" + big + "\r\n", "$19\r\n" + big + "\r\n"} {
+		cmd := NewUint64Cmd("DEBUG", "OBJECT", "key")
+		if err := cmd.parseReply(newTestReader(reply)); err != nil {
+			t.Fatalf("%q: %s", reply, err)
+		}
+		if cmd.Val() != 1<<63 {
+			t.Errorf("%q: got %d, wanted %d", reply, cmd.Val(), uint64(1<<63))
+		}
+		if got := string(cmd.Reply()); got != ":"+big+"\r\n" {
+			t.Errorf("Reply: got %q", got)
+		}
+	}
+
+	cmd := NewUint64Cmd("BITCOUNT", "key")
+	if err := cmd.parseReply(newTestReader(":-1\r\n")); err == nil {
+		t.Error("negative value must be rejected")
+	}
+	if err := NewIntCmd("INCR", "key").parseReply(newTestReader(":" + big + "\r\n")); err == nil {
+		t.Error("IntCmd must not accept values above math.MaxInt64")
+	}
+
+	if got := string(FormatSlice([]interface{}{uint64(1 << 63)})); got != "*1\r\n$19\r\n"+big+"\r\n" {
+		t.Errorf("FormatSlice: got %q", got)
+	}
+}
+
+func TestObjectCmd(t *testing.T) {
+	cmd := NewObjectCmd("ENCODING", "key")
+	if cmd.clusterKey() != "key" {
+		t.Errorf("got key %q, wanted key", cmd.clusterKey())
+	}
+	if err := cmd.parseReply(newTestReader("$7\r\nziplist\r\n")); err != nil || cmd.Encoding() != "ziplist" {
+		t.Errorf("got %q, %v", cmd.Encoding(), err)
+	}
+	if got := string(cmd.Reply()); got != "$7\r\nziplist\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	cmd = NewObjectCmd("idletime", "key")
+	if cmd.clusterKey() != "key" {
+		t.Errorf("got key %q, wanted key", cmd.clusterKey())
+	}
+	if err := cmd.parseReply(newTestReader(":120\r\n")); err != nil || cmd.IdleTime() != 2*time.Minute {
+		t.Errorf("got %s, %v", cmd.IdleTime(), err)
+	}
+	if got := string(cmd.Reply()); got != ":120\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	cmd = NewObjectCmd("REFCOUNT", "missing")
+	if err := cmd.parseReply(newTestReader("$-1\r\n")); err != Nil {
+		t.Errorf("got %v, wanted %v", err, Nil)
+	}
+	cmd = NewObjectCmd("REFCOUNT", "key")
+	if err := cmd.parseReply(newTestReader("+raw\r\n")); err == nil {
+		t.Error("REFCOUNT must reply an integer")
+	}
+}
+
+func TestPingCmd(t *testing.T) {
+	cmd := NewPingCmd()
+	if cmd.clusterKey() != "" {
+		t.Errorf("PING must be keyless, got key %q", cmd.clusterKey())
+	}
+	if err := cmd.parseReply(newTestReader("+PONG\r\n")); err != nil || cmd.Val() != "PONG" {
+		t.Errorf("got %q, %v", cmd.Val(), err)
+	}
+
+	msg := NewPingMsgCmd("hello")
+	if msg.clusterKey() != "" {
+		t.Errorf("PING must be keyless, got key %q", msg.clusterKey())
+	}
+	if err := msg.parseReply(newTestReader("$5\r\nhello\r\n")); err != nil || msg.Val() != "hello" {
+		t.Errorf("got %q, %v", msg.Val(), err)
+	}
+	if got := string(msg.Reply()); got != "$5\r\nhello\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestWaitCmd(t *testing.T) {
+	cmd := NewWaitCmd(2, 1500*time.Millisecond)
+	if got := strings.Join(cmd.args(), " "); got != "WAIT 2 1500" {
+		t.Errorf("got %q", got)
+	}
+	if cmd.clusterKey() != "" {
+		t.Errorf("WAIT must be keyless, got key %q", cmd.clusterKey())
+	}
+	if rd := cmd.readTimeout(); rd == nil || *rd <= 1500*time.Millisecond {
+		t.Errorf("got read timeout %v, wanted above the wait", rd)
+	}
+	if err := cmd.parseReply(newTestReader(":1\r\n")); err != nil || cmd.Val() != 1 {
+		t.Errorf("got %d, %v", cmd.Val(), err)
+	}
+
+	// WAIT 0 blocks until the replicas acked.
+	if rd := NewWaitCmd(1, 0).readTimeout(); rd == nil || *rd != 0 {
+		t.Errorf("got read timeout %v, wanted none", rd)
+	}
+}
+
+func TestDebugSleepTimeout(t *testing.T) {
+	opt := &Options{ReadTimeout: time.Second}
+	for _, tt := range []struct {
+		args  []string
+		sleep time.Duration
+	}{
+		{[]string{"5"}, 5 * time.Second},
+		{[]string{"0.5"}, 500 * time.Millisecond},
+	} {
+		for _, subcommand := range []string{"SLEEP", "sleep"} {
+			cmd := NewDebugCmd(subcommand, tt.args...)
+			cn := &conn{}
+			cn.applyTimeouts(opt, cmd)
+			if cn.ReadTimeout <= tt.sleep {
+				t.Errorf("DEBUG %s %s: got read timeout %s, wanted above the sleep", subcommand, tt.args[0], cn.ReadTimeout)
+			}
+		}
+	}
+
+	// No sleep, or one Redis rejects, keeps the client default.
+	for _, args := range [][]string{{"0"}, {"-1"}, {"x"}, {"1e12"}, {"inf"}, {"nan"}, nil} {
+		if rd := NewDebugCmd("SLEEP", args...).readTimeout(); rd != nil {
+			t.Errorf("DEBUG SLEEP %q: got read timeout %s, wanted none", args, *rd)
+		}
+	}
+	if rd := NewDebugCmd("RELOAD").readTimeout(); rd != nil {
+		t.Errorf("DEBUG RELOAD: got read timeout %s, wanted none", *rd)
+	}
+}
+
+func TestBlockingCmdTimeouts(t *testing.T) {
+	// Redis accepts fractional timeouts.
+	fractional := NewStringSliceCmd("BLPOP", "a", "0.5")
+	fractional.setBlockingReadTimeout()
+
+	tests := []struct {
+		cmd  Cmder
+		keys []string
+		rd   time.Duration
+	}{
+		{NewBLPopCmd(5*time.Second, "a", "b"), []string{"a", "b"}, 6 * time.Second},
+		{NewBRPopCmd(0, "a", "b"), []string{"a", "b"}, 0},
+		{NewBRPopLPushCmd("src", "dst", time.Second), []string{"src", "dst"}, 2 * time.Second},
+		{NewBLMoveCmd("src", "dst", "LEFT", "RIGHT", 0), []string{"src", "dst"}, 0},
+		{fractional, []string{"a"}, 1500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		rd := test.cmd.readTimeout()
+		if rd == nil || *rd != test.rd {
+			t.Errorf("%q: got read timeout %v, wanted %s", test.cmd.args(), rd, test.rd)
+		}
+		if strings.Join(test.cmd.clusterKeys(), " ") != strings.Join(test.keys, " ") {
+			t.Errorf("%q: got keys %q, wanted %q", test.cmd.args(), test.cmd.clusterKeys(), test.keys)
+		}
+	}
+}
+
+func TestDebugObjectAndMemoryUsage(t *testing.T) {
+	usage := NewMemoryUsageCmd("key", 5)
+	if got := strings.Join(usage.args(), " "); got != "MEMORY USAGE key SAMPLES 5" {
+		t.Errorf("got %q", got)
+	}
+	if usage.clusterKey() != "key" || len(usage.clusterKeys()) != 1 {
+		t.Errorf("got keys %q, wanted key", usage.clusterKeys())
+	}
+	if err := usage.parseReply(newTestReader(":56\r\n")); err != nil || usage.Val() != 56 {
+		t.Errorf("got %d, %v", usage.Val(), err)
+	}
+	usage = NewMemoryUsageCmd("missing")
+	if err := usage.parseReply(newTestReader("$-1\r\n")); err != Nil {
+		t.Errorf("got %v, wanted %v", err, Nil)
+	}
+	if got := string(usage.Reply()); got != "$-1\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	debug := NewDebugObjectCmd("key")
+	if debug.clusterKey() != "key" {
+		t.Errorf("got key %q, wanted key", debug.clusterKey())
+	}
+	reply := "+Value at:0x7f refcount:1 encoding:embstr serializedlength:4\r\n"
+	if err := debug.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	if debug.Field("encoding") != "embstr" || debug.Field("missing") != "" {
+		t.Errorf("got encoding %q", debug.Field("encoding"))
+	}
+	if got := string(debug.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+}
+
+func TestDurationCmdSentinels(t *testing.T) {
+	for _, cmd := range []*DurationCmd{NewTTLCmd("key"), NewPTTLCmd("key")} {
+		for _, want := range []time.Duration{TTLNoExpire, TTLNoKey} {
+			reply := string(FormatInt(int64(want)))
+			if err := cmd.parseReply(newTestReader(reply)); err != nil {
+				t.Fatalf("parseReply: %s", err)
+			}
+			if cmd.Val() != want {
+				t.Errorf("%s %q: got %d, wanted %d", cmd.Name(), reply, cmd.Val(), want)
+			}
+			if got := string(cmd.Reply()); got != reply {
+				t.Errorf("%s Reply: got %q, wanted %q", cmd.Name(), got, reply)
+			}
+		}
+	}
+
+	cmd := NewPTTLCmd("key")
+	cmd.parseReply(newTestReader(":2500\r\n"))
+	if cmd.Val() != 2500*time.Millisecond {
+		t.Errorf("got %s, wanted 2.5s", cmd.Val())
+	}
+}
+
+func TestUnexpectedReplyType(t *testing.T) {
+	tests := []struct {
+		cmd   Cmder
+		reply string
+	}{
+		{NewSliceCmd("HMGET", "h", "f"), "+OK\r\n"},
+		{NewStatusCmd("SET", "k", "v"), ":1\r\n"},
+		{NewIntCmd("INCR", "k"), "+OK\r\n"},
+		{NewUint64Cmd("BITCOUNT", "k"), "*0\r\n"},
+		{NewTTLCmd("k"), "$1\r\na\r\n"},
+		{NewBoolCmd("EXISTS", "k"), "*0\r\n"},
+		{NewStringCmd("GET", "k"), ":1\r\n"},
+		{NewFloatCmd("INCRBYFLOAT", "k", "1"), ":1\r\n"},
+		{NewStringSliceCmd("LRANGE", "k", "0", "-1"), "+OK\r\n"},
+		{NewNullableStringSliceCmd("MGET", "k"), ":1\r\n"},
+		{NewBoolSliceCmd("SCRIPT", "EXISTS", "sha"), "+OK\r\n"},
+		{NewStringStringMapCmd("HGETALL", "h"), ":1\r\n"},
+		{NewStringIntMapCmd("PUBSUB", "NUMSUB"), "+OK\r\n"},
+		{NewKeyValueSliceCmd("CONFIG", "GET", "*"), ":1\r\n"},
+		{NewZSliceCmd("ZRANGE", "z", "0", "-1", "WITHSCORES"), "+OK\r\n"},
+		{NewScanCmd("SCAN", "0"), "+OK\r\n"},
+		{NewScanCmd("SCAN", "0"), "*2\r\n:0\r\n*0\r\n"},
+		{NewClusterSlotCmd("CLUSTER", "SLOTS"), ":1\r\n"},
+		{NewObjectCmd("ENCODING", "k"), ":1\r\n"},
+		{NewDebugObjectCmd("k"), ":1\r\n"},
+	}
+	for _, test := range tests {
+		err := test.cmd.parseReply(newTestReader(test.reply))
+		if !errors.Is(err, ErrUnexpectedReplyType) {
+			t.Errorf("%q %q: got %v, wanted %v", test.cmd.args(), test.reply, err, ErrUnexpectedReplyType)
+			continue
+		}
+		if test.cmd.Err() != err {
+			t.Errorf("%q: error is not stored on the command", test.cmd.args())
+		}
+		if got := string(test.cmd.Reply()); !strings.HasPrefix(got, "-ERR unexpected reply type") {
+			t.Errorf("%q: Reply got %q", test.cmd.args(), got)
+		}
+	}
+}
+
+func TestSliceCmdLen(t *testing.T) {
+	cmds := []interface {
+		Len() int
+		IsEmpty() bool
+	}{
+		NewSliceCmd("HMGET", "h", "f"),
+		NewStringSliceCmd("KEYS", "*"),
+		NewBoolSliceCmd("SCRIPT", "EXISTS", "sha"),
+		NewZSliceCmd("ZRANGE", "z", "0", "-1", "WITHSCORES"),
+	}
+	for _, cmd := range cmds {
+		if cmd.Len() != 0 || !cmd.IsEmpty() {
+			t.Errorf("%T: got Len %d for a nil reply", cmd, cmd.Len())
+		}
+	}
+
+	cmd := NewStringSliceCmd("KEYS", "*")
+	cmd.parseReply(newTestReader("*2\r\n$1\r\na\r\n$1\r\nb\r\n"))
+	if cmd.Len() != 2 || cmd.IsEmpty() {
+		t.Errorf("got Len %d, wanted 2", cmd.Len())
+	}
+}
+
+func TestStringStringMapCmdOrdered(t *testing.T) {
+	reply := "*6\r\n$1\r\nb\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\n2\r\n$1\r\nb\r\n$1\r\n3\r\n"
+
+	cmd := NewOrderedStringStringMapCmd("HGETALL", "h")
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	want := []KeyValue{{"b", "1"}, {"a", "2"}, {"b", "3"}}
+	if !reflect.DeepEqual(cmd.Pairs(), want) {
+		t.Errorf("got pairs %v, wanted %v", cmd.Pairs(), want)
+	}
+	if val := cmd.Val(); len(val) != 2 || val["b"] != "3" || val["a"] != "2" {
+		t.Errorf("got %v, wanted the last value of b", val)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+
+	// A transformer sees the map, the pairs follow it in upstream order.
+	cmd.setValue(map[string]string{"a": "x", "b": "y", "c": "z"})
+	want = []KeyValue{{"b", "y"}, {"a", "x"}, {"b", "y"}, {"c", "z"}}
+	if !reflect.DeepEqual(cmd.Pairs(), want) {
+		t.Errorf("got pairs %v, wanted %v", cmd.Pairs(), want)
+	}
+
+	cmd = NewStringStringMapCmd("HGETALL", "h")
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	if cmd.Pairs() != nil || len(cmd.Val()) != 2 {
+		t.Errorf("got pairs %v and %v, wanted the map only", cmd.Pairs(), cmd.Val())
+	}
+	if got := string(cmd.Reply()); !strings.HasPrefix(got, "*4\r\n") {
+		t.Errorf("Reply: got %q, wanted 2 fields", got)
+	}
+}
+
+func TestFloatSliceCmdZMScore(t *testing.T) {
+	reply := "*2\r\n$3\r\n1.5\r\n$-1\r\n"
+
+	cmd := NewFloatSliceCmd("ZMSCORE", "z", "present", "missing")
+	if cmd.clusterKey() != "z" {
+		t.Errorf("got key %q, wanted z", cmd.clusterKey())
+	}
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	vals := cmd.Val()
+	if len(vals) != 2 || vals[0] == nil || *vals[0] != 1.5 || vals[1] != nil {
+		t.Fatalf("got %v, wanted [1.5 nil]", vals)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+
+	cmd = NewFloatSliceCmd("ZMSCORE", "z", "m")
+	if err := cmd.parseReply(newTestReader("*1\r\n$3\r\nabc\r\n")); err == nil {
+		t.Error("non numeric element must fail")
+	}
+}
+
+func TestIntSliceCmdBitField(t *testing.T) {
+	reply := "*3\r\n:1\r\n:-5\r\n$-1\r\n"
+
+	cmd := NewIntSliceCmd("BITFIELD", "k", "INCRBY", "u2", "0", "1", "OVERFLOW", "FAIL")
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	if got := cmd.Val(); len(got) != 3 || got[0] != 1 || got[1] != -5 {
+		t.Errorf("got %v, wanted [1 -5 0]", got)
+	}
+	if cmd.IsNil(0) || !cmd.IsNil(2) {
+		t.Error("only the last element is nil")
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+}
+
+func TestBitPosAndBitFieldRO(t *testing.T) {
+	start, end := int64(2), int64(-1)
+	pos := NewBitPosCmd("k", 1, &start, &end, "bit")
+	if want := []string{"BITPOS", "k", "1", "2", "-1", "BIT"}; !reflect.DeepEqual(pos.args(), want) {
+		t.Errorf("got %q, wanted %q", pos.args(), want)
+	}
+	if pos.clusterKey() != "k" || !pos.IsReadOnly() {
+		t.Errorf("got key %q readonly %v", pos.clusterKey(), pos.IsReadOnly())
+	}
+	if err := pos.parseReply(newTestReader(":-1\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(pos.Reply()); pos.Val() != -1 || got != ":-1\r\n" {
+		t.Errorf("got %d %q, wanted -1", pos.Val(), got)
+	}
+
+	ro := NewBitFieldROCmd("k", "u8", "0", "i4", "#1")
+	if want := []string{"BITFIELD_RO", "k", "GET", "u8", "0", "GET", "i4", "#1"}; !reflect.DeepEqual(ro.args(), want) {
+		t.Errorf("got %q, wanted %q", ro.args(), want)
+	}
+	if ro.clusterKey() != "k" || !ro.IsReadOnly() {
+		t.Errorf("got key %q readonly %v", ro.clusterKey(), ro.IsReadOnly())
+	}
+	if NewIntSliceCmd("BITFIELD", "k", "GET", "u8", "0").IsReadOnly() {
+		t.Error("BITFIELD must not be read only")
+	}
+	reply := "*2\r\n:255\r\n:-3\r\n"
+	if err := ro.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(ro.Reply()); got != reply {
+		t.Errorf("got %q, wanted %q", got, reply)
+	}
+	if NewBitFieldROCmd("k", "u8").Err() == nil {
+		t.Error("wanted an odd number of fields to be rejected")
+	}
+}
+
+func TestTypeCmd(t *testing.T) {
+	for _, reply := range []string{"+none\r\n", "$4\r\nnone\r\n"} {
+		cmd := NewTypeCmd("missing")
+		if cmd.clusterKey() != "missing" {
+			t.Errorf("got key %q, wanted missing", cmd.clusterKey())
+		}
+		if err := cmd.parseReply(newTestReader(reply)); err != nil {
+			t.Fatalf("parseReply: %s", err)
+		}
+		if got := string(cmd.Reply()); got != "+none\r\n" {
+			t.Errorf("%q: Reply got %q, wanted %q", reply, got, "+none\r\n")
+		}
+	}
+}
+
+const hello3Reply = "%7\r\n" +
+	"$6\r\nserver\r\n$5\r\nredis\r\n" +
+	"$7\r\nversion\r\n$5\r\n7.2.4\r\n" +
+	"$5\r\nproto\r\n:3\r\n" +
+	"$2\r\nid\r\n:10\r\n" +
+	"$4\r\nmode\r\n$10\r\nstandalone\r\n" +
+	"$4\r\nrole\r\n$6\r\nmaster\r\n" +
+	"$7\r\nmodules\r\n*0\r\n"
+
+func TestHelloCmd(t *testing.T) {
+	cmd := NewHelloCmd(3, "pw")
+	if got := strings.Join(cmd.args(), " "); got != "HELLO 3 AUTH default pw" {
+		t.Errorf("got %q", got)
+	}
+	if got := strings.Join(NewHelloCmd(3, "user", "pw").args(), " "); got != "HELLO 3 AUTH user pw" {
+		t.Errorf("got %q", got)
+	}
+
+	if err := cmd.parseReply(newTestReader(hello3Reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	if cmd.Proto() != 3 {
+		t.Errorf("got proto %d, wanted 3", cmd.Proto())
+	}
+	props := cmd.Val()
+	if props["server"] != "redis" || props["version"] != "7.2.4" || props["role"] != "master" {
+		t.Errorf("got %v", props)
+	}
+	if modules, ok := props["modules"].([]interface{}); !ok || len(modules) != 0 {
+		t.Errorf("got modules %#v", props["modules"])
+	}
+	if got := string(cmd.Reply()); !strings.HasPrefix(got, "*14\r\n$6\r\nserver\r\n") {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestBitCountCmd(t *testing.T) {
+	start, end := int64(1), int64(-2)
+	tests := []struct {
+		cmd  *IntCmd
+		want string
+	}{
+		{NewBitCountCmd("key", nil, nil, ""), "BITCOUNT key"},
+		{NewBitCountCmd("key", nil, nil, "BIT"), "BITCOUNT key"},
+		{NewBitCountCmd("key", &start, &end, ""), "BITCOUNT key 1 -2"},
+		{NewBitCountCmd("key", &start, &end, "byte"), "BITCOUNT key 1 -2 BYTE"},
+		{NewBitCountCmd("key", &start, &end, "BIT"), "BITCOUNT key 1 -2 BIT"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(test.cmd.args(), " "); got != test.want {
+			t.Errorf("got %q, wanted %q", got, test.want)
+		}
+		if test.cmd.clusterKey() != "key" {
+			t.Errorf("%q: got key %q", test.want, test.cmd.clusterKey())
+		}
+	}
+}
+
+func TestClientInfoCmd(t *testing.T) {
+	list := "id=3 addr=127.0.0.1:50188 laddr=127.0.0.1:6379 fd=8 name= age=5 idle=0 db=0 cmd=client|list\n" +
+		"id=4 addr=10.0.0.2:41234 laddr=127.0.0.1:6379 fd=9 name=worker age=120 idle=3 db=2 cmd=get\n"
+	reply := "$" + strconv.Itoa(len(list)) + "\r\n" + list + "\r\n"
+
+	cmd := NewClientListCmd()
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	clients := cmd.Val()
+	if len(clients) != 2 {
+		t.Fatalf("got %d clients, wanted 2", len(clients))
+	}
+	if c := clients[0]; c["addr"] != "127.0.0.1:50188" || c["cmd"] != "client|list" || c["name"] != "" {
+		t.Errorf("got %v", c)
+	}
+	if c := clients[1]; c["age"] != "120" || c["db"] != "2" || c["name"] != "worker" {
+		t.Errorf("got %v", c)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+}
+
+func TestResetDropsTimeouts(t *testing.T) {
+	cmd := NewIntCmd("WAIT", "1", "5000")
+	cmd.setReadTimeout(6 * time.Second)
+	cmd.setWriteTimeout(time.Second)
+	cmd.reset()
+	if cmd.readTimeout() != nil || cmd.writeTimeout() != nil {
+		t.Errorf("got timeouts %v %v after reset", cmd.readTimeout(), cmd.writeTimeout())
+	}
+
+	// A retried command keeps its timeouts.
+	blpop := NewBLPopCmd(5*time.Second, "list")
+	blpop.setErr(Nil)
+	resetCmds(blpop)
+	if rd := blpop.readTimeout(); rd == nil || *rd != 6*time.Second {
+		t.Errorf("got read timeout %v after retry reset", rd)
+	}
+	if blpop.Err() != nil {
+		t.Errorf("got %v after retry reset", blpop.Err())
+	}
+}
+
+func TestDumpRestoreRoundTrip(t *testing.T) {
+	// Serialized values are binary, not UTF-8.
+	payload := "\x00\x03foo\r\n\xff\xfe\x09\x00\xb2\x8c\xd5\x1e"
+	dump := NewDumpCmd("src")
+	if err := dump.parseReply(newTestReader("$" + strconv.Itoa(len(payload)) + "\r\n" + payload + "\r\n")); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	b, err := dump.Bytes()
+	if err != nil || string(b) != payload {
+		t.Fatalf("got %q, %v", b, err)
+	}
+
+	restore := NewRestoreCmd("dst", 1500, b, true)
+	args := restore.args()
+	if len(args) != 5 || args[0] != "RESTORE" || args[1] != "dst" || args[2] != "1500" || args[4] != "REPLACE" {
+		t.Fatalf("got %q", args)
+	}
+	if args[3] != payload {
+		t.Errorf("got payload %q, wanted %q", args[3], payload)
+	}
+	if restore.clusterKey() != "dst" {
+		t.Errorf("got key %q, wanted dst", restore.clusterKey())
+	}
+	if got := NewRestoreCmd("dst", 0, b, false).args(); len(got) != 4 {
+		t.Errorf("got %q, wanted no REPLACE", got)
+	}
+
+	req := EncodeCommand(args)
+	if !strings.Contains(string(req), "$"+strconv.Itoa(len(payload))+"\r\n"+payload+"\r\n") {
+		t.Errorf("payload is not framed as is in %q", req)
+	}
+}
+
+func TestBoolCmdReplyByProto(t *testing.T) {
+	for _, reply := range []string{":1\r\n", "#t\r\n"} {
+		cmd := NewBoolCmd("SISMEMBER", "set", "m")
+		if err := cmd.parseReply(newTestReader(reply)); err != nil {
+			t.Fatalf("%q: %s", reply, err)
+		}
+		if got := string(cmd.Reply()); got != ":1\r\n" {
+			t.Errorf("%q: RESP2 reply: got %q", reply, got)
+		}
+		cmd.SetProto(3)
+		if got := string(cmd.Reply()); got != "#t\r\n" {
+			t.Errorf("%q: RESP3 reply: got %q", reply, got)
+		}
+	}
+
+	cmd := NewBoolCmd("EXPIRE", "key", "10")
+	if err := cmd.parseReply(newTestReader(":0\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	cmd.SetProto(3)
+	if got := string(cmd.Reply()); got != "#f\r\n" {
+		t.Errorf("RESP3 reply: got %q", got)
+	}
+	cmd.SetProto(2)
+	if got := string(cmd.Reply()); got != ":0\r\n" {
+		t.Errorf("RESP2 reply: got %q", got)
+	}
+}
+
+func TestSortCmd(t *testing.T) {
+	cmd := NewSortCmd("{u}ids", &Sort{By: "{u}w_*", Get: []string{"#", "{u}name_*"}, Count: 2, IsAlpha: true})
+	want := []string{"SORT", "{u}ids", "BY", "{u}w_*", "LIMIT", "0", "2", "GET", "#", "GET", "{u}name_*", "ALPHA"}
+	if got := cmd.args(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if keys := cmd.clusterKeys(); strings.Join(keys, " ") != "{u}ids {u}w_* {u}name_*" {
+		t.Errorf("got keys %q", keys)
+	}
+	if cmd.IsStore() {
+		t.Error("got STORE, wanted none")
+	}
+	reply := "*4\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\n2\r\n$-1\r\n"
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if v := cmd.Val(); len(v) != 4 || *v[1] != "a" || v[3] != nil {
+		t.Errorf("got %v", v)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+
+	cmd = NewSortCmd("{u}ids", &Sort{By: "nosort", Store: "{u}dst"})
+	if keys := cmd.clusterKeys(); strings.Join(keys, " ") != "{u}ids {u}dst" {
+		t.Errorf("got keys %q", keys)
+	}
+	if !cmd.IsStore() {
+		t.Fatal("got no STORE")
+	}
+	if err := cmd.parseReply(newTestReader(":3\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Count() != 3 {
+		t.Errorf("got %d, wanted 3", cmd.Count())
+	}
+	if got := string(cmd.Reply()); got != ":3\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	// Keys in other slots are rejected before anything is sent.
+	cmd = NewSortCmd("ids", &Sort{Store: "dst"})
+	if sameSlot(cmd.clusterKeys()) {
+		t.Error("got ids and dst in the same slot")
+	}
+
+	cmd = NewSortCmd("ids", nil)
+	if got := cmd.args(); strings.Join(got, " ") != "SORT ids" || cmd.IsStore() {
+		t.Errorf("got %q, store %v", got, cmd.IsStore())
+	}
+}
+
+func TestClusterShardsCmd(t *testing.T) {
+	node := "*12\r\n$2\r\nid\r\n$3\r\nabc\r\n$4\r\nport\r\n:7000\r\n$2\r\nip\r\n$9\r\n127.0.0.1\r\n" +
+		"$4\r\nrole\r\n$6\r\nmaster\r\n$18\r\nreplication-offset\r\n:72156\r\n$6\r\nhealth\r\n$6\r\nonline\r\n"
+	shard := "*4\r\n$5\r\nslots\r\n*2\r\n:0\r\n:5460\r\n$5\r\nnodes\r\n*1\r\n" + node
+	reply := "*2\r\n" + shard + "*4\r\n$5\r\nslots\r\n*0\r\n$5\r\nnodes\r\n*0\r\n"
+
+	cmd := NewClusterShardsCmd()
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	shards := cmd.Val()
+	if len(shards) != 2 || shards[0][0].Key != "slots" || shards[0][1].Key != "nodes" {
+		t.Fatalf("got %v", shards)
+	}
+	if slots := shards[0].Get("slots"); len(slots) != 2 || slots[1] != int64(5460) {
+		t.Errorf("got slots %v", slots)
+	}
+	nodes := shards[0].Get("nodes")
+	if n, ok := nodes[0].([]interface{}); !ok || len(n) != 12 || n[1] != "abc" {
+		t.Errorf("got nodes %v", nodes)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+
+	m := NewMapStringSliceCmd("X", "k")
+	if err := m.parseReply(newTestReader(shard)); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(m.Reply()); got != shard {
+		t.Errorf("Reply: got %q, wanted %q", got, shard)
+	}
+	if err := m.parseReply(newTestReader("*2\r\n$1\r\na\r\n:1\r\n")); err == nil {
+		t.Error("got no error for a value which isn't an array")
+	}
+}
+
+func TestStringMutationCmds(t *testing.T) {
+	getset := NewGetSetCmd("key", "new")
+	if getset.clusterKey() != "key" {
+		t.Errorf("got key %q", getset.clusterKey())
+	}
+	getset.parseReply(newTestReader("$-1\r\n"))
+	if err := getset.Err(); err != Nil {
+		t.Errorf("missing key: got %v, wanted %v", err, Nil)
+	}
+	if got := string(getset.Reply()); got != "$-1\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	getset = NewGetSetCmd("key", "new")
+	if err := getset.parseReply(newTestReader("$3\r\nold\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if getset.Val() != "old" || string(getset.Reply()) != "$3\r\nold\r\n" {
+		t.Errorf("got %q, %q", getset.Val(), getset.Reply())
+	}
+
+	for _, cmd := range []*IntCmd{NewAppendCmd("key", "abc"), NewSetRangeCmd("key", 5, "abc")} {
+		if cmd.clusterKey() != "key" {
+			t.Errorf("%v: got key %q", cmd.args(), cmd.clusterKey())
+		}
+		if err := cmd.parseReply(newTestReader(":8\r\n")); err != nil || cmd.Val() != 8 {
+			t.Errorf("%v: got %d, %v", cmd.args(), cmd.Val(), err)
+		}
+		if got := string(cmd.Reply()); got != ":8\r\n" {
+			t.Errorf("%v: Reply: got %q", cmd.args(), got)
+		}
+	}
+	if args := NewSetRangeCmd("key", 5, "abc").args(); strings.Join(args, " ") != "SETRANGE key 5 abc" {
+		t.Errorf("got %q", args)
+	}
+}
+
+func TestExpireCmdFlags(t *testing.T) {
+	tests := []struct {
+		cmd  *BoolCmd
+		args string
+	}{
+		{NewExpireCmd("key", 10, ""), "EXPIRE key 10"},
+		{NewExpireCmd("key", 10, "NX"), "EXPIRE key 10 NX"},
+		{NewExpireCmd("key", 10, "xx"), "EXPIRE key 10 XX"},
+		{NewPExpireCmd("key", 1500, "GT"), "PEXPIRE key 1500 GT"},
+		{NewExpireAtCmd("key", 1700000000, "LT"), "EXPIREAT key 1700000000 LT"},
+		{NewPExpireAtCmd("key", 1700000000000, ""), "PEXPIREAT key 1700000000000"},
+	}
+	for _, test := range tests {
+		if err := test.cmd.Err(); err != nil {
+			t.Errorf("%s: %s", test.args, err)
+		}
+		if got := strings.Join(test.cmd.args(), " "); got != test.args {
+			t.Errorf("got %q, wanted %q", got, test.args)
+		}
+		if test.cmd.clusterKey() != "key" {
+			t.Errorf("%s: got key %q", test.args, test.cmd.clusterKey())
+		}
+	}
+
+	cmd := NewExpireCmd("key", 10, "GT")
+	for reply, want := range map[string]bool{":1\r\n": true, ":0\r\n": false} {
+		if err := cmd.parseReply(newTestReader(reply)); err != nil || cmd.Val() != want {
+			t.Errorf("%q: got %v, %v", reply, cmd.Val(), err)
+		}
+		if got := string(cmd.Reply()); got != reply {
+			t.Errorf("Reply: got %q, wanted %q", got, reply)
+		}
+	}
+
+	cmd = NewExpireCmd("key", 10, "NEVER")
+	if got := string(cmd.Reply()); got != "-ERR Unsupported option NEVER\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestLposCmd(t *testing.T) {
+	cmd := NewLposCmd("LPOS", "list", "c", "RANK", "2")
+	if cmd.clusterKey() != "list" {
+		t.Errorf("got key %q", cmd.clusterKey())
+	}
+	if err := cmd.parseReply(newTestReader(":6\r\n")); err != nil || cmd.Val() != 6 {
+		t.Errorf("got %d, %v", cmd.Val(), err)
+	}
+	if got := string(cmd.Reply()); got != ":6\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	cmd = NewLposCmd("LPOS", "list", "c", "count", "0")
+	reply := "*2\r\n:2\r\n:6\r\n"
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if v := cmd.Vals(); len(v) != 2 || v[0] != 2 || v[1] != 6 {
+		t.Errorf("got %v", v)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+	if err := cmd.parseReply(newTestReader("*0\r\n")); err != nil || len(cmd.Vals()) != 0 {
+		t.Errorf("got %v, %v", cmd.Vals(), err)
+	}
+	if got := string(cmd.Reply()); got != "*0\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	cmd = NewLposCmd("LPOS", "list", "z")
+	if err := cmd.parseReply(newTestReader("$-1\r\n")); err != Nil {
+		t.Errorf("got %v, wanted %v", err, Nil)
+	}
+	if got := string(cmd.Reply()); got != "$-1\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestScanContinueCmd(t *testing.T) {
+	cmd := NewScanContinueCmd(0, "", 0)
+	if got := strings.Join(cmd.args(), " "); got != "SCAN 0" {
+		t.Errorf("got %q", got)
+	}
+	if cmd.clusterKey() != "" {
+		t.Errorf("SCAN must be keyless, got %q", cmd.clusterKey())
+	}
+	reply := "*2\r\n$4\r\n1792\r\n*1\r\n$1\r\na\r\n"
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Cursor() != 1792 {
+		t.Fatalf("got cursor %d, wanted 1792", cmd.Cursor())
+	}
+
+	next := NewScanContinueCmd(cmd.Cursor(), "user:*", 100)
+	if got := strings.Join(next.args(), " "); got != "SCAN 1792 MATCH user:* COUNT 100" {
+		t.Errorf("got %q", got)
+	}
+	if err := next.parseReply(newTestReader("*2\r\n$1\r\n0\r\n*0\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if next.Cursor() != 0 {
+		t.Errorf("got cursor %d, wanted 0 at the end", next.Cursor())
+	}
+}
+
+func TestRandCmds(t *testing.T) {
+	field := NewHRandFieldCmd("h")
+	if err := field.parseReply(newTestReader("$1\r\na\r\n")); err != nil || field.Val() != "a" {
+		t.Errorf("got %q, %v", field.Val(), err)
+	}
+	if field.clusterKey() != "h" {
+		t.Errorf("got key %q", field.clusterKey())
+	}
+
+	// A negative count may repeat elements.
+	members := NewSRandMemberCountCmd("s", -3)
+	reply := "*3\r\n$1\r\na\r\n$1\r\na\r\n$1\r\nb\r\n"
+	if err := members.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(members.Val(), " "); got != "a a b" {
+		t.Errorf("got %q", got)
+	}
+	if got := strings.Join(members.args(), " "); got != "SRANDMEMBER s -3" {
+		t.Errorf("got %q", got)
+	}
+
+	pairs := NewHRandFieldWithValuesCmd("h", -2)
+	reply = "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\n1\r\n"
+	if err := pairs.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if v := pairs.Val(); len(v) != 2 || v[1].Key != "a" || v[1].Value != "1" {
+		t.Errorf("got %v", v)
+	}
+	if got := string(pairs.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+	if got := strings.Join(NewZRandMemberWithScoresCmd("z", 1).args(), " "); got != "ZRANDMEMBER z 1 WITHSCORES" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestNumKeysCmds(t *testing.T) {
+	card := NewSInterCardCmd(10, "{s}a", "{s}b")
+	if got := strings.Join(card.args(), " "); got != "SINTERCARD 2 {s}a {s}b LIMIT 10" {
+		t.Errorf("got %q", got)
+	}
+	if keys := card.clusterKeys(); strings.Join(keys, " ") != "{s}a {s}b" {
+		t.Errorf("got keys %q", keys)
+	}
+
+	pop := NewLMPopCmd("LEFT", 2, "{l}a", "{l}b")
+	if got := strings.Join(pop.args(), " "); got != "LMPOP 2 {l}a {l}b LEFT COUNT 2" {
+		t.Errorf("got %q", got)
+	}
+	if keys := pop.clusterKeys(); strings.Join(keys, " ") != "{l}a {l}b" {
+		t.Errorf("got keys %q", keys)
+	}
+	reply := "*2\r\n$4\r\n{l}b\r\n*2\r\n$1\r\nx\r\n$1\r\ny\r\n"
+	if err := pop.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if pop.Key() != "{l}b" || len(pop.Val()) != 2 || pop.Val()[1] != "y" {
+		t.Errorf("got %q %v", pop.Key(), pop.Val())
+	}
+	if got := string(pop.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+
+	zpop := NewZMPopCmd("MIN", 0, "z")
+	if got := strings.Join(zpop.args(), " "); got != "ZMPOP 1 z MIN" {
+		t.Errorf("got %q", got)
+	}
+	reply = "*2\r\n$1\r\nz\r\n*1\r\n*2\r\n$1\r\nm\r\n$1\r\n1\r\n"
+	if err := zpop.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(zpop.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+
+	// All the keys are empty.
+	zpop.parseReply(newTestReader("*-1\r\n"))
+	if zpop.Err() != Nil {
+		t.Errorf("got %v, wanted %v", zpop.Err(), Nil)
+	}
+	if got := string(zpop.Reply()); got != "*-1\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	// The error branch every Reply used to repeat.
+	legacy := func(err error) []byte {
+		if err.Error() == "redis: nil" {
+			return []byte("$-1\r\n")
+		}
+		d := fmt.Sprintf("-%s\r\n", err.Error())
+		return []byte(d)
+	}
+
+	cmds := []Cmder{
+		NewSliceCmd("X"),
+		NewStatusCmd("X"),
+		NewIntCmd("X"),
+		NewDurationCmd(time.Second, "X"),
+		NewBoolCmd("X"),
+		NewStringCmd("X"),
+		NewFloatCmd("X"),
+		NewStringSliceCmd("X"),
+		NewNullableStringSliceCmd("X"),
+		NewIntSliceCmd("X"),
+		NewStringStringMapCmd("X"),
+		NewKeyValueSliceCmd("X"),
+		NewObjectCmd("ENCODING", "k"),
+	}
+	errs := []error{
+		Nil,
+		errorf("ERR wrong number of arguments"),
+		errorf("MOVED 3999 127.0.0.1:6381"),
+		errorf("ASK 3999 127.0.0.1:6381"),
+		ErrCrossSlot,
+		errors.New("i/o timeout"),
+	}
+	for _, err := range errs {
+		want := legacy(err)
+		if got := FormatError(err); string(got) != string(want) {
+			t.Errorf("FormatError(%q) = %q, wanted %q", err, got, want)
+		}
+		for _, cmd := range cmds {
+			cmd.setErr(err)
+			if got := cmd.Reply(); string(got) != string(want) {
+				t.Errorf("%s with %q replied %q, wanted %q", cmd.Name(), err, got, want)
+			}
+		}
+	}
+}
+
+// Replies of XINFO captured from Redis 7.0.
+const (
+	xinfoStreamReply = "*20\r\n" +
+		"$6\r\nlength\r\n:2\r\n" +
+		"$15\r\nradix-tree-keys\r\n:1\r\n" +
+		"$16\r\nradix-tree-nodes\r\n:2\r\n" +
+		"$17\r\nlast-generated-id\r\n$15\r\n1638125141232-0\r\n" +
+		"$20\r\nmax-deleted-entry-id\r\n$3\r\n0-0\r\n" +
+		"$13\r\nentries-added\r\n:2\r\n" +
+		"$23\r\nrecorded-first-entry-id\r\n$15\r\n1638125133432-0\r\n" +
+		"$6\r\ngroups\r\n:1\r\n" +
+		"$11\r\nfirst-entry\r\n*2\r\n$15\r\n1638125133432-0\r\n*2\r\n$7\r\nmessage\r\n$5\r\napple\r\n" +
+		"$10\r\nlast-entry\r\n*2\r\n$15\r\n1638125141232-0\r\n*2\r\n$7\r\nmessage\r\n$6\r\nbanana\r\n"
+	xinfoEmptyStreamReply = "*20\r\n" +
+		"$6\r\nlength\r\n:0\r\n" +
+		"$15\r\nradix-tree-keys\r\n:0\r\n" +
+		"$16\r\nradix-tree-nodes\r\n:1\r\n" +
+		"$17\r\nlast-generated-id\r\n$3\r\n0-0\r\n" +
+		"$20\r\nmax-deleted-entry-id\r\n$3\r\n0-0\r\n" +
+		"$13\r\nentries-added\r\n:0\r\n" +
+		"$23\r\nrecorded-first-entry-id\r\n$3\r\n0-0\r\n" +
+		"$6\r\ngroups\r\n:0\r\n" +
+		"$11\r\nfirst-entry\r\n$-1\r\n" +
+		"$10\r\nlast-entry\r\n$-1\r\n"
+	xinfoGroupsReply = "*2\r\n" +
+		"*12\r\n$4\r\nname\r\n$7\r\nmygroup\r\n$9\r\nconsumers\r\n:2\r\n$7\r\npending\r\n:2\r\n" +
+		"$17\r\nlast-delivered-id\r\n$15\r\n1638126030001-0\r\n$12\r\nentries-read\r\n:2\r\n$3\r\nlag\r\n:0\r\n" +
+		"*12\r\n$4\r\nname\r\n$16\r\nsome-other-group\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:0\r\n" +
+		"$17\r\nlast-delivered-id\r\n$15\r\n1638126028070-0\r\n$12\r\nentries-read\r\n:1\r\n$3\r\nlag\r\n:1\r\n"
+)
+
+func TestXInfoStreamCmd(t *testing.T) {
+	cmd := NewXInfoStreamCmd("mystream")
+	if err := cmd.parseReply(newTestReader(xinfoStreamReply)); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(cmd.Reply()); got != xinfoStreamReply {
+		t.Errorf("got reply %q, wanted %q", got, xinfoStreamReply)
+	}
+	if n := cmd.Val().GetInt("length"); n != 2 {
+		t.Errorf("got length %d, wanted 2", n)
+	}
+	if id := cmd.Val().GetString("last-generated-id"); id != "1638125141232-0" {
+		t.Errorf("got last-generated-id %q", id)
+	}
+	entry := cmd.Val().GetEntry("last-entry")
+	if entry == nil || entry.ID != "1638125141232-0" ||
+		strings.Join(entry.Values, " ") != "message banana" {
+		t.Errorf("got last-entry %+v", entry)
+	}
+	if key := cmd.clusterKey(); key != "mystream" {
+		t.Errorf("got key %q, wanted mystream", key)
+	}
+
+	cmd = NewXInfoStreamCmd("empty")
+	if err := cmd.parseReply(newTestReader(xinfoEmptyStreamReply)); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(cmd.Reply()); got != xinfoEmptyStreamReply {
+		t.Errorf("got reply %q, wanted %q", got, xinfoEmptyStreamReply)
+	}
+	if entry := cmd.Val().GetEntry("first-entry"); entry != nil {
+		t.Errorf("got first-entry %+v of an empty stream", entry)
+	}
+}
+
+func TestXInfoGroupsCmd(t *testing.T) {
+	cmd, err := BuildCmd([]string{"XINFO", "GROUPS", "mystream"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, ok := cmd.(*XInfoGroupsCmd)
+	if !ok {
+		t.Fatalf("got %T, wanted *XInfoGroupsCmd", cmd)
+	}
+	if key := groups.clusterKey(); key != "mystream" {
+		t.Errorf("got key %q, wanted mystream", key)
+	}
+	if err := groups.parseReply(newTestReader(xinfoGroupsReply)); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(groups.Reply()); got != xinfoGroupsReply {
+		t.Errorf("got reply %q, wanted %q", got, xinfoGroupsReply)
+	}
+	if len(groups.Val()) != 2 {
+		t.Fatalf("got %d groups, wanted 2", len(groups.Val()))
+	}
+	if name := groups.Val()[1].GetString("name"); name != "some-other-group" {
+		t.Errorf("got name %q", name)
+	}
+	if lag := groups.Val()[1].GetInt("lag"); lag != 1 {
+		t.Errorf("got lag %d, wanted 1", lag)
+	}
+}
+
+func TestLcsCmd(t *testing.T) {
+	tests := []struct {
+		args  []string
+		reply string
+		len   int64
+	}{
+		{[]string{"LCS", "key1", "key2"}, "$6\r\nmytext\r\n", 6},
+		{[]string{"LCS", "key1", "key2", "LEN"}, ":6\r\n", 6},
+		{
+			[]string{"LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"},
+			"*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n",
+			6,
+		},
+	}
+	for _, test := range tests {
+		cmd := NewLcsCmd(test.args...)
+		if err := cmd.parseReply(newTestReader(test.reply)); err != nil {
+			t.Errorf("%q: %s", test.args, err)
+			continue
+		}
+		if got := string(cmd.Reply()); got != test.reply {
+			t.Errorf("%q: got reply %q, wanted %q", test.args, got, test.reply)
+		}
+		if cmd.Len() != test.len {
+			t.Errorf("%q: got len %d, wanted %d", test.args, cmd.Len(), test.len)
+		}
+		if keys := strings.Join(cmd.clusterKeys(), " "); keys != "key1 key2" {
+			t.Errorf("%q: got keys %q", test.args, keys)
+		}
+	}
+
+	cmd := NewLcsCmd("LCS", "key1", "key2", "IDX", "WITHMATCHLEN")
+	cmd.parseReply(newTestReader(tests[2].reply))
+	want := []LcsMatch{{Key1: [2]int64{4, 7}, Key2: [2]int64{5, 8}, MatchLen: 4}}
+	if got := cmd.Matches(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got matches %+v, wanted %+v", got, want)
+	}
+
+	// The reply shape must follow the options.
+	cmd = NewLcsCmd("LCS", "key1", "key2", "LEN")
+	if err := cmd.parseReply(newTestReader("$6\r\nmytext\r\n")); err == nil {
+		t.Error("a string reply of LCS LEN must be rejected")
+	}
+}
+
+func TestBinaryReplies(t *testing.T) {
+	binary := "\x00\x01\x7f\r\n\xfe\xff\tend"
+	bulk := "$" + strconv.Itoa(len(binary)) + "\r\n" + binary + "\r\n"
+
+	cmds := []Cmder{
+		NewStringCmd("DUMP", "k"),
+		NewStatusCmd("DEBUG", "JMAP"),
+		NewDebugObjectCmd("k"),
+		NewDebugCmd("JMAP"),
+	}
+	for _, cmd := range cmds {
+		if err := cmd.parseReply(newTestReader(bulk)); err != nil {
+			t.Errorf("%s: %s", cmd.Name(), err)
+			continue
+		}
+		if got := string(cmd.Reply()); got != bulk {
+			t.Errorf("%s: got %q, wanted %q", cmd.Name(), got, bulk)
+		}
+	}
+
+	// Status replies stay status replies.
+	for _, reply := range []string{"+OK\r\n", ":1\r\n", "*2\r\n$1\r\n\x00\r\n:3\r\n"} {
+		cmd := NewDebugCmd("SLEEP", "0")
+		if err := cmd.parseReply(newTestReader(reply)); err != nil {
+			t.Errorf("%q: %s", reply, err)
+			continue
+		}
+		if got := string(cmd.Reply()); got != reply {
+			t.Errorf("got %q, wanted %q", got, reply)
+		}
+	}
+
+	cmd := NewDebugCmd("SLEEP", "0")
+	if strings.Join(cmd.args(), " ") != "DEBUG SLEEP 0" || cmd.clusterKey() != "" {
+		t.Errorf("got %q routed by %q, wanted keyless DEBUG SLEEP 0", cmd.args(), cmd.clusterKey())
+	}
+}
+
+func TestClusterFailoverCmd(t *testing.T) {
+	tests := []struct {
+		cmd  *StatusCmd
+		want []string
+	}{
+		{NewClusterFailoverCmd(false), []string{"CLUSTER", "FAILOVER"}},
+		{NewClusterFailoverCmd(true), []string{"CLUSTER", "FAILOVER", "FORCE"}},
+		{NewClusterTakeoverCmd(), []string{"CLUSTER", "FAILOVER", "TAKEOVER"}},
+		{NewFailoverCmd("TO", "10.0.0.2", "6379", "FORCE"), []string{"FAILOVER", "TO", "10.0.0.2", "6379", "FORCE"}},
+	}
+	for _, test := range tests {
+		if got := test.cmd.args(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("got %q, wanted %q", got, test.want)
+		}
+		if keys := test.cmd.keyIndexes(); keys != nil {
+			t.Errorf("%q: got keys at %v, wanted keyless", test.want, keys)
+		}
+		if addr := test.cmd.Addr(); addr != "" {
+			t.Errorf("%q: pinned to %q", test.want, addr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cmd  Cmder
+		want error
+	}{
+		{NewStringCmd("GET", "k"), nil},
+		{NewStringCmd("GET"), errorf("ERR wrong number of arguments for 'get' command")},
+		{NewStringCmd("get", "k1", "k2"), errorf("ERR wrong number of arguments for 'get' command")},
+		{NewIntCmd("INCR", "k"), nil},
+		{NewIntCmd("INCR", "k", "1"), errorf("ERR wrong number of arguments for 'incr' command")},
+		{NewIntCmd("DEL", "k1", "k2", "k3"), nil},
+		{NewIntCmd("DEL"), errorf("ERR wrong number of arguments for 'del' command")},
+		{NewStatusCmd(), errEmptyCommand},
+		// Unknown commands are left to Redis.
+		{NewCmd("NOSUCHCMD"), nil},
+	}
+	for _, test := range tests {
+		if err := test.cmd.Validate(); err != test.want {
+			t.Errorf("%q: got %v, wanted %v", test.cmd.args(), err, test.want)
+		}
+	}
+
+	// Malformed commands are not sent, net.Pipe would block on them.
+	client, server, _ := newPipeClient(&Options{})
+	get := NewStringCmd("GET")
+	client.Process(get)
+	if got := string(get.Reply()); got != "-ERR wrong number of arguments for 'get' command\r\n" {
+		t.Errorf("got %q", got)
+	}
+
+	ok := NewStringCmd("GET", "k")
+	go servePipeline(server, []Cmder{ok}, "$1\r\nv\r\n")
+	pipe := client.Pipeline()
+	pipe.Process(NewStatusCmd())
+	pipe.Process(ok)
+	pipe.Process(NewIntCmd("INCR"))
+	cmds, err := pipe.Exec()
+	if err != errEmptyCommand {
+		t.Errorf("got %v, wanted %v", err, errEmptyCommand)
+	}
+	if len(cmds) != 3 || cmds[0].Err() != errEmptyCommand || ok.Val() != "v" || cmds[2].Err() == nil {
+		t.Errorf("got %v", cmds)
+	}
+}
+
+func TestFormatSliceParsedTypes(t *testing.T) {
+	// Every type parseSlice returns, nested and in RESP3, is formatted
+	// back without reaching the panicking default case.
+	for _, reply := range []string{
+		"*4\r\n+OK\r\n:-1\r\n$-1\r\n$0\r\n\r\n",
+		"*2\r\n*-1\r\n*1\r\n*1\r\n$1\r\na\r\n",
+		"*5\r\n#t\r\n#f\r\n,1.5\r\n(12345678901234567890\r\n=7\r\ntxt:abc\r\n",
+		"*3\r\n%1\r\n$1\r\nk\r\n:1\r\n~1\r\n_\r\n|1\r\n+ttl\r\n:3\r\n$1\r\nv\r\n",
+		">2\r\n$7\r\nmessage\r\n$2\r\nhi\r\n",
+	} {
+		cmd := NewSliceCmd()
+		if err := cmd.parseReply(newTestReader(reply)); err != nil {
+			t.Errorf("%q: %s", reply, err)
+			continue
+		}
+		again := NewSliceCmd()
+		if err := again.parseReply(newTestReader(string(cmd.Reply()))); err != nil {
+			t.Errorf("%q: got %q: %s", reply, cmd.Reply(), err)
+			continue
+		}
+		if !reflect.DeepEqual(again.Val(), cmd.Val()) {
+			t.Errorf("%q: got %#v, wanted %#v", reply, again.Val(), cmd.Val())
+		}
+	}
+}
+
+func TestFormatSliceUnformattable(t *testing.T) {
+	val := []interface{}{"a", struct{}{}, int64(1)}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("unformattable value must panic in tests")
+			}
+		}()
+		FormatSlice(val)
+	}()
+
+	var logged interface{}
+	unformattable = func(v interface{}) { logged = v }
+	defer func() { unformattable = panicUnformattable }()
+	if got, want := string(FormatSlice(val)), "*3\r\n$1\r\na\r\n$-1\r\n:1\r\n"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if logged != struct{}{} {
+		t.Errorf("got %v reported, wanted the struct", logged)
+	}
+}
+
+func TestMergeInfo(t *testing.T) {
+	replies := []string{
+		"# Server\r\nredis_version:7.2.4\r\nuptime_in_seconds:100\r\n\r\n" +
+			"# Stats\r\ntotal_commands_processed:10\r\ninstantaneous_ops_per_sec:3\r\n\r\n" +
+			"# Replication\r\nrole:master\r\n\r\n" +
+			"# Cluster\r\ncluster_enabled:1\r\n\r\n" +
+			"# Persistence\r\nrdb_last_save_time:1700000000\r\n",
+		"# Server\r\nredis_version:7.2.4\r\nuptime_in_seconds:200\r\n\r\n" +
+			"# Stats\r\ntotal_commands_processed:32\r\ninstantaneous_ops_per_sec:4\r\n\r\n" +
+			"# Replication\r\nrole:replica\r\n\r\n" +
+			"# Cluster\r\ncluster_enabled:1\r\n\r\n" +
+			"# Persistence\r\nrdb_last_save_time:1700000005\r\n",
+	}
+	cmds := make([]*InfoCmd, len(replies))
+	for i, reply := range replies {
+		cmds[i] = NewInfoCmd("INFO")
+		bulk := "$" + strconv.Itoa(len(reply)) + "\r\n" + reply + "\r\n"
+		if err := cmds[i].parseReply(newTestReader(bulk)); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(cmds[i].Reply()); got != bulk {
+			t.Errorf("Reply: got %q, wanted %q", got, bulk)
+		}
+	}
+	if v, ok := cmds[0].Get("stats", "total_commands_processed"); !ok || v != "10" {
+		t.Errorf("got %q, %v", v, ok)
+	}
+
+	merged := MergeInfo([]string{"10.0.0.1:7000", "10.0.0.2:7000"}, cmds)
+	want := []InfoSection{
+		{"Server", []KeyValue{{"redis_version", "7.2.4"}}},
+		{"Stats", []KeyValue{{"total_commands_processed", "42"}, {"instantaneous_ops_per_sec", "7"}}},
+		{"Replication", nil},
+		{"Cluster", []KeyValue{{"cluster_enabled", "1"}}},
+		{"Persistence", nil},
+		{"Server 10.0.0.1:7000", []KeyValue{{"uptime_in_seconds", "100"}}},
+		{"Replication 10.0.0.1:7000", []KeyValue{{"role", "master"}}},
+		{"Persistence 10.0.0.1:7000", []KeyValue{{"rdb_last_save_time", "1700000000"}}},
+		{"Server 10.0.0.2:7000", []KeyValue{{"uptime_in_seconds", "200"}}},
+		{"Replication 10.0.0.2:7000", []KeyValue{{"role", "replica"}}},
+		{"Persistence 10.0.0.2:7000", []KeyValue{{"rdb_last_save_time", "1700000005"}}},
+	}
+	if !reflect.DeepEqual(merged.Val(), want) {
+		t.Fatalf("got %v, wanted %v", merged.Val(), want)
+	}
+
+	// The merged reply parses back to the same sections.
+	again := NewInfoCmd("INFO")
+	if err := again.parseReply(newTestReader(string(merged.Reply()))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Val(), want) {
+		t.Errorf("got %v, wanted %v", again.Val(), want)
+	}
+
+	failed := NewInfoCmd("INFO")
+	failed.setErr(ErrTooManyInFlight)
+	if err := MergeInfo([]string{"a", "b"}, []*InfoCmd{cmds[0], failed}).Err(); err != ErrTooManyInFlight {
+		t.Errorf("got %v, wanted %v", err, ErrTooManyInFlight)
+	}
+}
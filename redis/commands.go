@@ -2,8 +2,9 @@ package redis
 
 import (
 	"io"
+	"math"
 	"strconv"
-	// "strings"
+	"strings"
 	"time"
 
 	log "github.com/ngaut/logging"
@@ -17,6 +18,10 @@ func formatInt(i int64) string {
 	return strconv.FormatInt(i, 10)
 }
 
+func formatUint(i uint64) string {
+	return strconv.FormatUint(i, 10)
+}
+
 func readTimeout(timeout time.Duration) time.Duration {
 	if timeout == 0 {
 		return 0
@@ -67,6 +72,19 @@ func (c *commandable) OnUnDenfined(req *Request) *StringCmd {
 	return cmd
 }
 
+// ProcessBuilt processes the command of req built by BuildCmd, for the
+// commands without an On method of their own.
+func (c *commandable) ProcessBuilt(req *Request) Cmder {
+	cmd, err := BuildCmd(req.cmd)
+	if err != nil {
+		failed := NewStringCmd(req.cmd...)
+		failed.setErr(err)
+		return failed
+	}
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnReflectUnvalid(req *Request) *StringCmd {
 
 	// args := req.Args()
@@ -79,7 +97,7 @@ func (c *commandable) OnReflectUnvalid(req *Request) *StringCmd {
 //------------------------------------------------------------------------------
 
 func (c *commandable) Auth(password string) *StatusCmd {
-	cmd := newKeylessStatusCmd("AUTH", password)
+	cmd := NewAuthCmd(password)
 	c.Process(cmd)
 	return cmd
 }
@@ -92,7 +110,13 @@ func (c *commandable) Echo(message string) *StringCmd {
 }
 
 func (c *commandable) Ping() *StatusCmd {
-	cmd := newKeylessStatusCmd("PING")
+	cmd := NewPingCmd()
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) Wait(numReplicas int, timeout time.Duration) *IntCmd {
+	cmd := NewWaitCmd(numReplicas, timeout)
 	c.Process(cmd)
 	return cmd
 }
@@ -103,7 +127,13 @@ func (c *commandable) Quit() *StatusCmd {
 }
 
 func (c *commandable) Select(index int64) *StatusCmd {
-	cmd := newKeylessStatusCmd("SELECT", strconv.FormatInt(index, 10))
+	cmd := NewSelectCmd(int(index))
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) Reset() *StatusCmd {
+	cmd := NewResetCmd()
 	c.Process(cmd)
 	return cmd
 }
@@ -116,6 +146,36 @@ func (c *commandable) OnDEL(req *Request) *IntCmd {
 	return cmd
 }
 
+func (c *commandable) Unlink(keys ...string) *IntCmd {
+	cmd := NewUnlinkCmd(keys...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnUNLINK(req *Request) *IntCmd {
+	cmd := NewIntCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) Touch(keys ...string) *IntCmd {
+	cmd := NewTouchCmd(keys...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnTOUCH(req *Request) *IntCmd {
+	cmd := NewIntCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) Dump(key string) *StringCmd {
+	cmd := NewDumpCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnDUMP(req *Request) *StringCmd {
 	cmd := NewStringCmd(req.cmd...)
 	c.Process(cmd)
@@ -128,13 +188,53 @@ func (c *commandable) OnEXISTS(req *Request) *BoolCmd {
 	return cmd
 }
 
+func (c *commandable) Expire(key string, seconds int64, flag string) *BoolCmd {
+	cmd := NewExpireCmd(key, seconds, flag)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
 func (c *commandable) OnEXPIRE(req *Request) *BoolCmd {
 	cmd := NewBoolCmd(req.cmd...)
+	if len(req.cmd) > 3 {
+		if _, err := checkExpireFlag(req.cmd[3]); err != nil {
+			cmd.setErr(err)
+			return cmd
+		}
+	}
 	c.Process(cmd)
 	return cmd
 }
 
+func (c *commandable) ExpireAt(key string, unixTime int64, flag string) *BoolCmd {
+	cmd := NewExpireAtCmd(key, unixTime, flag)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
 func (c *commandable) OnEXPIREAT(req *Request) *BoolCmd {
+	cmd := NewBoolCmd(req.cmd...)
+	if len(req.cmd) > 3 {
+		if _, err := checkExpireFlag(req.cmd[3]); err != nil {
+			cmd.setErr(err)
+			return cmd
+		}
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) Copy(source, destination string, db *int, replace bool) *BoolCmd {
+	cmd := NewCopyCmd(source, destination, db, replace)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnCOPY(req *Request) *BoolCmd {
 	cmd := NewBoolCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
@@ -183,6 +283,18 @@ func (c *commandable) ObjectEncoding(keys ...string) *StringCmd {
 	return cmd
 }
 
+func (c *commandable) TTL(key string) *DurationCmd {
+	cmd := NewTTLCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) PTTL(key string) *DurationCmd {
+	cmd := NewPTTLCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) ObjectIdleTime(keys ...string) *DurationCmd {
 	args := append([]string{"OBJECT", "IDLETIME"}, keys...)
 	cmd := NewDurationCmd(time.Second, args...)
@@ -197,14 +309,42 @@ func (c *commandable) OnPERSIST(req *Request) *BoolCmd {
 	return cmd
 }
 
+func (c *commandable) PExpire(key string, milliseconds int64, flag string) *BoolCmd {
+	cmd := NewPExpireCmd(key, milliseconds, flag)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
 func (c *commandable) OnPEXPIRE(req *Request) *BoolCmd {
 	cmd := NewBoolCmd(req.cmd...)
+	if len(req.cmd) > 3 {
+		if _, err := checkExpireFlag(req.cmd[3]); err != nil {
+			cmd.setErr(err)
+			return cmd
+		}
+	}
 	c.Process(cmd)
 	return cmd
 }
 
+func (c *commandable) PExpireAt(key string, unixTimeMs int64, flag string) *BoolCmd {
+	cmd := NewPExpireAtCmd(key, unixTimeMs, flag)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
 func (c *commandable) OnPEXPIREAT(req *Request) *BoolCmd {
 	cmd := NewBoolCmd(req.cmd...)
+	if len(req.cmd) > 3 {
+		if _, err := checkExpireFlag(req.cmd[3]); err != nil {
+			cmd.setErr(err)
+			return cmd
+		}
+	}
 	c.Process(cmd)
 	return cmd
 }
@@ -222,19 +362,130 @@ func (c *commandable) RandomKey() *StringCmd {
 }
 
 func (c *commandable) Rename(key, newkey string) *StatusCmd {
-	cmd := NewStatusCmd("RENAME", key, newkey)
+	cmd := NewRenameCmd(key, newkey)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnRENAME(req *Request) *StatusCmd {
+	cmd := NewStatusCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
 
 func (c *commandable) RenameNX(key, newkey string) *BoolCmd {
-	cmd := NewBoolCmd("RENAMENX", key, newkey)
+	cmd := NewRenameNXCmd(key, newkey)
 	c.Process(cmd)
 	return cmd
 }
 
+func (c *commandable) OnRENAMENX(req *Request) *BoolCmd {
+	cmd := NewBoolCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+var errRestoreIdleFreq = errorf("ERR IDLETIME and FREQ options are mutually exclusive")
+
+// RestoreArgs are the optional arguments of RESTORE. IdleTime and Freq
+// depend on maxmemory-policy (LRU or LFU), so only one of them can be
+// set.
+type RestoreArgs struct {
+	Replace bool
+	// ABSTTL is sent and ttl ignored when ExpireAt is set.
+	ExpireAt time.Time
+	IdleTime time.Duration
+	Freq     int64
+}
+
+// restoreArgs builds a RESTORE command. The payload is sent as a bulk
+// string, so it is length framed and may contain any bytes.
+func restoreArgs(key string, ttl time.Duration, value string, opt RestoreArgs) ([]string, error) {
+	if opt.IdleTime > 0 && opt.Freq > 0 {
+		return nil, errRestoreIdleFreq
+	}
+	if opt.Freq < 0 || opt.Freq > 255 {
+		return nil, errorf("ERR Invalid FREQ value, must be >= 0 and <= 255")
+	}
+
+	args := []string{"RESTORE", key}
+	if !opt.ExpireAt.IsZero() {
+		args = append(args, formatInt(opt.ExpireAt.UnixNano()/int64(time.Millisecond)))
+	} else {
+		args = append(args, formatMs(ttl))
+	}
+	args = append(args, value)
+	if opt.Replace {
+		args = append(args, "REPLACE")
+	}
+	if !opt.ExpireAt.IsZero() {
+		args = append(args, "ABSTTL")
+	}
+	if opt.IdleTime > 0 {
+		args = append(args, "IDLETIME", formatSec(opt.IdleTime))
+	}
+	if opt.Freq > 0 {
+		args = append(args, "FREQ", formatInt(opt.Freq))
+	}
+	return args, nil
+}
+
+// parseRestoreArgs validates the options of a client RESTORE, i.e.
+// everything after RESTORE key ttl payload.
+func parseRestoreArgs(options []string) error {
+	var idle, freq bool
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "REPLACE", "ABSTTL":
+		case "IDLETIME":
+			if i+1 >= len(options) {
+				return errorf("ERR syntax error")
+			}
+			if v, err := strconv.ParseInt(options[i+1], 10, 64); err != nil || v < 0 {
+				return errorf("ERR Invalid IDLETIME value, must be >= 0")
+			}
+			idle = true
+			i++
+		case "FREQ":
+			if i+1 >= len(options) {
+				return errorf("ERR syntax error")
+			}
+			if v, err := strconv.ParseInt(options[i+1], 10, 64); err != nil || v < 0 || v > 255 {
+				return errorf("ERR Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			freq = true
+			i++
+		default:
+			return errorf("ERR syntax error")
+		}
+	}
+	if idle && freq {
+		return errRestoreIdleFreq
+	}
+	return nil
+}
+
+func (c *commandable) Restore(key string, ttl time.Duration, value string, opt RestoreArgs) *StatusCmd {
+	args, err := restoreArgs(key, ttl, value, opt)
+	if err != nil {
+		cmd := NewStatusCmd("RESTORE", key)
+		cmd.setErr(err)
+		return cmd
+	}
+	cmd := NewStatusCmd(args...)
+	c.Process(cmd)
+	return cmd
+}
+
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
 func (c *commandable) OnRESTORE(req *Request) *StatusCmd {
 	cmd := NewStatusCmd(req.cmd...)
+	if len(req.cmd) > 4 {
+		if err := parseRestoreArgs(req.cmd[4:]); err != nil {
+			cmd.setErr(err)
+			return cmd
+		}
+	}
 	c.Process(cmd)
 	return cmd
 }
@@ -248,30 +499,11 @@ type Sort struct {
 	Store         string
 }
 
-// func (c *commandable) Sort(key string, sort Sort) *StringSliceCmd {
-// 	args := []string{"SORT", key}
-// 	if sort.By != "" {
-// 		args = append(args, "BY", sort.By)
-// 	}
-// 	if sort.Offset != 0 || sort.Count != 0 {
-// 		args = append(args, "LIMIT", formatFloat(sort.Offset), formatFloat(sort.Count))
-// 	}
-// 	for _, get := range sort.Get {
-// 		args = append(args, "GET", get)
-// 	}
-// 	if sort.Order != "" {
-// 		args = append(args, sort.Order)
-// 	}
-// 	if sort.IsAlpha {
-// 		args = append(args, "ALPHA")
-// 	}
-// 	if sort.Store != "" {
-// 		args = append(args, "STORE", sort.Store)
-// 	}
-// 	cmd := NewStringSliceCmd(args...)
-// 	c.Process(cmd)
-// 	return cmd
-// }
+func (c *commandable) Sort(key string, sort *Sort) *SortCmd {
+	cmd := NewSortCmd(key, sort)
+	c.Process(cmd)
+	return cmd
+}
 
 func (c *commandable) OnTTL(req *Request) *DurationCmd {
 	cmd := NewDurationCmd(time.Second, req.cmd...)
@@ -279,24 +511,23 @@ func (c *commandable) OnTTL(req *Request) *DurationCmd {
 	return cmd
 }
 
+func (c *commandable) Type(key string) *StatusCmd {
+	cmd := NewTypeCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnTYPE(req *Request) *StatusCmd {
 	cmd := NewStatusCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
 
-// func (c *commandable) Scan(cursor int64, match string, count int64) *ScanCmd {
-// 	args := []string{"SCAN", strconv.FormatInt(cursor, 10)}
-// 	if match != "" {
-// 		args = append(args, "MATCH", match)
-// 	}
-// 	if count > 0 {
-// 		args = append(args, "COUNT", strconv.FormatInt(count, 10))
-// 	}
-// 	cmd := NewScanCmd(args...)
-// 	c.Process(cmd)
-// 	return cmd
-// }
+func (c *commandable) Scan(cursor int64, match string, count int64) *ScanCmd {
+	cmd := NewScanContinueCmd(cursor, match, count)
+	c.Process(cmd)
+	return cmd
+}
 
 func (c *commandable) SScan(key string, cursor int64, match string, count int64) *ScanCmd {
 	args := []string{"SSCAN", key, strconv.FormatInt(cursor, 10)}
@@ -339,6 +570,12 @@ func (c *commandable) ZScan(key string, cursor int64, match string, count int64)
 
 //------------------------------------------------------------------------------
 
+func (c *commandable) Append(key, value string) *IntCmd {
+	cmd := NewAppendCmd(key, value)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnAPPEND(req *Request) *IntCmd {
 	cmd := NewIntCmd(req.cmd...)
 	c.Process(cmd)
@@ -349,16 +586,21 @@ type BitCount struct {
 	Start, End int64
 }
 
-func (c *commandable) OnBITCOUNT(req *Request) *IntCmd {
-	// args := []string{"BITCOUNT", key}
-	// if bitCount != nil {
-	// 	args = append(
-	// 		args,
-	// 		strconv.FormatInt(bitCount.Start, 10),
-	// 		strconv.FormatInt(bitCount.End, 10),
-	// 	)
-	// }
-	cmd := NewIntCmd(req.cmd...)
+func (c *commandable) BitCount(key string, bitCount *BitCount) *IntCmd {
+	var cmd *IntCmd
+	if bitCount != nil {
+		cmd = NewBitCountCmd(key, &bitCount.Start, &bitCount.End, "")
+	} else {
+		cmd = NewBitCountCmd(key, nil, nil, "")
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+// OnBITCOUNT replies the count unsigned, the bits of a huge string may
+// not fit an int64.
+func (c *commandable) OnBITCOUNT(req *Request) *Uint64Cmd {
+	cmd := NewUint64Cmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
@@ -388,17 +630,43 @@ func (c *commandable) BitOpNot(destKey string, key string) *IntCmd {
 }
 
 func (c *commandable) BitPos(key string, bit int64, pos ...int64) *IntCmd {
-	args := []string{"BITPOS", key, formatInt(bit)}
+	var cmd *IntCmd
 	switch len(pos) {
 	case 0:
+		cmd = NewBitPosCmd(key, bit, nil, nil, "")
 	case 1:
-		args = append(args, formatInt(pos[0]))
+		cmd = NewBitPosCmd(key, bit, &pos[0], nil, "")
 	case 2:
-		args = append(args, formatInt(pos[0]), formatInt(pos[1]))
+		cmd = NewBitPosCmd(key, bit, &pos[0], &pos[1], "")
 	default:
 		panic("too many arguments")
 	}
-	cmd := NewIntCmd(args...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnBITPOS(req *Request) *IntCmd {
+	cmd := NewIntCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) BitFieldRO(key string, fields ...string) *IntSliceCmd {
+	cmd := NewBitFieldROCmd(key, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnBITFIELD(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnBITFIELD_RO(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
@@ -440,12 +708,89 @@ func (c *commandable) OnGETRANGE(req *Request) *StringCmd {
 	return cmd
 }
 
+func (c *commandable) GetSet(key, value string) *StringCmd {
+	cmd := NewGetSetCmd(key, value)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnGETSET(req *Request) *StringCmd {
 	cmd := NewStringCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
 
+func (c *commandable) GetDel(key string) *StringCmd {
+	cmd := NewGetDelCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnGETDEL(req *Request) *StringCmd {
+	cmd := NewStringCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+// parseGetExArgs validates the options of GETEX, i.e. everything after
+// GETEX key. At most one of them is allowed.
+func parseGetExArgs(options []string) error {
+	var expiry bool
+	for i := 0; i < len(options); i++ {
+		if expiry {
+			return errorf("ERR syntax error")
+		}
+		switch strings.ToUpper(options[i]) {
+		case "PERSIST":
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(options) {
+				return errorf("ERR syntax error")
+			}
+			if v, err := strconv.ParseInt(options[i+1], 10, 64); err != nil {
+				return errNotInteger
+			} else if v <= 0 {
+				return errorf("ERR invalid expire time in 'getex' command")
+			}
+			i++
+		default:
+			return errorf("ERR syntax error")
+		}
+		expiry = true
+	}
+	return nil
+}
+
+func (c *commandable) GetEx(key string, options ...string) *StringCmd {
+	cmd := NewGetExCmd(key, options...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnGETEX(req *Request) *StringCmd {
+	cmd := NewStringCmd(req.cmd...)
+	if err := parseGetExArgs(req.cmd[2:]); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+// LCS is LCS key1 key2 with options, e.g. "IDX", "WITHMATCHLEN".
+func (c *commandable) LCS(key1, key2 string, options ...string) *LcsCmd {
+	cmd := NewLcsCmd(append([]string{"LCS", key1, key2}, options...)...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnLCS(req *Request) *LcsCmd {
+	cmd := NewLcsCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnINCR(req *Request) *IntCmd {
 	cmd := NewIntCmd(req.cmd...)
 	c.Process(cmd)
@@ -464,9 +809,14 @@ func (c *commandable) OnINCRBYFLOAT(req *Request) *FloatCmd {
 	return cmd
 }
 
-func (c *commandable) MGet(keys ...string) *SliceCmd {
-	args := append([]string{"MGET"}, keys...)
-	cmd := NewSliceCmd(args...)
+func (c *commandable) MGet(keys ...string) *NullableStringSliceCmd {
+	cmd := NewMGetCmd(keys...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnMGET(req *Request) *NullableStringSliceCmd {
+	cmd := NewNullableStringSliceCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
@@ -485,27 +835,22 @@ func (c *commandable) MSetNX(pairs ...string) *BoolCmd {
 	return cmd
 }
 
-func (c *commandable) OnSET(req *Request) *StatusCmd {
-	// args := []string{"SET", key, value}
-	// if expiration > 0 {
-	// 	if usePrecise(expiration) {
-	// 		args = append(args, "PX", formatMs(expiration))
-	// 	} else {
-	// 		args = append(args, "EX", formatSec(expiration))
-	// 	}
-	// }
-	// cmd := NewStatusCmd(args...)
-	// c.Process(cmd)
-	// return cmd
-	// var cmd *StatusCmd
-	// args := req.Args()
-	// NewStatusCmd(...)
-	// if len(args) != 1 {
-	// 	cmd = NewStringCmd("GET", "")
-	// } else {
-	// 	cmd = NewStringCmd("GET", args[0])
-	// }
-	cmd := NewStatusCmd(req.cmd...)
+func (c *commandable) Set(key, value string, opt SetOptions) *SetCmd {
+	cmd := NewSetCmd(key, value, opt)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnSET(req *Request) *SetCmd {
+	cmd := newRawSetCmd(req.cmd...)
+	if len(req.cmd) > 3 {
+		if _, err := parseSetArgs(req.cmd[3:]); err != nil {
+			cmd.setErr(err)
+			return cmd
+		}
+	}
 	c.Process(cmd)
 	return cmd
 }
@@ -541,6 +886,12 @@ func (c *Client) OnSETXX(req *Request) *BoolCmd {
 	return cmd
 }
 
+func (c *commandable) SetRange(key string, offset int64, value string) *IntCmd {
+	cmd := NewSetRangeCmd(key, offset, value)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnSETRANGE(req *Request) *IntCmd {
 	cmd := NewIntCmd(req.cmd...)
 	c.Process(cmd)
@@ -585,14 +936,41 @@ func (c *commandable) OnHGETALL(req *Request) *StringSliceCmd {
 // 	return cmd
 // }
 
+var (
+	errNotInteger = errorf("ERR value is not an integer or out of range")
+	errNotFloat   = errorf("ERR value is not a valid float")
+)
+
+func (c *commandable) HIncrBy(key, field string, incr int64) *IntCmd {
+	cmd := NewIntCmd("HINCRBY", key, field, formatInt(incr))
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) HIncrByFloat(key, field string, incr float64) *FloatCmd {
+	cmd := NewFloatCmd("HINCRBYFLOAT", key, field, formatFloat(incr))
+	c.Process(cmd)
+	return cmd
+}
+
+// HINCRBY key field increment
 func (c *commandable) OnHINCRBY(req *Request) *IntCmd {
 	cmd := NewIntCmd(req.cmd...)
+	if _, err := strconv.ParseInt(req.StringAtIndex(3), 10, 64); err != nil {
+		cmd.setErr(errNotInteger)
+		return cmd
+	}
 	c.Process(cmd)
 	return cmd
 }
 
+// HINCRBYFLOAT key field increment
 func (c *commandable) OnHINCRBYFLOAT(req *Request) *FloatCmd {
 	cmd := NewFloatCmd(req.cmd...)
+	if _, err := strconv.ParseFloat(req.StringAtIndex(3), 64); err != nil {
+		cmd.setErr(errNotFloat)
+		return cmd
+	}
 	c.Process(cmd)
 	return cmd
 }
@@ -615,14 +993,46 @@ func (c *commandable) OnHMGET(req *Request) *SliceCmd {
 	return cmd
 }
 
+func (c *commandable) HMSet(key string, fv ...string) *StatusCmd {
+	cmd := NewHMSetCmd(key, fv...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
 func (c *commandable) OnHMSET(req *Request) *StatusCmd {
 	cmd := NewStatusCmd(req.cmd...)
+	if err := checkHashPairs(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
 	c.Process(cmd)
 	return cmd
 }
 
-func (c *commandable) OnHSET(req *Request) *BoolCmd {
-	cmd := NewBoolCmd(req.cmd...)
+func (c *commandable) HSet(key string, fv ...string) *IntCmd {
+	cmd := NewHSetCmd(key, fv...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) HSetMap(key string, fields map[string]string) *IntCmd {
+	cmd := NewHSetMapCmd(key, fields)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHSET(req *Request) *IntCmd {
+	cmd := NewIntCmd(req.cmd...)
+	if err := checkHashPairs(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
 	c.Process(cmd)
 	return cmd
 }
@@ -639,34 +1049,217 @@ func (c *commandable) OnHVALS(req *Request) *StringSliceCmd {
 	return cmd
 }
 
+// checkHashFields checks the FIELDS numfields field... segment ending
+// args, a command of the HEXPIRE family, like Redis does.
+func checkHashFields(args []string) error {
+	for i := 2; i < len(args)-1; i++ {
+		if !strings.EqualFold(args[i], "FIELDS") {
+			continue
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n <= 0 {
+			return errNoHashFields
+		}
+		if n != len(args)-i-2 {
+			return errorf("ERR The `numfields` parameter must match the number of arguments")
+		}
+		return nil
+	}
+	return errorf("ERR Mandatory argument FIELDS is missing or not at the right position")
+}
+
+func (c *commandable) HExpire(key string, seconds int64, flag string, fields ...string) *IntSliceCmd {
+	cmd := NewHExpireCmd(key, seconds, flag, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHEXPIRE(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	if err := checkHashFields(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) HPExpire(key string, milliseconds int64, flag string, fields ...string) *IntSliceCmd {
+	cmd := NewHPExpireCmd(key, milliseconds, flag, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHPEXPIRE(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	if err := checkHashFields(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) HExpireAt(key string, unixTime int64, flag string, fields ...string) *IntSliceCmd {
+	cmd := NewHExpireAtCmd(key, unixTime, flag, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHEXPIREAT(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	if err := checkHashFields(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) HPExpireAt(key string, unixTimeMs int64, flag string, fields ...string) *IntSliceCmd {
+	cmd := NewHPExpireAtCmd(key, unixTimeMs, flag, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHPEXPIREAT(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	if err := checkHashFields(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) HTTL(key string, fields ...string) *IntSliceCmd {
+	cmd := NewHTTLCmd(key, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHTTL(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	if err := checkHashFields(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) HPTTL(key string, fields ...string) *IntSliceCmd {
+	cmd := NewHPTTLCmd(key, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHPTTL(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	if err := checkHashFields(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) HPersist(key string, fields ...string) *IntSliceCmd {
+	cmd := NewHPersistCmd(key, fields...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnHPERSIST(req *Request) *IntSliceCmd {
+	cmd := NewIntSliceCmd(req.cmd...)
+	if err := checkHashFields(req.cmd); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnHRANDFIELD(req *Request) Cmder {
+	cmd := newRandCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+//------------------------------------------------------------------------------
+
+func (c *commandable) PFAdd(key string, elements ...string) *BoolCmd {
+	cmd := NewPFAddCmd(key, elements...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnPFADD(req *Request) *BoolCmd {
+	cmd := NewBoolCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) PFCount(keys ...string) *IntCmd {
+	cmd := NewPFCountCmd(keys...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnPFCOUNT(req *Request) *IntCmd {
+	cmd := NewIntCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) PFMerge(dest string, sources ...string) *StatusCmd {
+	cmd := NewPFMergeCmd(dest, sources...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnPFMERGE(req *Request) *StatusCmd {
+	cmd := NewStatusCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
 //------------------------------------------------------------------------------
 
 func (c *commandable) BLPop(timeout time.Duration, keys ...string) *StringSliceCmd {
-	args := append([]string{"BLPOP"}, keys...)
-	args = append(args, formatSec(timeout))
-	cmd := NewStringSliceCmd(args...)
-	cmd.setReadTimeout(readTimeout(timeout))
+	cmd := NewBLPopCmd(timeout, keys...)
 	c.Process(cmd)
 	return cmd
 }
 
 func (c *commandable) BRPop(timeout time.Duration, keys ...string) *StringSliceCmd {
-	args := append([]string{"BRPOP"}, keys...)
-	args = append(args, formatSec(timeout))
-	cmd := NewStringSliceCmd(args...)
-	cmd.setReadTimeout(readTimeout(timeout))
+	cmd := NewBRPopCmd(timeout, keys...)
 	c.Process(cmd)
 	return cmd
 }
 
 func (c *commandable) BRPopLPush(source, destination string, timeout time.Duration) *StringCmd {
-	cmd := NewStringCmd(
-		"BRPOPLPUSH",
-		source,
-		destination,
-		formatSec(timeout),
-	)
-	cmd.setReadTimeout(readTimeout(timeout))
+	cmd := NewBRPopLPushCmd(source, destination, timeout)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) BLMove(source, destination, srcpos, destpos string, timeout time.Duration) *StringCmd {
+	cmd := NewBLMoveCmd(source, destination, srcpos, destpos, timeout)
 	c.Process(cmd)
 	return cmd
 }
@@ -683,6 +1276,26 @@ func (c *commandable) OnLINSERT(req *Request) *IntCmd {
 	return cmd
 }
 
+// LPos is LPOS key element, with RANK and COUNT when not nil.
+func (c *commandable) LPos(key, element string, rank, count *int64) *LposCmd {
+	args := []string{"LPOS", key, element}
+	if rank != nil {
+		args = append(args, "RANK", strconv.FormatInt(*rank, 10))
+	}
+	if count != nil {
+		args = append(args, "COUNT", strconv.FormatInt(*count, 10))
+	}
+	cmd := NewLposCmd(args...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnLPOS(req *Request) *LposCmd {
+	cmd := NewLposCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) OnLLEN(req *Request) *IntCmd {
 	cmd := NewIntCmd(req.cmd...)
 	c.Process(cmd)
@@ -809,11 +1422,17 @@ func (c *commandable) OnSMEMBERS(req *Request) *StringSliceCmd {
 	return cmd
 }
 
-// func (c *commandable) SMove(source, destination, member string) *BoolCmd {
-// 	cmd := NewBoolCmd("SMOVE", source, destination, member)
-// 	c.Process(cmd)
-// 	return cmd
-// }
+func (c *commandable) SMove(source, destination, member string) *BoolCmd {
+	cmd := NewSMoveCmd(source, destination, member)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnSMOVE(req *Request) *BoolCmd {
+	cmd := NewBoolCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
 
 func (c *commandable) OnSPOP(req *Request) *StringCmd {
 	cmd := NewStringCmd(req.cmd...)
@@ -821,8 +1440,8 @@ func (c *commandable) OnSPOP(req *Request) *StringCmd {
 	return cmd
 }
 
-func (c *commandable) OnSRANDMEMBER(req *Request) *StringCmd {
-	cmd := NewStringCmd(req.cmd...)
+func (c *commandable) OnSRANDMEMBER(req *Request) Cmder {
+	cmd := newRandCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
@@ -857,8 +1476,26 @@ type ZStore struct {
 	Aggregate string
 }
 
-func (c *commandable) OnZADD(req *Request) *IntCmd {
-	cmd := NewIntCmd(req.cmd...)
+func (c *commandable) ZAdd(key string, opt ZAddOptions, members ...Z) *ZAddCmd {
+	cmd := NewZAddCmd(key, opt, members...)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) OnZADD(req *Request) *ZAddCmd {
+	cmd := newRawZAddCmd(req.cmd...)
+	if _, _, err := parseZAddArgs(req.cmd[2:]); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnZRANDMEMBER(req *Request) Cmder {
+	cmd := newRandCmd(req.cmd...)
 	c.Process(cmd)
 	return cmd
 }
@@ -936,13 +1573,50 @@ func (c *commandable) ZRangeWithScores(key string, start, stop int64) *ZSliceCmd
 	return cmd
 }
 
+// ZRangeByScore is the range of ZRANGEBYSCORE, Min and Max are scores
+// maybe excluded by a leading (, or -inf and +inf. It is the range of
+// ZRANGEBYLEX too, Min and Max are then members included by a leading
+// [ or excluded by (, or - and +. LIMIT Offset Count is sent if either
+// is set.
 type ZRangeByScore struct {
 	Min, Max      string
 	Offset, Count int64
 }
 
-func (c *commandable) zRangeByScore(key string, opt ZRangeByScore, withScores bool) *StringSliceCmd {
-	args := []string{"ZRANGEBYSCORE", key, opt.Min, opt.Max}
+var (
+	errScoreRange = errorf("ERR min or max is not a float")
+	errLexRange   = errorf("ERR min or max not valid string range item")
+)
+
+// validScoreBound reports whether s is a bound of ZRANGEBYSCORE.
+func validScoreBound(s string) bool {
+	f, err := strconv.ParseFloat(strings.TrimPrefix(s, "("), 64)
+	return err == nil && !math.IsNaN(f)
+}
+
+// validLexBound reports whether s is a bound of ZRANGEBYLEX.
+func validLexBound(s string) bool {
+	return s == "-" || s == "+" || strings.HasPrefix(s, "(") || strings.HasPrefix(s, "[")
+}
+
+func checkScoreRange(min, max string) error {
+	if !validScoreBound(min) || !validScoreBound(max) {
+		return errScoreRange
+	}
+	return nil
+}
+
+func checkLexRange(min, max string) error {
+	if !validLexBound(min) || !validLexBound(max) {
+		return errLexRange
+	}
+	return nil
+}
+
+// args returns name key first last [WITHSCORES] [LIMIT offset count],
+// first and last are Min and Max, swapped by the REV commands.
+func (opt ZRangeByScore) args(name, key, first, last string, withScores bool) []string {
+	args := []string{name, key, first, last}
 	if withScores {
 		args = append(args, "WITHSCORES")
 	}
@@ -954,19 +1628,43 @@ func (c *commandable) zRangeByScore(key string, opt ZRangeByScore, withScores bo
 			strconv.FormatInt(opt.Count, 10),
 		)
 	}
-	cmd := NewStringSliceCmd(args...)
-	c.Process(cmd)
+	return args
+}
+
+func (c *commandable) ZRangeByScore(key string, opt ZRangeByScore) *StringSliceCmd {
+	cmd := NewZRangeByScoreCmd(key, opt)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
 	return cmd
 }
 
+// OnZRANGEBYSCORE keeps the reply as strings, WITHSCORES or not, so the
+// scores are replied as Redis formatted them.
 func (c *commandable) OnZRANGEBYSCORE(req *Request) *StringSliceCmd {
 	cmd := NewStringSliceCmd(req.cmd...)
+	if err := checkScoreRange(req.cmd[2], req.cmd[3]); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
 	c.Process(cmd)
 	return cmd
 }
 
+func (c *commandable) ZRangeByLex(key string, opt ZRangeByScore) *StringSliceCmd {
+	cmd := NewZRangeByLexCmd(key, opt)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
 func (c *commandable) OnZRANGEBYLEX(req *Request) *StringSliceCmd {
 	cmd := NewStringSliceCmd(req.cmd...)
+	if err := checkLexRange(req.cmd[2], req.cmd[3]); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
 	c.Process(cmd)
 	return cmd
 }
@@ -984,17 +1682,10 @@ func (c *commandable) OnZREMRANGEBYLEX(req *Request) *IntCmd {
 }
 
 func (c *commandable) ZRangeByScoreWithScores(key string, opt ZRangeByScore) *ZSliceCmd {
-	args := []string{"ZRANGEBYSCORE", key, opt.Min, opt.Max, "WITHSCORES"}
-	if opt.Offset != 0 || opt.Count != 0 {
-		args = append(
-			args,
-			"LIMIT",
-			strconv.FormatInt(opt.Offset, 10),
-			strconv.FormatInt(opt.Count, 10),
-		)
+	cmd := NewZRangeByScoreWithScoresCmd(key, opt)
+	if cmd.Err() == nil {
+		c.Process(cmd)
 	}
-	cmd := NewZSliceCmd(args...)
-	c.Process(cmd)
 	return cmd
 }
 
@@ -1034,24 +1725,29 @@ func (c *commandable) OnZREVRANGE(req *Request) *StringSliceCmd {
 // 	return cmd
 // }
 
+func (c *commandable) ZRevRangeByScore(key string, opt ZRangeByScore) *StringSliceCmd {
+	cmd := NewZRevRangeByScoreCmd(key, opt)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
 func (c *commandable) OnZREVRANGEBYSCORE(req *Request) *StringSliceCmd {
 	cmd := NewStringSliceCmd(req.cmd...)
+	if err := checkScoreRange(req.cmd[2], req.cmd[3]); err != nil {
+		cmd.setErr(err)
+		return cmd
+	}
 	c.Process(cmd)
 	return cmd
 }
 
 func (c *commandable) ZRevRangeByScoreWithScores(key string, opt ZRangeByScore) *ZSliceCmd {
-	args := []string{"ZREVRANGEBYSCORE", key, opt.Max, opt.Min, "WITHSCORES"}
-	if opt.Offset != 0 || opt.Count != 0 {
-		args = append(
-			args,
-			"LIMIT",
-			strconv.FormatInt(opt.Offset, 10),
-			strconv.FormatInt(opt.Count, 10),
-		)
+	cmd := NewZRevRangeByScoreWithScoresCmd(key, opt)
+	if cmd.Err() == nil {
+		c.Process(cmd)
 	}
-	cmd := NewZSliceCmd(args...)
-	c.Process(cmd)
 	return cmd
 }
 
@@ -1067,6 +1763,12 @@ func (c *commandable) OnZSCORE(req *Request) *FloatCmd {
 	return cmd
 }
 
+func (c *commandable) OnZMSCORE(req *Request) *FloatSliceCmd {
+	cmd := NewFloatSliceCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) ZUnionStore(dest string, store ZStore, keys ...string) *IntCmd {
 	args := []string{"ZUNIONSTORE", dest, strconv.FormatInt(int64(len(keys)), 10)}
 	args = append(args, keys...)
@@ -1086,6 +1788,27 @@ func (c *commandable) ZUnionStore(dest string, store ZStore, keys ...string) *In
 
 //------------------------------------------------------------------------------
 
+func (c *commandable) XInfoStream(key string) *XInfoStreamCmd {
+	cmd := NewXInfoStreamCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) XInfoGroups(key string) *XInfoGroupsCmd {
+	cmd := NewXInfoGroupsCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) OnXINFO(req *Request) Cmder {
+	cmd := newXInfoCmd(req.cmd...)
+	cmd.setClusterKeyPos(2)
+	c.Process(cmd)
+	return cmd
+}
+
+//------------------------------------------------------------------------------
+
 func (c *commandable) BgRewriteAOF() *StatusCmd {
 	cmd := NewStatusCmd("BGREWRITEAOF")
 	cmd._clusterKeyPos = 0
@@ -1107,9 +1830,8 @@ func (c *commandable) ClientKill(ipPort string) *StatusCmd {
 	return cmd
 }
 
-func (c *commandable) ClientList() *StringCmd {
-	cmd := NewStringCmd("CLIENT", "LIST")
-	cmd._clusterKeyPos = 0
+func (c *commandable) ClientList() *ClientInfoCmd {
+	cmd := NewClientListCmd()
 	c.Process(cmd)
 	return cmd
 }
@@ -1121,8 +1843,28 @@ func (c *commandable) ClientPause(dur time.Duration) *BoolCmd {
 	return cmd
 }
 
-func (c *commandable) ConfigGet(parameter string) *SliceCmd {
-	cmd := NewSliceCmd("CONFIG", "GET", parameter)
+// ClientNoEvict sends CLIENT NO-EVICT on one of the connections of the
+// client, which connection is up to the pool. Options.NoEvict sets it
+// on all of them.
+func (c *commandable) ClientNoEvict(mode string) *StatusCmd {
+	cmd := NewClientNoEvictCmd(mode)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+// ClientNoTouch is like ClientNoEvict for CLIENT NO-TOUCH.
+func (c *commandable) ClientNoTouch(mode string) *StatusCmd {
+	cmd := NewClientNoTouchCmd(mode)
+	if cmd.Err() == nil {
+		c.Process(cmd)
+	}
+	return cmd
+}
+
+func (c *commandable) ConfigGet(parameter string) *KeyValueSliceCmd {
+	cmd := NewKeyValueSliceCmd("CONFIG", "GET", parameter)
 	cmd._clusterKeyPos = 0
 	c.Process(cmd)
 	return cmd
@@ -1168,6 +1910,12 @@ func (c *commandable) Info() *StringCmd {
 	return cmd
 }
 
+func (c *commandable) OnINFO(req *Request) *InfoCmd {
+	cmd := NewInfoCmd(req.cmd...)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) LastSave() *IntCmd {
 	cmd := NewIntCmd("LASTSAVE")
 	cmd._clusterKeyPos = 0
@@ -1239,25 +1987,13 @@ func (c *commandable) Time() *StringSliceCmd {
 //------------------------------------------------------------------------------
 
 func (c *commandable) Eval(script string, keys []string, args []string) *Cmd {
-	cmdArgs := []string{"EVAL", script, strconv.FormatInt(int64(len(keys)), 10)}
-	cmdArgs = append(cmdArgs, keys...)
-	cmdArgs = append(cmdArgs, args...)
-	cmd := NewCmd(cmdArgs...)
-	if len(keys) > 0 {
-		cmd._clusterKeyPos = 3
-	}
+	cmd := NewEvalCmd(script, keys, args)
 	c.Process(cmd)
 	return cmd
 }
 
 func (c *commandable) EvalSha(sha1 string, keys []string, args []string) *Cmd {
-	cmdArgs := []string{"EVALSHA", sha1, strconv.FormatInt(int64(len(keys)), 10)}
-	cmdArgs = append(cmdArgs, keys...)
-	cmdArgs = append(cmdArgs, args...)
-	cmd := NewCmd(cmdArgs...)
-	if len(keys) > 0 {
-		cmd._clusterKeyPos = 3
-	}
+	cmd := NewEvalShaCmd(sha1, keys, args)
 	c.Process(cmd)
 	return cmd
 }
@@ -1283,17 +2019,27 @@ func (c *commandable) ScriptKill() *StatusCmd {
 }
 
 func (c *commandable) ScriptLoad(script string) *StringCmd {
-	cmd := NewStringCmd("SCRIPT", "LOAD", script)
-	cmd._clusterKeyPos = 0
+	cmd := NewScriptLoadCmd(script)
 	c.Process(cmd)
 	return cmd
 }
 
 //------------------------------------------------------------------------------
 
-func (c *commandable) DebugObject(key string) *StringCmd {
-	cmd := NewStringCmd("DEBUG", "OBJECT", key)
-	cmd._clusterKeyPos = 2
+func (c *commandable) Debug(subcommand string, args ...string) *DebugCmd {
+	cmd := NewDebugCmd(subcommand, args...)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) DebugObject(key string) *DebugObjectCmd {
+	cmd := NewDebugObjectCmd(key)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) MemoryUsage(key string, samples ...int) *IntCmd {
+	cmd := NewMemoryUsageCmd(key, samples...)
 	c.Process(cmd)
 	return cmd
 }
@@ -1336,6 +2082,12 @@ func (c *commandable) ClusterSlots() *ClusterSlotCmd {
 	return cmd
 }
 
+func (c *commandable) ClusterShards() *ClusterShardsCmd {
+	cmd := NewClusterShardsCmd()
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) ClusterNodes() *StringCmd {
 	cmd := NewStringCmd("CLUSTER", "nodes")
 	cmd._clusterKeyPos = 0
@@ -1368,6 +2120,20 @@ func (c *commandable) ClusterFailover() *StatusCmd {
 	return cmd
 }
 
+// ClusterFailoverNode sends CLUSTER FAILOVER to the replica at addr.
+func (c *commandable) ClusterFailoverNode(addr string, force bool) *StatusCmd {
+	cmd := NewClusterFailoverCmd(force)
+	cmd.SetAddr(addr)
+	c.Process(cmd)
+	return cmd
+}
+
+func (c *commandable) Failover(args ...string) *StatusCmd {
+	cmd := NewFailoverCmd(args...)
+	c.Process(cmd)
+	return cmd
+}
+
 func (c *commandable) ClusterAddSlots(slots ...int) *StatusCmd {
 	args := make([]string, len(slots)+2)
 	args[0] = "CLUSTER"
@@ -0,0 +1,667 @@
+package redis
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder returns a commandable which keeps the processed commands
+// instead of sending them.
+func recorder() (*commandable, *[]Cmder) {
+	cmds := &[]Cmder{}
+	c := &commandable{process: func(cmd Cmder) {
+		*cmds = append(*cmds, cmd)
+	}}
+	return c, cmds
+}
+
+func TestRestoreArgs(t *testing.T) {
+	payload := "\x00\xc0\n\t\x00\r\n\xff"
+	at := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		opt  RestoreArgs
+		want []string
+	}{
+		{RestoreArgs{}, []string{"RESTORE", "k", "1500", payload}},
+		{RestoreArgs{Replace: true}, []string{"RESTORE", "k", "1500", payload, "REPLACE"}},
+		{RestoreArgs{ExpireAt: at}, []string{"RESTORE", "k", "1700000000000", payload, "ABSTTL"}},
+		{RestoreArgs{IdleTime: time.Minute}, []string{"RESTORE", "k", "1500", payload, "IDLETIME", "60"}},
+		{RestoreArgs{Freq: 10}, []string{"RESTORE", "k", "1500", payload, "FREQ", "10"}},
+		{
+			RestoreArgs{Replace: true, ExpireAt: at, IdleTime: time.Minute},
+			[]string{"RESTORE", "k", "1700000000000", payload, "REPLACE", "ABSTTL", "IDLETIME", "60"},
+		},
+		{
+			RestoreArgs{Replace: true, ExpireAt: at, Freq: 255},
+			[]string{"RESTORE", "k", "1700000000000", payload, "REPLACE", "ABSTTL", "FREQ", "255"},
+		},
+	}
+	for _, test := range tests {
+		got, err := restoreArgs("k", 1500*time.Millisecond, payload, test.opt)
+		if err != nil {
+			t.Errorf("%+v: %s", test.opt, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %q, wanted %q", test.opt, got, test.want)
+		}
+	}
+
+	if _, err := restoreArgs("k", 0, payload, RestoreArgs{IdleTime: time.Second, Freq: 1}); err != errRestoreIdleFreq {
+		t.Errorf("got %v, wanted %v", err, errRestoreIdleFreq)
+	}
+	if _, err := restoreArgs("k", 0, payload, RestoreArgs{Freq: 256}); err == nil {
+		t.Error("FREQ 256 must be rejected")
+	}
+
+	// The binary payload must be framed by its length.
+	args, _ := restoreArgs("k", 0, payload, RestoreArgs{})
+	buf := string(AppendCommand(nil, args))
+	if want := "$8\r\n" + payload + "\r\n"; buf[len(buf)-len(want):] != want {
+		t.Errorf("got %q, wanted suffix %q", buf, want)
+	}
+}
+
+func TestOnRESTOREValidation(t *testing.T) {
+	c, cmds := recorder()
+
+	tests := []struct {
+		options []string
+		ok      bool
+	}{
+		{nil, true},
+		{[]string{"REPLACE"}, true},
+		{[]string{"replace", "absttl"}, true},
+		{[]string{"IDLETIME", "10"}, true},
+		{[]string{"FREQ", "5", "REPLACE"}, true},
+		{[]string{"IDLETIME", "10", "FREQ", "5"}, false},
+		{[]string{"FREQ", "300"}, false},
+		{[]string{"IDLETIME"}, false},
+		{[]string{"IDLETIME", "-1"}, false},
+		{[]string{"BOGUS"}, false},
+	}
+	for _, test := range tests {
+		*cmds = nil
+		req := NewRequest(append([]string{"RESTORE", "k", "0", "payload"}, test.options...))
+		cmd := c.OnRESTORE(req)
+		if test.ok && (cmd.Err() != nil || len(*cmds) != 1) {
+			t.Errorf("%q: got %v, wanted command to be sent", test.options, cmd.Err())
+		}
+		if !test.ok && (cmd.Err() == nil || len(*cmds) != 0) {
+			t.Errorf("%q: wanted command to be rejected", test.options)
+		}
+	}
+}
+
+func TestHIncrBy(t *testing.T) {
+	c, cmds := recorder()
+
+	for _, incr := range []int64{5, -3} {
+		*cmds = nil
+		cmd := c.HIncrBy("hash", "field", incr)
+		want := []string{"HINCRBY", "hash", "field", formatInt(incr)}
+		if !reflect.DeepEqual(cmd.args(), want) || cmd.clusterKey() != "hash" {
+			t.Errorf("got %q key %q", cmd.args(), cmd.clusterKey())
+		}
+		if err := cmd.parseReply(newTestReader(":7\r\n")); err != nil || cmd.Val() != 7 {
+			t.Errorf("got %d, %v", cmd.Val(), err)
+		}
+	}
+
+	for _, incr := range []string{"10", "-10"} {
+		*cmds = nil
+		c.OnHINCRBY(NewRequest([]string{"HINCRBY", "hash", "field", incr}))
+		if len(*cmds) != 1 {
+			t.Errorf("%s: command must be sent", incr)
+		}
+	}
+	for _, incr := range []string{"1.5", "abc", ""} {
+		*cmds = nil
+		cmd := c.OnHINCRBY(NewRequest([]string{"HINCRBY", "hash", "field", incr}))
+		if cmd.Err() != errNotInteger || len(*cmds) != 0 {
+			t.Errorf("%q: got %v, wanted %v", incr, cmd.Err(), errNotInteger)
+		}
+	}
+}
+
+func TestHIncrByFloat(t *testing.T) {
+	c, cmds := recorder()
+
+	for _, incr := range []float64{0.5, -2.25} {
+		cmd := c.HIncrByFloat("hash", "field", incr)
+		want := []string{"HINCRBYFLOAT", "hash", "field", formatFloat(incr)}
+		if !reflect.DeepEqual(cmd.args(), want) || cmd.clusterKey() != "hash" {
+			t.Errorf("got %q key %q", cmd.args(), cmd.clusterKey())
+		}
+		if err := cmd.parseReply(newTestReader("$4\r\n1.25\r\n")); err != nil || cmd.Val() != 1.25 {
+			t.Errorf("got %v, %v", cmd.Val(), err)
+		}
+	}
+
+	for _, incr := range []string{"3", "-0.1", "1e3"} {
+		*cmds = nil
+		c.OnHINCRBYFLOAT(NewRequest([]string{"HINCRBYFLOAT", "hash", "field", incr}))
+		if len(*cmds) != 1 {
+			t.Errorf("%s: command must be sent", incr)
+		}
+	}
+	*cmds = nil
+	cmd := c.OnHINCRBYFLOAT(NewRequest([]string{"HINCRBYFLOAT", "hash", "field", "one"}))
+	if cmd.Err() != errNotFloat || len(*cmds) != 0 {
+		t.Errorf("got %v, wanted %v", cmd.Err(), errNotFloat)
+	}
+	if got := string(cmd.Reply()); got != "-ERR value is not a valid float\r\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestEvalCmd(t *testing.T) {
+	keys := []string{"{user}:a", "{user}:b"}
+	args := []string{"1", "2", "3"}
+
+	eval := NewEvalCmd("return 1", keys, args)
+	want := []string{"EVAL", "return 1", "2", "{user}:a", "{user}:b", "1", "2", "3"}
+	if !reflect.DeepEqual(eval.args(), want) {
+		t.Errorf("got %q, wanted %q", eval.args(), want)
+	}
+	if !reflect.DeepEqual(eval.clusterKeys(), keys) || eval.clusterKey() != "{user}:a" {
+		t.Errorf("got keys %q, key %q", eval.clusterKeys(), eval.clusterKey())
+	}
+
+	sha := NewEvalShaCmd("e0e1f9fabfc9d4800c877a703b823ac0578ff8db", nil, args)
+	want = []string{"EVALSHA", "e0e1f9fabfc9d4800c877a703b823ac0578ff8db", "0", "1", "2", "3"}
+	if !reflect.DeepEqual(sha.args(), want) {
+		t.Errorf("got %q, wanted %q", sha.args(), want)
+	}
+	if len(sha.clusterKeys()) != 0 || sha.clusterKey() != "" {
+		t.Errorf("script without keys must be keyless, got %q", sha.clusterKeys())
+	}
+}
+
+func TestClusterCrossSlot(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+
+	if !sameSlot([]string{"{user}:a", "{user}:b"}) {
+		t.Error("keys with the same hash tag must share a slot")
+	}
+
+	cmd := NewEvalCmd("return 1", []string{"a", "b"}, nil)
+	c.process(cmd)
+	if cmd.Err() != ErrCrossSlot {
+		t.Errorf("got %v, wanted %v", cmd.Err(), ErrCrossSlot)
+	}
+}
+
+func TestCopyCmd(t *testing.T) {
+	db := 2
+	tests := []struct {
+		cmd  *BoolCmd
+		args string
+	}{
+		{NewCopyCmd("{u}a", "{u}b", nil, false), "COPY {u}a {u}b"},
+		{NewCopyCmd("{u}a", "{u}b", nil, true), "COPY {u}a {u}b REPLACE"},
+		{NewCopyCmd("{u}a", "{u}b", &db, false), "COPY {u}a {u}b DB 2"},
+		{NewCopyCmd("{u}a", "{u}b", &db, true), "COPY {u}a {u}b DB 2 REPLACE"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(test.cmd.args(), " "); got != test.args {
+			t.Errorf("got %q, wanted %q", got, test.args)
+		}
+		if keys := test.cmd.clusterKeys(); strings.Join(keys, " ") != "{u}a {u}b" {
+			t.Errorf("%s: got keys %q", test.args, keys)
+		}
+	}
+
+	c := newTestClusterClient(&ClusterOptions{})
+	cmd := NewCopyCmd("a", "b", nil, true)
+	c.process(cmd)
+	if cmd.Err() != ErrCrossSlot {
+		t.Errorf("got %v, wanted %v", cmd.Err(), ErrCrossSlot)
+	}
+}
+
+func TestGetEx(t *testing.T) {
+	c, cmds := recorder()
+
+	tests := []struct {
+		options []string
+		ok      bool
+	}{
+		{nil, true},
+		{[]string{"EX", "10"}, true},
+		{[]string{"px", "1500"}, true},
+		{[]string{"EXAT", "1700000000"}, true},
+		{[]string{"PERSIST"}, true},
+		{[]string{"EX", "10", "PERSIST"}, false},
+		{[]string{"PERSIST", "EX", "10"}, false},
+		{[]string{"EX", "10", "PX", "100"}, false},
+		{[]string{"EX"}, false},
+		{[]string{"EX", "0"}, false},
+		{[]string{"EX", "ten"}, false},
+		{[]string{"KEEPTTL"}, false},
+	}
+	for _, test := range tests {
+		*cmds = nil
+		cmd := c.GetEx("k", test.options...)
+		if test.ok && (cmd.Err() != nil || len(*cmds) != 1) {
+			t.Errorf("%q: got %v, wanted command to be sent", test.options, cmd.Err())
+		}
+		if !test.ok && (cmd.Err() == nil || len(*cmds) != 0) {
+			t.Errorf("%q: wanted command to be rejected", test.options)
+		}
+
+		*cmds = nil
+		cmd = c.OnGETEX(NewRequest(append([]string{"GETEX", "k"}, test.options...)))
+		if test.ok != (cmd.Err() == nil && len(*cmds) == 1) {
+			t.Errorf("%q: OnGETEX got %v", test.options, cmd.Err())
+		}
+	}
+
+	cmd := NewGetDelCmd("k")
+	if cmd.clusterKey() != "k" {
+		t.Errorf("got key %q, wanted k", cmd.clusterKey())
+	}
+	cmd.parseReply(newTestReader("$-1\r\n"))
+	if got := string(cmd.Reply()); got != "$-1\r\n" {
+		t.Errorf("got %q for a missing key, wanted $-1", got)
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	c, cmds := recorder()
+
+	tests := []struct {
+		opt  SetOptions
+		args string
+	}{
+		{SetOptions{}, "SET k v"},
+		{SetOptions{EX: 10}, "SET k v EX 10"},
+		{SetOptions{PX: 1500, NX: true}, "SET k v PX 1500 NX"},
+		{SetOptions{Get: true, XX: true, ExAt: 1700000000}, "SET k v EXAT 1700000000 XX GET"},
+		{SetOptions{KeepTTL: true, Get: true}, "SET k v KEEPTTL GET"},
+	}
+	for _, test := range tests {
+		*cmds = nil
+		cmd := c.Set("k", "v", test.opt)
+		if got := strings.Join(cmd.args(), " "); got != test.args {
+			t.Errorf("got %q, wanted %q", got, test.args)
+		}
+		if cmd.Err() != nil || len(*cmds) != 1 {
+			t.Errorf("%s: got %v, wanted command to be sent", test.args, cmd.Err())
+		}
+		if opt, err := parseSetArgs(cmd.args()[3:]); err != nil || opt != test.opt {
+			t.Errorf("%s: parsed %+v, %v", test.args, opt, err)
+		}
+	}
+
+	invalid := []SetOptions{
+		{EX: 10, PX: 100},
+		{EX: 10, KeepTTL: true},
+		{PxAt: 1, ExAt: 1},
+		{NX: true, XX: true},
+		{EX: -1},
+	}
+	for _, opt := range invalid {
+		*cmds = nil
+		if cmd := c.Set("k", "v", opt); cmd.Err() == nil || len(*cmds) != 0 {
+			t.Errorf("%+v: wanted command to be rejected", opt)
+		}
+	}
+	for _, options := range [][]string{
+		{"EX", "10", "PX", "10"},
+		{"EX", "10", "EX", "10"},
+		{"KEEPTTL", "EX", "10"},
+		{"NX", "XX"},
+		{"EX"},
+		{"EX", "0"},
+		{"EX", "ten"},
+		{"BOGUS"},
+	} {
+		*cmds = nil
+		cmd := c.OnSET(NewRequest(append([]string{"SET", "k", "v"}, options...)))
+		if cmd.Err() == nil || len(*cmds) != 0 {
+			t.Errorf("%q: wanted command to be rejected", options)
+		}
+	}
+}
+
+func TestSetCmdGet(t *testing.T) {
+	cmd := NewSetCmd("k", "v", SetOptions{})
+	cmd.parseReply(newTestReader("+OK\r\n"))
+	if got := string(cmd.Reply()); got != "+OK\r\n" {
+		t.Errorf("got %q, wanted +OK", got)
+	}
+
+	// GET replies with the old value, a bulk string.
+	cmd = NewSetCmd("k", "v", SetOptions{Get: true})
+	cmd.parseReply(newTestReader("$3\r\nold\r\n"))
+	if got := string(cmd.Reply()); got != "$3\r\nold\r\n" || cmd.Val() != "old" {
+		t.Errorf("got %q, wanted the old value", got)
+	}
+	cmd.reset()
+	cmd.parseReply(newTestReader("$-1\r\n"))
+	if got := string(cmd.Reply()); got != "$-1\r\n" || cmd.Err() != Nil {
+		t.Errorf("got %q, %v for a missing key", got, cmd.Err())
+	}
+
+	built, _ := BuildCmd([]string{"set", "k", "v", "get"})
+	if set, ok := built.(*SetCmd); !ok || !set.IsGet() {
+		t.Errorf("got %T, wanted SET GET", built)
+	}
+}
+
+func TestZAddOptions(t *testing.T) {
+	c, cmds := recorder()
+	m := Z{Score: 1.5, Member: "a"}
+
+	tests := []struct {
+		opt  ZAddOptions
+		args string
+	}{
+		{ZAddOptions{}, "ZADD z 1.5 a"},
+		{ZAddOptions{XX: true, GT: true, CH: true}, "ZADD z XX GT CH 1.5 a"},
+		{ZAddOptions{NX: true, Incr: true}, "ZADD z NX INCR 1.5 a"},
+		{ZAddOptions{LT: true}, "ZADD z LT 1.5 a"},
+	}
+	for _, test := range tests {
+		*cmds = nil
+		cmd := c.ZAdd("z", test.opt, m)
+		if got := strings.Join(cmd.args(), " "); got != test.args {
+			t.Errorf("got %q, wanted %q", got, test.args)
+		}
+		if cmd.Err() != nil || len(*cmds) != 1 || cmd.clusterKey() != "z" {
+			t.Errorf("%s: got %v, wanted command to be sent", test.args, cmd.Err())
+		}
+	}
+
+	invalid := []struct {
+		opt     ZAddOptions
+		members []Z
+		err     error
+	}{
+		{ZAddOptions{NX: true, XX: true}, []Z{m}, errZAddNXXX},
+		{ZAddOptions{NX: true, GT: true}, []Z{m}, errZAddGTLT},
+		{ZAddOptions{GT: true, LT: true}, []Z{m}, errZAddGTLT},
+		{ZAddOptions{Incr: true}, []Z{m, m}, errZAddIncr},
+	}
+	for _, test := range invalid {
+		*cmds = nil
+		if cmd := c.ZAdd("z", test.opt, test.members...); cmd.Err() != test.err || len(*cmds) != 0 {
+			t.Errorf("%+v: got %v, wanted %v", test.opt, cmd.Err(), test.err)
+		}
+	}
+	for _, args := range [][]string{
+		{"ZADD", "z", "NX", "GT", "1", "a"},
+		{"ZADD", "z", "INCR", "1", "a", "2", "b"},
+		{"ZADD", "z", "1"},
+		{"ZADD", "z", "XX"},
+	} {
+		*cmds = nil
+		if cmd := c.OnZADD(NewRequest(args)); cmd.Err() == nil || len(*cmds) != 0 {
+			t.Errorf("%q: wanted command to be rejected", args)
+		}
+	}
+}
+
+func TestZAddCmdReply(t *testing.T) {
+	cmd := NewZAddCmd("z", ZAddOptions{CH: true}, Z{1, "a"}, Z{2, "b"})
+	cmd.parseReply(newTestReader(":2\r\n"))
+	if cmd.Val() != 2 || string(cmd.Reply()) != ":2\r\n" {
+		t.Errorf("got %d, %q", cmd.Val(), cmd.Reply())
+	}
+
+	cmd = NewZAddCmd("z", ZAddOptions{Incr: true}, Z{1, "a"})
+	cmd.parseReply(newTestReader("$3\r\n2.5\r\n"))
+	if cmd.Score() != 2.5 || string(cmd.Reply()) != "$3\r\n2.5\r\n" {
+		t.Errorf("got %v, %q", cmd.Score(), cmd.Reply())
+	}
+
+	// NX kept the existing member from being incremented.
+	built, _ := BuildCmd([]string{"ZADD", "z", "nx", "incr", "1", "a"})
+	cmd, ok := built.(*ZAddCmd)
+	if !ok || !cmd.IsIncr() {
+		t.Fatalf("got %T, wanted ZADD INCR", built)
+	}
+	cmd.parseReply(newTestReader("$-1\r\n"))
+	if cmd.Err() != Nil || string(cmd.Reply()) != "$-1\r\n" {
+		t.Errorf("got %v, %q, wanted a nil reply", cmd.Err(), cmd.Reply())
+	}
+
+	// An integer reply doesn't fit INCR.
+	cmd = NewZAddCmd("z", ZAddOptions{Incr: true}, Z{1, "a"})
+	if err := cmd.parseReply(newTestReader(":1\r\n")); !errors.Is(err, ErrUnexpectedReplyType) {
+		t.Errorf("got %v, wanted %v", err, ErrUnexpectedReplyType)
+	}
+}
+
+func TestHExpire(t *testing.T) {
+	c, cmds := recorder()
+
+	cmd := c.HExpire("h", 60, "nx", "f1", "f2")
+	if cmd.Err() != nil || len(*cmds) != 1 {
+		t.Fatalf("got %v, wanted command to be sent", cmd.Err())
+	}
+	want := []string{"HEXPIRE", "h", "60", "NX", "FIELDS", "2", "f1", "f2"}
+	if !reflect.DeepEqual(cmd.args(), want) {
+		t.Errorf("got %q, wanted %q", cmd.args(), want)
+	}
+	if keys := cmd.clusterKeys(); !reflect.DeepEqual(keys, []string{"h"}) {
+		t.Errorf("got keys %q, wanted h", keys)
+	}
+
+	// f1 has a TTL now, f2 doesn't exist.
+	reply := "*2\r\n:1\r\n:-2\r\n"
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if got := cmd.Val(); !reflect.DeepEqual(got, []int64{HExpireSet, HFieldMissing}) {
+		t.Errorf("got %v", got)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("got %q, wanted %q", got, reply)
+	}
+
+	ttl := NewHTTLCmd("h", "f1", "f2")
+	if !ttl.IsReadOnly() || !reflect.DeepEqual(ttl.args(), []string{"HTTL", "h", "FIELDS", "2", "f1", "f2"}) {
+		t.Errorf("got %q", ttl.args())
+	}
+	ttl.parseReply(newTestReader("*2\r\n:60\r\n:-2\r\n"))
+	if got := ttl.Val(); !reflect.DeepEqual(got, []int64{60, HFieldMissing}) {
+		t.Errorf("got %v", got)
+	}
+
+	*cmds = nil
+	if err := c.HPersist("h").Err(); err != errNoHashFields || len(*cmds) != 0 {
+		t.Errorf("got %v, wanted %v", err, errNoHashFields)
+	}
+	if err := c.HExpire("h", 60, "sometimes", "f").Err(); err == nil || len(*cmds) != 0 {
+		t.Error("wanted an invalid flag to be rejected")
+	}
+
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"HEXPIRE", "h", "60", "FIELDS", "1", "f"}, true},
+		{[]string{"HEXPIRE", "h", "60", "XX", "fields", "2", "f1", "f2"}, true},
+		{[]string{"HEXPIRE", "h", "60", "FIELDS", "2", "f"}, false},
+		{[]string{"HEXPIRE", "h", "60", "FIELDS", "0", "f"}, false},
+		{[]string{"HEXPIRE", "h", "60", "f1", "f2"}, false},
+	}
+	for _, test := range tests {
+		*cmds = nil
+		cmd := c.OnHEXPIRE(NewRequest(test.args))
+		if test.ok != (cmd.Err() == nil && len(*cmds) == 1) {
+			t.Errorf("%q: got %v", test.args, cmd.Err())
+		}
+	}
+}
+
+func TestTwoKeyCommandsSameSlot(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	c.commandable.process = c.process
+
+	tests := []struct {
+		cmd  Cmder
+		want []string
+	}{
+		{NewRenameCmd("{u1}a", "{u1}b"), []string{"RENAME", "{u1}a", "{u1}b"}},
+		{NewRenameNXCmd("{u1}a", "{u1}b"), []string{"RENAMENX", "{u1}a", "{u1}b"}},
+		{NewSMoveCmd("{u1}a", "{u1}b", "m"), []string{"SMOVE", "{u1}a", "{u1}b", "m"}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.cmd.args(), test.want) {
+			t.Errorf("got %q, wanted %q", test.cmd.args(), test.want)
+		}
+		if keys := test.cmd.clusterKeys(); !reflect.DeepEqual(keys, test.want[1:3]) || !sameSlot(keys) {
+			t.Errorf("%q: got keys %q", test.want, keys)
+		}
+	}
+
+	// Cross slot commands fail before being routed, there is no node.
+	rename := c.Rename("a", "b")
+	renameNX := c.RenameNX("a", "b")
+	smove := c.SMove("a", "b", "m")
+	for _, cmd := range []Cmder{rename, renameNX, smove} {
+		if cmd.Err() != ErrCrossSlot {
+			t.Errorf("%q: got %v, wanted %v", cmd.args(), cmd.Err(), ErrCrossSlot)
+		}
+		if got := string(cmd.Reply()); !strings.HasPrefix(got, "-CROSSSLOT ") {
+			t.Errorf("%q: got %q", cmd.args(), got)
+		}
+	}
+	if err := c.OnSMOVE(NewRequest([]string{"SMOVE", "a", "b", "m"})).Err(); err != ErrCrossSlot {
+		t.Errorf("OnSMOVE: got %v, wanted %v", err, ErrCrossSlot)
+	}
+}
+
+func TestHSet(t *testing.T) {
+	c, cmds := recorder()
+
+	hset := c.HSet("h", "f1", "v1", "f2", "v2")
+	if want := []string{"HSET", "h", "f1", "v1", "f2", "v2"}; !reflect.DeepEqual(hset.args(), want) || len(*cmds) != 1 {
+		t.Errorf("got %q, wanted %q", hset.args(), want)
+	}
+	hset.parseReply(newTestReader(":2\r\n"))
+	if hset.Val() != 2 || string(hset.Reply()) != ":2\r\n" {
+		t.Errorf("got %d %q, wanted 2 fields added", hset.Val(), hset.Reply())
+	}
+
+	*cmds = nil
+	m := map[string]string{"f2": "v2", "f1": "v1", "f3": ""}
+	if got, want := c.HSetMap("h", m).args(), []string{"HSET", "h", "f1", "v1", "f2", "v2", "f3", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if got, want := NewHMSetMapCmd("h", m).args(), []string{"HMSET", "h", "f1", "v1", "f2", "v2", "f3", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	*cmds = nil
+	odd := []Cmder{
+		c.HSet("h", "f1", "v1", "f2"),
+		c.HSet("h"),
+		c.HSetMap("h", nil),
+		c.HMSet("h", "f1"),
+		c.OnHSET(NewRequest([]string{"HSET", "h", "f1", "v1", "f2"})),
+		c.OnHMSET(NewRequest([]string{"HMSET", "h", "f1"})),
+	}
+	for _, cmd := range odd {
+		want := "ERR wrong number of arguments for '" + strings.ToLower(cmd.Name()) + "' command"
+		if cmd.Err() == nil || cmd.Err().Error() != want {
+			t.Errorf("%q: got %v, wanted %q", cmd.args(), cmd.Err(), want)
+		}
+	}
+	if len(*cmds) != 0 {
+		t.Errorf("got %d commands sent, wanted none", len(*cmds))
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	add := NewPFAddCmd("{hll}a", "x", "y")
+	if want := []string{"PFADD", "{hll}a", "x", "y"}; !reflect.DeepEqual(add.args(), want) || add.IsReadOnly() {
+		t.Errorf("got %q, wanted %q", add.args(), want)
+	}
+	count := NewPFCountCmd("{hll}a", "{hll}b")
+	if keys := count.clusterKeys(); !reflect.DeepEqual(keys, []string{"{hll}a", "{hll}b"}) || !count.IsReadOnly() {
+		t.Errorf("got keys %q", keys)
+	}
+	merge := NewPFMergeCmd("{hll}dst", "{hll}a", "{hll}b")
+	if want := []string{"PFMERGE", "{hll}dst", "{hll}a", "{hll}b"}; !reflect.DeepEqual(merge.args(), want) {
+		t.Errorf("got %q, wanted %q", merge.args(), want)
+	}
+	if keys := merge.clusterKeys(); !reflect.DeepEqual(keys, merge.args()[1:]) || !sameSlot(keys) {
+		t.Errorf("got keys %q", keys)
+	}
+
+	c := newTestClusterClient(&ClusterOptions{})
+	c.commandable.process = c.process
+	for _, cmd := range []Cmder{
+		c.PFCount("a", "b"),
+		c.PFMerge("dst", "a"),
+		c.OnPFCOUNT(NewRequest([]string{"PFCOUNT", "a", "b"})),
+		c.OnPFMERGE(NewRequest([]string{"PFMERGE", "dst", "a", "b"})),
+	} {
+		if cmd.Err() != ErrCrossSlot {
+			t.Errorf("%q: got %v, wanted %v", cmd.args(), cmd.Err(), ErrCrossSlot)
+		}
+	}
+}
+
+func TestZRangeBy(t *testing.T) {
+	opt := ZRangeByScore{Min: "(1", Max: "+inf", Offset: 2, Count: 3}
+	cmd := NewZRangeByScoreWithScoresCmd("zset", opt)
+	if want := []string{"ZRANGEBYSCORE", "zset", "(1", "+inf", "WITHSCORES", "LIMIT", "2", "3"}; !reflect.DeepEqual(cmd.args(), want) {
+		t.Errorf("got %q, wanted %q", cmd.args(), want)
+	}
+	if cmd.Err() != nil || cmd.clusterKey() != "zset" || !cmd.IsReadOnly() {
+		t.Errorf("got err %v, key %q", cmd.Err(), cmd.clusterKey())
+	}
+	reply := "*4\r\n$1\r\na\r\n$3\r\n1.5\r\n$1\r\nb\r\n$3\r\ninf\r\n"
+	if err := cmd.parseReply(newTestReader(reply)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []Z{{1.5, "a"}, {math.Inf(1), "b"}}; !reflect.DeepEqual(cmd.Val(), want) {
+		t.Errorf("got %v, wanted %v", cmd.Val(), want)
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+	if err := NewZSliceCmd().parseReply(newTestReader("*1\r\n$1\r\na\r\n")); !errors.Is(err, ErrProtocol) {
+		t.Errorf("odd reply: got %v, wanted %v", err, ErrProtocol)
+	}
+
+	rev := NewZRevRangeByScoreCmd("zset", ZRangeByScore{Min: "-inf", Max: "10"})
+	if want := []string{"ZREVRANGEBYSCORE", "zset", "10", "-inf"}; !reflect.DeepEqual(rev.args(), want) || rev.Err() != nil {
+		t.Errorf("got %q, %v", rev.args(), rev.Err())
+	}
+	lex := NewZRangeByLexCmd("zset", ZRangeByScore{Min: "[a", Max: "+", Count: -1})
+	if want := []string{"ZRANGEBYLEX", "zset", "[a", "+", "LIMIT", "0", "-1"}; !reflect.DeepEqual(lex.args(), want) || lex.Err() != nil {
+		t.Errorf("got %q, %v", lex.args(), lex.Err())
+	}
+
+	for _, cmd := range []Cmder{
+		NewZRangeByScoreCmd("zset", ZRangeByScore{Min: "a", Max: "1"}),
+		NewZRangeByScoreWithScoresCmd("zset", ZRangeByScore{Min: "1", Max: "nan"}),
+		NewZRevRangeByScoreCmd("zset", ZRangeByScore{Min: "[1", Max: "2"}),
+	} {
+		if cmd.Err() != errScoreRange {
+			t.Errorf("%q: got %v, wanted %v", cmd.args(), cmd.Err(), errScoreRange)
+		}
+	}
+	if cmd := NewZRangeByLexCmd("zset", ZRangeByScore{Min: "a", Max: "+"}); cmd.Err() != errLexRange {
+		t.Errorf("got %v, wanted %v", cmd.Err(), errLexRange)
+	}
+
+	c, cmds := recorder()
+	c.ZRangeByScore("zset", ZRangeByScore{Min: "x", Max: "1"})
+	c.OnZRANGEBYLEX(NewRequest([]string{"ZRANGEBYLEX", "zset", "a", "b"}))
+	c.OnZRANGEBYSCORE(NewRequest([]string{"ZRANGEBYSCORE", "zset", "(1", "inf", "WITHSCORES"}))
+	if len(*cmds) != 1 || (*cmds)[0].Name() != "ZRANGEBYSCORE" {
+		t.Errorf("got %v processed, wanted only the valid ZRANGEBYSCORE", *cmds)
+	}
+}
@@ -1,7 +1,10 @@
 package redis
 
 import (
+	"context"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dongzerun/smartproxy/redis/bufio.v1"
@@ -11,14 +14,26 @@ var (
 	zeroTime = time.Time{}
 )
 
+// maxConnBufSize is the largest request buffer kept by a connection.
+const maxConnBufSize = 64 * 1024
+
 type conn struct {
 	netcn net.Conn
-	rd    *bufio.Reader
+	rd    *reader
 	buf   []byte
 
 	usedAt       time.Time
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+
+	// Requests larger than chunkSize are written in chunks, each with
+	// its own write deadline.
+	chunkSize int
+
+	// The database currently selected on the connection.
+	db int64
+	// The protocol version negotiated with HELLO, 2 without HELLO.
+	proto int
 }
 
 func newConnDialer(opt *Options) func() (*conn, error) {
@@ -29,34 +44,45 @@ func newConnDialer(opt *Options) func() (*conn, error) {
 			return nil, err
 		}
 		cn := &conn{
-			netcn: netcn,
-			buf:   make([]byte, 0, 64),
+			netcn:     netcn,
+			buf:       make([]byte, 0, 64),
+			chunkSize: opt.WriteChunkSize,
 		}
-		cn.rd = bufio.NewReader(cn)
+		cn.rd = newReader(bufio.NewReaderSize(cn, opt.getReadBufferSize()), opt)
 		return cn, cn.init(opt)
 	}
 }
 
 func (cn *conn) init(opt *Options) error {
-	if opt.Password == "" && opt.DB == 0 {
-		return nil
+	cn.proto = 2
+	hello := false
+	if opt.Protocol > 2 {
+		ok, err := cn.hello(opt)
+		if err != nil {
+			return err
+		}
+		hello = ok
 	}
 
-	// Use connection to connect to redis
-	pool := newSingleConnPool(nil, false)
-	pool.SetConn(cn)
-
-	// Client is not closed because we want to reuse underlying connection.
-	client := newClient(opt, pool)
-
-	if opt.Password != "" {
-		if err := client.Auth(opt.Password).Err(); err != nil {
+	if opt.Password != "" && !hello {
+		if err := cn.exec(NewAuthCmd(opt.Password)); err != nil {
 			return err
 		}
 	}
 
 	if opt.DB > 0 {
-		if err := client.Select(opt.DB).Err(); err != nil {
+		if err := cn.selectDB(opt.DB); err != nil {
+			return err
+		}
+	}
+
+	if opt.NoEvict {
+		if err := cn.exec(NewClientNoEvictCmd("ON")); err != nil {
+			return err
+		}
+	}
+	if opt.NoTouch {
+		if err := cn.exec(NewClientNoTouchCmd("ON")); err != nil {
 			return err
 		}
 	}
@@ -64,14 +90,141 @@ func (cn *conn) init(opt *Options) error {
 	return nil
 }
 
+// hello negotiates opt.Protocol and authenticates with HELLO. It
+// returns false if the server doesn't know HELLO, which leaves the
+// connection on RESP2 and unauthenticated.
+func (cn *conn) hello(opt *Options) (bool, error) {
+	var auth []string
+	if opt.Password != "" {
+		auth = append(auth, opt.Password)
+	}
+	cmd := NewHelloCmd(opt.Protocol, auth...)
+	if err := cn.exec(cmd); err != nil {
+		if _, ok := err.(redisError); ok && isUnknownCommandError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if proto := cmd.Proto(); proto > 0 {
+		cn.proto = proto
+	} else {
+		cn.proto = opt.Protocol
+	}
+	return true, nil
+}
+
+func isUnknownCommandError(err error) bool {
+	return strings.HasPrefix(err.Error(), "ERR unknown command")
+}
+
+// exec sends cmd and reads its reply.
+func (cn *conn) exec(cmd Cmder) error {
+	if err := cn.writeCmds(cmd); err != nil {
+		return err
+	}
+	return cmd.parseReply(cn.rd)
+}
+
+func (cn *conn) selectDB(db int64) error {
+	if err := cn.exec(NewSelectCmd(int(db))); err != nil {
+		return err
+	}
+	cn.db = db
+	return nil
+}
+
+// trackState records the connection state changed by a successful
+// SELECT or RESET sent through cn. RESET drops the authentication and
+// the protocol too, the connection is set up again as if just dialed.
+func (cn *conn) trackState(opt *Options, cmd Cmder) error {
+	if cmd.Err() != nil {
+		return nil
+	}
+	args := cmd.args()
+	switch cmd.Name() {
+	case "SELECT":
+		if len(args) != 2 {
+			return nil
+		}
+		if db, err := strconv.ParseInt(args[1], 10, 64); err == nil {
+			cn.db = db
+		}
+	case "RESET":
+		cn.db = 0
+		cn.proto = 2
+		if opt.Password != "" || opt.Protocol > 2 || opt.DB > 0 || opt.NoEvict || opt.NoTouch {
+			return cn.init(opt)
+		}
+	}
+	return nil
+}
+
+// applyTimeouts sets the read and write timeouts of cn to the ones
+// declared by cmds, the largest one wins for a batch. Commands without
+// a timeout use the client defaults from opt.
+func (cn *conn) applyTimeouts(opt *Options, cmds ...Cmder) {
+	cn.ReadTimeout = opt.ReadTimeout
+	cn.WriteTimeout = opt.WriteTimeout
+
+	var rd, wr *time.Duration
+	for _, cmd := range cmds {
+		if t := cmd.readTimeout(); t != nil && (rd == nil || *t > *rd) {
+			rd = t
+		}
+		if t := cmd.writeTimeout(); t != nil && (wr == nil || *t > *wr) {
+			wr = t
+		}
+	}
+	if rd != nil {
+		cn.ReadTimeout = *rd
+	}
+	if wr != nil {
+		cn.WriteTimeout = *wr
+	}
+}
+
+// clearTimeouts drops the timeouts of the last command, so they don't
+// leak to the next user of the pooled connection.
+func (cn *conn) clearTimeouts() {
+	cn.ReadTimeout = 0
+	cn.WriteTimeout = 0
+	cn.netcn.SetDeadline(zeroTime)
+}
+
 func (cn *conn) writeCmds(cmds ...Cmder) error {
 	buf := cn.buf[:0]
 	for _, cmd := range cmds {
-		buf = appendArgs(buf, cmd.args())
+		buf = AppendCommand(buf, cmd.args())
 	}
+	// Keep the grown buffer for the next request, unless a large value
+	// would pin it to the connection.
+	if cap(buf) <= maxConnBufSize {
+		cn.buf = buf
+	}
+
+	if cn.chunkSize <= 0 {
+		_, err := cn.Write(buf)
+		return err
+	}
+	for len(buf) > 0 {
+		n := cn.chunkSize
+		if n > len(buf) {
+			n = len(buf)
+		}
+		if _, err := cn.Write(buf[:n]); err != nil {
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
 
-	_, err := cn.Write(buf)
-	return err
+// readReply parses the reply of cmd, the connection is closed if ctx is
+// done before the whole reply is read.
+func (cn *conn) readReply(ctx context.Context, cmd Cmder) error {
+	return parseReplyContext(ctx, cmd, cn.rd, func() {
+		cn.netcn.Close()
+	})
 }
 
 func (cn *conn) Read(b []byte) (int, error) {
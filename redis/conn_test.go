@@ -0,0 +1,616 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongzerun/smartproxy/redis/bufio.v1"
+)
+
+func TestParseReplyContextTimeout(t *testing.T) {
+	// Nothing is ever written, so reads block until interrupted.
+	pr, pw := io.Pipe()
+	rd := newReader(bufio.NewReader(pr), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	cmd := NewStringCmd("GET", "key")
+	start := time.Now()
+	err := parseReplyContext(ctx, cmd, rd, func() {
+		pw.CloseWithError(errors.New("interrupted"))
+	})
+	if err != ErrReadTimeout {
+		t.Fatalf("got %v, wanted %v", err, ErrReadTimeout)
+	}
+	if cmd.Err() != ErrReadTimeout {
+		t.Fatalf("cmd error: got %v, wanted %v", cmd.Err(), ErrReadTimeout)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("took %s to time out", d)
+	}
+
+	nerr, ok := err.(net.Error)
+	if !ok || !nerr.Timeout() {
+		t.Fatalf("%v must be a net.Error timeout", err)
+	}
+	if !isNetworkError(err) {
+		t.Fatal("timed out connection must not be reused")
+	}
+}
+
+func TestParseReplyContextCanceled(t *testing.T) {
+	pr, pw := io.Pipe()
+	rd := newReader(bufio.NewReader(pr), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	cmd := NewIntCmd("INCR", "key")
+	err := parseReplyContext(ctx, cmd, rd, func() { pw.Close() })
+	if err != ErrReadCanceled {
+		t.Fatalf("got %v, wanted %v", err, ErrReadCanceled)
+	}
+}
+
+func TestParseReplyContextDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	cmd := NewIntCmd("INCR", "key")
+	err := parseReplyContext(ctx, cmd, newTestReader(":42\r\n"), func() {
+		t.Error("interrupt must not be called")
+	})
+	if err != nil || cmd.Val() != 42 {
+		t.Fatalf("got %d, %v", cmd.Val(), err)
+	}
+}
+
+// testPool hands out a single connection and drops it on Remove.
+type testPool struct {
+	cn      *conn
+	removed bool
+}
+
+func (p *testPool) First() *conn          { return p.cn }
+func (p *testPool) Get() (*conn, error)   { return p.cn, nil }
+func (p *testPool) Put(cn *conn) error    { return nil }
+func (p *testPool) Remove(cn *conn) error { p.removed = true; return cn.Close() }
+func (p *testPool) Len() int              { return 1 }
+func (p *testPool) FreeLen() int          { return 0 }
+func (p *testPool) Close() error          { return p.cn.Close() }
+
+func newPipeClient(opt *Options) (*Client, net.Conn, *testPool) {
+	client, server := net.Pipe()
+	cn := &conn{netcn: client}
+	cn.rd = newReader(bufio.NewReader(cn), nil)
+	p := &testPool{cn: cn}
+	return newClient(opt, p), server, p
+}
+
+func assertTimeout(t *testing.T, err error, start time.Time, window time.Duration) {
+	nerr, ok := err.(net.Error)
+	if !ok || !nerr.Timeout() {
+		t.Fatalf("got %v, wanted a timeout", err)
+	}
+	if d := time.Since(start); d > window {
+		t.Fatalf("timed out after %s, wanted within %s", d, window)
+	}
+}
+
+func TestCommandReadTimeout(t *testing.T) {
+	client, server, p := newPipeClient(&Options{})
+	defer server.Close()
+	// The server reads the request but never replies.
+	go io.Copy(ioutil.Discard, server)
+
+	cmd := NewStringCmd("GET", "key")
+	cmd.setReadTimeout(50 * time.Millisecond)
+	start := time.Now()
+	client.Process(cmd)
+
+	assertTimeout(t, cmd.Err(), start, time.Second)
+	if !p.removed {
+		t.Error("timed out connection must be removed from the pool")
+	}
+}
+
+func TestCommandWriteTimeout(t *testing.T) {
+	client, server, _ := newPipeClient(&Options{})
+	defer server.Close()
+
+	// Nobody reads the server side, so the write blocks.
+	cmd := NewStatusCmd("SET", "key", "value")
+	cmd.setWriteTimeout(50 * time.Millisecond)
+	start := time.Now()
+	client.Process(cmd)
+
+	assertTimeout(t, cmd.Err(), start, time.Second)
+}
+
+func TestApplyTimeouts(t *testing.T) {
+	cn := &conn{}
+	opt := &Options{ReadTimeout: time.Second, WriteTimeout: 2 * time.Second}
+
+	cn.applyTimeouts(opt, NewStringCmd("GET", "key"))
+	if cn.ReadTimeout != time.Second || cn.WriteTimeout != 2*time.Second {
+		t.Errorf("got %s/%s, wanted client defaults", cn.ReadTimeout, cn.WriteTimeout)
+	}
+
+	short, long := NewStringCmd("GET", "a"), NewStringCmd("GET", "b")
+	short.setReadTimeout(3 * time.Second)
+	long.setReadTimeout(10 * time.Second)
+	cn.applyTimeouts(opt, short, long, NewStringCmd("GET", "c"))
+	if cn.ReadTimeout != 10*time.Second {
+		t.Errorf("got %s, wanted the largest declared timeout", cn.ReadTimeout)
+	}
+}
+
+// throttledConn accepts writes slowly and records every write and the
+// write deadline it was done under.
+type throttledConn struct {
+	net.Conn
+
+	delay     time.Duration
+	deadline  time.Time
+	writes    []int
+	deadlines []time.Time
+}
+
+func (c *throttledConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	time.Sleep(c.delay)
+	if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+		return 0, ErrReadTimeout
+	}
+	c.writes = append(c.writes, len(b))
+	c.deadlines = append(c.deadlines, c.deadline)
+	return len(b), nil
+}
+
+func TestChunkedWrites(t *testing.T) {
+	value := strings.Repeat("v", 10000)
+	netcn := &throttledConn{delay: 10 * time.Millisecond}
+	cn := &conn{netcn: netcn, chunkSize: 4096, WriteTimeout: 30 * time.Millisecond}
+
+	// The whole request takes longer than the write timeout, but
+	// every chunk is written in time.
+	if err := cn.writeCmds(NewStatusCmd("SET", "key", value)); err != nil {
+		t.Fatalf("writeCmds: %s", err)
+	}
+
+	total := len(AppendCommand(nil, []string{"SET", "key", value}))
+	sum := 0
+	for _, n := range netcn.writes {
+		if n > 4096 {
+			t.Errorf("chunk of %d bytes is larger than the chunk size", n)
+		}
+		sum += n
+	}
+	if sum != total || len(netcn.writes) != 3 {
+		t.Errorf("got chunks %v, wanted %d bytes in 3 chunks", netcn.writes, total)
+	}
+	for i := 1; i < len(netcn.deadlines); i++ {
+		if !netcn.deadlines[i].After(netcn.deadlines[i-1]) {
+			t.Errorf("chunk %d reused the deadline of the previous chunk", i)
+		}
+	}
+
+	// A chunk slower than the timeout fails the write.
+	netcn = &throttledConn{delay: 40 * time.Millisecond}
+	cn = &conn{netcn: netcn, chunkSize: 4096, WriteTimeout: 30 * time.Millisecond}
+	if err := cn.writeCmds(NewStatusCmd("SET", "key", value)); err == nil {
+		t.Fatal("slow chunk must trip the write timeout")
+	}
+	if len(netcn.writes) != 0 {
+		t.Errorf("got %d writes, wanted the first chunk to fail", len(netcn.writes))
+	}
+}
+
+func TestAuthSelectCmds(t *testing.T) {
+	auth := NewAuthCmd("secret")
+	if args := auth.args(); len(args) != 2 || args[0] != "AUTH" || args[1] != "secret" {
+		t.Errorf("got %q", args)
+	}
+	sel := NewSelectCmd(3)
+	if args := sel.args(); len(args) != 2 || args[0] != "SELECT" || args[1] != "3" {
+		t.Errorf("got %q", args)
+	}
+	if auth.clusterKey() != "" || sel.clusterKey() != "" {
+		t.Errorf("AUTH and SELECT must be keyless, got %q %q", auth.clusterKey(), sel.clusterKey())
+	}
+}
+
+func TestConnReselectsDB(t *testing.T) {
+	client, server, p := newPipeClient(&Options{DB: 3})
+	defer server.Close()
+
+	selectReq := AppendCommand(nil, []string{"SELECT", "3"})
+	getReq := AppendCommand(nil, []string{"GET", "key"})
+	go func() {
+		// A fresh connection is on db 0, SELECT is sent first.
+		buf := make([]byte, len(selectReq)+len(getReq))
+		io.ReadFull(server, buf[:len(selectReq)])
+		io.WriteString(server, "+OK\r\n")
+		io.ReadFull(server, buf[len(selectReq):])
+		io.WriteString(server, "$1\r\nv\r\n")
+		if string(buf) != string(selectReq)+string(getReq) {
+			t.Errorf("got %q", buf)
+		}
+	}()
+
+	get := NewStringCmd("GET", "key")
+	client.Process(get)
+	if v, err := get.Result(); err != nil || v != "v" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if p.cn.db != 3 {
+		t.Errorf("got db %d, wanted 3", p.cn.db)
+	}
+
+	p.cn.trackState(&Options{}, NewSelectCmd(5))
+	if p.cn.db != 5 {
+		t.Errorf("got db %d, wanted 5", p.cn.db)
+	}
+}
+
+func TestResetCmd(t *testing.T) {
+	client, server, p := newPipeClient(&Options{Password: "secret"})
+	defer server.Close()
+
+	// RESET drops the authentication, AUTH is sent again.
+	reqs := [][]byte{
+		AppendCommand(nil, []string{"RESET"}),
+		AppendCommand(nil, []string{"AUTH", "secret"}),
+	}
+	replies := []string{"+RESET\r\n", "+OK\r\n"}
+	go func() {
+		for i, req := range reqs {
+			buf := make([]byte, len(req))
+			io.ReadFull(server, buf)
+			if string(buf) != string(req) {
+				t.Errorf("got %q, wanted %q", buf, req)
+			}
+			io.WriteString(server, replies[i])
+		}
+	}()
+
+	reset := NewResetCmd()
+	if reset.clusterKey() != "" {
+		t.Errorf("RESET must be keyless, got %q", reset.clusterKey())
+	}
+	client.Process(reset)
+	if v, err := reset.Result(); err != nil || v != "RESET" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if string(reset.Reply()) != "+RESET\r\n" {
+		t.Errorf("Reply: got %q", reset.Reply())
+	}
+
+	p.cn.db, p.cn.proto = 4, 3
+	p.cn.trackState(&Options{}, reset)
+	if p.cn.db != 0 || p.cn.proto != 2 {
+		t.Errorf("got db %d proto %d after RESET, wanted 0 and 2", p.cn.db, p.cn.proto)
+	}
+}
+
+func TestIsHealthy(t *testing.T) {
+	client, server, _ := newPipeClient(&Options{})
+	go func() {
+		buf := make([]byte, 64)
+		server.Read(buf)
+		server.Write([]byte("+PONG\r\n"))
+	}()
+	if !IsHealthy(client) {
+		t.Error("got unhealthy, wanted healthy")
+	}
+	server.Close()
+
+	defer func(d time.Duration) { HealthCheckTimeout = d }(HealthCheckTimeout)
+	HealthCheckTimeout = 50 * time.Millisecond
+	client, server, _ = newPipeClient(&Options{})
+	defer server.Close()
+	// The server reads the PING but never replies.
+	go io.Copy(ioutil.Discard, server)
+	start := time.Now()
+	if IsHealthy(client) {
+		t.Error("got healthy, wanted unhealthy")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("health check took %s", d)
+	}
+}
+
+func TestCmdDBDoesNotLeak(t *testing.T) {
+	client, server, p := newPipeClient(&Options{})
+	defer server.Close()
+
+	reqs := [][]byte{
+		AppendCommand(nil, []string{"SELECT", "3"}),
+		AppendCommand(nil, []string{"GET", "a"}),
+		AppendCommand(nil, []string{"SELECT", "0"}),
+		AppendCommand(nil, []string{"GET", "b"}),
+	}
+	replies := []string{"+OK\r\n", "$2\r\nv3\r\n", "+OK\r\n", "$2\r\nv0\r\n"}
+	go func() {
+		for i, req := range reqs {
+			buf := make([]byte, len(req))
+			io.ReadFull(server, buf)
+			if string(buf) != string(req) {
+				t.Errorf("request %d: got %q, wanted %q", i, buf, req)
+			}
+			io.WriteString(server, replies[i])
+		}
+	}()
+
+	// Both commands share the pooled connection, the one asking for db 3
+	// must not leave it selected for the other.
+	a := NewStringCmd("GET", "a")
+	a.SetDB(3)
+	client.Process(a)
+	if v, err := a.Result(); err != nil || v != "v3" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if p.cn.db != 3 {
+		t.Errorf("got db %d, wanted 3", p.cn.db)
+	}
+
+	b := NewStringCmd("GET", "b")
+	if _, ok := b.DB(); ok {
+		t.Error("db must be unset by default")
+	}
+	client.Process(b)
+	if v, err := b.Result(); err != nil || v != "v0" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if p.cn.db != 0 {
+		t.Errorf("got db %d, wanted 0", p.cn.db)
+	}
+}
+
+func TestConnHello(t *testing.T) {
+	dial := func(reply string) (*conn, string, error) {
+		client, server := net.Pipe()
+		defer server.Close()
+		opt := &Options{
+			Dialer:   func() (net.Conn, error) { return client, nil },
+			Password: "pw",
+			Protocol: 3,
+		}
+		hello := AppendCommand(nil, []string{"HELLO", "3", "AUTH", "default", "pw"})
+		auth := AppendCommand(nil, []string{"AUTH", "pw"})
+		sent := make(chan string, 1)
+		go func() {
+			buf := make([]byte, len(hello))
+			io.ReadFull(server, buf)
+			io.WriteString(server, reply)
+			if reply[0] == '-' {
+				// The server doesn't know HELLO, AUTH follows.
+				more := make([]byte, len(auth))
+				io.ReadFull(server, more)
+				buf = append(buf, more...)
+				io.WriteString(server, "+OK\r\n")
+			}
+			sent <- string(buf)
+		}()
+		cn, err := newConnDialer(opt)()
+		return cn, <-sent, err
+	}
+
+	cn, sent, err := dial(hello3Reply)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	if cn.proto != 3 {
+		t.Errorf("got proto %d, wanted 3", cn.proto)
+	}
+	if want := string(AppendCommand(nil, []string{"HELLO", "3", "AUTH", "default", "pw"})); sent != want {
+		t.Errorf("got %q, wanted %q", sent, want)
+	}
+
+	cn, sent, err = dial("-ERR unknown command 'HELLO'\r\n")
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	if cn.proto != 2 {
+		t.Errorf("got proto %d, wanted 2", cn.proto)
+	}
+	if !strings.HasSuffix(sent, string(AppendCommand(nil, []string{"AUTH", "pw"}))) {
+		t.Errorf("got %q, wanted AUTH after HELLO", sent)
+	}
+}
+
+func TestPoolKeepAlive(t *testing.T) {
+	var servers []net.Conn
+	p := newConnPool(&Options{
+		KeepAliveInterval: time.Hour,
+		Dialer: func() (net.Conn, error) {
+			client, server := net.Pipe()
+			servers = append(servers, server)
+			return client, nil
+		},
+	})
+	defer p.Close()
+
+	cn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(cn)
+	start := cn.usedAt
+
+	// Not idle for the interval yet, nothing is sent.
+	p.keepAlive(start.Add(30 * time.Minute))
+	if p.FreeLen() != 1 || cn.usedAt != start {
+		t.Fatalf("got %d free connections, used at %s", p.FreeLen(), cn.usedAt)
+	}
+
+	ping := AppendCommand(nil, []string{"PING"})
+	go func() {
+		buf := make([]byte, len(ping))
+		io.ReadFull(servers[0], buf)
+		if string(buf) != string(ping) {
+			t.Errorf("got %q, wanted %q", buf, ping)
+		}
+		io.WriteString(servers[0], "+PONG\r\n")
+	}()
+	now := start.Add(2 * time.Hour)
+	p.keepAlive(now)
+	if p.FreeLen() != 1 || cn.usedAt != now {
+		t.Fatalf("got %d free connections, used at %s", p.FreeLen(), cn.usedAt)
+	}
+
+	// A connection failing the PING is replaced.
+	servers[0].Close()
+	p.keepAlive(now.Add(2 * time.Hour))
+	got, err := p.Get()
+	if err != nil || got == cn {
+		t.Fatalf("got %p, %v, wanted a new connection", got, err)
+	}
+	p.Put(got)
+	if len(servers) != 2 {
+		t.Errorf("dialed %d connections, wanted 2", len(servers))
+	}
+}
+
+// redialPool hands out a new pipe connection once the current one is
+// removed, the server ends are sent to servers.
+type redialPool struct {
+	testPool
+	servers chan net.Conn
+}
+
+func newRedialPool() *redialPool {
+	p := &redialPool{servers: make(chan net.Conn, 10)}
+	p.dial()
+	return p
+}
+
+func (p *redialPool) dial() {
+	client, server := net.Pipe()
+	p.cn = &conn{netcn: client}
+	p.cn.rd = newReader(bufio.NewReader(p.cn), nil)
+	p.servers <- server
+}
+
+func (p *redialPool) Remove(cn *conn) error {
+	cn.Close()
+	p.dial()
+	return nil
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := &RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}
+
+	for _, test := range []struct {
+		cmd      Cmder
+		attempts int
+	}{
+		{NewStringCmd("GET", "k"), 2},
+		{NewStatusCmd("SET", "k", "v"), 1},
+	} {
+		p := newRedialPool()
+		client := newClient(&Options{RetryPolicy: policy}, p)
+		req := make([]byte, len(AppendCommand(nil, test.cmd.args())))
+		attempts := make(chan int)
+		go func() {
+			// The first connection breaks before replying.
+			server := <-p.servers
+			io.ReadFull(server, req)
+			server.Close()
+
+			server = <-p.servers
+			if _, err := io.ReadFull(server, req); err != nil {
+				attempts <- 1
+				return
+			}
+			io.WriteString(server, "$2\r\nOK\r\n")
+			attempts <- 2
+		}()
+
+		client.Process(test.cmd)
+		// Unblocks the server of a command not retried.
+		p.cn.Close()
+		if n := <-attempts; n != test.attempts {
+			t.Errorf("%q: got %d attempts, wanted %d", test.cmd.args(), n, test.attempts)
+		}
+		if test.cmd.IsReadOnly() && test.cmd.Err() != nil {
+			t.Errorf("%q: got %v, wanted the retry to succeed", test.cmd.args(), test.cmd.Err())
+		}
+		if !test.cmd.IsReadOnly() && test.cmd.Err() != io.EOF {
+			t.Errorf("%q: got %v, wanted %v", test.cmd.args(), test.cmd.Err(), io.EOF)
+		}
+	}
+
+	policy = &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for retry, want := range []time.Duration{1: 10, 2: 20, 3: 40, 4: 50, 5: 50} {
+		if retry == 0 {
+			continue
+		}
+		if got := policy.backoff(retry); got != want*time.Millisecond {
+			t.Errorf("retry %d: got %s, wanted %s", retry, got, want*time.Millisecond)
+		}
+	}
+}
+
+func TestClientNoEvictNoTouch(t *testing.T) {
+	for _, tt := range []struct {
+		cmd  *StatusCmd
+		args []string
+	}{
+		{NewClientNoEvictCmd("on"), []string{"CLIENT", "NO-EVICT", "ON"}},
+		{NewClientNoTouchCmd("Off"), []string{"CLIENT", "NO-TOUCH", "OFF"}},
+	} {
+		if !reflect.DeepEqual(tt.cmd.args(), tt.args) || tt.cmd.Err() != nil {
+			t.Errorf("got %q, %v, wanted %q", tt.cmd.args(), tt.cmd.Err(), tt.args)
+		}
+		if tt.cmd.clusterKey() != "" || len(tt.cmd.keyIndexes()) != 0 || tt.cmd.IsReadOnly() {
+			t.Errorf("%q must be keyless, got %q", tt.args, tt.cmd.clusterKey())
+		}
+	}
+	for _, cmd := range []*StatusCmd{NewClientNoEvictCmd("yes"), NewClientNoTouchCmd("")} {
+		if cmd.Err() != errSetSyntax {
+			t.Errorf("%q: got %v, wanted %v", cmd.args(), cmd.Err(), errSetSyntax)
+		}
+	}
+
+	// Every new connection of the client is set up with the flags.
+	client, server := net.Pipe()
+	defer server.Close()
+	opt := &Options{
+		Dialer:  func() (net.Conn, error) { return client, nil },
+		DB:      1,
+		NoEvict: true,
+		NoTouch: true,
+	}
+	reqs := [][]string{
+		{"SELECT", "1"},
+		{"CLIENT", "NO-EVICT", "ON"},
+		{"CLIENT", "NO-TOUCH", "ON"},
+	}
+	go func() {
+		for _, req := range reqs {
+			want := AppendCommand(nil, req)
+			buf := make([]byte, len(want))
+			io.ReadFull(server, buf)
+			if string(buf) != string(want) {
+				t.Errorf("got %q, wanted %q", buf, want)
+			}
+			io.WriteString(server, "+OK\r\n")
+		}
+	}()
+	if _, err := newConnDialer(opt)(); err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -18,8 +19,56 @@ var (
 
 	// Redis type assert failed.
 	TypeAssertedErr = errorf("Type Asserted Error")
+
+	// Keys of a command live in different cluster slots.
+	ErrCrossSlot = errorf("CROSSSLOT Keys in request don't hash to the same slot")
+
+	// Commands of a closed ClusterClient fail with it right away, so
+	// clients tell a shutdown from a timeout.
+	ErrProxyClosing = errorf("ERR proxy is shutting down")
+
+	// A command for every master, like INFO, has no master to go to
+	// before the slots are known.
+	ErrNoMasters = errorf("CLUSTERDOWN no master known")
+)
+
+// ErrUnexpectedReplyType is set on a command whose reply has another
+// type than the command expects, e.g. an integer instead of a bulk
+// string.
+var ErrUnexpectedReplyType = errors.New("ERR unexpected reply type")
+
+func unexpectedReplyType(cmd Cmder, v interface{}) error {
+	return fmt.Errorf("%w: got %T for %s", ErrUnexpectedReplyType, v, cmd.Name())
+}
+
+var (
+	// ErrReadTimeout is set on a command whose reply did not arrive
+	// before its read deadline.
+	ErrReadTimeout error = interruptError{s: "redis: read timeout", timeout: true}
+	// ErrReadCanceled is set on a command whose reply read was
+	// canceled.
+	ErrReadCanceled error = interruptError{s: "redis: read canceled"}
 )
 
+// interruptError is a net.Error so the connection it happened on is
+// dropped from the pool instead of being reused with a pending reply.
+type interruptError struct {
+	s       string
+	timeout bool
+}
+
+func (err interruptError) Error() string {
+	return err.s
+}
+
+func (err interruptError) Timeout() bool {
+	return err.timeout
+}
+
+func (err interruptError) Temporary() bool {
+	return false
+}
+
 type redisError struct {
 	s string
 }
@@ -33,7 +82,7 @@ func (err redisError) Error() string {
 }
 
 func isNetworkError(err error) bool {
-	if _, ok := err.(net.Error); ok || err == io.EOF {
+	if _, ok := err.(net.Error); ok || err == io.EOF || err == ErrTruncatedReply {
 		return true
 	}
 	return false
@@ -61,9 +110,10 @@ func isMovedError(err error) (moved bool, ask bool, addr string) {
 	return
 }
 
-// shouldRetry reports whether failed command should be retried.
+// shouldRetry reports whether failed command should be retried. A
+// truncated reply means the command ran, it is not sent again.
 func shouldRetry(err error) bool {
-	if err == nil {
+	if err == nil || err == ErrTruncatedReply {
 		return false
 	}
 	return isNetworkError(err)
@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrTooManyInFlight is set on a command which waited longer than
+// Options.InFlightTimeout for the commands in flight to a node to drop
+// below Options.MaxInFlight.
+var ErrTooManyInFlight = errorf("ERR too many commands in flight to redis")
+
+// inflightLimiter caps the commands sent to a node and not replied yet.
+// Commands over the cap wait, which blocks the client sending them, so
+// a slow node pushes back on its clients instead of queueing without
+// bound. A nil limiter doesn't limit.
+type inflightLimiter struct {
+	max     int
+	timeout time.Duration
+
+	mx sync.Mutex
+	n  int
+	// Closed and replaced whenever commands are released.
+	released chan struct{}
+}
+
+func newInflightLimiter(max int, timeout time.Duration) *inflightLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &inflightLimiter{
+		max:      max,
+		timeout:  timeout,
+		released: make(chan struct{}),
+	}
+}
+
+// weight returns the share of the cap taken by n commands sent at once,
+// a pipeline larger than the cap takes all of it and is sent alone.
+func (l *inflightLimiter) weight(n int) int {
+	if n > l.max {
+		return l.max
+	}
+	return n
+}
+
+// acquire waits until n more commands can be sent, or fails with
+// ErrTooManyInFlight after the timeout. Every successful acquire must
+// be followed by a release of the same n.
+func (l *inflightLimiter) acquire(n int) error {
+	if l == nil {
+		return nil
+	}
+	n = l.weight(n)
+
+	var timer *time.Timer
+	for {
+		l.mx.Lock()
+		if l.n+n <= l.max {
+			l.n += n
+			l.mx.Unlock()
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		}
+		released := l.released
+		l.mx.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(l.timeout)
+		}
+		select {
+		case <-released:
+		case <-timer.C:
+			return ErrTooManyInFlight
+		}
+	}
+}
+
+// release marks n commands acquired together as replied.
+func (l *inflightLimiter) release(n int) {
+	if l == nil {
+		return
+	}
+	l.mx.Lock()
+	l.n -= l.weight(n)
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mx.Unlock()
+}
+
+// inflight returns the number of commands in flight.
+func (l *inflightLimiter) inflight() int {
+	if l == nil {
+		return 0
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.n
+}
@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInflightLimiterCap(t *testing.T) {
+	const max = 4
+	l := newInflightLimiter(max, time.Second)
+
+	var depth, peak int64
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := l.acquire(n); err != nil {
+					t.Error(err)
+					return
+				}
+				d := atomic.AddInt64(&depth, int64(l.weight(n)))
+				for {
+					p := atomic.LoadInt64(&peak)
+					if d <= p || atomic.CompareAndSwapInt64(&peak, p, d) {
+						break
+					}
+				}
+				atomic.AddInt64(&depth, -int64(l.weight(n)))
+				l.release(n)
+			}
+		}(i%6 + 1)
+	}
+	wg.Wait()
+
+	if peak > max || peak == 0 {
+		t.Errorf("got a peak of %d in flight, wanted at most %d", peak, max)
+	}
+	if n := l.inflight(); n != 0 {
+		t.Errorf("got %d in flight after all released", n)
+	}
+}
+
+func TestInflightLimiterTimeout(t *testing.T) {
+	l := newInflightLimiter(2, 20*time.Millisecond)
+	if err := l.acquire(2); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := l.acquire(1); err != ErrTooManyInFlight {
+		t.Fatalf("got %v, wanted %v", err, ErrTooManyInFlight)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond || d > time.Second {
+		t.Errorf("gave up after %s, wanted 20ms", d)
+	}
+
+	// A waiter gets in as soon as enough is released.
+	done := make(chan error, 1)
+	l.timeout = time.Second
+	go func() { done <- l.acquire(1) }()
+	l.release(1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := l.inflight(); n != 2 {
+		t.Errorf("got %d in flight, wanted 2", n)
+	}
+
+	var none *inflightLimiter
+	if err := none.acquire(1000); err != nil {
+		t.Errorf("nil limiter must not limit, got %v", err)
+	}
+	none.release(1000)
+}
+
+func TestClientMaxInFlight(t *testing.T) {
+	client, server, _ := newPipeClient(&Options{
+		MaxInFlight:     1,
+		InFlightTimeout: 20 * time.Millisecond,
+	})
+	defer server.Close()
+	// The server reads the requests but never replies.
+	go io.Copy(ioutil.Discard, server)
+
+	blocked := NewStringCmd("GET", "a")
+	blocked.setReadTimeout(time.Second)
+	go client.Process(blocked)
+	for client.inflight.inflight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cmd := NewStringCmd("GET", "b")
+	client.Process(cmd)
+	if cmd.Err() != ErrTooManyInFlight {
+		t.Errorf("got %v, wanted %v", cmd.Err(), ErrTooManyInFlight)
+	}
+
+	pipe := client.Pipeline()
+	pipe.Process(NewStringCmd("GET", "c"))
+	if _, err := pipe.Exec(); err != ErrTooManyInFlight {
+		t.Errorf("pipeline: got %v, wanted %v", err, ErrTooManyInFlight)
+	}
+}
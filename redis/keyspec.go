@@ -0,0 +1,224 @@
+package redis
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dongzerun/smartproxy/util"
+)
+
+// CommandInfo describes a command like COMMAND INFO does. Arity is
+// negative for variadic commands, the keys are the arguments from
+// FirstKey to LastKey every StepCount ones. A negative LastKey counts
+// from the end, -1 is the last argument.
+type CommandInfo struct {
+	Name      string
+	Arity     int
+	Flags     []string
+	FirstKey  int
+	LastKey   int
+	StepCount int
+}
+
+func newCommandInfos(infos ...CommandInfo) map[string]*CommandInfo {
+	m := make(map[string]*CommandInfo, len(infos))
+	for i := range infos {
+		m[infos[i].Name] = &infos[i]
+	}
+	return m
+}
+
+var commandInfos = newCommandInfos(
+	// connection and server
+	CommandInfo{"PING", -1, []string{"stale", "fast"}, 0, 0, 0},
+	CommandInfo{"ECHO", 2, []string{"fast"}, 0, 0, 0},
+	CommandInfo{"COMMAND", -1, []string{"random", "loading", "stale"}, 0, 0, 0},
+	CommandInfo{"INFO", -1, []string{"random", "loading", "stale"}, 0, 0, 0},
+	CommandInfo{"KEYS", 2, []string{"readonly", "sort_for_script"}, 0, 0, 0},
+	CommandInfo{"SCAN", -2, []string{"readonly", "random"}, 0, 0, 0},
+	CommandInfo{"RANDOMKEY", 1, []string{"readonly", "random"}, 0, 0, 0},
+	// key
+	CommandInfo{"DEL", -2, []string{"write"}, 1, -1, 1},
+	CommandInfo{"UNLINK", -2, []string{"write", "fast"}, 1, -1, 1},
+	CommandInfo{"EXISTS", -2, []string{"readonly", "fast"}, 1, -1, 1},
+	CommandInfo{"TOUCH", -2, []string{"readonly", "fast"}, 1, -1, 1},
+	CommandInfo{"EXPIRE", -3, []string{"write", "fast"}, 1, 1, 1},
+	CommandInfo{"TTL", 2, []string{"readonly", "random", "fast"}, 1, 1, 1},
+	CommandInfo{"TYPE", 2, []string{"readonly", "fast"}, 1, 1, 1},
+	CommandInfo{"RENAME", 3, []string{"write"}, 1, 2, 1},
+	CommandInfo{"RENAMENX", 3, []string{"write", "fast"}, 1, 2, 1},
+	CommandInfo{"COPY", -3, []string{"write", "denyoom"}, 1, 2, 1},
+	CommandInfo{"OBJECT", -2, []string{"readonly", "random"}, 2, 2, 1},
+	CommandInfo{"MEMORY", -2, []string{"readonly", "random"}, 2, 2, 1},
+	CommandInfo{"DUMP", 2, []string{"readonly", "random"}, 1, 1, 1},
+	CommandInfo{"RESTORE", -4, []string{"write", "denyoom"}, 1, 1, 1},
+	CommandInfo{"WATCH", -2, []string{"noscript", "fast"}, 1, -1, 1},
+	CommandInfo{"BITOP", -4, []string{"write", "denyoom"}, 2, -1, 1},
+	CommandInfo{"PFADD", -2, []string{"write", "denyoom", "fast"}, 1, 1, 1},
+	CommandInfo{"PFCOUNT", -2, []string{"readonly"}, 1, -1, 1},
+	CommandInfo{"PFMERGE", -2, []string{"write", "denyoom"}, 1, -1, 1},
+	CommandInfo{"GETRANGE", 4, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"SETRANGE", 4, []string{"write", "denyoom"}, 1, 1, 1},
+	CommandInfo{"BITCOUNT", -2, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"BITPOS", -3, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"BITFIELD", -2, []string{"write", "denyoom"}, 1, 1, 1},
+	CommandInfo{"BITFIELD_RO", -2, []string{"readonly", "fast"}, 1, 1, 1},
+	CommandInfo{"GEOADD", -5, []string{"write", "denyoom"}, 1, 1, 1},
+	CommandInfo{"GEORADIUS", -6, []string{"write", "movablekeys"}, 1, 1, 1},
+	// string
+	CommandInfo{"GET", 2, []string{"readonly", "fast"}, 1, 1, 1},
+	CommandInfo{"SET", -3, []string{"write", "denyoom"}, 1, 1, 1},
+	CommandInfo{"INCR", 2, []string{"write", "denyoom", "fast"}, 1, 1, 1},
+	CommandInfo{"MGET", -2, []string{"readonly", "fast"}, 1, -1, 1},
+	CommandInfo{"MSET", -3, []string{"write", "denyoom"}, 1, -1, 2},
+	CommandInfo{"MSETNX", -3, []string{"write", "denyoom"}, 1, -1, 2},
+	CommandInfo{"LCS", -3, []string{"readonly"}, 1, 2, 1},
+	// hash
+	CommandInfo{"HGET", 3, []string{"readonly", "fast"}, 1, 1, 1},
+	CommandInfo{"HSET", -4, []string{"write", "denyoom", "fast"}, 1, 1, 1},
+	CommandInfo{"HGETALL", 2, []string{"readonly", "random"}, 1, 1, 1},
+	CommandInfo{"HEXPIRE", -6, []string{"write", "fast"}, 1, 1, 1},
+	CommandInfo{"HPEXPIRE", -6, []string{"write", "fast"}, 1, 1, 1},
+	CommandInfo{"HEXPIREAT", -6, []string{"write", "fast"}, 1, 1, 1},
+	CommandInfo{"HPEXPIREAT", -6, []string{"write", "fast"}, 1, 1, 1},
+	CommandInfo{"HTTL", -5, []string{"readonly", "fast"}, 1, 1, 1},
+	CommandInfo{"HPTTL", -5, []string{"readonly", "fast"}, 1, 1, 1},
+	CommandInfo{"HPERSIST", -5, []string{"write", "fast"}, 1, 1, 1},
+	CommandInfo{"HSCAN", -3, []string{"readonly", "random"}, 1, 1, 1},
+	// list
+	CommandInfo{"LPUSH", -3, []string{"write", "denyoom", "fast"}, 1, 1, 1},
+	CommandInfo{"RPUSH", -3, []string{"write", "denyoom", "fast"}, 1, 1, 1},
+	CommandInfo{"LRANGE", 4, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"RPOPLPUSH", 3, []string{"write", "denyoom"}, 1, 2, 1},
+	CommandInfo{"BLPOP", -3, []string{"write", "noscript"}, 1, -2, 1},
+	CommandInfo{"BRPOP", -3, []string{"write", "noscript"}, 1, -2, 1},
+	CommandInfo{"BRPOPLPUSH", 4, []string{"write", "denyoom", "noscript"}, 1, 2, 1},
+	CommandInfo{"BLMOVE", 6, []string{"write", "denyoom", "noscript"}, 1, 2, 1},
+	// set
+	CommandInfo{"SADD", -3, []string{"write", "denyoom", "fast"}, 1, 1, 1},
+	CommandInfo{"SMOVE", 4, []string{"write", "fast"}, 1, 2, 1},
+	CommandInfo{"SSCAN", -3, []string{"readonly", "random"}, 1, 1, 1},
+	CommandInfo{"SDIFF", -2, []string{"readonly", "sort_for_script"}, 1, -1, 1},
+	CommandInfo{"SDIFFSTORE", -3, []string{"write", "denyoom"}, 1, -1, 1},
+	CommandInfo{"SINTER", -2, []string{"readonly", "sort_for_script"}, 1, -1, 1},
+	CommandInfo{"SINTERSTORE", -3, []string{"write", "denyoom"}, 1, -1, 1},
+	CommandInfo{"SUNION", -2, []string{"readonly", "sort_for_script"}, 1, -1, 1},
+	CommandInfo{"SUNIONSTORE", -3, []string{"write", "denyoom"}, 1, -1, 1},
+	// zset
+	CommandInfo{"ZADD", -4, []string{"write", "denyoom", "fast"}, 1, 1, 1},
+	CommandInfo{"ZRANGE", -4, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"ZRANGEBYSCORE", -4, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"ZREVRANGEBYSCORE", -4, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"ZRANGEBYLEX", -4, []string{"readonly"}, 1, 1, 1},
+	CommandInfo{"ZSCORE", 3, []string{"readonly", "fast"}, 1, 1, 1},
+	CommandInfo{"ZSCAN", -3, []string{"readonly", "random"}, 1, 1, 1},
+	// stream
+	CommandInfo{"XINFO", -2, []string{"readonly", "random"}, 2, 2, 1},
+	// finite zset
+	CommandInfo{"XADD", -4, []string{"write", "denyoom"}, 1, 1, 1},
+	CommandInfo{"XRANGE", -4, []string{"readonly"}, 1, 1, 1},
+)
+
+// lookupKeySpec returns the info of the command name, false for commands
+// not in commandInfos.
+func lookupKeySpec(args []string, name string) (*CommandInfo, bool) {
+	info, ok := commandInfos[name]
+	return info, ok
+}
+
+// IsKnownCommand reports whether name, upper cased, is in the command
+// table answering COMMAND.
+func IsKnownCommand(name string) bool {
+	_, ok := commandInfos[name]
+	return ok
+}
+
+// hasFlag reports whether info has flag, e.g. "readonly".
+func (info *CommandInfo) hasFlag(flag string) bool {
+	for _, f := range info.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// keyIndexes returns the indexes of the keys in args described by info.
+func (info *CommandInfo) keyIndexes(args []string) []int {
+	if info.FirstKey == 0 || info.FirstKey >= len(args) {
+		return nil
+	}
+	last := info.LastKey
+	if last < 0 {
+		last += len(args)
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+	var indexes []int
+	for i := info.FirstKey; i <= last; i += info.StepCount {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+//------------------------------------------------------------------------------
+
+// CommandReply answers COMMAND, COMMAND COUNT, COMMAND INFO and COMMAND
+// DOCS from commandInfos, args are the arguments after COMMAND.
+func CommandReply(args []string) ([]byte, error) {
+	if len(args) == 0 {
+		names := make([]string, 0, len(commandInfos))
+		for name := range commandInfos {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return FormatCommandInfos(names), nil
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "COUNT":
+		return FormatInt(int64(len(commandInfos))), nil
+	case "INFO":
+		names := make([]string, len(args)-1)
+		for i, name := range args[1:] {
+			names[i] = strings.ToUpper(name)
+		}
+		return FormatCommandInfos(names), nil
+	case "DOCS":
+		// Docs are optional, clients get along without them.
+		return []byte("*0\r\n"), nil
+	}
+	return nil, fmt.Errorf("ERR Unknown subcommand '%s'", args[0])
+}
+
+// FormatCommandInfos formats the infos of names as COMMAND INFO replies
+// them, unknown commands are replied as nil.
+func FormatCommandInfos(names []string) []byte {
+	b := bytes.Buffer{}
+	b.WriteByte('*')
+	b.WriteString(util.Itoa(len(names)))
+	b.WriteString("\r\n")
+	for _, name := range names {
+		info, ok := commandInfos[name]
+		if !ok {
+			b.WriteString("$-1\r\n")
+			continue
+		}
+		b.WriteString("*6\r\n")
+		writeBulk(&b, strings.ToLower(info.Name))
+		b.Write(FormatInt(int64(info.Arity)))
+		b.WriteByte('*')
+		b.WriteString(util.Itoa(len(info.Flags)))
+		b.WriteString("\r\n")
+		for _, flag := range info.Flags {
+			b.Write(FormatStatus(flag))
+		}
+		b.Write(FormatInt(int64(info.FirstKey)))
+		b.Write(FormatInt(int64(info.LastKey)))
+		b.Write(FormatInt(int64(info.StepCount)))
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeySpecs(t *testing.T) {
+	tests := []struct {
+		args []string
+		key  string
+		keys []string
+	}{
+		{[]string{"OBJECT", "ENCODING", "k"}, "k", []string{"k"}},
+		{[]string{"MEMORY", "USAGE", "k", "SAMPLES", "5"}, "k", []string{"k"}},
+		{[]string{"GEORADIUS", "k", "15", "37", "200", "km"}, "k", []string{"k"}},
+		{[]string{"ZADD", "k", "NX", "CH", "1", "m"}, "k", []string{"k"}},
+		{[]string{"getrange", "k", "0", "3"}, "k", []string{"k"}},
+		{[]string{"MSET", "a", "1", "b", "2"}, "a", []string{"a", "b"}},
+		{[]string{"BLPOP", "a", "b", "0"}, "a", []string{"a", "b"}},
+		{[]string{"BITOP", "AND", "dest", "a", "b"}, "dest", []string{"dest", "a", "b"}},
+		{[]string{"RENAME", "a", "b"}, "a", []string{"a", "b"}},
+		{[]string{"OBJECT", "HELP"}, "", nil},
+	}
+	for _, test := range tests {
+		cmd := NewCmd(test.args...)
+		if cmd.clusterKey() != test.key {
+			t.Errorf("%q: got key %q, wanted %q", test.args, cmd.clusterKey(), test.key)
+		}
+		if !reflect.DeepEqual(cmd.clusterKeys(), test.keys) {
+			t.Errorf("%q: got keys %q, wanted %q", test.args, cmd.clusterKeys(), test.keys)
+		}
+	}
+
+	// Commands not in commandInfos keep their constructor position.
+	echo := NewStringCmd("ECHO", "hello")
+	echo._clusterKeyPos = 0
+	if echo.clusterKey() != "" {
+		t.Errorf("got key %q for ECHO", echo.clusterKey())
+	}
+	if cmd := NewStringCmd("HGET", "h", "f"); cmd.clusterKey() != "h" {
+		t.Errorf("got key %q, wanted h", cmd.clusterKey())
+	}
+}
+
+func TestCommandReply(t *testing.T) {
+	b, err := CommandReply([]string{"count"})
+	if want := FormatInt(int64(len(commandInfos))); err != nil || string(b) != string(want) {
+		t.Errorf("COUNT: got %q, %v, wanted %q", b, err, want)
+	}
+
+	b, err = CommandReply([]string{"INFO", "mset", "nosuch"})
+	if err != nil {
+		t.Fatalf("INFO: %s", err)
+	}
+	v, err := parseReply(newTestReader(string(b)), parseSlice)
+	if err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	want := []interface{}{
+		[]interface{}{
+			"mset", int64(-3), []interface{}{"write", "denyoom"},
+			int64(1), int64(-1), int64(2),
+		},
+		nil,
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("INFO: got %v, wanted %v", v, want)
+	}
+
+	b, err = CommandReply(nil)
+	if err != nil {
+		t.Fatalf("COMMAND: %s", err)
+	}
+	v, err = parseReply(newTestReader(string(b)), parseSlice)
+	if err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	infos := v.([]interface{})
+	if len(infos) != len(commandInfos) {
+		t.Fatalf("got %d commands, wanted %d", len(infos), len(commandInfos))
+	}
+	for _, info := range infos {
+		if fields := info.([]interface{}); len(fields) != 6 {
+			t.Errorf("got %d fields, wanted 6: %v", len(fields), fields)
+		}
+	}
+
+	if _, err := CommandReply([]string{"GETKEYS"}); err == nil {
+		t.Error("unknown subcommand must fail")
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		cmd  Cmder
+		read bool
+	}{
+		{NewStringCmd("GET", "k"), true},
+		{NewStringCmd("get", "k"), true},
+		{NewNullableStringSliceCmd("MGET", "a", "b"), true},
+		{NewStringSliceCmd("ZRANGE", "z", "0", "-1"), true},
+		{NewStatusCmd("SET", "k", "v"), false},
+		{NewIntCmd("DEL", "a", "b"), false},
+		{NewCmd("NOSUCHCMD", "k"), false},
+	}
+	for _, test := range tests {
+		if got := test.cmd.IsReadOnly(); got != test.read {
+			t.Errorf("%q: got %v, wanted %v", test.cmd.args(), got, test.read)
+		}
+	}
+}
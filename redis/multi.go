@@ -2,13 +2,16 @@ package redis
 
 import (
 	"errors"
-	"fmt"
 
 	log "github.com/ngaut/logging"
 )
 
 var errDiscard = errors.New("redis: Discard can be used only inside Exec")
 
+// errExecAbort is the error of Redis for the commands of a transaction
+// discarded because one of them is malformed.
+var errExecAbort = errorf("EXECABORT Transaction discarded because of previous errors.")
+
 // Multi implements Redis transactions as described in
 // http://redis.io/topics/transactions.
 type Multi struct {
@@ -23,6 +26,7 @@ func (c *Client) Multi() *Multi {
 		base: &baseClient{
 			opt:      c.opt,
 			connPool: newSingleConnPool(c.connPool, true),
+			inflight: c.inflight,
 		},
 	}
 	multi.commandable.process = multi.process
@@ -74,74 +78,61 @@ func (c *Multi) Exec(f func() error) ([]Cmder, error) {
 	if err := f(); err != nil {
 		return nil, err
 	}
-	c.cmds = append(c.cmds, NewSliceCmd("EXEC"))
 
-	cmds := c.cmds
+	cmds := c.cmds[1:]
 	c.cmds = nil
 
-	if len(cmds) == 2 {
+	if len(cmds) == 0 {
 		return []Cmder{}, nil
 	}
 
-	cn, err := c.base.conn()
-	if err != nil {
-		setCmdsErr(cmds[1:len(cmds)-1], err)
-		return cmds[1 : len(cmds)-1], err
+	// Like Redis, a malformed command discards the whole transaction.
+	if valid, err := validCmds(cmds); err != nil {
+		setCmdsErr(valid, errExecAbort)
+		return cmds, err
 	}
 
-	err = c.execCmds(cn, cmds)
-	c.base.putConn(cn, err)
-	return cmds[1 : len(cmds)-1], err
-}
+	// With MULTI and EXEC.
+	n := len(cmds) + 2
+	if err := c.base.inflight.acquire(n); err != nil {
+		setCmdsErr(cmds, err)
+		return cmds, err
+	}
+	defer c.base.inflight.release(n)
 
-func (c *Multi) execCmds(cn *conn, cmds []Cmder) error {
-	err := cn.writeCmds(cmds...)
+	cn, err := c.base.conn()
 	if err != nil {
-		setCmdsErr(cmds[1:len(cmds)-1], err)
-		return err
+		setCmdsErr(cmds, err)
+		return cmds, err
 	}
 
-	statusCmd := NewStatusCmd()
-
-	// Omit last command (EXEC).
-	cmdsLen := len(cmds) - 1
+	exec := NewExecCmd(cmds...)
+	cn.applyTimeouts(c.base.opt, cmds...)
+	err = execTx(cn, exec)
+	c.base.putConn(cn, err)
+	return cmds, err
+}
 
-	// Parse queued replies.
-	for i := 0; i < cmdsLen; i++ {
-		if err := statusCmd.parseReply(cn.rd); err != nil {
-			setCmdsErr(cmds[1:len(cmds)-1], err)
-			return err
-		}
-	}
+// txCmds wraps the commands queued by exec with MULTI and EXEC.
+func txCmds(exec *ExecCmd) []Cmder {
+	cmds := make([]Cmder, 0, len(exec.cmds)+2)
+	cmds = append(cmds, newKeylessStatusCmd("MULTI"))
+	cmds = append(cmds, exec.cmds...)
+	return append(cmds, exec)
+}
 
-	// Parse number of replies.
-	line, err := readLine(cn.rd)
-	if err != nil {
-		setCmdsErr(cmds[1:len(cmds)-1], err)
+// execTx runs the transaction of exec on cn and returns error of the
+// first failed command.
+func execTx(cn *conn, exec *ExecCmd) error {
+	if err := cn.writeCmds(txCmds(exec)...); err != nil {
+		exec.setErr(err)
+		setCmdsErr(exec.cmds, err)
 		return err
 	}
-	if line[0] != '*' {
-		err := fmt.Errorf("redis: expected '*', but got line %q", line)
-		setCmdsErr(cmds[1:len(cmds)-1], err)
+	if err := exec.parseQueued(cn.rd); err != nil {
+		exec.setErr(err)
+		setCmdsErr(exec.cmds, err)
 		return err
 	}
-	if len(line) == 3 && line[1] == '-' && line[2] == '1' {
-		setCmdsErr(cmds[1:len(cmds)-1], TxFailedErr)
-		return TxFailedErr
-	}
-
-	var firstCmdErr error
-
-	// Parse replies.
-	// Loop starts from 1 to omit MULTI cmd.
-	for i := 1; i < cmdsLen; i++ {
-		cmd := cmds[i]
-		if err := cmd.parseReply(cn.rd); err != nil {
-			if firstCmdErr == nil {
-				firstCmdErr = err
-			}
-		}
-	}
-
-	return firstCmdErr
+	return exec.parseReply(cn.rd)
 }
@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExecTx(t *testing.T) {
+	cn, server := newPipeConn()
+	defer cn.Close()
+
+	set := NewStatusCmd("SET", "a", "1")
+	incr := NewIntCmd("INCR", "a")
+	get := NewStringCmd("GET", "b")
+	exec := NewExecCmd(set, incr, get)
+	reply := "*3\r\n+OK\r\n:2\r\n$-1\r\n"
+	go servePipeline(server, txCmds(exec), "+OK\r\n+QUEUED\r\n+QUEUED\r\n+QUEUED\r\n"+reply)
+
+	if err := execTx(cn, exec); err != Nil {
+		t.Fatalf("got %v, wanted %v of GET", err, Nil)
+	}
+	if set.Val() != "OK" || incr.Val() != 2 || get.Err() != Nil {
+		t.Errorf("got %q %d %v", set.Val(), incr.Val(), get.Err())
+	}
+	if exec.clusterKey() != "a" {
+		t.Errorf("got key %q, wanted a", exec.clusterKey())
+	}
+	if got := string(exec.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+}
+
+func TestExecTxAbort(t *testing.T) {
+	cn, server := newPipeConn()
+	defer cn.Close()
+
+	set := NewStatusCmd("SET", "a", "1")
+	bad := NewIntCmd("INCR")
+	exec := NewExecCmd(set, bad)
+	abort := "EXECABORT Transaction discarded because of previous errors."
+	go servePipeline(server, txCmds(exec),
+		"+OK\r\n+QUEUED\r\n-ERR wrong number of arguments for 'incr' command\r\n-"+abort+"\r\n")
+
+	err := execTx(cn, exec)
+	if err == nil || err.Error() != abort {
+		t.Fatalf("got %v, wanted %s", err, abort)
+	}
+	if set.Err() != err {
+		t.Errorf("queued command: got %v, wanted %v", set.Err(), err)
+	}
+	if bad.Err() == nil || bad.Err().Error() != "ERR wrong number of arguments for 'incr' command" {
+		t.Errorf("refused command must keep its error, got %v", bad.Err())
+	}
+	if got := string(exec.Reply()); got != "-"+abort+"\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestExecTxWatchFailed(t *testing.T) {
+	cn, server := newPipeConn()
+	defer cn.Close()
+
+	exec := NewExecCmd(NewStatusCmd("SET", "a", "1"), NewIntCmd("INCR", "b"))
+	go servePipeline(server, txCmds(exec), "+OK\r\n+QUEUED\r\n+QUEUED\r\n*-1\r\n")
+
+	if err := execTx(cn, exec); err != TxFailedErr {
+		t.Fatalf("got %v, wanted %v", err, TxFailedErr)
+	}
+	for _, cmd := range exec.Val() {
+		if cmd.Err() != TxFailedErr {
+			t.Errorf("%v: got %v, wanted %v", cmd.args(), cmd.Err(), TxFailedErr)
+		}
+	}
+	if got := string(exec.Reply()); got != "*-1\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+}
+
+func TestExecTxGenericCmd(t *testing.T) {
+	cn, server := newPipeConn()
+	defer cn.Close()
+
+	eval := NewCmd("EVAL", "return {1,'a'}", "0")
+	exec := NewExecCmd(eval, NewCmd("GET", "a"))
+	reply := "*2\r\n*2\r\n:1\r\n$1\r\na\r\n$-1\r\n"
+	go servePipeline(server, txCmds(exec), "+OK\r\n+QUEUED\r\n+QUEUED\r\n"+reply)
+
+	execTx(cn, exec)
+	if got := string(exec.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+}
+
+func TestExecCmdEmptyLine(t *testing.T) {
+	exec := NewExecCmd(NewStatusCmd("SET", "a", "1"))
+	if err := exec.parseReply(newTestReader("\r\n")); !errors.Is(err, ErrProtocol) {
+		t.Errorf("got %v, wanted %v", err, ErrProtocol)
+	}
+	exec = NewExecCmd(NewStatusCmd("SET", "a", "1"))
+	if err := exec.parseReply(newTestReader("*x\r\n")); !errors.Is(err, ErrProtocol) {
+		t.Errorf("got %v, wanted %v", err, ErrProtocol)
+	}
+}
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Observer is notified about every command a client processes, e.g. to
+// export latency and error rate metrics. It must be safe for concurrent
+// use.
+type Observer interface {
+	// ObserveCommand is called once the reply of the command named name
+	// is read or the command failed with err. Redis errors and Nil are
+	// passed as well.
+	ObserveCommand(name string, dur time.Duration, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveCommand(string, time.Duration, error) {}
+
+// ReplySizeBuckets are the upper bounds in bytes of the reply size
+// histogram of CmdStat, larger replies go to an extra last bucket.
+var ReplySizeBuckets = []int{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// CmdStat aggregates the commands of a name.
+type CmdStat struct {
+	// Round-trips to Redis, those failed and their total duration, as
+	// observed by the clients.
+	Calls    int64
+	Errors   int64
+	Duration time.Duration
+
+	// Replies written to clients and their total size.
+	Replies    int64
+	ReplyBytes int64
+	// ReplySizes counts the replies by size, ReplySizes[i] those up to
+	// ReplySizeBuckets[i] bytes and the last one the larger ones.
+	ReplySizes []int64
+}
+
+// CmdStats aggregates a CmdStat per command name. It is an Observer for
+// the round-trips, the replies are recorded with ObserveReply.
+type CmdStats struct {
+	mx    sync.Mutex
+	stats map[string]*CmdStat
+}
+
+func NewCmdStats() *CmdStats {
+	return &CmdStats{stats: make(map[string]*CmdStat)}
+}
+
+// stat returns the stat of name, s.mx must be held.
+func (s *CmdStats) stat(name string) *CmdStat {
+	st, ok := s.stats[name]
+	if !ok {
+		st = &CmdStat{ReplySizes: make([]int64, len(ReplySizeBuckets)+1)}
+		s.stats[name] = st
+	}
+	return st
+}
+
+func (s *CmdStats) ObserveCommand(name string, dur time.Duration, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	st := s.stat(name)
+	st.Calls++
+	st.Duration += dur
+	if err != nil && err != Nil {
+		st.Errors++
+	}
+}
+
+// ObserveReply records a reply of size bytes to the command name, e.g.
+// the length of Reply.
+func (s *CmdStats) ObserveReply(name string, size int) {
+	bucket := sort.SearchInts(ReplySizeBuckets, size)
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	st := s.stat(name)
+	st.Replies++
+	st.ReplyBytes += int64(size)
+	st.ReplySizes[bucket]++
+}
+
+// Stats returns a snapshot of the stats by command name.
+func (s *CmdStats) Stats() map[string]CmdStat {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	stats := make(map[string]CmdStat, len(s.stats))
+	for name, st := range s.stats {
+		cp := *st
+		cp.ReplySizes = append([]int64(nil), st.ReplySizes...)
+		stats[name] = cp
+	}
+	return stats
+}
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingObserver counts observed commands and errors by name.
+type countingObserver struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	errors map[string]int
+}
+
+func newCountingObserver() *countingObserver {
+	return &countingObserver{
+		calls:  make(map[string]int),
+		errors: make(map[string]int),
+	}
+}
+
+func (o *countingObserver) ObserveCommand(name string, dur time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.calls[name]++
+	if err != nil {
+		o.errors[name]++
+	}
+}
+
+func TestObserver(t *testing.T) {
+	obs := newCountingObserver()
+	client, server, _ := newPipeClient(&Options{Observer: obs})
+
+	go func() {
+		io.ReadFull(server, make([]byte, len(AppendCommand(nil, []string{"GET", "key"}))))
+		io.WriteString(server, "$1\r\nv\r\n")
+		io.ReadFull(server, make([]byte, len(AppendCommand(nil, []string{"incr", "key"}))))
+		// Garbage reply, parsing fails.
+		io.WriteString(server, ":abc\r\n")
+		server.Close()
+	}()
+
+	client.Process(NewStringCmd("GET", "key"))
+	client.Process(NewIntCmd("incr", "key"))
+
+	if obs.calls["GET"] != 1 || obs.errors["GET"] != 0 {
+		t.Errorf("GET: got %d calls %d errors", obs.calls["GET"], obs.errors["GET"])
+	}
+	if obs.calls["INCR"] != 1 || obs.errors["INCR"] != 1 {
+		t.Errorf("INCR: got %d calls %d errors", obs.calls["INCR"], obs.errors["INCR"])
+	}
+}
+
+func TestCmdStats(t *testing.T) {
+	s := NewCmdStats()
+
+	const goroutines, n = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				s.ObserveCommand("GET", time.Millisecond, nil)
+				s.ObserveReply("GET", 10)
+				s.ObserveCommand("HGETALL", time.Millisecond, io.EOF)
+				s.ObserveReply("HGETALL", 5000)
+				s.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := s.Stats()
+	get := stats["GET"]
+	if get.Calls != goroutines*n || get.Replies != goroutines*n || get.Errors != 0 {
+		t.Errorf("GET: got %+v", get)
+	}
+	if get.ReplyBytes != goroutines*n*10 || get.ReplySizes[0] != goroutines*n {
+		t.Errorf("GET: got %d bytes, sizes %v", get.ReplyBytes, get.ReplySizes)
+	}
+	if get.Duration != goroutines*n*time.Millisecond {
+		t.Errorf("GET: got duration %s", get.Duration)
+	}
+	hgetall := stats["HGETALL"]
+	if hgetall.Errors != goroutines*n {
+		t.Errorf("HGETALL: got %d errors", hgetall.Errors)
+	}
+	// 5000 bytes is over 4096 and up to 16384.
+	if hgetall.ReplySizes[4] != goroutines*n {
+		t.Errorf("HGETALL: got sizes %v", hgetall.ReplySizes)
+	}
+
+	// Snapshots don't change with later updates.
+	s.ObserveReply("GET", 1<<30)
+	if stats["GET"].ReplySizes[len(ReplySizeBuckets)] != 0 {
+		t.Error("snapshot was changed")
+	}
+	if got := s.Stats()["GET"].ReplySizes[len(ReplySizeBuckets)]; got != 1 {
+		t.Errorf("got %d replies over the largest bucket, wanted 1", got)
+	}
+	// Nil is a reply, not an error.
+	s.ObserveCommand("GET", 0, Nil)
+	if s.Stats()["GET"].Errors != 0 {
+		t.Error("Nil was counted as an error")
+	}
+}
@@ -1,23 +1,93 @@
 package redis
 
 import (
+	"bytes"
+	"context"
+	"encoding"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 
 	"github.com/dongzerun/smartproxy/redis/bufio.v1"
 )
 
-type multiBulkParser func(rd *bufio.Reader, n int64) (interface{}, error)
+type multiBulkParser func(rd *reader, n int64) (interface{}, error)
 
 var (
 	errReaderTooSmall = errors.New("redis: reader is too small")
+
+	// ErrProtocol is returned for a reply which isn't valid RESP.
+	ErrProtocol = errors.New("redis: protocol error")
+
+	errEmptyLine = fmt.Errorf("%w: empty line", ErrProtocol)
+
+	// ErrReplyTooLarge is returned for a reply exceeding
+	// Options.MaxBulkSize or Options.MaxArrayLen. The rest of the reply
+	// is left unread, so it is not a redis error and the connection is
+	// not reused.
+	ErrReplyTooLarge = errors.New("ERR reply too large")
+
+	// ErrTruncatedReply is returned when the connection ends in the
+	// middle of a reply. It wraps io.ErrUnexpectedEOF, the connection is
+	// dropped but the command, which ran, is not retried.
+	ErrTruncatedReply = fmt.Errorf("ERR truncated reply: %w", io.ErrUnexpectedEOF)
 )
 
+// truncated turns io.EOF read after the start of a reply into
+// ErrTruncatedReply, a clean EOF is only one before the reply.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncatedReply
+	}
+	return err
+}
+
+// reader reads the replies of a connection within the limits of its
+// Options.
+type reader struct {
+	*bufio.Reader
+
+	maxBulkSize    int64
+	maxArrayLen    int64
+	strictNewlines bool
+}
+
+// newReader returns a reader of rd, opt nil stands for the defaults.
+func newReader(rd *bufio.Reader, opt *Options) *reader {
+	if opt == nil {
+		opt = &Options{}
+	}
+	return &reader{
+		Reader:         rd,
+		maxBulkSize:    int64(opt.getMaxBulkSize()),
+		maxArrayLen:    opt.getMaxArrayLen(),
+		strictNewlines: opt.StrictNewlines,
+	}
+}
+
 //------------------------------------------------------------------------------
 
-func appendArgs(buf []byte, args []string) []byte {
+// AppendCommand appends args encoded as the multi bulk request Redis
+// expects to buf. Connections write commands with it into a buffer they
+// reuse from one request to the next.
+func AppendCommand(buf []byte, args []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendUint(buf, uint64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendUint(buf, uint64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// AppendCommandBytes is AppendCommand for binary arguments.
+func AppendCommandBytes(buf []byte, args [][]byte) []byte {
 	buf = append(buf, '*')
 	buf = strconv.AppendUint(buf, uint64(len(args)), 10)
 	buf = append(buf, '\r', '\n')
@@ -31,20 +101,58 @@ func appendArgs(buf []byte, args []string) []byte {
 	return buf
 }
 
+// encodedLen returns the size of a multi bulk request holding n
+// arguments of size total, overestimating the length headers.
+func encodedLen(n, total int) int {
+	// '*' or '$', up to 20 digits and CRLF per header, CRLF per argument.
+	return (n+1)*23 + n*2 + total
+}
+
+// EncodeCommand encodes args as the multi bulk request Redis expects,
+// in a buffer of its own; see AppendCommand to reuse one.
+func EncodeCommand(args []string) []byte {
+	total := 0
+	for _, arg := range args {
+		total += len(arg)
+	}
+	return AppendCommand(make([]byte, 0, encodedLen(len(args), total)), args)
+}
+
+// EncodeCommandBytes is EncodeCommand for binary arguments.
+func EncodeCommandBytes(args [][]byte) []byte {
+	total := 0
+	for _, arg := range args {
+		total += len(arg)
+	}
+	return AppendCommandBytes(make([]byte, 0, encodedLen(len(args), total)), args)
+}
+
 //------------------------------------------------------------------------------
 
-func readLine(rd *bufio.Reader) ([]byte, error) {
-	line, isPrefix, err := rd.ReadLine()
+// readLine reads a line without its terminator, see
+// Options.StrictNewlines.
+func readLine(rd *reader) ([]byte, error) {
+	line, err := rd.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errReaderTooSmall
+	}
 	if err != nil {
-		return line, err
+		if len(line) > 0 {
+			return nil, truncated(err)
+		}
+		return nil, err
+	}
+	n := len(line) - 1
+	if n > 0 && line[n-1] == '\r' {
+		return line[:n-1], nil
 	}
-	if isPrefix {
-		return line, errReaderTooSmall
+	if !rd.strictNewlines {
+		return line[:n], nil
 	}
-	return line, nil
+	return nil, fmt.Errorf("%w: line %q not terminated by CRLF", ErrProtocol, line)
 }
 
-func readN(rd *bufio.Reader, n int) ([]byte, error) {
+func readN(rd *reader, n int) ([]byte, error) {
 	b, err := rd.ReadN(n)
 	if err == bufio.ErrBufferFull {
 		tmp := make([]byte, n)
@@ -59,27 +167,269 @@ func readN(rd *bufio.Reader, n int) ([]byte, error) {
 				break
 			}
 			if err != nil {
-				return nil, err
+				return nil, truncated(err)
 			}
 		}
 	} else if err != nil {
-		return nil, err
+		return nil, truncated(err)
 	}
 	return b, nil
 }
 
+// discardN advances rd by n bytes without copying them.
+func discardN(rd *reader, n int) error {
+	for n > 0 {
+		k := rd.Buffered()
+		if k == 0 {
+			if _, err := rd.Peek(1); err != nil {
+				return truncated(err)
+			}
+			continue
+		}
+		if k > n {
+			k = n
+		}
+		rd.ReadN(k)
+		n -= k
+	}
+	return nil
+}
+
+// DiscardReply advances rd past the next reply without building it,
+// e.g. to drain the reply of an ASKING nobody reads. Nested aggregates
+// are walked with a counter rather than recursion. Error replies are
+// skipped like the others, only reading the reply can fail. The limits
+// are the defaults of Options.
+func DiscardReply(rd *bufio.Reader) error {
+	return discardReply(newReader(rd, nil))
+}
+
+func discardReply(rd *reader) error {
+	var nested bool
+	for pending := int64(1); pending > 0; pending-- {
+		line, err := readLine(rd)
+		if err != nil {
+			if nested {
+				return truncated(err)
+			}
+			return err
+		}
+		nested = true
+		if len(line) == 0 {
+			return errEmptyLine
+		}
+
+		switch line[0] {
+		case '+', '-', ':', '_', '#', ',', '(':
+		case '$', '=', '!':
+			n, err := parseLen(line)
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				continue
+			}
+			if err := discardN(rd, int(n)+2); err != nil {
+				return err
+			}
+		case '*', '~', '>', '%', '|':
+			n, err := parseLen(line)
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				continue
+			}
+			if line[0] == '%' || line[0] == '|' {
+				n *= 2
+			}
+			if n > rd.maxArrayLen {
+				return ErrReplyTooLarge
+			}
+			if line[0] == '|' {
+				// Attributes annotate the reply that follows them.
+				n++
+			}
+			pending += n
+		default:
+			return fmt.Errorf("redis: can't parse %q", line)
+		}
+	}
+	return nil
+}
+
+// ReplyType is the RESP type of a reply, its first byte.
+type ReplyType byte
+
+const (
+	ReplyStatus  ReplyType = '+'
+	ReplyError   ReplyType = '-'
+	ReplyInteger ReplyType = ':'
+	// RESP2 nils are bulk strings and arrays too, with a length of -1.
+	ReplyBulk  ReplyType = '$'
+	ReplyArray ReplyType = '*'
+
+	// The RESP3 types, RESP2 servers never send them.
+	ReplyNull      ReplyType = '_'
+	ReplyBoolean   ReplyType = '#'
+	ReplyDouble    ReplyType = ','
+	ReplyBigNumber ReplyType = '('
+	ReplyVerbatim  ReplyType = '='
+	ReplyBlobError ReplyType = '!'
+	ReplyMap       ReplyType = '%'
+	ReplySet       ReplyType = '~'
+	ReplyPush      ReplyType = '>'
+	ReplyAttribute ReplyType = '|'
+)
+
+var replyTypeNames = map[ReplyType]string{
+	ReplyStatus:    "status",
+	ReplyError:     "error",
+	ReplyInteger:   "integer",
+	ReplyBulk:      "bulk",
+	ReplyArray:     "array",
+	ReplyNull:      "null",
+	ReplyBoolean:   "boolean",
+	ReplyDouble:    "double",
+	ReplyBigNumber: "big number",
+	ReplyVerbatim:  "verbatim",
+	ReplyBlobError: "blob error",
+	ReplyMap:       "map",
+	ReplySet:       "set",
+	ReplyPush:      "push",
+	ReplyAttribute: "attribute",
+}
+
+func (t ReplyType) String() string {
+	if name, ok := replyTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ReplyType(%q)", byte(t))
+}
+
+// PeekReplyType returns the type of the next reply in rd, reading only
+// its first byte which is left buffered.
+func PeekReplyType(rd *bufio.Reader) (ReplyType, error) {
+	b, err := rd.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	t := ReplyType(b[0])
+	if _, ok := replyTypeNames[t]; !ok {
+		return 0, fmt.Errorf("%w: unknown reply type %q", ErrProtocol, b[0])
+	}
+	return t, nil
+}
+
+// readRedirect reads the next reply of rd if it is a MOVED or ASK error
+// and returns it as the error, false leaves the reply unread for the parser of the
+// command. Only the buffered bytes are looked at.
+func readRedirect(rd *reader) (bool, error) {
+	if t, err := PeekReplyType(rd.Reader); err != nil || t != ReplyError {
+		return false, nil
+	}
+	n := rd.Buffered()
+	if n > len("-MOVED ") {
+		n = len("-MOVED ")
+	}
+	b, _ := rd.Peek(n)
+	if !bytes.HasPrefix(b, []byte("-MOVED ")) && !bytes.HasPrefix(b, []byte("-ASK ")) {
+		return false, nil
+	}
+	line, err := readLine(rd)
+	if err != nil {
+		return true, err
+	}
+	return true, errorf(string(line[1:]))
+}
+
 //------------------------------------------------------------------------------
 
-func parseReq(rd *bufio.Reader) ([]string, error) {
+// scan parses s into dest, which must be *string, *int, *int64,
+// *float64, *bool or an encoding.BinaryUnmarshaler.
+func scan(s string, dest interface{}) error {
+	var err error
+	switch v := dest.(type) {
+	case nil:
+		return errorf("redis: Scan(nil)")
+	case *string:
+		*v = s
+	case *int:
+		*v, err = strconv.Atoi(s)
+	case *int64:
+		*v, err = strconv.ParseInt(s, 10, 64)
+	case *float64:
+		*v, err = strconv.ParseFloat(s, 64)
+	case *bool:
+		*v, err = strconv.ParseBool(s)
+	case encoding.BinaryUnmarshaler:
+		err = v.UnmarshalBinary([]byte(s))
+	default:
+		return fmt.Errorf(
+			"redis: can't unmarshal %T (consider implementing BinaryUnmarshaler)", dest)
+	}
+	return err
+}
+
+// parseUintReply parses an integer or bulk reply holding an unsigned
+// 64 bit value, which parseReply would overflow above math.MaxInt64.
+func parseUintReply(rd *reader) (uint64, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(line) == 0 {
+		return 0, errEmptyLine
+	}
+
+	switch line[0] {
+	case '-':
+		return 0, errorf(string(line[1:]))
+	case ':':
+		return strconv.ParseUint(string(line[1:]), 10, 64)
+	case '$':
+		replyLen, err := parseLen(line)
+		if err != nil {
+			return 0, err
+		}
+		if replyLen == -1 {
+			return 0, Nil
+		}
+		if replyLen > rd.maxBulkSize {
+			return 0, ErrReplyTooLarge
+		}
+		b, err := readN(rd, int(replyLen)+2)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(string(b[:replyLen]), 10, 64)
+	}
+	return 0, fmt.Errorf("%w: got %q for an unsigned integer", ErrUnexpectedReplyType, line)
+}
+
+// parseLen parses the length of a bulk or multi bulk header line, -1 is
+// the only valid negative length and stands for nil.
+func parseLen(line []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	if err != nil || n < -1 {
+		return 0, fmt.Errorf("%w: invalid length in %q", ErrProtocol, line)
+	}
+	return n, nil
+}
+
+//------------------------------------------------------------------------------
+
+func parseReq(rd *reader) ([]string, error) {
 	line, err := readLine(rd)
 	if err != nil {
 		return nil, err
 	}
 
-	if line[0] != '*' {
+	if len(line) == 0 || line[0] != '*' {
 		return []string{string(line)}, nil
 	}
-	numReplies, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	numReplies, err := parseLen(line)
 	if err != nil {
 		return nil, err
 	}
@@ -90,14 +440,17 @@ func parseReq(rd *bufio.Reader) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		if line[0] != '$' {
+		if len(line) == 0 || line[0] != '$' {
 			return nil, fmt.Errorf("redis: expected '$', but got %q", line)
 		}
 
-		argLen, err := strconv.ParseInt(string(line[1:]), 10, 32)
+		argLen, err := parseLen(line)
 		if err != nil {
 			return nil, err
 		}
+		if argLen == -1 {
+			return nil, fmt.Errorf("%w: nil argument", ErrProtocol)
+		}
 
 		arg, err := readN(rd, int(argLen)+2)
 		if err != nil {
@@ -110,11 +463,14 @@ func parseReq(rd *bufio.Reader) ([]string, error) {
 
 //------------------------------------------------------------------------------
 
-func parseReply(rd *bufio.Reader, p multiBulkParser) (interface{}, error) {
+func parseReply(rd *reader, p multiBulkParser) (interface{}, error) {
 	line, err := readLine(rd)
 	if err != nil {
 		return nil, err
 	}
+	if len(line) == 0 {
+		return nil, errEmptyLine
+	}
 
 	switch line[0] {
 	case '-':
@@ -128,39 +484,143 @@ func parseReply(rd *bufio.Reader, p multiBulkParser) (interface{}, error) {
 		}
 		return v, nil
 	case '$':
-		if len(line) == 3 && line[1] == '-' && line[2] == '1' {
-			return nil, Nil
-		}
-
-		replyLen, err := strconv.Atoi(string(line[1:]))
+		replyLen, err := parseLen(line)
 		if err != nil {
 			return nil, err
 		}
+		if replyLen == -1 {
+			return nil, Nil
+		}
+		if replyLen > rd.maxBulkSize {
+			return nil, ErrReplyTooLarge
+		}
 
-		b, err := readN(rd, replyLen+2)
+		b, err := readN(rd, int(replyLen)+2)
 		if err != nil {
 			return nil, err
 		}
 		return string(b[:replyLen]), nil
 	case '*':
-		if len(line) == 3 && line[1] == '-' && line[2] == '1' {
+		repliesNum, err := parseLen(line)
+		if err != nil {
+			return nil, err
+		}
+		if repliesNum == -1 {
 			return nil, Nil
 		}
+		if repliesNum > rd.maxArrayLen {
+			return nil, ErrReplyTooLarge
+		}
 
-		repliesNum, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if p == nil {
+			// Read the array anyway so the connection stays usable,
+			// the caller rejects the unexpected type.
+			p = parseSlice
+		}
+		v, err := p(rd, repliesNum)
+		return v, truncated(err)
+	}
+	return parseResp3Reply(rd, line, p)
+}
+
+// parseResp3Reply decodes the RESP3 types into the values their RESP2
+// counterparts parse to, so commands don't depend on the protocol
+// negotiated by HELLO. RESP2 servers never send them.
+func parseResp3Reply(rd *reader, line []byte, p multiBulkParser) (interface{}, error) {
+	switch line[0] {
+	case '_':
+		return nil, Nil
+	case '#':
+		// Booleans are the integers 1 and 0 in RESP2.
+		switch string(line[1:]) {
+		case "t":
+			return int64(1), nil
+		case "f":
+			return int64(0), nil
+		}
+		return nil, fmt.Errorf("%w: invalid boolean %q", ErrProtocol, line)
+	case ',', '(':
+		// Doubles and big numbers are bulk strings in RESP2.
+		return string(line[1:]), nil
+	case '=':
+		// Verbatim strings start with their format, e.g. "txt:".
+		n, err := parseLen(line)
 		if err != nil {
 			return nil, err
 		}
-
-		return p(rd, repliesNum)
+		if n < 4 || n > rd.maxBulkSize {
+			return nil, fmt.Errorf("%w: invalid verbatim string length in %q", ErrProtocol, line)
+		}
+		b, err := readN(rd, int(n)+2)
+		if err != nil {
+			return nil, err
+		}
+		return string(b[4:n]), nil
+	case '%', '~', '>', '|':
+		n, err := parseLen(line)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("%w: invalid length in %q", ErrProtocol, line)
+		}
+		if line[0] == '%' || line[0] == '|' {
+			// Maps and attributes are flat arrays of pairs in RESP2.
+			n *= 2
+		}
+		if n > rd.maxArrayLen {
+			return nil, ErrReplyTooLarge
+		}
+		if line[0] == '|' {
+			// Attributes annotate the reply that follows them.
+			if _, err := parseSlice(rd, n); err != nil {
+				return nil, truncated(err)
+			}
+			v, err := parseReply(rd, p)
+			return v, truncated(err)
+		}
+		if p == nil {
+			p = parseSlice
+		}
+		v, err := p(rd, n)
+		return v, truncated(err)
 	}
 	return nil, fmt.Errorf("redis: can't parse %q", line)
 }
 
-func parseSlice(rd *bufio.Reader, n int64) (interface{}, error) {
+// parseReplyContext parses the reply of cmd from rd and gives up when
+// ctx is done. interrupt must make a blocked read on rd return; it is
+// called on cancellation and the parser is waited for, so cmd is never
+// written concurrently with the caller.
+func parseReplyContext(ctx context.Context, cmd Cmder, rd *reader, interrupt func()) error {
+	if ctx.Done() == nil {
+		return cmd.parseReply(rd)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.parseReply(rd)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		interrupt()
+		<-done
+		err := ErrReadCanceled
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ErrReadTimeout
+		}
+		cmd.setErr(err)
+		return err
+	}
+}
+
+func parseSlice(rd *reader, n int64) (interface{}, error) {
 	vals := make([]interface{}, 0, n)
 	for i := int64(0); i < n; i++ {
-		v, err := parseReply(rd, parseSlice)
+		v, err := parseValue(rd)
 		if err == Nil {
 			vals = append(vals, nil)
 		} else if err != nil {
@@ -172,7 +632,22 @@ func parseSlice(rd *bufio.Reader, n int64) (interface{}, error) {
 	return vals, nil
 }
 
-func parseStringSlice(rd *bufio.Reader, n int64) (interface{}, error) {
+// parseValue reads an element of a multi bulk reply parsed by
+// parseSlice. It only returns the types formatSlice writes back: string,
+// int64 and []interface{}, nil replies are Nil.
+func parseValue(rd *reader) (interface{}, error) {
+	v, err := parseReply(rd, parseSlice)
+	if err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case string, int64, []interface{}:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: got %T in a multi bulk reply", ErrUnexpectedReplyType, v)
+}
+
+func parseStringSlice(rd *reader, n int64) (interface{}, error) {
 	vals := make([]string, 0, n)
 	for i := int64(0); i < n; i++ {
 		viface, err := parseReply(rd, nil)
@@ -188,7 +663,79 @@ func parseStringSlice(rd *bufio.Reader, n int64) (interface{}, error) {
 	return vals, nil
 }
 
-func parseBoolSlice(rd *bufio.Reader, n int64) (interface{}, error) {
+func parseNilStringSlice(rd *reader, n int64) (interface{}, error) {
+	vals := make([]*string, 0, n)
+	for i := int64(0); i < n; i++ {
+		viface, err := parseReply(rd, nil)
+		if err == Nil {
+			vals = append(vals, nil)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		v, ok := viface.(string)
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected string", viface)
+		}
+		vals = append(vals, &v)
+	}
+	return vals, nil
+}
+
+func parseFloatSlice(rd *reader, n int64) (interface{}, error) {
+	vals := make([]*float64, 0, n)
+	for i := int64(0); i < n; i++ {
+		viface, err := parseReply(rd, nil)
+		if err == Nil {
+			vals = append(vals, nil)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		s, ok := viface.(string)
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected string", viface)
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, &v)
+	}
+	return vals, nil
+}
+
+// intSlice is an array of integers, null marks the nil elements and is
+// only allocated when there is one.
+type intSlice struct {
+	vals []int64
+	null []bool
+}
+
+func parseIntSlice(rd *reader, n int64) (interface{}, error) {
+	s := intSlice{vals: make([]int64, 0, n)}
+	for i := int64(0); i < n; i++ {
+		viface, err := parseReply(rd, nil)
+		if err == Nil {
+			if s.null == nil {
+				s.null = make([]bool, n)
+			}
+			s.null[i] = true
+			s.vals = append(s.vals, 0)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		v, ok := viface.(int64)
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected int64", viface)
+		}
+		s.vals = append(s.vals, v)
+	}
+	return s, nil
+}
+
+func parseBoolSlice(rd *reader, n int64) (interface{}, error) {
 	vals := make([]bool, 0, n)
 	for i := int64(0); i < n; i++ {
 		viface, err := parseReply(rd, nil)
@@ -204,7 +751,7 @@ func parseBoolSlice(rd *bufio.Reader, n int64) (interface{}, error) {
 	return vals, nil
 }
 
-func parseStringStringMap(rd *bufio.Reader, n int64) (interface{}, error) {
+func parseStringStringMap(rd *reader, n int64) (interface{}, error) {
 	m := make(map[string]string, n/2)
 	for i := int64(0); i < n; i += 2 {
 		keyiface, err := parseReply(rd, nil)
@@ -230,7 +777,33 @@ func parseStringStringMap(rd *bufio.Reader, n int64) (interface{}, error) {
 	return m, nil
 }
 
-func parseStringIntMap(rd *bufio.Reader, n int64) (interface{}, error) {
+func parseKeyValueSlice(rd *reader, n int64) (interface{}, error) {
+	kvs := make([]KeyValue, 0, n/2)
+	for i := int64(0); i < n; i += 2 {
+		keyiface, err := parseReply(rd, nil)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := keyiface.(string)
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected string", keyiface)
+		}
+
+		valueiface, err := parseReply(rd, nil)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := valueiface.(string)
+		if !ok {
+			return nil, fmt.Errorf("got %T, expected string", valueiface)
+		}
+
+		kvs = append(kvs, KeyValue{Key: key, Value: value})
+	}
+	return kvs, nil
+}
+
+func parseStringIntMap(rd *reader, n int64) (interface{}, error) {
 	m := make(map[string]int64, n/2)
 	for i := int64(0); i < n; i += 2 {
 		keyiface, err := parseReply(rd, nil)
@@ -262,7 +835,10 @@ func parseStringIntMap(rd *bufio.Reader, n int64) (interface{}, error) {
 	return m, nil
 }
 
-func parseZSlice(rd *bufio.Reader, n int64) (interface{}, error) {
+func parseZSlice(rd *reader, n int64) (interface{}, error) {
+	if n%2 != 0 {
+		return nil, fmt.Errorf("%w: odd number of elements in a WITHSCORES reply", ErrProtocol)
+	}
 	zz := make([]Z, n/2)
 	for i := int64(0); i < n; i += 2 {
 		z := &zz[i/2]
@@ -294,7 +870,7 @@ func parseZSlice(rd *bufio.Reader, n int64) (interface{}, error) {
 	return zz, nil
 }
 
-func parseClusterSlotInfoSlice(rd *bufio.Reader, n int64) (interface{}, error) {
+func parseClusterSlotInfoSlice(rd *reader, n int64) (interface{}, error) {
 	infos := make([]ClusterSlotInfo, 0, n)
 	for i := int64(0); i < n; i++ {
 		viface, err := parseReply(rd, parseSlice)
@@ -0,0 +1,349 @@
+package redis
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplyTooLarge(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	for _, reply := range []string{"$2000000000\r\n", "*2000000000\r\n"} {
+		cmd := NewStringCmd("GET", "key")
+		if err := cmd.parseReply(newTestReader(reply)); err != ErrReplyTooLarge {
+			t.Errorf("%q: got %v, wanted %v", reply, err, ErrReplyTooLarge)
+		}
+		if got := string(cmd.Reply()); got != "-ERR reply too large\r\n" {
+			t.Errorf("Reply: got %q", got)
+		}
+	}
+
+	runtime.ReadMemStats(&after)
+	if d := after.TotalAlloc - before.TotalAlloc; d > 1<<20 {
+		t.Errorf("allocated %d bytes for a rejected reply", d)
+	}
+
+	opt := &Options{MaxBulkSize: 4}
+	cmd := NewStringCmd("GET", "key")
+	if err := cmd.parseReply(newReader(newTestReader("$4\r\nabcd\r\n").Reader, opt)); err != nil || cmd.Val() != "abcd" {
+		t.Errorf("got %q, %v", cmd.Val(), err)
+	}
+	if err := cmd.parseReply(newReader(newTestReader("$5\r\nabcde\r\n").Reader, opt)); err != ErrReplyTooLarge {
+		t.Errorf("got %v, wanted %v", err, ErrReplyTooLarge)
+	}
+}
+
+func TestMalformedLength(t *testing.T) {
+	for _, reply := range []string{"$-2\r\n", "*-5\r\n", "*abc\r\n", "$\r\n", "$1x\r\n", "\r\n"} {
+		cmd := NewSliceCmd("LRANGE", "k", "0", "-1")
+		err := cmd.parseReply(newTestReader(reply))
+		if !errors.Is(err, ErrProtocol) {
+			t.Errorf("%q: got %v, wanted %v", reply, err, ErrProtocol)
+		}
+	}
+
+	if _, err := parseUintReply(newTestReader("$-2\r\n")); !errors.Is(err, ErrProtocol) {
+		t.Errorf("got %v, wanted %v", err, ErrProtocol)
+	}
+	if _, err := parseReq(newTestReader("*1\r\n$-3\r\n")); !errors.Is(err, ErrProtocol) {
+		t.Errorf("got %v, wanted %v", err, ErrProtocol)
+	}
+
+	// Only -1 is nil.
+	cmd := NewStringCmd("GET", "key")
+	if err := cmd.parseReply(newTestReader("$-1\r\n")); err != Nil {
+		t.Errorf("got %v, wanted %v", err, Nil)
+	}
+}
+
+func TestTruncatedReply(t *testing.T) {
+	for _, reply := range []string{"$5\r\nab", "*2\r\n$1\r\na\r\n", "*2\r\n*1\r\n", "%1\r\n+k\r\n"} {
+		cmd := NewSliceCmd("LRANGE", "k", "0", "-1")
+		err := cmd.parseReply(newTestReader(reply))
+		if !errors.Is(err, io.ErrUnexpectedEOF) || cmd.Err() != err {
+			t.Errorf("%q: got %v, wanted %v", reply, err, ErrTruncatedReply)
+		}
+	}
+
+	cmd := NewStringCmd("GET", "key")
+	cmd.parseReply(newTestReader("$5\r\nab"))
+	if got := string(cmd.Reply()); got != "-ERR truncated reply: unexpected EOF\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	// A clean EOF before the reply is a network error, retried.
+	if err := cmd.parseReply(newTestReader("")); err != io.EOF {
+		t.Errorf("got %v, wanted %v", err, io.EOF)
+	}
+
+	// The connection is dropped and the command not retried.
+	client, server, p := newPipeClient(&Options{MaxRetries: 2})
+	go func() {
+		buf := make([]byte, 64)
+		server.Read(buf)
+		io.WriteString(server, "$5\r\nab")
+		server.Close()
+	}()
+	get := NewStringCmd("GET", "key")
+	client.Process(get)
+	if err := get.Err(); err != ErrTruncatedReply {
+		t.Errorf("got %v, wanted %v", err, ErrTruncatedReply)
+	}
+	if !p.removed {
+		t.Error("connection with a truncated reply was put back")
+	}
+}
+
+func TestEncodeCommand(t *testing.T) {
+	want := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$4\r\na\r\nb\r\n"
+	if got := string(EncodeCommand([]string{"SET", "key", "a\r\nb"})); got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if got := string(EncodeCommandBytes([][]byte{[]byte("SET"), []byte("key"), []byte("a\r\nb")})); got != want {
+		t.Errorf("bytes: got %q, wanted %q", got, want)
+	}
+	if got := string(EncodeCommand(nil)); got != "*0\r\n" {
+		t.Errorf("got %q", got)
+	}
+
+	v, err := parseReply(newTestReader(string(EncodeCommand([]string{"MSET", "k", "\x00\xff"}))), parseSlice)
+	if err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	if vals := v.([]interface{}); len(vals) != 3 || vals[2] != "\x00\xff" {
+		t.Errorf("got %q", vals)
+	}
+}
+
+func BenchmarkEncodeCommand(b *testing.B) {
+	args := []string{"SET", "key:000000001", strings.Repeat("x", 128)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EncodeCommand(args)
+	}
+}
+
+// The way connections encode, into a reused buffer.
+func BenchmarkAppendCommand(b *testing.B) {
+	args := []string{"SET", "key:000000001", strings.Repeat("x", 128)}
+	var buf []byte
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = AppendCommand(buf[:0], args)
+	}
+}
+
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) SetWriteDeadline(time.Time) error { return nil }
+func (discardConn) Write(b []byte) (int, error)      { return len(b), nil }
+
+func BenchmarkWriteCmds(b *testing.B) {
+	cn := &conn{netcn: discardConn{}}
+	cmd := NewStatusCmd("SET", "key:000000001", strings.Repeat("x", 128))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cn.writeCmds(cmd)
+	}
+}
+
+func TestResp3Replies(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  interface{}
+	}{
+		{"#t\r\n", int64(1)},
+		{"#f\r\n", int64(0)},
+		{",3.14\r\n", "3.14"},
+		{",inf\r\n", "inf"},
+		{"(3492890328409238509324850943850943825024385\r\n", "3492890328409238509324850943850943825024385"},
+		{"=15\r\ntxt:Some string\r\n", "Some string"},
+		{"%1\r\n+key\r\n:1\r\n", []interface{}{"key", int64(1)}},
+		{"~2\r\n+a\r\n+b\r\n", []interface{}{"a", "b"}},
+		{">3\r\n+message\r\n+ch\r\n+hi\r\n", []interface{}{"message", "ch", "hi"}},
+		{"|1\r\n+ttl\r\n:3600\r\n+v\r\n", "v"},
+		{"*2\r\n_\r\n#t\r\n", []interface{}{nil, int64(1)}},
+	}
+	for _, test := range tests {
+		v, err := parseReply(newTestReader(test.reply), parseSlice)
+		if err != nil {
+			t.Errorf("%q: %s", test.reply, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, test.want) {
+			t.Errorf("%q: got %#v, wanted %#v", test.reply, v, test.want)
+		}
+	}
+
+	if _, err := parseReply(newTestReader("_\r\n"), nil); err != Nil {
+		t.Errorf("got %v, wanted %v", err, Nil)
+	}
+	if _, err := parseReply(newTestReader("#x\r\n"), nil); !errors.Is(err, ErrProtocol) {
+		t.Errorf("got %v, wanted %v", err, ErrProtocol)
+	}
+
+	// A RESP3 map is a flat RESP2 array to the typed commands.
+	cmd := NewStringStringMapCmd("HGETALL", "h")
+	if err := cmd.parseReply(newTestReader("%1\r\n$1\r\nf\r\n$1\r\nv\r\n")); err != nil || cmd.Val()["f"] != "v" {
+		t.Errorf("got %v, %v", cmd.Val(), err)
+	}
+}
+
+func TestStrictNewlines(t *testing.T) {
+	tests := []struct {
+		reply  string
+		strict bool
+		ok     bool
+	}{
+		{"+OK\r\n", true, true},
+		{"+OK\n", true, false},
+		{"+OK\r\n", false, true},
+		{"+OK\n", false, true},
+	}
+	for _, test := range tests {
+		rd := newReader(newTestReader(test.reply).Reader, &Options{StrictNewlines: test.strict})
+		cmd := NewStatusCmd("SET", "k", "v")
+		err := cmd.parseReply(rd)
+		if test.ok && (err != nil || cmd.Val() != "OK") {
+			t.Errorf("%q strict=%v: got %q, %v", test.reply, test.strict, cmd.Val(), err)
+		}
+		if !test.ok && !errors.Is(err, ErrProtocol) {
+			t.Errorf("%q strict=%v: got %v, wanted %v", test.reply, test.strict, err, ErrProtocol)
+		}
+	}
+
+	// Bulk strings are framed by their length, only the headers differ.
+	// Bare newlines are accepted by default.
+	cmd := NewStringCmd("GET", "k")
+	if err := cmd.parseReply(newTestReader("$2\nab\r\n")); err != nil || cmd.Val() != "ab" {
+		t.Errorf("got %q, %v", cmd.Val(), err)
+	}
+}
+
+func TestClusterReplyLimits(t *testing.T) {
+	opt := (&ClusterOptions{MaxBulkSize: 4, MaxArrayLen: 2, StrictNewlines: true}).clientOptions()
+	opt.Dialer = func() (net.Conn, error) {
+		client, _ := net.Pipe()
+		return client, nil
+	}
+	cn, err := newConnDialer(opt)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cn.Close()
+	if rd := cn.rd; rd.maxBulkSize != 4 || rd.maxArrayLen != 2 || !rd.strictNewlines {
+		t.Errorf("got %+v", *rd)
+	}
+
+	// Connections are lenient within generous limits by default.
+	rd := newReader(nil, &Options{})
+	if rd.maxBulkSize != 512*1024*1024 || rd.maxArrayLen != 16*1024*1024 || rd.strictNewlines {
+		t.Errorf("got %+v", *rd)
+	}
+}
+
+func TestDiscardReply(t *testing.T) {
+	nested := strings.Repeat("*2\r\n:1\r\n", 1000) + "$3\r\nend\r\n"
+	large := "$100000\r\n" + strings.Repeat("x", 100000) + "\r\n"
+	resp3 := "|1\r\n+key\r\n+val\r\n%2\r\n+a\r\n=7\r\ntxt:one\r\n+b\r\n~1\r\n_\r\n"
+	replies := []string{nested, large, resp3, "-ERR oops\r\n", "*-1\r\n", "$-1\r\n"}
+
+	rd := newTestReader(strings.Join(replies, "") + "+next\r\n")
+	for _, reply := range replies {
+		if err := DiscardReply(rd.Reader); err != nil {
+			t.Fatalf("%.20q: %s", reply, err)
+		}
+	}
+	v, err := parseReply(rd, nil)
+	if err != nil || v != "next" {
+		t.Fatalf("got %v %v, wanted the reader at the next reply", v, err)
+	}
+
+	if err := DiscardReply(newTestReader("*3\r\n:1\r\n:2\r\n").Reader); err != ErrTruncatedReply {
+		t.Errorf("got %v, wanted %v", err, ErrTruncatedReply)
+	}
+
+	const runs = 100
+	rd = newTestReader(strings.Repeat(nested+large, runs+1))
+	allocs := testing.AllocsPerRun(runs, func() {
+		discardReply(rd)
+		discardReply(rd)
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocations per run, wanted none", allocs)
+	}
+}
+
+func TestPeekReplyType(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  ReplyType
+	}{
+		{"+OK\r\n", ReplyStatus},
+		{"-ERR oops\r\n", ReplyError},
+		{":1\r\n", ReplyInteger},
+		{"$1\r\na\r\n", ReplyBulk},
+		{"$-1\r\n", ReplyBulk},
+		{"*1\r\n:1\r\n", ReplyArray},
+		{"*-1\r\n", ReplyArray},
+		{"_\r\n", ReplyNull},
+		{"#t\r\n", ReplyBoolean},
+		{",1.5\r\n", ReplyDouble},
+		{"(123\r\n", ReplyBigNumber},
+		{"=7\r\ntxt:abc\r\n", ReplyVerbatim},
+		{"!3\r\nERR\r\n", ReplyBlobError},
+		{"%0\r\n", ReplyMap},
+		{"~0\r\n", ReplySet},
+		{">0\r\n", ReplyPush},
+		{"|0\r\n+OK\r\n", ReplyAttribute},
+	}
+	for _, test := range tests {
+		rd := newTestReader(test.reply)
+		got, err := PeekReplyType(rd.Reader)
+		if err != nil || got != test.want {
+			t.Errorf("%q: got %v %v, wanted %v", test.reply, got, err, test.want)
+		}
+		if rd.Buffered() != len(test.reply) {
+			t.Errorf("%q: the type byte must stay buffered", test.reply)
+		}
+	}
+	if got := ReplyBigNumber.String(); got != "big number" {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := PeekReplyType(newTestReader("?1\r\n").Reader); !errors.Is(err, ErrProtocol) {
+		t.Errorf("got %v, wanted %v", err, ErrProtocol)
+	}
+	if _, err := PeekReplyType(newTestReader("").Reader); err != io.EOF {
+		t.Errorf("got %v, wanted %v", err, io.EOF)
+	}
+}
+
+func TestReadRedirect(t *testing.T) {
+	rd := newTestReader("-MOVED 3999 127.0.0.1:6381\r\n-ASK 3999 127.0.0.1:6382\r\n-ERR oops\r\n:1\r\n")
+
+	for _, want := range []string{"MOVED 3999 127.0.0.1:6381", "ASK 3999 127.0.0.1:6382"} {
+		ok, err := readRedirect(rd)
+		if !ok || err == nil || err.Error() != want {
+			t.Fatalf("got %v %v, wanted %q", ok, err, want)
+		}
+	}
+	// Other replies are left to the parser of the command.
+	for i := 0; i < 2; i++ {
+		if ok, err := readRedirect(rd); ok || err != nil {
+			t.Fatalf("got %v %v, wanted the reply left unread", ok, err)
+		}
+		if _, err := parseReply(rd, nil); err != nil && err.Error() != "ERR oops" {
+			t.Fatal(err)
+		}
+	}
+}
@@ -64,8 +64,16 @@ func (pipe *Pipeline) Exec() (cmds []Cmder, retErr error) {
 	cmds = pipe.cmds
 	pipe.cmds = make([]Cmder, 0, 10)
 
-	failedCmds := cmds
-	for i := 0; i <= pipe.client.opt.MaxRetries; i++ {
+	// Malformed commands are not sent, they fail on their own.
+	failedCmds, retErr := validCmds(cmds)
+	if n := len(failedCmds); n > 0 {
+		if err := pipe.client.inflight.acquire(n); err != nil {
+			setCmdsErr(failedCmds, err)
+			return cmds, err
+		}
+		defer pipe.client.inflight.release(n)
+	}
+	for i := 0; len(failedCmds) > 0 && i <= pipe.client.opt.MaxRetries; i++ {
 		cn, err := pipe.client.conn()
 		if err != nil {
 			setCmdsErr(failedCmds, err)
@@ -73,30 +81,44 @@ func (pipe *Pipeline) Exec() (cmds []Cmder, retErr error) {
 		}
 
 		if i > 0 {
-			resetCmds(failedCmds)
+			resetCmds(failedCmds...)
 		}
+		cn.applyTimeouts(pipe.client.opt, failedCmds...)
 		failedCmds, err = execCmds(cn, failedCmds)
 		pipe.client.putConn(cn, err)
 		if err != nil && retErr == nil {
 			retErr = err
 		}
-		if len(failedCmds) == 0 {
-			break
-		}
 	}
 
 	return cmds, retErr
 }
 
 func execCmds(cn *conn, cmds []Cmder) ([]Cmder, error) {
+	err := pipelineCmds(cn, cmds)
+
+	var failedCmds []Cmder
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && shouldRetry(err) {
+			failedCmds = append(failedCmds, cmd)
+		}
+	}
+	return failedCmds, err
+}
+
+// pipelineCmds writes cmds to cn at once and reads their replies in
+// order. Redis errors are kept by the commands they belong to, but once
+// the connection fails the remaining replies can't be read and all the
+// remaining commands get the connection error. Error of the first failed
+// command is returned.
+func pipelineCmds(cn *conn, cmds []Cmder) error {
 	if err := cn.writeCmds(cmds...); err != nil {
 		setCmdsErr(cmds, err)
-		return cmds, err
+		return err
 	}
 
 	var firstCmdErr error
-	var failedCmds []Cmder
-	for _, cmd := range cmds {
+	for i, cmd := range cmds {
 		err := cmd.parseReply(cn.rd)
 		if err == nil {
 			continue
@@ -104,10 +126,10 @@ func execCmds(cn *conn, cmds []Cmder) ([]Cmder, error) {
 		if firstCmdErr == nil {
 			firstCmdErr = err
 		}
-		if shouldRetry(err) {
-			failedCmds = append(failedCmds, cmd)
+		if isNetworkError(err) {
+			setCmdsErr(cmds[i+1:], err)
+			break
 		}
 	}
-
-	return failedCmds, firstCmdErr
+	return firstCmdErr
 }
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dongzerun/smartproxy/redis/bufio.v1"
+)
+
+// servePipeline reads the whole batch of cmds from server, writes reply
+// and closes the connection.
+func servePipeline(server net.Conn, cmds []Cmder, reply string) {
+	var req []byte
+	for _, cmd := range cmds {
+		req = AppendCommand(req, cmd.args())
+	}
+	io.ReadFull(server, make([]byte, len(req)))
+	io.WriteString(server, reply)
+	server.Close()
+}
+
+func newPipeConn() (*conn, net.Conn) {
+	client, server := net.Pipe()
+	cn := &conn{netcn: client}
+	cn.rd = newReader(bufio.NewReader(cn), nil)
+	return cn, server
+}
+
+func TestPipelineCmdsOrder(t *testing.T) {
+	cn, server := newPipeConn()
+	defer cn.Close()
+
+	get := NewStringCmd("GET", "a")
+	incr := NewIntCmd("INCR", "b")
+	wrong := NewIntCmd("INCR", "a")
+	set := NewStatusCmd("SET", "c", "v")
+	cmds := []Cmder{get, incr, wrong, set}
+	go servePipeline(server, cmds, "$1\r\nx\r\n:2\r\n-ERR value is not an integer\r\n+OK\r\n")
+
+	err := pipelineCmds(cn, cmds)
+	if err == nil || err.Error() != "ERR value is not an integer" {
+		t.Fatalf("got %v, wanted the error of the third command", err)
+	}
+	if get.Val() != "x" || incr.Val() != 2 || set.Val() != "OK" {
+		t.Errorf("got %q %d %q", get.Val(), incr.Val(), set.Val())
+	}
+	if wrong.Err() == nil || get.Err() != nil || set.Err() != nil {
+		t.Errorf("redis errors must stay with their commands")
+	}
+}
+
+func TestPipelineCmdsConnectionDrop(t *testing.T) {
+	cn, server := newPipeConn()
+	defer cn.Close()
+
+	cmds := []Cmder{
+		NewStringCmd("GET", "a"),
+		NewStringCmd("GET", "b"),
+		NewStringCmd("GET", "c"),
+	}
+	// Reply of the second command is cut in the middle.
+	go servePipeline(server, cmds, "$1\r\nx\r\n$5\r\nab")
+
+	err := pipelineCmds(cn, cmds)
+	if !isNetworkError(err) {
+		t.Fatalf("got %v, wanted a connection error", err)
+	}
+	if cmds[0].Err() != nil || cmds[0].(*StringCmd).Val() != "x" {
+		t.Errorf("first command: got %v", cmds[0].Err())
+	}
+	for _, cmd := range cmds[1:] {
+		if cmd.Err() != err {
+			t.Errorf("%v: got %v, wanted %v", cmd.args(), cmd.Err(), err)
+		}
+	}
+
+}
+
+// replayConn replies to every read with the next bytes of reply, over
+// and over, at most a socket buffer at a time.
+type replayConn struct {
+	net.Conn
+	reply []byte
+	off   int
+}
+
+func (cn *replayConn) SetReadDeadline(time.Time) error { return nil }
+
+func (cn *replayConn) Read(b []byte) (int, error) {
+	if len(b) > 64<<10 {
+		b = b[:64<<10]
+	}
+	n := 0
+	for n < len(b) {
+		c := copy(b[n:], cn.reply[cn.off:])
+		n += c
+		cn.off = (cn.off + c) % len(cn.reply)
+	}
+	return n, nil
+}
+
+func benchmarkPipelineRead(b *testing.B, bufSize, valSize int) {
+	const depth = 100
+	val := strings.Repeat("x", valSize)
+	cmds := make([]Cmder, depth)
+	var reply []byte
+	for i := range cmds {
+		cmds[i] = NewStringCmd("GET", "key")
+		reply = append(reply, FormatString(val)...)
+	}
+	cn := &conn{netcn: &replayConn{reply: reply}}
+	cn.rd = newReader(bufio.NewReaderSize(cn, bufSize), nil)
+
+	b.SetBytes(int64(len(reply)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, cmd := range cmds {
+			if err := cmd.parseReply(cn.rd); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkPipelineRead4KB(b *testing.B)       { benchmarkPipelineRead(b, 4<<10, 64) }
+func BenchmarkPipelineRead64KB(b *testing.B)      { benchmarkPipelineRead(b, 64<<10, 64) }
+func BenchmarkPipelineReadLarge4KB(b *testing.B)  { benchmarkPipelineRead(b, 4<<10, 16<<10) }
+func BenchmarkPipelineReadLarge64KB(b *testing.B) { benchmarkPipelineRead(b, 64<<10, 16<<10) }
@@ -145,6 +145,9 @@ func newConnPool(opt *Options) *connPool {
 	if p.opt.getIdleTimeout() > 0 {
 		go p.reaper()
 	}
+	if p.opt.getKeepAliveInterval() > 0 {
+		go p.keepAliveLoop()
+	}
 	return p
 }
 
@@ -247,7 +250,7 @@ func (p *connPool) Put(cn *conn) error {
 		log.Warningf("redis: connection has unread data: %q", b)
 		return p.Remove(cn)
 	}
-	if p.opt.getIdleTimeout() > 0 {
+	if p.opt.getIdleTimeout() > 0 || p.opt.getKeepAliveInterval() > 0 {
 		cn.usedAt = time.Now()
 	}
 	p.freeConns <- cn
@@ -311,6 +314,50 @@ func (p *connPool) reaper() {
 	}
 }
 
+func (p *connPool) keepAliveLoop() {
+	ticker := time.NewTicker(p.opt.getKeepAliveInterval())
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if p.closed() {
+			break
+		}
+		p.keepAlive(now)
+	}
+}
+
+// keepAlive sends a PING on the free connections unused since the keep
+// alive interval before now. Connections are taken out of the pool for
+// it, so it never interleaves with a command.
+func (p *connPool) keepAlive(now time.Time) {
+	interval := p.opt.getKeepAliveInterval()
+	for n := len(p.freeConns); n > 0; n-- {
+		var cn *conn
+		select {
+		case cn = <-p.freeConns:
+		default:
+			return
+		}
+		if now.Sub(cn.usedAt) < interval {
+			p.freeConns <- cn
+			continue
+		}
+
+		cmd := NewPingCmd()
+		cn.ReadTimeout = HealthCheckTimeout
+		cn.WriteTimeout = HealthCheckTimeout
+		err := cn.exec(cmd)
+		cn.clearTimeouts()
+		if err != nil {
+			log.Warningf("redis: keepalive PING failed: %s", err)
+			p.Remove(cn)
+			continue
+		}
+		cn.usedAt = now
+		p.freeConns <- cn
+	}
+}
+
 //------------------------------------------------------------------------------
 
 type singleConnPool struct {
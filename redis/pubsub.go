@@ -1,8 +1,14 @@
 package redis
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/dongzerun/smartproxy/redis/bufio.v1"
+	"github.com/dongzerun/smartproxy/util"
 )
 
 // PubSub implements Pub/Sub commands as described in
@@ -141,3 +147,348 @@ func (c *PubSub) Unsubscribe(channels ...string) error {
 func (c *PubSub) PUnsubscribe(patterns ...string) error {
 	return c.unsubscribe("PUNSUBSCRIBE", patterns...)
 }
+
+//------------------------------------------------------------------------------
+
+// PubSubMessage is a frame pushed by Redis on a subscribed connection.
+type PubSubMessage struct {
+	// Can be "subscribe", "unsubscribe", "psubscribe", "punsubscribe",
+	// "message", "pmessage" or "pong".
+	Kind    string
+	Channel string
+	Pattern string
+	Payload string
+	// Number of channels we are currently subscribed to, only set by
+	// (un)subscribe frames.
+	Count int
+
+	// status is the status Redis replied to PING with outside of
+	// subscribed state, e.g. "PONG".
+	status string
+	// nilChannel is set by unsubscribe frames without a channel.
+	nilChannel bool
+}
+
+func (m *PubSubMessage) String() string {
+	return fmt.Sprintf("%s: %s", m.Kind, m.Channel)
+}
+
+// Reply formats m back into the frame Redis sent, so it can be
+// forwarded to a subscribed client.
+func (m *PubSubMessage) Reply() []byte {
+	b := bytes.Buffer{}
+	switch m.Kind {
+	case "message":
+		b.WriteString("*3\r\n")
+		writeBulk(&b, m.Kind)
+		writeBulk(&b, m.Channel)
+		writeBulk(&b, m.Payload)
+	case "pmessage":
+		b.WriteString("*4\r\n")
+		writeBulk(&b, m.Kind)
+		writeBulk(&b, m.Pattern)
+		writeBulk(&b, m.Channel)
+		writeBulk(&b, m.Payload)
+	case "pong":
+		if m.status != "" {
+			b.WriteString("+" + m.status + "\r\n")
+			break
+		}
+		b.WriteString("*2\r\n")
+		writeBulk(&b, m.Kind)
+		writeBulk(&b, m.Payload)
+	default:
+		b.WriteString("*3\r\n")
+		writeBulk(&b, m.Kind)
+		if m.nilChannel {
+			b.WriteString("$-1\r\n")
+		} else {
+			writeBulk(&b, m.Channel)
+		}
+		b.Write(FormatInt(int64(m.Count)))
+	}
+	return b.Bytes()
+}
+
+func writeBulk(b *bytes.Buffer, s string) {
+	b.WriteByte('$')
+	b.WriteString(util.Itoa(len(s)))
+	b.WriteString("\r\n")
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
+
+// parsePubSubMessage reads the next frame of a subscribed connection.
+func parsePubSubMessage(rd *reader) (*PubSubMessage, error) {
+	v, err := parseReply(rd, parseSlice)
+	if err != nil {
+		return nil, err
+	}
+
+	// PING outside of subscribed state.
+	if s, ok := v.(string); ok && strings.ToLower(s) == "pong" {
+		return &PubSubMessage{Kind: "pong", status: s}, nil
+	}
+
+	reply, ok := v.([]interface{})
+	if !ok || len(reply) == 0 {
+		return nil, fmt.Errorf("redis: got %T, expected pub/sub frame", v)
+	}
+	kind, ok := reply[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("redis: got %T, expected pub/sub frame kind", reply[0])
+	}
+
+	m := &PubSubMessage{Kind: kind}
+	switch kind {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe":
+		if len(reply) != 3 {
+			break
+		}
+		// Channel is nil when unsubscribing without subscriptions.
+		m.Channel, ok = reply[1].(string)
+		m.nilChannel = !ok
+		count, ok := reply[2].(int64)
+		if !ok {
+			break
+		}
+		m.Count = int(count)
+		return m, nil
+	case "message":
+		if len(reply) != 3 {
+			break
+		}
+		if m.Channel, ok = reply[1].(string); !ok {
+			break
+		}
+		if m.Payload, ok = reply[2].(string); !ok {
+			break
+		}
+		return m, nil
+	case "pmessage":
+		if len(reply) != 4 {
+			break
+		}
+		if m.Pattern, ok = reply[1].(string); !ok {
+			break
+		}
+		if m.Channel, ok = reply[2].(string); !ok {
+			break
+		}
+		if m.Payload, ok = reply[3].(string); !ok {
+			break
+		}
+		return m, nil
+	case "pong":
+		if len(reply) != 2 {
+			break
+		}
+		m.Payload, _ = reply[1].(string)
+		return m, nil
+	default:
+		return nil, fmt.Errorf("redis: unsupported message name: %q", kind)
+	}
+	return nil, fmt.Errorf("redis: malformed %s frame: %v", kind, reply)
+}
+
+// SubscribeCmd subscribes to channels. Its reply is a subscribe frame for
+// every channel, after which the connection only carries pushed
+// messages, read them with parsePubSubMessage.
+type SubscribeCmd struct {
+	baseCmd
+
+	val []*PubSubMessage
+}
+
+func NewSubscribeCmd(channels ...string) *SubscribeCmd {
+	args := append([]string{"SUBSCRIBE"}, channels...)
+	return &SubscribeCmd{baseCmd: baseCmd{_args: args}}
+}
+
+func (cmd *SubscribeCmd) reset() {
+	cmd.val = nil
+	cmd.err = nil
+	cmd.resetTimeouts()
+}
+
+func (cmd *SubscribeCmd) Val() []*PubSubMessage {
+	return cmd.val
+}
+
+func (cmd *SubscribeCmd) Result() ([]*PubSubMessage, error) {
+	return cmd.val, cmd.err
+}
+
+func (cmd *SubscribeCmd) String() string {
+	return cmdString(cmd, cmd.val)
+}
+
+func (cmd *SubscribeCmd) parseReply(rd *reader) error {
+	n := len(cmd._args) - 1
+	vals := make([]*PubSubMessage, 0, n)
+	for i := 0; i < n; i++ {
+		m, err := parsePubSubMessage(rd)
+		if err != nil {
+			cmd.err = err
+			return err
+		}
+		vals = append(vals, m)
+	}
+	cmd.val = vals
+	return nil
+}
+
+func (cmd *SubscribeCmd) Reply() []byte {
+	if err := cmd.Err(); err != nil {
+		return FormatError(err)
+	}
+
+	b := bytes.Buffer{}
+	for _, m := range cmd.val {
+		b.Write(m.Reply())
+	}
+	return b.Bytes()
+}
+
+//------------------------------------------------------------------------------
+
+// Subscriber is a client multiplexed on a shared subscribed connection.
+type Subscriber interface {
+	// Deliver forwards a message of a channel the subscriber is
+	// subscribed to.
+	Deliver(m *PubSubMessage)
+}
+
+// SubscriptionRegistry counts the subscribers of every channel of a
+// shared backend connection. The backend is only subscribed to a channel
+// while at least one client is, and messages read from the connection
+// are delivered to exactly the clients subscribed to their channel.
+type SubscriptionRegistry struct {
+	mx       sync.Mutex
+	channels map[string]map[Subscriber]struct{}
+	clients  map[Subscriber][]string
+}
+
+func NewSubscriptionRegistry() *SubscriptionRegistry {
+	return &SubscriptionRegistry{
+		channels: make(map[string]map[Subscriber]struct{}),
+		clients:  make(map[Subscriber][]string),
+	}
+}
+
+// Subscribe subscribes s to channels. It returns the subscribe frames
+// to answer s with and the channels nobody was subscribed to, which
+// must be subscribed to on the backend.
+func (r *SubscriptionRegistry) Subscribe(s Subscriber, channels ...string) ([]*PubSubMessage, []string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	acks := make([]*PubSubMessage, 0, len(channels))
+	var backend []string
+	for _, channel := range channels {
+		subs, ok := r.channels[channel]
+		if !ok {
+			subs = make(map[Subscriber]struct{})
+			r.channels[channel] = subs
+			backend = append(backend, channel)
+		}
+		if _, ok := subs[s]; !ok {
+			subs[s] = struct{}{}
+			r.clients[s] = append(r.clients[s], channel)
+		}
+		acks = append(acks, &PubSubMessage{
+			Kind:    "subscribe",
+			Channel: channel,
+			Count:   len(r.clients[s]),
+		})
+	}
+	return acks, backend
+}
+
+// Unsubscribe unsubscribes s from channels, from all its channels if
+// none are given. It returns the unsubscribe frames to answer s with and
+// the channels nobody is subscribed to anymore, which must be
+// unsubscribed from on the backend.
+func (r *SubscriptionRegistry) Unsubscribe(s Subscriber, channels ...string) ([]*PubSubMessage, []string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if len(channels) == 0 {
+		channels = append([]string(nil), r.clients[s]...)
+	}
+	acks := make([]*PubSubMessage, 0, len(channels))
+	var backend []string
+	for _, channel := range channels {
+		if subs, ok := r.channels[channel]; ok {
+			if _, ok := subs[s]; ok {
+				delete(subs, s)
+				r.removeChannel(s, channel)
+				if len(subs) == 0 {
+					delete(r.channels, channel)
+					backend = append(backend, channel)
+				}
+			}
+		}
+		acks = append(acks, &PubSubMessage{
+			Kind:    "unsubscribe",
+			Channel: channel,
+			Count:   len(r.clients[s]),
+		})
+	}
+	return acks, backend
+}
+
+func (r *SubscriptionRegistry) removeChannel(s Subscriber, channel string) {
+	channels := r.clients[s]
+	for i, ch := range channels {
+		if ch == channel {
+			channels = append(channels[:i], channels[i+1:]...)
+			break
+		}
+	}
+	if len(channels) == 0 {
+		delete(r.clients, s)
+	} else {
+		r.clients[s] = channels
+	}
+}
+
+// Subscribers returns the number of clients subscribed to channel.
+func (r *SubscriptionRegistry) Subscribers(channel string) int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return len(r.channels[channel])
+}
+
+// Dispatch delivers a message frame to the clients subscribed to its
+// channel and returns how many got it. Other frames are not delivered.
+func (r *SubscriptionRegistry) Dispatch(m *PubSubMessage) int {
+	if m.Kind != "message" {
+		return 0
+	}
+
+	r.mx.Lock()
+	subs := make([]Subscriber, 0, len(r.channels[m.Channel]))
+	for s := range r.channels[m.Channel] {
+		subs = append(subs, s)
+	}
+	r.mx.Unlock()
+
+	for _, s := range subs {
+		s.Deliver(m)
+	}
+	return len(subs)
+}
+
+// Receive reads the next frame of the shared backend connection and
+// dispatches it. The (un)subscribe frames answer the backend commands
+// sent by the registry owner, clients get their own from Subscribe and
+// Unsubscribe. The limits are the defaults of Options.
+func (r *SubscriptionRegistry) Receive(rd *bufio.Reader) (*PubSubMessage, error) {
+	m, err := parsePubSubMessage(newReader(rd, nil))
+	if err != nil {
+		return nil, err
+	}
+	r.Dispatch(m)
+	return m, nil
+}
@@ -0,0 +1,157 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePubSubMessage(t *testing.T) {
+	tests := []struct {
+		frame string
+		want  PubSubMessage
+	}{
+		{
+			"*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n",
+			PubSubMessage{Kind: "subscribe", Channel: "news", Count: 1},
+		},
+		{
+			"*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:0\r\n",
+			PubSubMessage{Kind: "unsubscribe", Channel: "news"},
+		},
+		{
+			"*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n",
+			PubSubMessage{Kind: "message", Channel: "news", Payload: "hello"},
+		},
+		{
+			"*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n",
+			PubSubMessage{Kind: "pmessage", Pattern: "n*", Channel: "news", Payload: "hello"},
+		},
+		{
+			"*2\r\n$4\r\npong\r\n$0\r\n\r\n",
+			PubSubMessage{Kind: "pong"},
+		},
+		{
+			"+PONG\r\n",
+			PubSubMessage{Kind: "pong", status: "PONG"},
+		},
+		{
+			"*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n",
+			PubSubMessage{Kind: "unsubscribe", nilChannel: true},
+		},
+	}
+	for _, test := range tests {
+		m, err := parsePubSubMessage(newTestReader(test.frame))
+		if err != nil {
+			t.Errorf("%q: %s", test.frame, err)
+			continue
+		}
+		if *m != test.want {
+			t.Errorf("%q: got %+v, wanted %+v", test.frame, *m, test.want)
+		}
+		if got := string(m.Reply()); got != test.frame {
+			t.Errorf("Reply: got %q, wanted %q", got, test.frame)
+		}
+	}
+
+	for _, frame := range []string{
+		"*2\r\n$7\r\nmessage\r\n$4\r\nnews\r\n",
+		"*3\r\n$7\r\nunknown\r\n$4\r\nnews\r\n:1\r\n",
+		":1\r\n",
+	} {
+		if _, err := parsePubSubMessage(newTestReader(frame)); err == nil {
+			t.Errorf("%q: wanted an error", frame)
+		}
+	}
+}
+
+func TestSubscribeCmd(t *testing.T) {
+	reply := "*3\r\n$9\r\nsubscribe\r\n$1\r\na\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$1\r\nb\r\n:2\r\n"
+	message := "*3\r\n$7\r\nmessage\r\n$1\r\na\r\n$2\r\nhi\r\n"
+	rd := newTestReader(reply + message)
+
+	cmd := NewSubscribeCmd("a", "b")
+	if cmd.clusterKey() != "" {
+		t.Errorf("SUBSCRIBE must be keyless, got %q", cmd.clusterKey())
+	}
+	if err := cmd.parseReply(rd); err != nil {
+		t.Fatalf("parseReply: %s", err)
+	}
+	if len(cmd.Val()) != 2 || cmd.Val()[1].Channel != "b" || cmd.Val()[1].Count != 2 {
+		t.Errorf("got %v", cmd.Val())
+	}
+	if got := string(cmd.Reply()); got != reply {
+		t.Errorf("Reply: got %q, wanted %q", got, reply)
+	}
+
+	// Messages pushed afterwards stay on the connection.
+	m, err := parsePubSubMessage(rd)
+	if err != nil || m.Kind != "message" || m.Payload != "hi" {
+		t.Errorf("got %+v, %v", m, err)
+	}
+}
+
+type testSubscriber struct {
+	msgs []string
+}
+
+func (s *testSubscriber) Deliver(m *PubSubMessage) {
+	s.msgs = append(s.msgs, m.Channel+":"+m.Payload)
+}
+
+func TestSubscriptionRegistry(t *testing.T) {
+	r := NewSubscriptionRegistry()
+	a, b := &testSubscriber{}, &testSubscriber{}
+
+	acks, backend := r.Subscribe(a, "news", "sport")
+	if !reflect.DeepEqual(backend, []string{"news", "sport"}) {
+		t.Fatalf("got backend %q, wanted news and sport", backend)
+	}
+	if len(acks) != 2 || acks[1].Count != 2 {
+		t.Fatalf("got acks %v, wanted two with count 2", acks)
+	}
+	acks, backend = r.Subscribe(b, "news")
+	if backend != nil {
+		t.Fatalf("got backend %q, news is already subscribed", backend)
+	}
+	if acks[0].Count != 1 {
+		t.Fatalf("got count %d, wanted 1", acks[0].Count)
+	}
+
+	stream := "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n" +
+		"*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$2\r\nhi\r\n" +
+		"*3\r\n$7\r\nmessage\r\n$5\r\nsport\r\n$4\r\ngoal\r\n"
+	rd := newTestReader(stream)
+	for i := 0; i < 3; i++ {
+		if _, err := r.Receive(rd.Reader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(a.msgs, []string{"news:hi", "sport:goal"}) {
+		t.Errorf("a got %q", a.msgs)
+	}
+	if !reflect.DeepEqual(b.msgs, []string{"news:hi"}) {
+		t.Errorf("b got %q", b.msgs)
+	}
+
+	// The backend keeps news until its last subscriber leaves.
+	if _, backend = r.Unsubscribe(a, "news"); backend != nil {
+		t.Fatalf("got backend %q, b is still subscribed to news", backend)
+	}
+	if n := r.Subscribers("news"); n != 1 {
+		t.Fatalf("got %d news subscribers, wanted 1", n)
+	}
+	acks, backend = r.Unsubscribe(b)
+	if !reflect.DeepEqual(backend, []string{"news"}) {
+		t.Fatalf("got backend %q, wanted news", backend)
+	}
+	if len(acks) != 1 || acks[0].Channel != "news" || acks[0].Count != 0 {
+		t.Fatalf("got acks %v", acks)
+	}
+	acks, backend = r.Unsubscribe(a)
+	if !reflect.DeepEqual(backend, []string{"sport"}) || acks[0].Count != 0 {
+		t.Fatalf("got backend %q, acks %v", backend, acks)
+	}
+	if n := r.Dispatch(&PubSubMessage{Kind: "message", Channel: "news"}); n != 0 {
+		t.Errorf("delivered to %d clients after unsubscribe", n)
+	}
+}
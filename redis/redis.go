@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -11,18 +12,37 @@ import (
 type baseClient struct {
 	connPool pool
 	opt      *Options
+	inflight *inflightLimiter
 }
 
 func (c *baseClient) String() string {
 	return fmt.Sprintf("Redis<%s db:%d>", c.opt.Addr, c.opt.DB)
 }
 
+// conn returns a connection from the pool, switched back to the
+// configured database if a SELECT changed it.
 func (c *baseClient) conn() (*conn, error) {
-	return c.connPool.Get()
+	return c.connDB(c.opt.DB)
+}
+
+// connDB returns a connection from the pool switched to database db.
+func (c *baseClient) connDB(db int64) (*conn, error) {
+	cn, err := c.connPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	if cn.db != db {
+		if err := cn.selectDB(db); err != nil {
+			c.putConn(cn, err)
+			return nil, err
+		}
+	}
+	return cn, nil
 }
 
 func (c *baseClient) putConn(cn *conn, ei error) {
 	var err error
+	cn.clearTimeouts()
 	if cn.rd.Buffered() > 0 {
 		err = c.connPool.Remove(cn)
 	} else if ei == nil {
@@ -38,30 +58,67 @@ func (c *baseClient) putConn(cn *conn, ei error) {
 }
 
 func (c *baseClient) process(cmd Cmder) {
-	for i := 0; i <= c.opt.MaxRetries; i++ {
+	if err := cmd.Validate(); err != nil {
+		cmd.setErr(err)
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		dur := time.Since(start)
+		c.opt.getObserver().ObserveCommand(cmd.Name(), dur, cmd.Err())
+		if l := c.opt.CommandLogger; l != nil {
+			l.LogCommand(cmd, dur)
+		}
+	}()
+
+	// The slot is kept across retries, the command is still in flight.
+	if err := c.inflight.acquire(1); err != nil {
+		cmd.setErr(err)
+		return
+	}
+	defer c.inflight.release(1)
+
+	// Deferred first, so it sees the keys of the client.
+	if t := c.opt.ReplyTransformer; t != nil {
+		defer transformReply(cmd, t)
+	}
+	if rw := c.opt.KeyRewriter; rw != nil {
+		rewriteKeys(cmd, rw)
+		defer unrewriteKeys(cmd, rw)
+	}
+
+	retries := c.opt.getRetries(cmd)
+	for i := 0; i <= retries; i++ {
 		if i > 0 {
-			cmd.reset()
+			if p := c.opt.RetryPolicy; p != nil {
+				time.Sleep(p.backoff(i))
+			}
+			resetCmds(cmd)
 		}
 
-		cn, err := c.conn()
+		db := c.opt.DB
+		if d, ok := cmd.DB(); ok {
+			db = d
+		}
+		cn, err := c.connDB(db)
 		if err != nil {
 			cmd.setErr(err)
 			return
 		}
 
-		if timeout := cmd.writeTimeout(); timeout != nil {
-			cn.WriteTimeout = *timeout
-		} else {
-			cn.WriteTimeout = c.opt.WriteTimeout
-		}
+		cn.applyTimeouts(c.opt, cmd)
 
-		if timeout := cmd.readTimeout(); timeout != nil {
-			cn.ReadTimeout = *timeout
-		} else {
-			cn.ReadTimeout = c.opt.ReadTimeout
+		ctx := context.Background()
+		cancel := func() {}
+		if timeout := cmd.readTimeout(); timeout != nil && *timeout > 0 {
+			// Socket deadline is renewed on every read, the whole
+			// reply has to arrive in time too.
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
 		}
 
 		if err := cn.writeCmds(cmd); err != nil {
+			cancel()
 			c.putConn(cn, err)
 			cmd.setErr(err)
 			if shouldRetry(err) {
@@ -70,7 +127,16 @@ func (c *baseClient) process(cmd Cmder) {
 			return
 		}
 
-		err = cmd.parseReply(cn.rd)
+		err = cn.readReply(ctx, cmd)
+		cancel()
+		if err == nil {
+			// The reply is good, a connection that can't be set up
+			// again is dropped.
+			if e := cn.trackState(c.opt, cmd); e != nil {
+				c.putConn(cn, e)
+				return
+			}
+		}
 		c.putConn(cn, err)
 		if shouldRetry(err) {
 			continue
@@ -103,10 +169,37 @@ type Options struct {
 	Password string
 	// A database to be selected after connecting to server.
 	DB int64
+	// Sends CLIENT NO-EVICT ON after connecting, so the connections of
+	// the client are never evicted under maxmemory-clients. Requires
+	// Redis 7.0.
+	// Default is to leave eviction on.
+	NoEvict bool
+	// Sends CLIENT NO-TOUCH ON after connecting, so the commands of the
+	// client don't change the LRU/LFU of the keys they read. Requires
+	// Redis 7.2.
+	// Default is to leave touching on.
+	NoTouch bool
+	// The RESP version to negotiate with HELLO after connecting, 3 for
+	// RESP3. Servers without HELLO stay on RESP2.
+	// Default is RESP2 without HELLO.
+	Protocol int
+
+	// Rewrites the keys of commands before they are sent, and the keys
+	// replied by KEYS, SCAN and RANDOMKEY back.
+	// Default is to send keys as is.
+	KeyRewriter KeyRewriter
+
+	// Rewrites the values of successful replies.
+	// Default is to leave replies as is.
+	ReplyTransformer ReplyTransformer
 
 	// The maximum number of retries before giving up.
 	// Default is to not retry failed commands.
 	MaxRetries int
+	// Retries the read-only commands failed by a connection error and
+	// fails the others at once, it takes precedence over MaxRetries.
+	// Default is to retry every command up to MaxRetries.
+	RetryPolicy *RetryPolicy
 
 	// Sets the deadline for establishing new connections. If reached,
 	// dial will fail with a timeout.
@@ -117,6 +210,30 @@ type Options struct {
 	// Sets the deadline for socket writes. If reached, commands will
 	// fail with a timeout instead of blocking.
 	WriteTimeout time.Duration
+	// Requests larger than this are written in chunks, the write
+	// deadline applies to every chunk so a slow server trips it
+	// predictably on large values.
+	// Default is to write requests at once.
+	WriteChunkSize int
+	// Size of the buffer replies are read through, every connection has
+	// one. Bulk replies larger than it are read into a new slice, so a
+	// larger buffer pays off with values of several KB, it is a loss for
+	// small ones (see BenchmarkPipelineRead) and costs memory on every
+	// pooled connection.
+	// Default is 4KB.
+	ReadBufferSize int
+	// The largest bulk string accepted in a reply, larger ones fail
+	// with ErrReplyTooLarge.
+	// Default is 512MB.
+	MaxBulkSize int
+	// The largest number of elements accepted in a multi bulk reply,
+	// larger ones fail with ErrReplyTooLarge.
+	// Default is 16M elements.
+	MaxArrayLen int64
+	// Rejects reply lines ended by a bare \n, as sent by some buggy
+	// servers, with ErrProtocol.
+	// Default is to accept them.
+	StrictNewlines bool
 
 	// The maximum number of socket connections.
 	// Default is 10 connections.
@@ -129,6 +246,27 @@ type Options struct {
 	// connections. Should be less than server's timeout.
 	// Default is to not close idle connections.
 	IdleTimeout time.Duration
+	// Specifies how often connections idle for that long are sent a
+	// PING, so the server's timeout doesn't close them. Connections
+	// failing it are replaced.
+	// Default is to not send keepalives.
+	KeepAliveInterval time.Duration
+	// The maximum number of commands sent and not replied yet, a
+	// pipeline counts all of its commands. Commands over it wait, which
+	// blocks their client, and fail with ErrTooManyInFlight after
+	// InFlightTimeout.
+	// Default is no limit.
+	MaxInFlight int
+	// Specifies amount of time a command waits for MaxInFlight.
+	// Default is PoolTimeout.
+	InFlightTimeout time.Duration
+
+	// Observer is notified about every processed command.
+	// Default is to not observe commands.
+	Observer Observer
+	// CommandLogger logs a sample of the processed commands.
+	// Default is to not log commands.
+	CommandLogger *CommandLogger
 }
 
 func (opt *Options) getNetwork() string {
@@ -147,6 +285,27 @@ func (opt *Options) getDialer() func() (net.Conn, error) {
 	return opt.Dialer
 }
 
+func (opt *Options) getReadBufferSize() int {
+	if opt.ReadBufferSize == 0 {
+		return 4096
+	}
+	return opt.ReadBufferSize
+}
+
+func (opt *Options) getMaxBulkSize() int {
+	if opt.MaxBulkSize == 0 {
+		return 512 * 1024 * 1024
+	}
+	return opt.MaxBulkSize
+}
+
+func (opt *Options) getMaxArrayLen() int64 {
+	if opt.MaxArrayLen == 0 {
+		return 16 * 1024 * 1024
+	}
+	return opt.MaxArrayLen
+}
+
 func (opt *Options) getPoolSize() int {
 	if opt.PoolSize == 0 {
 		return 10
@@ -168,10 +327,74 @@ func (opt *Options) getPoolTimeout() time.Duration {
 	return opt.PoolTimeout
 }
 
+func (opt *Options) getInFlightTimeout() time.Duration {
+	if opt.InFlightTimeout == 0 {
+		return opt.getPoolTimeout()
+	}
+	return opt.InFlightTimeout
+}
+
 func (opt *Options) getIdleTimeout() time.Duration {
 	return opt.IdleTimeout
 }
 
+func (opt *Options) getKeepAliveInterval() time.Duration {
+	return opt.KeepAliveInterval
+}
+
+// getRetries returns the number of times cmd is retried.
+func (opt *Options) getRetries(cmd Cmder) int {
+	if opt.RetryPolicy == nil {
+		return opt.MaxRetries
+	}
+	return opt.RetryPolicy.retries(cmd)
+}
+
+func (opt *Options) getObserver() Observer {
+	if opt.Observer == nil {
+		return nopObserver{}
+	}
+	return opt.Observer
+}
+
+// RetryPolicy retries the commands failed by a connection error, e.g.
+// a backend restarting. Only read-only commands are retried, a write may
+// have been applied before its connection failed. The failed connection
+// is replaced with a freshly dialed one before the retry.
+type RetryPolicy struct {
+	// The maximum number of retries of a read-only command.
+	MaxRetries int
+	// Backoff is waited before the first retry and doubled before every
+	// next one, up to MaxBackoff.
+	// Default is to retry at once.
+	Backoff time.Duration
+	// Default is to not limit the backoff.
+	MaxBackoff time.Duration
+}
+
+func (p *RetryPolicy) retries(cmd Cmder) int {
+	if !cmd.IsReadOnly() {
+		return 0
+	}
+	return p.MaxRetries
+}
+
+// backoff returns the time waited before the retry number retry,
+// starting from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && d > 0; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
 //------------------------------------------------------------------------------
 
 type Client struct {
@@ -180,7 +403,11 @@ type Client struct {
 }
 
 func newClient(opt *Options, pool pool) *Client {
-	base := &baseClient{opt: opt, connPool: pool}
+	base := &baseClient{
+		opt:      opt,
+		connPool: pool,
+		inflight: newInflightLimiter(opt.MaxInFlight, opt.getInFlightTimeout()),
+	}
 	return &Client{
 		baseClient:  base,
 		commandable: commandable{process: base.process},
@@ -191,3 +418,16 @@ func NewClient(opt *Options) *Client {
 	pool := newConnPool(opt)
 	return newClient(opt, pool)
 }
+
+// HealthCheckTimeout bounds the PING sent by IsHealthy.
+var HealthCheckTimeout = time.Second
+
+// IsHealthy pings the server of c and reports whether it answered in
+// HealthCheckTimeout.
+func IsHealthy(c *Client) bool {
+	cmd := NewPingCmd()
+	cmd.setReadTimeout(HealthCheckTimeout)
+	cmd.setWriteTimeout(HealthCheckTimeout)
+	c.Process(cmd)
+	return cmd.Err() == nil
+}
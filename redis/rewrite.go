@@ -0,0 +1,79 @@
+package redis
+
+import "strings"
+
+// KeyRewriter maps the keys clients use to the keys stored in Redis,
+// e.g. to give every tenant its own key space. Rewrite is applied to the
+// patterns of KEYS and SCAN too, so it must keep a pattern matching the
+// rewritten keys, like prefixing does.
+type KeyRewriter interface {
+	// Rewrite returns the stored key of key.
+	Rewrite(key string) string
+	// Unrewrite returns the key of a stored key.
+	Unrewrite(key string) string
+}
+
+// PrefixRewriter prefixes every key with itself, e.g. "tenant1:".
+type PrefixRewriter string
+
+func (p PrefixRewriter) Rewrite(key string) string {
+	return string(p) + key
+}
+
+func (p PrefixRewriter) Unrewrite(key string) string {
+	return strings.TrimPrefix(key, string(p))
+}
+
+// rewriteKeys rewrites the keys of cmd in place with rw.
+func rewriteKeys(cmd Cmder, rw KeyRewriter) {
+	args := cmd.args()
+	for _, i := range cmd.keyIndexes() {
+		args[i] = rw.Rewrite(args[i])
+	}
+
+	switch cmd.Name() {
+	case "KEYS":
+		if len(args) == 2 {
+			args[1] = rw.Rewrite(args[1])
+		}
+	case "SCAN":
+		scan, ok := cmd.(*ScanCmd)
+		if !ok {
+			return
+		}
+		for i := 2; i < len(args)-1; i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				args[i+1] = rw.Rewrite(args[i+1])
+				return
+			}
+		}
+		// Without a pattern SCAN would return the keys of everyone.
+		scan._args = append(args, "MATCH", rw.Rewrite("*"))
+	}
+}
+
+// unrewriteKeys turns the keys replied by KEYS, SCAN and RANDOMKEY back
+// into the keys of the client.
+func unrewriteKeys(cmd Cmder, rw KeyRewriter) {
+	if cmd.Err() != nil {
+		return
+	}
+	switch cmd := cmd.(type) {
+	case *ScanCmd:
+		if cmd.Name() == "SCAN" {
+			for i, key := range cmd.keys {
+				cmd.keys[i] = rw.Unrewrite(key)
+			}
+		}
+	case *StringSliceCmd:
+		if cmd.Name() == "KEYS" {
+			for i, key := range cmd.val {
+				cmd.val[i] = rw.Unrewrite(key)
+			}
+		}
+	case *StringCmd:
+		if cmd.Name() == "RANDOMKEY" {
+			cmd.val = rw.Unrewrite(cmd.val)
+		}
+	}
+}
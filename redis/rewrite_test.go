@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestKeyRewriterScan(t *testing.T) {
+	client, server, _ := newPipeClient(&Options{KeyRewriter: PrefixRewriter("tenant1:")})
+	defer server.Close()
+
+	req := AppendCommand(nil, []string{"SCAN", "0", "MATCH", "tenant1:user:*", "COUNT", "10"})
+	reply := "*2\r\n$2\r\n17\r\n*2\r\n$14\r\ntenant1:user:1\r\n$14\r\ntenant1:user:2\r\n"
+	go func() {
+		buf := make([]byte, len(req))
+		io.ReadFull(server, buf)
+		if string(buf) != string(req) {
+			t.Errorf("got %q, wanted %q", buf, req)
+		}
+		io.WriteString(server, reply)
+	}()
+
+	cmd := NewScanCmd("SCAN", "0", "MATCH", "user:*", "COUNT", "10")
+	client.Process(cmd)
+	cursor, keys, err := cmd.Result()
+	if err != nil {
+		t.Fatalf("SCAN: %s", err)
+	}
+	if cursor != 17 || strings.Join(keys, " ") != "user:1 user:2" {
+		t.Errorf("got %d %q", cursor, keys)
+	}
+	want := "*2\r\n$2\r\n17\r\n*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n"
+	if got := string(cmd.Reply()); got != want {
+		t.Errorf("Reply: got %q, wanted %q", got, want)
+	}
+}
+
+func TestRewriteKeys(t *testing.T) {
+	rw := PrefixRewriter("t:")
+	tests := []struct {
+		cmd  Cmder
+		want string
+	}{
+		{NewStringCmd("GET", "k"), "GET t:k"},
+		{NewStatusCmd("MSET", "a", "1", "b", "2"), "MSET t:a 1 t:b 2"},
+		{NewStringSliceCmd("KEYS", "user:*"), "KEYS t:user:*"},
+		{NewScanCmd("SCAN", "0"), "SCAN 0 MATCH t:*"},
+		{NewScanCmd("HSCAN", "h", "0", "MATCH", "f*"), "HSCAN t:h 0 MATCH f*"},
+	}
+	for _, test := range tests {
+		rewriteKeys(test.cmd, rw)
+		if got := strings.Join(test.cmd.args(), " "); got != test.want {
+			t.Errorf("got %q, wanted %q", got, test.want)
+		}
+	}
+}
@@ -202,8 +202,7 @@ func (ring *Ring) heartbeat() {
 		}
 
 		for _, shard := range ring.shards {
-			err := shard.Client.Ping().Err()
-			if shard.Vote(err == nil) {
+			if shard.Vote(IsHealthy(shard.Client)) {
 				log.Warningf("redis: ring shard state changed: %s", shard)
 				rebalance = true
 			}
@@ -326,8 +325,9 @@ func (pipe *RingPipeline) Exec() (cmds []Cmder, retErr error) {
 			}
 
 			if i > 0 {
-				resetCmds(cmds)
+				resetCmds(cmds...)
 			}
+			cn.applyTimeouts(client.opt, cmds...)
 			failedCmds, err := execCmds(cn, cmds)
 			client.putConn(cn, err)
 			if err != nil && retErr == nil {
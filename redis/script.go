@@ -43,9 +43,41 @@ func (s *Script) EvalSha(c scripter, keys []string, args []string) *Cmd {
 	return c.EvalSha(s.hash, keys, args)
 }
 
+// keyScriptLoader loads scripts on the node serving a key, e.g. a
+// ClusterClient, where a keyless SCRIPT LOAD goes to a random node.
+type keyScriptLoader interface {
+	scriptLoadFor(key, script string) *StringCmd
+}
+
+// RunLoad runs the script by its sha1 digest. If the server does not
+// know the script yet, it is loaded and EVALSHA is retried once, so the
+// script body is only sent once per server.
+func (s *Script) RunLoad(c scripter, keys []string, args []string) *Cmd {
+	r := s.EvalSha(c, keys, args)
+	if !isNoScriptError(r.Err()) {
+		return r
+	}
+	if err := s.loadFor(c, keys).Err(); err != nil {
+		return r
+	}
+	return s.EvalSha(c, keys, args)
+}
+
+// loadFor loads the script on the server EVALSHA with keys goes to.
+func (s *Script) loadFor(c scripter, keys []string) *StringCmd {
+	if l, ok := c.(keyScriptLoader); ok && len(keys) > 0 {
+		return l.scriptLoadFor(keys[0], s.src)
+	}
+	return s.Load(c)
+}
+
+func isNoScriptError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ")
+}
+
 func (s *Script) Run(c *Client, keys []string, args []string) *Cmd {
 	r := s.EvalSha(c, keys, args)
-	if err := r.Err(); err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ") {
+	if isNoScriptError(r.Err()) {
 		return s.Eval(c, keys, args)
 	}
 	return r
@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// scriptServer returns a commandable answering like a server which
+// doesn't know any script until SCRIPT LOAD.
+func scriptServer(names *[]string) *commandable {
+	loaded := make(map[string]bool)
+	return &commandable{process: func(cmd Cmder) {
+		*names = append(*names, cmd.Name())
+		switch cmd := cmd.(type) {
+		case *StringCmd:
+			sha := NewScript(cmd.args()[2]).hash
+			loaded[sha] = true
+			cmd.val = sha
+		case *Cmd:
+			if !loaded[cmd.args()[1]] {
+				cmd.setErr(errorf("NOSCRIPT No matching script. Please use EVAL."))
+				return
+			}
+			cmd.val = int64(1)
+		}
+	}}
+}
+
+func TestScriptLoadCmd(t *testing.T) {
+	cmd := NewScriptLoadCmd("return 1")
+	if args := cmd.args(); len(args) != 3 || args[0] != "SCRIPT" || args[1] != "LOAD" || args[2] != "return 1" {
+		t.Errorf("got %q", args)
+	}
+	if cmd.clusterKey() != "" {
+		t.Errorf("SCRIPT LOAD must be keyless, got %q", cmd.clusterKey())
+	}
+}
+
+func TestScriptRunLoad(t *testing.T) {
+	var names []string
+	c := scriptServer(&names)
+	script := NewScript("return 1")
+
+	cmd := script.RunLoad(c, []string{"key"}, nil)
+	if cmd.Err() != nil || cmd.Val() != int64(1) {
+		t.Fatalf("got %v, %v", cmd.Val(), cmd.Err())
+	}
+	want := []string{"EVALSHA", "SCRIPT", "EVALSHA"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("got %q, wanted %q", names, want)
+	}
+
+	// The script is cached now.
+	names = nil
+	script.RunLoad(c, []string{"key"}, nil)
+	if len(names) != 1 || names[0] != "EVALSHA" {
+		t.Errorf("got %q, wanted a single EVALSHA", names)
+	}
+}
+
+func TestClusterScriptRunLoad(t *testing.T) {
+	c := newTestClusterClient(&ClusterOptions{})
+	c.commandable.process = c.process
+	// "key" hashes to slot 12539.
+	c.setSlots([]ClusterSlotInfo{
+		{0, 8191, []string{"10.0.0.1:7000"}},
+		{8192, 16383, []string{"10.0.0.2:7000"}},
+	})
+	script := NewScript("return 1")
+
+	other, otherServer, _ := newPipeClient(&Options{Addr: "10.0.0.1:7000"})
+	c.clients["10.0.0.1:7000"] = other
+	misrouted := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 512)
+		n, _ := otherServer.Read(buf)
+		misrouted <- buf[:n]
+	}()
+
+	owner, server, _ := newPipeClient(&Options{Addr: "10.0.0.2:7000"})
+	c.clients["10.0.0.2:7000"] = owner
+	evalSha := AppendCommand(nil, []string{"EVALSHA", script.hash, "1", "key"})
+	go func() {
+		for _, step := range []struct {
+			req   []byte
+			reply string
+		}{
+			{evalSha, "-NOSCRIPT No matching script. Please use EVAL.\r\n"},
+			{AppendCommand(nil, []string{"SCRIPT", "LOAD", "return 1"}), "$40\r\n" + script.hash + "\r\n"},
+			{evalSha, ":1\r\n"},
+		} {
+			buf := make([]byte, len(step.req))
+			io.ReadFull(server, buf)
+			if string(buf) != string(step.req) {
+				t.Errorf("got %q, wanted %q", buf, step.req)
+			}
+			io.WriteString(server, step.reply)
+		}
+	}()
+
+	done := make(chan *Cmd, 1)
+	go func() { done <- script.RunLoad(c, []string{"key"}, nil) }()
+	select {
+	case cmd := <-done:
+		if cmd.Err() != nil || cmd.Val() != int64(1) {
+			t.Errorf("got %v, %v", cmd.Val(), cmd.Err())
+		}
+	case b := <-misrouted:
+		t.Fatalf("node not serving the key got %q", b)
+	case <-time.After(time.Second):
+		t.Fatal("timed out")
+	}
+}
@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"sort"
+
+	log "github.com/ngaut/logging"
+)
+
+// ReplyTransformer rewrites the value of a successful reply before it is
+// handed out or formatted by Reply, e.g. to mask values. It gets the
+// upper cased command name and the value as returned by Val, and returns
+// the value to keep, which must be of the same type.
+type ReplyTransformer func(cmdName string, val interface{}) interface{}
+
+// valueSetter is implemented by the commands a ReplyTransformer can
+// rewrite.
+type valueSetter interface {
+	value() interface{}
+	// setValue reports false if v is not of the type of the value.
+	setValue(v interface{}) bool
+}
+
+func transformReply(cmd Cmder, t ReplyTransformer) {
+	if cmd.Err() != nil {
+		return
+	}
+	vs, ok := cmd.(valueSetter)
+	if !ok {
+		return
+	}
+	v := t(cmd.Name(), vs.value())
+	if !vs.setValue(v) {
+		log.Warningf("redis: reply transformer returned %T for %s, reply left as is", v, cmd.Name())
+	}
+}
+
+func (cmd *Cmd) value() interface{} { return cmd.val }
+
+func (cmd *Cmd) setValue(v interface{}) bool {
+	cmd.val = v
+	return true
+}
+
+func (cmd *SliceCmd) value() interface{} { return cmd.val }
+
+func (cmd *SliceCmd) setValue(v interface{}) bool {
+	val, ok := v.([]interface{})
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *StatusCmd) value() interface{} { return cmd.val }
+
+func (cmd *StatusCmd) setValue(v interface{}) bool {
+	val, ok := v.(string)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *IntCmd) value() interface{} { return cmd.val }
+
+func (cmd *IntCmd) setValue(v interface{}) bool {
+	val, ok := v.(int64)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *BoolCmd) value() interface{} { return cmd.val }
+
+func (cmd *BoolCmd) setValue(v interface{}) bool {
+	val, ok := v.(bool)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *StringCmd) value() interface{} { return cmd.val }
+
+func (cmd *StringCmd) setValue(v interface{}) bool {
+	val, ok := v.(string)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *SetCmd) value() interface{} { return cmd.val }
+
+func (cmd *SetCmd) setValue(v interface{}) bool {
+	val, ok := v.(string)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *FloatCmd) value() interface{} { return cmd.val }
+
+func (cmd *FloatCmd) setValue(v interface{}) bool {
+	val, ok := v.(float64)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *StringSliceCmd) value() interface{} { return cmd.val }
+
+func (cmd *StringSliceCmd) setValue(v interface{}) bool {
+	val, ok := v.([]string)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *NullableStringSliceCmd) value() interface{} { return cmd.val }
+
+func (cmd *NullableStringSliceCmd) setValue(v interface{}) bool {
+	val, ok := v.([]*string)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
+
+func (cmd *StringStringMapCmd) value() interface{} { return cmd.val }
+
+func (cmd *StringStringMapCmd) setValue(v interface{}) bool {
+	val, ok := v.(map[string]string)
+	if !ok {
+		return false
+	}
+	cmd.val = val
+	if cmd.ordered {
+		cmd.pairs = orderPairs(cmd.pairs, val)
+	}
+	return true
+}
+
+// orderPairs returns the pairs of m in the order of pairs, with the values
+// of m: the fields missing from m are dropped and the new ones appended
+// in sorted order.
+func orderPairs(pairs []KeyValue, m map[string]string) []KeyValue {
+	out := make([]KeyValue, 0, len(m))
+	seen := make(map[string]bool, len(m))
+	for _, kv := range pairs {
+		if v, ok := m[kv.Key]; ok {
+			out = append(out, KeyValue{Key: kv.Key, Value: v})
+			seen[kv.Key] = true
+		}
+	}
+	var added []string
+	for k := range m {
+		if !seen[k] {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+	for _, k := range added {
+		out = append(out, KeyValue{Key: k, Value: m[k]})
+	}
+	return out
+}
+
+func (cmd *KeyValueSliceCmd) value() interface{} { return cmd.val }
+
+func (cmd *KeyValueSliceCmd) setValue(v interface{}) bool {
+	val, ok := v.([]KeyValue)
+	if ok {
+		cmd.val = val
+	}
+	return ok
+}
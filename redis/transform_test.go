@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReplyTransformerRedactsConfig(t *testing.T) {
+	redact := func(name string, val interface{}) interface{} {
+		kvs, ok := val.([]KeyValue)
+		if name != "CONFIG" || !ok {
+			return val
+		}
+		for i := range kvs {
+			if kvs[i].Key == "requirepass" {
+				kvs[i].Value = "***"
+			}
+		}
+		return kvs
+	}
+	client, server, _ := newPipeClient(&Options{ReplyTransformer: redact})
+	defer server.Close()
+
+	req := AppendCommand(nil, []string{"CONFIG", "GET", "requirepass"})
+	go func() {
+		buf := make([]byte, len(req))
+		io.ReadFull(server, buf)
+		io.WriteString(server, "*2\r\n$11\r\nrequirepass\r\n$6\r\nsecret\r\n")
+	}()
+
+	cmd := NewKeyValueSliceCmd("CONFIG", "GET", "requirepass")
+	client.Process(cmd)
+	if err := cmd.Err(); err != nil {
+		t.Fatalf("CONFIG GET: %s", err)
+	}
+	want := "*2\r\n$11\r\nrequirepass\r\n$3\r\n***\r\n"
+	if got := string(cmd.Reply()); got != want {
+		t.Errorf("Reply: got %q, wanted %q", got, want)
+	}
+}
+
+func TestTransformReply(t *testing.T) {
+	upper := func(name string, val interface{}) interface{} {
+		if s, ok := val.(string); ok {
+			return strings.ToUpper(s)
+		}
+		return val
+	}
+
+	cmd := NewStringCmd("GET", "key")
+	if err := cmd.parseReply(newTestReader("$3\r\nabc\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	transformReply(cmd, upper)
+	if got := string(cmd.Reply()); got != "$3\r\nABC\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	// A value of another type leaves the reply as is.
+	ints := NewIntCmd("INCR", "key")
+	if err := ints.parseReply(newTestReader(":1\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	transformReply(ints, func(string, interface{}) interface{} { return "one" })
+	if got := string(ints.Reply()); got != ":1\r\n" {
+		t.Errorf("Reply: got %q", got)
+	}
+
+	// Errors are never transformed.
+	cmd = NewStringCmd("GET", "key")
+	cmd.setErr(Nil)
+	transformReply(cmd, func(string, interface{}) interface{} {
+		t.Error("transformer called for an error")
+		return nil
+	})
+}
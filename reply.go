@@ -0,0 +1,45 @@
+package smartproxy
+
+import (
+	"bufio"
+	"io"
+)
+
+// BufferedReplyWriter writes the replies to a client. By default every
+// reply is flushed as it is written. With Coalesce set the replies are
+// held until Flush, so that the replies to a pipeline batch reach the
+// client in a single write instead of one small write each.
+type BufferedReplyWriter struct {
+	w        *bufio.Writer
+	Coalesce bool
+}
+
+// NewBufferedReplyWriter returns a writer to w buffering up to size
+// bytes, larger replies or batches are written in chunks of size.
+func NewBufferedReplyWriter(w io.Writer, size int, coalesce bool) *BufferedReplyWriter {
+	return &BufferedReplyWriter{
+		w:        bufio.NewWriterSize(w, size),
+		Coalesce: coalesce,
+	}
+}
+
+// WriteReply writes a reply, flushing it unless replies are coalesced.
+func (w *BufferedReplyWriter) WriteReply(data []byte) error {
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	if w.Coalesce {
+		return nil
+	}
+	return w.w.Flush()
+}
+
+// Flush writes the buffered replies, at the end of a pipeline batch.
+func (w *BufferedReplyWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// Buffered returns the number of bytes of replies not written yet.
+func (w *BufferedReplyWriter) Buffered() int {
+	return w.w.Buffered()
+}
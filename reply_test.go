@@ -0,0 +1,87 @@
+package smartproxy
+
+import (
+	"bytes"
+	"testing"
+)
+
+// countingWriter counts the writes, one syscall each on a connection.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+var pipelineReplies = func() [][]byte {
+	replies := make([][]byte, 50)
+	for i := range replies {
+		replies[i] = []byte("$5\r\nvalue\r\n")
+	}
+	return replies
+}()
+
+func writeBatch(w *BufferedReplyWriter, replies [][]byte) error {
+	for _, reply := range replies {
+		if err := w.WriteReply(reply); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func TestBufferedReplyWriter(t *testing.T) {
+	for _, tt := range []struct {
+		coalesce bool
+		writes   int
+	}{
+		{false, len(pipelineReplies)},
+		{true, 1},
+	} {
+		cw := &countingWriter{}
+		w := NewBufferedReplyWriter(cw, 4096, tt.coalesce)
+		if err := writeBatch(w, pipelineReplies); err != nil {
+			t.Fatal(err)
+		}
+		if cw.writes != tt.writes {
+			t.Errorf("coalesce=%v: got %d writes, wanted %d", tt.coalesce, cw.writes, tt.writes)
+		}
+		if want := bytes.Repeat(pipelineReplies[0], len(pipelineReplies)); !bytes.Equal(cw.Bytes(), want) {
+			t.Errorf("coalesce=%v: got %q", tt.coalesce, cw.Bytes())
+		}
+	}
+
+	// Batches larger than the buffer go out in chunks of it.
+	cw := &countingWriter{}
+	w := NewBufferedReplyWriter(cw, 64, true)
+	if err := writeBatch(w, pipelineReplies); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pipelineReplies) * len(pipelineReplies[0]); cw.Len() != n || cw.writes > n/64+1 {
+		t.Errorf("got %d bytes in %d writes", cw.Len(), cw.writes)
+	}
+}
+
+func benchmarkReplyWriter(b *testing.B, coalesce bool) {
+	cw := &countingWriter{}
+	w := NewBufferedReplyWriter(cw, 4096, coalesce)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cw.Reset()
+		if err := writeBatch(w, pipelineReplies); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(cw.writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkReplyWriterPipeline50(b *testing.B) {
+	benchmarkReplyWriter(b, false)
+}
+
+func BenchmarkReplyWriterPipeline50Coalesced(b *testing.B) {
+	benchmarkReplyWriter(b, true)
+}
@@ -2,8 +2,10 @@ package smartproxy
 
 import (
 	"bufio"
+	"errors"
 	"github.com/dongzerun/smartproxy/redis"
 	"net"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -26,7 +28,14 @@ func HandleConn(ps *ProxyServer, c net.Conn) {
 	defer delete(ps.SessMgr, addr)
 
 	for {
-		reqstr, err := parseReq(s.r)
+		// The pipeline batch ends when no more commands are buffered,
+		// send its replies before waiting for the next one.
+		if s.r.Buffered() == 0 {
+			if err := s.w.Flush(); err != nil {
+				return
+			}
+		}
+		reqstr, err := parseReq(s.r, s.Proxy.Conf)
 
 		//for stats
 		s.LastAccess = time.Now().UnixNano() / 1e3
@@ -48,6 +57,17 @@ func HandleConn(ps *ProxyServer, c net.Conn) {
 				// log.Warning("Write2client ", e)
 				return
 			}
+			if errors.Is(err, errProtocol) {
+				s.w.Flush()
+				s.Close()
+				return
+			}
+			continue
+		}
+
+		// HELLO switches the protocol of the session, not of a backend.
+		if req.Name() == "HELLO" {
+			s.hello(req)
 			continue
 		}
 
@@ -62,6 +82,7 @@ func HandleConn(ps *ProxyServer, c net.Conn) {
 			s.Write2client(req)
 			if shouldClose {
 				// log.("should close from ", c.RemoteAddr())
+				s.w.Flush()
 				s.Close()
 				return
 			}
@@ -79,7 +100,7 @@ func HandleConn(ps *ProxyServer, c net.Conn) {
 type Session struct {
 	Conn net.Conn
 	r    *bufio.Reader
-	w    *bufio.Writer
+	w    *BufferedReplyWriter
 
 	Proxy *ProxyServer
 
@@ -87,17 +108,21 @@ type Session struct {
 	QuitChan   chan int
 
 	MulOpParallel int
+
+	// The protocol version negotiated by HELLO, 2 without HELLO.
+	proto int
 }
 
 func NewSession(ps *ProxyServer, conn net.Conn) *Session {
 	s := &Session{
 		Conn:          conn,
 		r:             bufio.NewReaderSize(conn, 4096),
-		w:             bufio.NewWriterSize(conn, 4096),
+		w:             NewBufferedReplyWriter(conn, ps.Conf.ReplyBufferSize, ps.Conf.CoalesceReplies),
 		Proxy:         ps,
 		LastAccess:    time.Now().Unix(),
 		QuitChan:      make(chan int, 1),
 		MulOpParallel: ps.Conf.MulOpParallel,
+		proto:         2,
 	}
 	return s
 }
@@ -110,11 +135,66 @@ func (s *Session) Forward(req *redis.Request) {
 func (s *Session) forward(req *redis.Request) {
 	resp := s.Proxy.Dispatch(req)
 	// log.Info("session forward got response: ", resp)
+	if cmd, ok := resp.(*redis.BoolCmd); ok {
+		cmd.SetProto(s.proto)
+	}
 	req.SetResp(resp)
 }
 
 func (s *Session) Write2client(req *redis.Request) error {
-	return s.write2client(req.Result())
+	data := req.Result()
+	if s.Proxy.Stats != nil {
+		s.Proxy.Stats.ObserveReply(statName(req.Name()), len(data))
+	}
+	return s.write2client(data)
+}
+
+// hello answers HELLO [protover [AUTH username password] [SETNAME
+// clientname]]. The protocol version is kept for the boolean replies of
+// the session, credentials and name are accepted and ignored like AUTH.
+func (s *Session) hello(req *redis.Request) {
+	if err := commandFilter.check(req.Name()); err != nil {
+		req.SetError(err)
+		s.Write2client(req)
+		return
+	}
+	if args := req.Args(); len(args) > 0 {
+		proto, err := strconv.Atoi(args[0])
+		if err != nil {
+			req.SetError(errors.New("ERR Protocol version is not an integer or out of range"))
+			s.Write2client(req)
+			return
+		}
+		if proto != 2 && proto != 3 {
+			req.SetError(errors.New("NOPROTO unsupported protocol version"))
+			s.Write2client(req)
+			return
+		}
+		s.proto = proto
+	}
+	req.SetReply(helloReply())
+	s.Write2client(req)
+}
+
+// helloReply is the server description replied to HELLO. Only boolean
+// replies follow protocol 3, so the description is a RESP2 flat array
+// advertising protocol 2 whatever the client negotiated.
+func helloReply() []byte {
+	return redis.FormatKeyValueSlice([]redis.KeyValue{
+		{Key: "server", Value: "redis"},
+		{Key: "proto", Value: "2"},
+		{Key: "mode", Value: "cluster"},
+		{Key: "role", Value: "master"},
+	})
+}
+
+// statName is the name a reply to name is counted under, the commands
+// unknown to the proxy share one so that clients can't grow the stats.
+func statName(name string) string {
+	if _, ok := reqrules[name]; ok || redis.IsKnownCommand(name) {
+		return name
+	}
+	return "UNKNOWN"
 }
 
 func (s *Session) write2client(data []byte) error {
@@ -123,8 +203,7 @@ func (s *Session) write2client(data []byte) error {
 			log.Warning("write2client panice: ", e)
 		}
 	}()
-	s.w.Write(data)
-	err := s.w.Flush()
+	err := s.w.WriteReply(data)
 
 	//stats
 	now := time.Now().UnixNano() / 1e3
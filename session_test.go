@@ -0,0 +1,35 @@
+package smartproxy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dongzerun/smartproxy/redis"
+)
+
+func TestSessionHello(t *testing.T) {
+	var out bytes.Buffer
+	s := &Session{
+		w:     NewBufferedReplyWriter(&out, 4096, false),
+		Proxy: &ProxyServer{},
+		proto: 2,
+	}
+	reply := func(args ...string) string {
+		out.Reset()
+		s.hello(redis.NewRequest(args))
+		s.w.Flush()
+		return out.String()
+	}
+
+	if got, want := reply("HELLO"), "*8\r\n$6\r\nserver\r\n"; !bytes.HasPrefix([]byte(got), []byte(want)) {
+		t.Errorf("got %q, wanted prefix %q", got, want)
+	}
+	if got := reply("HELLO", "4"); got != "-NOPROTO unsupported protocol version\r\n" || s.proto != 2 {
+		t.Errorf("got %q, proto %d", got, s.proto)
+	}
+	// Protocol 3 is kept for booleans, the description stays RESP2.
+	want := "*8\r\n$6\r\nserver\r\n$5\r\nredis\r\n$5\r\nproto\r\n$1\r\n2\r\n"
+	if got := reply("HELLO", "3"); !bytes.HasPrefix([]byte(got), []byte(want)) || s.proto != 3 {
+		t.Errorf("got %q, proto %d", got, s.proto)
+	}
+}
@@ -14,8 +14,6 @@ func (s *Session) SpecCommandProcess(req *redis.Request) {
 	switch req.Name() {
 	case "SINTERSTORE":
 		s.SINTERSTORE(req)
-	case "SMOVE":
-		s.SMOVE(req)
 	case "DEL":
 		s.DEL(req)
 	case "RPOPLPUSH":
@@ -26,16 +24,10 @@ func (s *Session) SpecCommandProcess(req *redis.Request) {
 		s.SINTER(req)
 	case "SDIFF":
 		s.SDIFF(req)
-	case "MGET":
-		s.MGET(req)
 	case "ZINTERSTORE":
 		s.ZINTERSTORE(req)
 	case "ZUNIONSTORE":
 		s.ZUNIONSTORE(req)
-	case "RENAME":
-		s.RENAME(req)
-	case "RENAMENX":
-		s.RENAMENX(req)
 	case "MSET":
 		s.MSET(req)
 	case "MSETNX":
@@ -50,14 +42,11 @@ func (s *Session) SpecCommandProcess(req *redis.Request) {
 //we will finish these commands later
 func (s *Session) MSETNX(req *redis.Request)      { s.write2client(OK_BYTES) }
 func (s *Session) ZUNIONSTORE(req *redis.Request) { s.write2client(OK_BYTES) }
-func (s *Session) RENAMENX(req *redis.Request)    { s.write2client(OK_BYTES) }
 func (s *Session) SDIFF(req *redis.Request)       { s.write2client(OK_BYTES) }
 func (s *Session) SINTER(req *redis.Request)      { s.write2client(OK_BYTES) }
 func (s *Session) SINTERSTORE(req *redis.Request) { s.write2client(OK_BYTES) }
-func (s *Session) RENAME(req *redis.Request)      { s.write2client(OK_BYTES) }
 func (s *Session) RPOPLPUSH(req *redis.Request)   { s.write2client(OK_BYTES) }
 func (s *Session) SDIFFSTORE(req *redis.Request)  { s.write2client(OK_BYTES) }
-func (s *Session) SMOVE(req *redis.Request)       { s.write2client(OK_BYTES) }
 func (s *Session) ZINTERSTORE(req *redis.Request) { s.write2client(OK_BYTES) }
 
 func (s *Session) MSET(req *redis.Request) {
@@ -105,45 +94,6 @@ func (s *Session) MSET(req *redis.Request) {
 	}
 }
 
-func (s *Session) MGET(req *redis.Request) {
-	p := make(chan int, s.MulOpParallel)
-	for i := 0; i < s.MulOpParallel; i++ {
-		p <- 1
-	}
-
-	defer func() {
-		close(p)
-	}()
-
-	keys := req.Args()
-	wg := sync.WaitGroup{}
-	wg.Add(len(keys))
-
-	// we should ensure the KEY's order
-	result := make([][]byte, len(keys))
-
-	for idx, key := range keys {
-		go func(key string, idx int) {
-			<-p
-			// log.Info("In MGET goroutine ", key)
-			cmdslice := []string{"GET", key}
-			r := redis.NewRequest(cmdslice)
-			resp := s.Proxy.Backend.OnGET(r)
-			result[idx] = resp.Reply()
-			p <- 1
-			wg.Done()
-		}(key, idx)
-	}
-
-	wg.Wait()
-	mergeResp := []byte(fmt.Sprintf("*%d\r\n", len(keys)))
-	for _, res := range result {
-		mergeResp = append(mergeResp, res...)
-	}
-	// log.Info("MGET merger resp ", string(mergeResp))
-	s.write2client(mergeResp)
-}
-
 func (s *Session) DEL(req *redis.Request) {
 	var result int64
 	// 串行会很慢，可以考滤开goroutine并行执行